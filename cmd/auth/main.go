@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/MorZLE/auth/internal/app"
 	"github.com/MorZLE/auth/internal/config"
 	"log/slog"
@@ -23,8 +24,15 @@ func main() {
 
 	application := app.NewApp(log, cfg)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	go application.GRPCSrv.MustRun()
 	go application.RESTapi.Run()
+	go application.Auth.RunKeyRotation(ctx, cfg.KeyRotation.CheckInterval)
+	go application.Auth.RunRevocationCleanup(ctx, cfg.RevocationCleanup)
+	go application.Guard.RunCleanup(ctx, log, cfg.BruteForce.Window)
+	go application.Queue.Run(ctx, cfg.Notifier.Queue.Interval)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
@@ -32,6 +40,7 @@ func main() {
 	sig := <-stop
 	log.Info("stopping application", slog.String("signal", sig.String()))
 
+	cancel()
 	application.GRPCSrv.Stop()
 	log.Info("application stop")
 }
@@ -0,0 +1,91 @@
+package adminkey
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"time"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid admin key")
+	ErrKeyExpired = errors.New("admin key expired")
+	ErrKeyRevoked = errors.New("admin key revoked")
+)
+
+type key struct {
+	name      string
+	hash      []byte
+	expiresAt time.Time
+	revoked   bool
+}
+
+// Keys набор мастер-ключей администратора. Ключи хранятся только в виде sha256 хэша
+type Keys struct {
+	keys []key
+	now  func() time.Time
+}
+
+// New собирает набор ключей из конфигурации
+func New(cfg []config.AdminKey) (*Keys, error) {
+	const op = "adminkey.New"
+
+	names := make(map[string]struct{}, len(cfg))
+	keys := make([]key, 0, len(cfg))
+	for _, k := range cfg {
+		if k.Name == "" {
+			return nil, fmt.Errorf("%s: admin key name is empty", op)
+		}
+		if _, ok := names[k.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate admin key %s", op, k.Name)
+		}
+		names[k.Name] = struct{}{}
+
+		hash, err := hex.DecodeString(k.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%s: admin key %s: hash must be hex encoded sha256", op, k.Name)
+		}
+
+		keys = append(keys, key{name: k.Name, hash: hash, expiresAt: k.ExpiresAt, revoked: k.Revoked})
+	}
+
+	return &Keys{keys: keys, now: time.Now}, nil
+}
+
+// Verify проверяет ключ и возвращает имя, под которым он настроен
+func (k *Keys) Verify(secret string) (string, error) {
+	if secret == "" {
+		return "", ErrInvalidKey
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+
+	// сравниваем со всеми ключами, чтобы время ответа не зависело от позиции совпадения
+	var found *key
+	for i := range k.keys {
+		if subtle.ConstantTimeCompare(sum[:], k.keys[i].hash) == 1 {
+			found = &k.keys[i]
+		}
+	}
+
+	if found == nil {
+		return "", ErrInvalidKey
+	}
+	if found.revoked {
+		return found.name, ErrKeyRevoked
+	}
+	if !found.expiresAt.IsZero() && k.now().After(found.expiresAt) {
+		return found.name, ErrKeyExpired
+	}
+
+	return found.name, nil
+}
+
+// Hash возвращает значение для поля hash в конфигурации
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
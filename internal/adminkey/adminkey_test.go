@@ -0,0 +1,67 @@
+package adminkey
+
+import (
+	"errors"
+	"github.com/MorZLE/auth/internal/config"
+	"testing"
+	"time"
+)
+
+func TestKeys_Verify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	keys, err := New([]config.AdminKey{
+		{Name: "bootstrap", Hash: Hash("bootstrap-secret")},
+		{Name: "ops", Hash: Hash("ops-secret"), ExpiresAt: now.Add(time.Hour)},
+		{Name: "expired", Hash: Hash("expired-secret"), ExpiresAt: now.Add(-time.Hour)},
+		{Name: "revoked", Hash: Hash("revoked-secret"), Revoked: true},
+	})
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+	keys.now = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		key      string
+		wantName string
+		wantErr  error
+	}{
+		{name: "positive_1", key: "bootstrap-secret", wantName: "bootstrap", wantErr: nil},
+		{name: "positive_2", key: "ops-secret", wantName: "ops", wantErr: nil},
+		{name: "expired", key: "expired-secret", wantName: "expired", wantErr: ErrKeyExpired},
+		{name: "revoked", key: "revoked-secret", wantName: "revoked", wantErr: ErrKeyRevoked},
+		{name: "unknown", key: "x", wantName: "", wantErr: ErrInvalidKey},
+		{name: "empty", key: "", wantName: "", wantErr: ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keys.Verify(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.wantName {
+				t.Errorf("Verify() got = %v, want %v", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  []config.AdminKey
+	}{
+		{name: "empty_name", cfg: []config.AdminKey{{Name: "", Hash: Hash("a")}}},
+		{name: "duplicate_name", cfg: []config.AdminKey{{Name: "a", Hash: Hash("a")}, {Name: "a", Hash: Hash("b")}}},
+		{name: "plain_key", cfg: []config.AdminKey{{Name: "a", Hash: "secret"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Errorf("New() cerror = nil, want error")
+			}
+		})
+	}
+}
@@ -1,36 +1,252 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/adminkey"
 	grpcserver "github.com/MorZLE/auth/internal/app/grpc"
+	"github.com/MorZLE/auth/internal/appsecret"
+	"github.com/MorZLE/auth/internal/authz"
+	"github.com/MorZLE/auth/internal/bruteforce"
 	"github.com/MorZLE/auth/internal/config"
 	"github.com/MorZLE/auth/internal/controller/rest"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/hasher"
+	"github.com/MorZLE/auth/internal/migrator"
+	"github.com/MorZLE/auth/internal/notifier"
+	"github.com/MorZLE/auth/internal/passpolicy"
+	"github.com/MorZLE/auth/internal/secretbox"
 	"github.com/MorZLE/auth/internal/service"
+	"github.com/MorZLE/auth/internal/storage/memory"
+	"github.com/MorZLE/auth/internal/storage/postgres"
 	"github.com/MorZLE/auth/internal/storage/sqlite"
 	"log/slog"
 )
 
 func NewApp(log *slog.Logger, cfg *config.Config) *App {
 
-	storage, err := sqlite.NewStorage(cfg.StoragePath)
+	storage, err := newStorage(cfg.StorageDriver, cfg.StoragePath)
 	if err != nil {
 		panic(err)
 	}
-	authservice := service.NewAuth(log, storage, storage, storage, storage, cfg.GRPC.Timeout)
-
-	grpcApp := grpcserver.NewGRPC(log, cfg.GRPC.Port, authservice, authservice)
-
-	restAPI := rest.NewHandler(log, authservice, authservice, cfg.Rest.Port, cfg.Rest.Timeout)
-
+	if err := migrateSchema(log, cfg); err != nil {
+		panic(err)
+	}
+	appSecrets, err := newAppSecretCipher(log, cfg.AppSecrets)
+	if err != nil {
+		panic(err)
+	}
+	storage = &secretStorage{Storage: storage, secrets: appSecrets}
+	adminKeys, err := adminkey.New(cfg.AdminKeys)
+	if err != nil {
+		panic(err)
+	}
+	passPolicy, err := passpolicy.New(cfg.Password)
 	if err != nil {
 		panic(err)
 	}
+	guard, err := newLoginGuard(storage, cfg.BruteForce)
+	if err != nil {
+		panic(err)
+	}
+	sender, err := newSender(log, cfg.Notifier)
+	if err != nil {
+		panic(err)
+	}
+	templates, err := notifier.NewTemplates(cfg.Notifier.Templates, cfg.Notifier.DefaultLocale, cfg.Notifier.Locales)
+	if err != nil {
+		panic(err)
+	}
+	queue := notifier.NewQueue(log, storage, sender, cfg.Notifier.Queue)
+	mfaCipher, err := newMFACipher(cfg.MFA)
+	if err != nil {
+		panic(err)
+	}
+	passHasher, err := hasher.New(cfg.PasswordHash)
+	if err != nil {
+		panic(err)
+	}
+
+	authservice := service.NewAuth(log, storage, storage, storage, storage, storage, storage, storage, storage, storage,
+		storage, storage, storage, notifier.New(templates, queue), passPolicy, guard, passHasher, mfaCipher,
+		cfg.MFA.Issuer,
+		cfg.TokenTTL, cfg.RefreshTTL, cfg.PasswordResetTTL, cfg.EmailVerificationTTL, cfg.MFA.ChallengeTTL,
+		cfg.WebAuthnSessionTTL, cfg.KeyRotation.Interval, cfg.KeyRotation.PublishDelay)
+
+	authAdmin := authz.New(log, adminKeys, authservice, authservice)
+
+	grpcApp := grpcserver.NewGRPC(log, cfg.GRPC.Port, authservice, authAdmin)
+
+	restAPI := rest.NewHandler(log, authservice, authAdmin, cfg.Rest.Port, cfg.Rest.Timeout)
+
 	return &App{
 		GRPCSrv: grpcApp,
 		RESTapi: restAPI,
+		Auth:    authservice,
+		Guard:   guard,
+		Queue:   queue,
+		Storage: storage,
 	}
 }
 
 type App struct {
 	GRPCSrv *grpcserver.App
 	RESTapi *rest.Handler
+	Auth    *service.Auth
+	Guard   *bruteforce.Guard
+	Queue   *notifier.Queue
+	// Storage выбранное хранилище, через него тесты наполняют memory перед запуском сервера
+	Storage Storage
+}
+
+// Storage всё, что сервис, защита от перебора и очередь писем ожидают от хранилища
+type Storage interface {
+	service.UserSaver
+	service.UserProvider
+	service.AppProvider
+	service.AdminProvider
+	service.TokenProvider
+	service.KeyProvider
+	service.RevocationProvider
+	service.ResetProvider
+	service.VerificationProvider
+	service.MFAProvider
+	service.WebAuthnProvider
+	service.RoleProvider
+	bruteforce.Store
+	notifier.Store
+}
+
+// newStorage выбирает хранилище по storage_driver
+func newStorage(driver string, path string) (Storage, error) {
+	switch driver {
+	case "sqlite", "":
+		return sqlite.NewStorage(path)
+	case "postgres":
+		return postgres.NewStorage(path)
+	case "memory":
+		return memory.New(), nil
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", driver)
+}
+
+// migrateSchema при migrate_on_start применяет встроенные миграции, а затем проверяет версию схемы.
+// Сервис не запускается на схеме новее, чем он знает, или оставшейся после упавшей миграции
+func migrateSchema(log *slog.Logger, cfg *config.Config) error {
+	if cfg.StorageDriver == "memory" {
+		return nil
+	}
+
+	src, err := migrator.Source(cfg.StorageDriver)
+	if err != nil {
+		return err
+	}
+	m, err := migrator.New(src, cfg.StorageDriver, cfg.StoragePath, migrator.Table)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if cfg.MigrateOnStart {
+		if err := migrator.Up(m); err != nil {
+			return err
+		}
+	}
+
+	version, latest, err := migrator.Check(m, src)
+	if err != nil {
+		return err
+	}
+	if version < latest {
+		log.Warn("database schema is behind the binary, run migrator up or enable migrate_on_start",
+			slog.Int("version", int(version)), slog.Int("latest", int(latest)))
+	}
+	return nil
+}
+
+// newLoginGuard выбирает хранилище счётчиков попыток входа. sqlite означает основное хранилище,
+// какой бы драйвер для него ни был выбран
+func newLoginGuard(storage Storage, cfg config.BruteForce) (*bruteforce.Guard, error) {
+	switch cfg.Store {
+	case "memory":
+		return bruteforce.New(bruteforce.NewMemoryStore(), cfg), nil
+	case "sqlite", "storage", "":
+		return bruteforce.New(storage, cfg), nil
+	}
+	return nil, fmt.Errorf("unknown brute force store %q", cfg.Store)
+}
+
+// newSender выбирает способ доставки писем
+func newSender(log *slog.Logger, cfg config.Notifier) (notifier.Sender, error) {
+	switch cfg.Sender {
+	case "log", "":
+		return notifier.NewLog(log), nil
+	case "file":
+		return notifier.NewFile(cfg.FilePath), nil
+	case "smtp":
+		return notifier.NewSMTP(cfg.SMTP)
+	}
+	return nil, fmt.Errorf("unknown notifier sender %q", cfg.Sender)
+}
+
+// newMFACipher без ключа шифрования возвращает nil, тогда включение MFA отключено
+func newMFACipher(cfg config.MFA) (service.SecretCipher, error) {
+	if cfg.EncryptionKey == "" {
+		return nil, nil
+	}
+	box, err := secretbox.New(cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("mfa encryption key: %w", err)
+	}
+	return box, nil
+}
+
+// newAppSecretCipher без KEK возвращает nil, тогда секреты приложений пишутся открытым текстом
+func newAppSecretCipher(log *slog.Logger, cfg config.AppSecrets) (*appsecret.Cipher, error) {
+	if cfg.KEK == "" {
+		log.Warn("app secrets are stored unencrypted, set app_secrets.kek")
+		return nil, nil
+	}
+	return appsecret.New(cfg.KEK)
+}
+
+// secretStorage шифрует секреты приложений при записи и расшифровывает их только в App,
+// откуда сервис берёт секрет для подписи токенов. Apps возвращает секреты как они хранятся
+type secretStorage struct {
+	Storage
+	secrets *appsecret.Cipher
+}
+
+func (s *secretStorage) AddApp(ctx context.Context, name, secret, alg string) (int32, error) {
+	secret, err := s.encrypt(secret)
+	if err != nil {
+		return 0, err
+	}
+	return s.Storage.AddApp(ctx, name, secret, alg)
+}
+
+func (s *secretStorage) SetAppSecret(ctx context.Context, appID int32, secret string) error {
+	secret, err := s.encrypt(secret)
+	if err != nil {
+		return err
+	}
+	return s.Storage.SetAppSecret(ctx, appID, secret)
+}
+
+func (s *secretStorage) App(ctx context.Context, appID int32) (models.App, error) {
+	app, err := s.Storage.App(ctx, appID)
+	if err != nil {
+		return models.App{}, err
+	}
+	if app.Secret, err = s.secrets.Decrypt(app.Secret); err != nil {
+		return models.App{}, fmt.Errorf("app %d secret: %w", appID, err)
+	}
+	return app, nil
+}
+
+func (s *secretStorage) encrypt(secret string) (string, error) {
+	if s.secrets == nil {
+		return secret, nil
+	}
+	return s.secrets.Encrypt(secret)
 }
@@ -11,7 +11,7 @@ import (
 )
 
 func NewGRPC(log *slog.Logger, port int, authservice controller.Auth, authAdmin controller.AuthAdmin) *App {
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(serverAPI.ClientIPInterceptor, serverAPI.BearerTokenInterceptor))
 
 	serverAPI.RegisterServerAPI(grpcServer, authservice, authAdmin)
 
@@ -45,13 +45,18 @@ func (a *App) Run() error {
 
 	log.Info("running controller server", slog.String("addr", l.Addr().String()))
 
-	if err := a.gRPCServer.Serve(l); err != nil {
+	if err := a.Serve(l); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
+// Serve обслуживает запросы на уже открытом l. Нужен, когда порт выбирает вызывающий, например в тестах
+func (a *App) Serve(l net.Listener) error {
+	return a.gRPCServer.Serve(l)
+}
+
 func (a *App) Stop() {
 	const op = "controller.app.Stop"
 
@@ -0,0 +1,126 @@
+package appsecret
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/secretbox"
+	"strings"
+)
+
+// prefix отличает зашифрованный секрет от записанного до включения шифрования
+const prefix = "env1:"
+
+var (
+	ErrNoKEK   = errors.New("appsecret: app secret is encrypted, but kek is not configured")
+	ErrInvalid = errors.New("appsecret: invalid encrypted secret")
+)
+
+// Cipher шифрует секреты приложений конвертом: каждый секрет шифруется своим случайным ключом данных,
+// а ключ данных хранится рядом, зашифрованный ключом шифрования ключей (KEK) из конфига
+type Cipher struct {
+	kek *secretbox.Box
+}
+
+// New принимает KEK длиной secretbox.KeySize в base64
+func New(kek string) (*Cipher, error) {
+	box, err := secretbox.New(kek)
+	if err != nil {
+		return nil, fmt.Errorf("appsecret: kek: %w", err)
+	}
+	return &Cipher{kek: box}, nil
+}
+
+// Encrypt возвращает env1:<ключ данных, зашифрованный KEK>:<секрет, зашифрованный ключом данных>
+func (c *Cipher) Encrypt(secret string) (string, error) {
+	dek := make([]byte, secretbox.KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("appsecret: %w", err)
+	}
+	box, err := secretbox.New(base64.StdEncoding.EncodeToString(dek))
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := c.kek.Encrypt(dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := box.Encrypt([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return prefix + wrapped + ":" + sealed, nil
+}
+
+// Decrypt расшифровывает секрет. Секрет, записанный до включения шифрования, возвращается как есть
+func (c *Cipher) Decrypt(stored string) (string, error) {
+	if !Encrypted(stored) {
+		return stored, nil
+	}
+	if c == nil {
+		return "", ErrNoKEK
+	}
+
+	wrapped, sealed, ok := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	if !ok {
+		return "", ErrInvalid
+	}
+	dek, err := c.kek.Decrypt(wrapped)
+	if err != nil {
+		return "", err
+	}
+	box, err := secretbox.New(base64.StdEncoding.EncodeToString(dek))
+	if err != nil {
+		return "", ErrInvalid
+	}
+	secret, err := box.Decrypt(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Encrypted сообщает, зашифрован ли сохранённый секрет
+func Encrypted(stored string) bool {
+	return strings.HasPrefix(stored, prefix)
+}
+
+// Store хранилище приложений, секреты которых шифрует EncryptAll
+type Store interface {
+	Apps(ctx context.Context) ([]models.App, error)
+	SetAppSecret(ctx context.Context, appID int32, secret string) error
+}
+
+// EncryptAll шифрует секреты, сохранённые открытым текстом, и возвращает число зашифрованных.
+// Уже зашифрованные секреты пропускаются, поэтому повторный запуск безопасен. Секрет с префиксом,
+// который не расшифровывается KEK, может оказаться открытым текстом, записанным до запрета такого префикса,
+// поэтому вместо пропуска возвращается ошибка: секрет этого приложения нужно заменить
+func EncryptAll(ctx context.Context, store Store, c *Cipher) (int, error) {
+	apps, err := store.Apps(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, app := range apps {
+		if Encrypted(app.Secret) {
+			if _, err := c.Decrypt(app.Secret); err != nil {
+				return n, fmt.Errorf("app %d: secret has prefix %q but does not decrypt: %w", app.ID, prefix, err)
+			}
+			continue
+		}
+		secret, err := c.Encrypt(app.Secret)
+		if err != nil {
+			return n, err
+		}
+		if err := store.SetAppSecret(ctx, int32(app.ID), secret); err != nil {
+			return n, fmt.Errorf("app %d: %w", app.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package appsecret
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/MorZLE/auth/internal/secretbox"
+	"github.com/MorZLE/auth/internal/storage/memory"
+	"strings"
+	"testing"
+)
+
+var testKEK = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", secretbox.KeySize)))
+
+func TestCipher_EncryptDecrypt(t *testing.T) {
+	c, err := New(testKEK)
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+
+	stored, err := c.Encrypt("secret")
+	if err != nil {
+		t.Fatalf("Encrypt() cerror = %v", err)
+	}
+	if !Encrypted(stored) || strings.Contains(stored, "secret") {
+		t.Errorf("Encrypt() got = %q", stored)
+	}
+
+	got, err := c.Decrypt(stored)
+	if err != nil || got != "secret" {
+		t.Errorf("Decrypt() got = %q, cerror = %v", got, err)
+	}
+
+	other, _ := New(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", secretbox.KeySize))))
+	if _, err := other.Decrypt(stored); !errors.Is(err, secretbox.ErrDecrypt) {
+		t.Errorf("Decrypt() with other kek cerror = %v, want %v", err, secretbox.ErrDecrypt)
+	}
+	if _, err := c.Decrypt(prefix + "garbage"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Decrypt() garbage cerror = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestCipher_DecryptPlaintext(t *testing.T) {
+	c, _ := New(testKEK)
+	if got, err := c.Decrypt("legacy"); err != nil || got != "legacy" {
+		t.Errorf("Decrypt() plaintext got = %q, cerror = %v", got, err)
+	}
+
+	var none *Cipher
+	if got, err := none.Decrypt("legacy"); err != nil || got != "legacy" {
+		t.Errorf("Decrypt() without kek got = %q, cerror = %v", got, err)
+	}
+	stored, _ := c.Encrypt("secret")
+	if _, err := none.Decrypt(stored); !errors.Is(err, ErrNoKEK) {
+		t.Errorf("Decrypt() encrypted without kek cerror = %v, want %v", err, ErrNoKEK)
+	}
+}
+
+func TestEncryptAll(t *testing.T) {
+	ctx := context.Background()
+	c, _ := New(testKEK)
+	s := memory.New()
+
+	plainID, _ := s.AddApp(ctx, "plain", "plain secret", "HS256")
+	stored, _ := c.Encrypt("encrypted secret")
+	encID, _ := s.AddApp(ctx, "encrypted", stored, "HS256")
+
+	n, err := EncryptAll(ctx, s, c)
+	if err != nil || n != 1 {
+		t.Fatalf("EncryptAll() got = %d, cerror = %v, want 1", n, err)
+	}
+	if n, err = EncryptAll(ctx, s, c); err != nil || n != 0 {
+		t.Errorf("EncryptAll() again got = %d, cerror = %v, want 0", n, err)
+	}
+
+	for id, want := range map[int32]string{plainID: "plain secret", encID: "encrypted secret"} {
+		app, err := s.App(ctx, id)
+		if err != nil {
+			t.Fatalf("App() cerror = %v", err)
+		}
+		got, err := c.Decrypt(app.Secret)
+		if !Encrypted(app.Secret) || err != nil || got != want {
+			t.Errorf("app %d secret = %q, decrypted %q, cerror = %v, want %q", id, app.Secret, got, err, want)
+		}
+	}
+}
+
+func TestEncryptAll_PlaintextWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	c, _ := New(testKEK)
+	s := memory.New()
+
+	// секрет, записанный открытым текстом до запрета префикса, нельзя молча оставить как зашифрованный
+	id, _ := s.AddApp(ctx, "legacy", "env1:legacy secret", "HS256")
+
+	if _, err := EncryptAll(ctx, s, c); err == nil {
+		t.Fatalf("EncryptAll() plaintext with prefix cerror = nil")
+	}
+	app, err := s.App(ctx, id)
+	if err != nil || app.Secret != "env1:legacy secret" {
+		t.Errorf("App() secret = %q, cerror = %v, want unchanged", app.Secret, err)
+	}
+}
@@ -0,0 +1,450 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+)
+
+// KeyVerifier проверяет мастер-ключ администратора и возвращает имя, под которым он настроен
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=KeyVerifier
+type KeyVerifier interface {
+	Verify(key string) (name string, err error)
+}
+
+// TokenVerifier проверяет access токен вызывающего и его права администратора в приложении,
+// AdminByLogin находит уровень администратора, с которого вызывающий снимает права
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=TokenVerifier
+type TokenVerifier interface {
+	ValidateToken(ctx context.Context, token string) (models.TokenClaims, error)
+	CheckIsAdmin(ctx context.Context, userid int64, appID int32) (models.Admin, error)
+	AdminByLogin(ctx context.Context, login string, appID int32) (models.Admin, error)
+}
+
+// Service действия администратора, которые выполняются только после проверки прав
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=Service
+type Service interface {
+	CreateAdmin(ctx context.Context, login string, lvl int32, appID int32) (userid int64, err error)
+	DeleteAdmin(ctx context.Context, login string, appID int32) (res bool, err error)
+	AddApp(ctx context.Context, name, secret, alg string) (appID int32, err error)
+	RotateSigningKey(ctx context.Context, appID int32) (kid string, err error)
+	RevokeAllForUser(ctx context.Context, userID int64) error
+	UnlockAccount(ctx context.Context, login string, appID int32) error
+	SetAppRequireVerified(ctx context.Context, appID int32, required bool) error
+	SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error
+	GrantAppAccess(ctx context.Context, userID int64, appID int32) error
+	RevokeAppAccess(ctx context.Context, userID int64, appID int32) error
+	CreateRole(ctx context.Context, appID int32, name string, permissions []string) (int64, error)
+	ListRoles(ctx context.Context, appID int32) ([]models.Role, error)
+	DeleteRole(ctx context.Context, appID int32, name string) error
+	AssignRole(ctx context.Context, userID int64, appID int32, name string) error
+	UnassignRole(ctx context.Context, userID int64, appID int32, name string) error
+	ListApps(ctx context.Context) ([]models.App, error)
+	GetApp(ctx context.Context, appID int32) (models.App, error)
+	UpdateApp(ctx context.Context, appID int32, name string) error
+	DisableApp(ctx context.Context, appID int32, disabled bool) error
+	DeleteApp(ctx context.Context, appID int32, cascade bool) error
+	RotateAppSecret(ctx context.Context, appID int32) (secret string, err error)
+	GetAppSettings(ctx context.Context, appID int32) (models.AppSettings, error)
+	UpdateAppSettings(ctx context.Context, appID int32, settings models.AppSettings) error
+}
+
+// New возвращает слой авторизации действий администратора перед сервисом svc
+func New(log *slog.Logger, keys KeyVerifier, tokens TokenVerifier, svc Service) *Admin {
+	return &Admin{
+		log:    log,
+		keys:   keys,
+		tokens: tokens,
+		svc:    svc,
+	}
+}
+
+// Admin пропускает действие администратора к сервису, если вызывающий передал действующий мастер-ключ
+// или access токен администратора того приложения, с которым выполняется действие
+type Admin struct {
+	log    *slog.Logger
+	keys   KeyVerifier
+	tokens TokenVerifier
+	svc    Service
+}
+
+func (a *Admin) CreateAdmin(ctx context.Context, login string, lvl int32, key string, appID int32) (int64, error) {
+	const op = "authz.CreateAdmin"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("login", login))
+
+	caller, err := a.authorize(ctx, log, key, appID)
+	if err != nil {
+		return 0, err
+	}
+	// администратор приложения не может выдать права выше своих
+	if caller != nil && lvl > caller.Lvl {
+		log.Warn("admin lvl above caller lvl", slog.Int("lvl", int(lvl)), slog.Int("caller_lvl", int(caller.Lvl)))
+		return 0, cerror.ErrNotRights
+	}
+
+	return a.svc.CreateAdmin(ctx, login, lvl, appID)
+}
+
+func (a *Admin) DeleteAdmin(ctx context.Context, login string, key string, appID int32) (bool, error) {
+	const op = "authz.DeleteAdmin"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("login", login))
+
+	caller, err := a.authorize(ctx, log, key, appID)
+	if err != nil {
+		return false, err
+	}
+	// администратор приложения не может снять права с администратора выше своего уровня
+	if caller != nil {
+		target, err := a.tokens.AdminByLogin(ctx, login, appID)
+		switch {
+		case errors.Is(err, cerror.ErrInvalidCredentials):
+			// пользователь не администратор, снимать нечего
+		case err != nil:
+			log.Error("cerror get target admin", slog.String("err", err.Error()))
+			return false, cerror.ErrInternalErr
+		case target.Lvl > caller.Lvl:
+			log.Warn("target admin lvl above caller lvl", slog.Int("lvl", int(target.Lvl)),
+				slog.Int("caller_lvl", int(caller.Lvl)))
+			return false, cerror.ErrNotRights
+		}
+	}
+
+	return a.svc.DeleteAdmin(ctx, login, appID)
+}
+
+// AddApp не относится ни к одному существующему приложению, поэтому доступен только по мастер-ключу
+func (a *Admin) AddApp(ctx context.Context, name, secret, alg, key string) (int32, error) {
+	const op = "authz.AddApp"
+
+	log := a.log.With(slog.String("op", op), slog.String("name", name))
+
+	if err := a.authorizeMaster(ctx, log, key); err != nil {
+		return 0, err
+	}
+	return a.svc.AddApp(ctx, name, secret, alg)
+}
+
+func (a *Admin) RotateSigningKey(ctx context.Context, appID int32, key string) (string, error) {
+	const op = "authz.RotateSigningKey"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return "", err
+	}
+	return a.svc.RotateSigningKey(ctx, appID)
+}
+
+// RevokeAllForUser отзывает токены пользователя во всех приложениях, поэтому доступен только по мастер-ключу
+func (a *Admin) RevokeAllForUser(ctx context.Context, userID int64, key string) error {
+	const op = "authz.RevokeAllForUser"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userid", userID))
+
+	if err := a.authorizeMaster(ctx, log, key); err != nil {
+		return err
+	}
+	return a.svc.RevokeAllForUser(ctx, userID)
+}
+
+func (a *Admin) UnlockAccount(ctx context.Context, login string, appID int32, key string) error {
+	const op = "authz.UnlockAccount"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("login", login))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.UnlockAccount(ctx, login, appID)
+}
+
+func (a *Admin) SetAppRequireVerified(ctx context.Context, appID int32, required bool, key string) error {
+	const op = "authz.SetAppRequireVerified"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.SetAppRequireVerified(ctx, appID, required)
+}
+
+func (a *Admin) SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string, key string) error {
+	const op = "authz.SetAppWebAuthn"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.SetAppWebAuthn(ctx, appID, rpID, origins)
+}
+
+func (a *Admin) GrantAppAccess(ctx context.Context, userID int64, appID int32, key string) error {
+	const op = "authz.GrantAppAccess"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Int64("userid", userID))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.GrantAppAccess(ctx, userID, appID)
+}
+
+func (a *Admin) RevokeAppAccess(ctx context.Context, userID int64, appID int32, key string) error {
+	const op = "authz.RevokeAppAccess"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Int64("userid", userID))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.RevokeAppAccess(ctx, userID, appID)
+}
+
+func (a *Admin) CreateRole(ctx context.Context, appID int32, name string, permissions []string, key string) (int64, error) {
+	const op = "authz.CreateRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("role", name))
+
+	if err := a.authorizeRole(ctx, log, key, appID, name); err != nil {
+		return 0, err
+	}
+	return a.svc.CreateRole(ctx, appID, name, permissions)
+}
+
+func (a *Admin) ListRoles(ctx context.Context, appID int32, key string) ([]models.Role, error) {
+	const op = "authz.ListRoles"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return nil, err
+	}
+	return a.svc.ListRoles(ctx, appID)
+}
+
+func (a *Admin) DeleteRole(ctx context.Context, appID int32, name string, key string) error {
+	const op = "authz.DeleteRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("role", name))
+
+	if err := a.authorizeRole(ctx, log, key, appID, name); err != nil {
+		return err
+	}
+	return a.svc.DeleteRole(ctx, appID, name)
+}
+
+func (a *Admin) AssignRole(ctx context.Context, userID int64, appID int32, name string, key string) error {
+	const op = "authz.AssignRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Int64("userid", userID),
+		slog.String("role", name))
+
+	if err := a.authorizeRole(ctx, log, key, appID, name); err != nil {
+		return err
+	}
+	return a.svc.AssignRole(ctx, userID, appID, name)
+}
+
+func (a *Admin) UnassignRole(ctx context.Context, userID int64, appID int32, name string, key string) error {
+	const op = "authz.UnassignRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Int64("userid", userID),
+		slog.String("role", name))
+
+	if err := a.authorizeRole(ctx, log, key, appID, name); err != nil {
+		return err
+	}
+	return a.svc.UnassignRole(ctx, userID, appID, name)
+}
+
+// ListApps показывает все приложения, поэтому доступен только по мастер-ключу
+func (a *Admin) ListApps(ctx context.Context, key string) ([]models.App, error) {
+	const op = "authz.ListApps"
+
+	log := a.log.With(slog.String("op", op))
+
+	if err := a.authorizeMaster(ctx, log, key); err != nil {
+		return nil, err
+	}
+	return a.svc.ListApps(ctx)
+}
+
+func (a *Admin) GetApp(ctx context.Context, appID int32, key string) (models.App, error) {
+	const op = "authz.GetApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return models.App{}, err
+	}
+	return a.svc.GetApp(ctx, appID)
+}
+
+func (a *Admin) UpdateApp(ctx context.Context, appID int32, name string, key string) error {
+	const op = "authz.UpdateApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("name", name))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.UpdateApp(ctx, appID, name)
+}
+
+// DisableApp доступен только по мастер-ключу: администратор приложения не должен выключать его сам
+// и не сможет включить обратно, когда истечёт его токен
+func (a *Admin) DisableApp(ctx context.Context, appID int32, disabled bool, key string) error {
+	const op = "authz.DisableApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if err := a.authorizeMaster(ctx, log, key); err != nil {
+		return err
+	}
+	return a.svc.DisableApp(ctx, appID, disabled)
+}
+
+// DeleteApp удаляет пользователей приложения вместе с их данными, поэтому доступен только по мастер-ключу
+func (a *Admin) DeleteApp(ctx context.Context, appID int32, cascade bool, key string) error {
+	const op = "authz.DeleteApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if err := a.authorizeMaster(ctx, log, key); err != nil {
+		return err
+	}
+	return a.svc.DeleteApp(ctx, appID, cascade)
+}
+
+func (a *Admin) RotateAppSecret(ctx context.Context, appID int32, key string) (string, error) {
+	const op = "authz.RotateAppSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return "", err
+	}
+	return a.svc.RotateAppSecret(ctx, appID)
+}
+
+func (a *Admin) GetAppSettings(ctx context.Context, appID int32, key string) (models.AppSettings, error) {
+	const op = "authz.GetAppSettings"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return models.AppSettings{}, err
+	}
+	return a.svc.GetAppSettings(ctx, appID)
+}
+
+func (a *Admin) UpdateAppSettings(ctx context.Context, appID int32, settings models.AppSettings, key string) error {
+	const op = "authz.UpdateAppSettings"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if _, err := a.authorize(ctx, log, key, appID); err != nil {
+		return err
+	}
+	return a.svc.UpdateAppSettings(ctx, appID, settings)
+}
+
+// authorize пропускает действие с приложением appID по мастер-ключу или по access токену из контекста.
+// Ключ проверяется первым: неверный ключ отклоняется, даже если передан и токен. Для мастер-ключа
+// возвращается nil, для токена запись администратора вызывающего
+func (a *Admin) authorize(ctx context.Context, log *slog.Logger, key string, appID int32) (*models.Admin, error) {
+	if key != "" {
+		return nil, a.verifyKey(log, key)
+	}
+
+	token := models.BearerToken(ctx)
+	if token == "" {
+		log.Warn("admin credentials missing")
+		return nil, cerror.ErrNotRights
+	}
+
+	claims, err := a.tokens.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			log.Warn("admin token rejected")
+			return nil, cerror.ErrNotRights
+		}
+		log.Error("cerror validate admin token", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+
+	log = log.With(slog.Int64("caller_userid", claims.UserID))
+
+	// токен другого приложения не даёт прав, даже если вызывающий администратор и здесь
+	if claims.AppID != appID {
+		log.Warn("admin token issued for another app", slog.Int("token_app_id", int(claims.AppID)))
+		return nil, cerror.ErrNotRights
+	}
+
+	admin, err := a.tokens.CheckIsAdmin(ctx, claims.UserID, appID)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidCredentials) {
+			log.Warn("caller is not app admin")
+			return nil, cerror.ErrNotRights
+		}
+		log.Error("cerror check caller is admin", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+
+	log.Info("admin action authorized by token", slog.Int("caller_lvl", int(admin.Lvl)))
+	return &admin, nil
+}
+
+// authorizeRole пропускает действие с ролью как authorize. Роли admin_lvl_N по токену менять нельзя:
+// иначе администратор приложения выдал бы или снял уровень выше своего в обход CreateAdmin и DeleteAdmin
+func (a *Admin) authorizeRole(ctx context.Context, log *slog.Logger, key string, appID int32, name string) error {
+	caller, err := a.authorize(ctx, log, key, appID)
+	if err != nil {
+		return err
+	}
+	if caller != nil && storage.IsAdminRole(name) {
+		log.Warn("admin role changed by token", slog.Int("caller_lvl", int(caller.Lvl)))
+		return cerror.ErrNotRights
+	}
+	return nil
+}
+
+// authorizeMaster пропускает действие, не привязанное к одному приложению, только по мастер-ключу
+func (a *Admin) authorizeMaster(ctx context.Context, log *slog.Logger, key string) error {
+	if key == "" {
+		if models.BearerToken(ctx) != "" {
+			log.Warn("admin token is not enough, master key required")
+		} else {
+			log.Warn("admin credentials missing")
+		}
+		return cerror.ErrNotRights
+	}
+	return a.verifyKey(log, key)
+}
+
+// verifyKey проверяет мастер-ключ и записывает в лог имя ключа, которым выполнено действие
+func (a *Admin) verifyKey(log *slog.Logger, key string) error {
+	if a.keys == nil {
+		log.Warn("admin keys not configured")
+		return cerror.ErrNotRights
+	}
+
+	name, err := a.keys.Verify(key)
+	if err != nil {
+		log.Warn("admin key rejected", slog.String("admin_key", name), slog.String("err", err.Error()))
+		return cerror.ErrNotRights
+	}
+
+	log.Info("admin action authorized by key", slog.String("admin_key", name))
+	return nil
+}
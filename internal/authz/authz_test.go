@@ -0,0 +1,368 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/adminkey"
+	"github.com/MorZLE/auth/internal/authz/mocks"
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/stretchr/testify/mock"
+	"log/slog"
+	"testing"
+)
+
+const keyAdmin = "test"
+
+func testAdminKeys(t *testing.T) *adminkey.Keys {
+	keys, err := adminkey.New([]config.AdminKey{{Name: "test", Hash: adminkey.Hash(keyAdmin)}})
+	if err != nil {
+		t.Fatalf("adminkey.New() cerror = %v", err)
+	}
+	return keys
+}
+
+func TestAdmin_CreateAdmin(t *testing.T) {
+	type mck func(tv *mocks.TokenVerifier, svc *mocks.Service)
+
+	tokenCtx := models.WithBearerToken(context.Background(), "token")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		key     string
+		lvl     int32
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "master_key",
+			ctx:  context.Background(),
+			key:  keyAdmin,
+			lvl:  5,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				svc.On("CreateAdmin", mock.Anything, "login", int32(5), int32(3)).Return(int64(1), nil)
+			},
+		},
+		{
+			name:    "wrong_key",
+			ctx:     tokenCtx,
+			key:     "wrong",
+			lvl:     1,
+			mck:     func(tv *mocks.TokenVerifier, svc *mocks.Service) {},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name:    "no_credentials",
+			ctx:     context.Background(),
+			lvl:     1,
+			mck:     func(tv *mocks.TokenVerifier, svc *mocks.Service) {},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "app_admin_token",
+			ctx:  tokenCtx,
+			lvl:  2,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+				tv.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 2}, nil)
+				svc.On("CreateAdmin", mock.Anything, "login", int32(2), int32(3)).Return(int64(1), nil)
+			},
+		},
+		{
+			name: "lvl_above_caller",
+			ctx:  tokenCtx,
+			lvl:  3,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+				tv.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 2}, nil)
+			},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "large_user_id",
+			ctx:  tokenCtx,
+			lvl:  1,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				// id больше 2^31 проверяется целиком, а не усечённым до другого пользователя
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 1<<32 + 7, AppID: 3}, nil)
+				tv.On("CheckIsAdmin", mock.Anything, int64(1<<32+7), int32(3)).Return(models.Admin{UserID: 1<<32 + 7, AppID: 3, Lvl: 2}, nil)
+				svc.On("CreateAdmin", mock.Anything, "login", int32(1), int32(3)).Return(int64(1), nil)
+			},
+		},
+		{
+			name: "token_of_other_app",
+			ctx:  tokenCtx,
+			lvl:  1,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 4}, nil)
+			},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "not_app_admin",
+			ctx:  tokenCtx,
+			lvl:  1,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+				tv.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{}, cerror.ErrInvalidCredentials)
+			},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "invalid_token",
+			ctx:  tokenCtx,
+			lvl:  1,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{}, cerror.ErrInvalidToken)
+			},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "validate_failed",
+			ctx:  tokenCtx,
+			lvl:  1,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{}, cerror.ErrInternalErr)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := mocks.NewTokenVerifier(t)
+			svc := mocks.NewService(t)
+			tt.mck(tokens, svc)
+
+			a := New(slog.With(slog.String("service", "authz")), testAdminKeys(t), tokens, svc)
+			if _, err := a.CreateAdmin(tt.ctx, "login", tt.lvl, tt.key, 3); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreateAdmin() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdmin_DeleteAdmin(t *testing.T) {
+	type mck func(tv *mocks.TokenVerifier, svc *mocks.Service)
+
+	tokenCtx := models.WithBearerToken(context.Background(), "token")
+	caller := func(tv *mocks.TokenVerifier) {
+		tv.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+		tv.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 1}, nil)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		key     string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "master_key",
+			ctx:  context.Background(),
+			key:  keyAdmin,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				svc.On("DeleteAdmin", mock.Anything, "login", int32(3)).Return(true, nil)
+			},
+		},
+		{
+			name: "same_lvl",
+			ctx:  tokenCtx,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				caller(tv)
+				tv.On("AdminByLogin", mock.Anything, "login", int32(3)).Return(models.Admin{UserID: 8, AppID: 3, Lvl: 1}, nil)
+				svc.On("DeleteAdmin", mock.Anything, "login", int32(3)).Return(true, nil)
+			},
+		},
+		{
+			name: "target_lvl_above_caller",
+			ctx:  tokenCtx,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				caller(tv)
+				tv.On("AdminByLogin", mock.Anything, "login", int32(3)).Return(models.Admin{UserID: 8, AppID: 3, Lvl: 3}, nil)
+			},
+			wantErr: cerror.ErrNotRights,
+		},
+		{
+			name: "target_not_admin",
+			ctx:  tokenCtx,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				caller(tv)
+				tv.On("AdminByLogin", mock.Anything, "login", int32(3)).Return(models.Admin{}, cerror.ErrInvalidCredentials)
+				svc.On("DeleteAdmin", mock.Anything, "login", int32(3)).Return(true, nil)
+			},
+		},
+		{
+			name: "target_lookup_failed",
+			ctx:  tokenCtx,
+			mck: func(tv *mocks.TokenVerifier, svc *mocks.Service) {
+				caller(tv)
+				tv.On("AdminByLogin", mock.Anything, "login", int32(3)).Return(models.Admin{}, cerror.ErrInternalErr)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := mocks.NewTokenVerifier(t)
+			svc := mocks.NewService(t)
+			tt.mck(tokens, svc)
+
+			a := New(slog.With(slog.String("service", "authz")), testAdminKeys(t), tokens, svc)
+			if _, err := a.DeleteAdmin(tt.ctx, "login", tt.key, 3); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteAdmin() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdmin_MasterKeyOnly(t *testing.T) {
+	tokens := mocks.NewTokenVerifier(t)
+	svc := mocks.NewService(t)
+	svc.On("AddApp", mock.Anything, "app", "secret", "HS256").Return(int32(3), nil)
+	svc.On("RevokeAllForUser", mock.Anything, int64(7)).Return(nil)
+	svc.On("ListApps", mock.Anything).Return([]models.App{}, nil)
+	svc.On("DisableApp", mock.Anything, int32(3), true).Return(nil)
+	svc.On("DeleteApp", mock.Anything, int32(3), true).Return(nil)
+
+	a := New(slog.With(slog.String("service", "authz")), testAdminKeys(t), tokens, svc)
+	ctx := models.WithBearerToken(context.Background(), "token")
+
+	if _, err := a.AddApp(ctx, "app", "secret", "HS256", ""); !errors.Is(err, cerror.ErrNotRights) {
+		t.Errorf("AddApp() cerror = %v, wantErr %v", err, cerror.ErrNotRights)
+	}
+	if _, err := a.AddApp(ctx, "app", "secret", "HS256", keyAdmin); err != nil {
+		t.Errorf("AddApp() cerror = %v", err)
+	}
+	if err := a.RevokeAllForUser(ctx, 7, ""); !errors.Is(err, cerror.ErrNotRights) {
+		t.Errorf("RevokeAllForUser() cerror = %v, wantErr %v", err, cerror.ErrNotRights)
+	}
+	if err := a.RevokeAllForUser(ctx, 7, keyAdmin); err != nil {
+		t.Errorf("RevokeAllForUser() cerror = %v", err)
+	}
+	if _, err := a.ListApps(ctx, ""); !errors.Is(err, cerror.ErrNotRights) {
+		t.Errorf("ListApps() cerror = %v, wantErr %v", err, cerror.ErrNotRights)
+	}
+	if _, err := a.ListApps(ctx, keyAdmin); err != nil {
+		t.Errorf("ListApps() cerror = %v", err)
+	}
+	if err := a.DisableApp(ctx, 3, true, ""); !errors.Is(err, cerror.ErrNotRights) {
+		t.Errorf("DisableApp() cerror = %v, wantErr %v", err, cerror.ErrNotRights)
+	}
+	if err := a.DisableApp(ctx, 3, true, keyAdmin); err != nil {
+		t.Errorf("DisableApp() cerror = %v", err)
+	}
+	if err := a.DeleteApp(ctx, 3, true, ""); !errors.Is(err, cerror.ErrNotRights) {
+		t.Errorf("DeleteApp() cerror = %v, wantErr %v", err, cerror.ErrNotRights)
+	}
+	if err := a.DeleteApp(ctx, 3, true, keyAdmin); err != nil {
+		t.Errorf("DeleteApp() cerror = %v", err)
+	}
+}
+
+func TestAdmin_AppScoped(t *testing.T) {
+	tokens := mocks.NewTokenVerifier(t)
+	tokens.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+	tokens.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 1}, nil)
+	tokens.On("AdminByLogin", mock.Anything, "login", int32(3)).Return(models.Admin{UserID: 8, AppID: 3, Lvl: 1}, nil)
+
+	svc := mocks.NewService(t)
+	svc.On("DeleteAdmin", mock.Anything, "login", int32(3)).Return(true, nil)
+	svc.On("RotateSigningKey", mock.Anything, int32(3)).Return("kid", nil)
+	svc.On("UnlockAccount", mock.Anything, "login", int32(3)).Return(nil)
+	svc.On("SetAppRequireVerified", mock.Anything, int32(3), true).Return(nil)
+	svc.On("SetAppWebAuthn", mock.Anything, int32(3), "", []string(nil)).Return(nil)
+	svc.On("GrantAppAccess", mock.Anything, int64(8), int32(3)).Return(nil)
+	svc.On("RevokeAppAccess", mock.Anything, int64(8), int32(3)).Return(nil)
+	svc.On("CreateRole", mock.Anything, int32(3), "editor", []string{"posts:write"}).Return(int64(1), nil)
+	svc.On("ListRoles", mock.Anything, int32(3)).Return([]models.Role{}, nil)
+	svc.On("DeleteRole", mock.Anything, int32(3), "editor").Return(nil)
+	svc.On("AssignRole", mock.Anything, int64(8), int32(3), "editor").Return(nil)
+	svc.On("UnassignRole", mock.Anything, int64(8), int32(3), "editor").Return(nil)
+	svc.On("GetApp", mock.Anything, int32(3)).Return(models.App{ID: 3}, nil)
+	svc.On("UpdateApp", mock.Anything, int32(3), "app").Return(nil)
+	svc.On("RotateAppSecret", mock.Anything, int32(3)).Return("secret", nil)
+	svc.On("GetAppSettings", mock.Anything, int32(3)).Return(models.AppSettings{}, nil)
+	svc.On("UpdateAppSettings", mock.Anything, int32(3), models.AppSettings{RegistrationClosed: true}).Return(nil)
+
+	a := New(slog.With(slog.String("service", "authz")), testAdminKeys(t), tokens, svc)
+	ctx := models.WithBearerToken(context.Background(), "token")
+
+	// каждое действие проверяем для своего приложения и для чужого, токен выдан приложению 3
+	for _, appID := range []int32{3, 4} {
+		wantErr := error(nil)
+		if appID != 3 {
+			wantErr = cerror.ErrNotRights
+		}
+
+		calls := map[string]error{}
+		_, calls["DeleteAdmin"] = a.DeleteAdmin(ctx, "login", "", appID)
+		_, calls["RotateSigningKey"] = a.RotateSigningKey(ctx, appID, "")
+		calls["UnlockAccount"] = a.UnlockAccount(ctx, "login", appID, "")
+		calls["SetAppRequireVerified"] = a.SetAppRequireVerified(ctx, appID, true, "")
+		calls["SetAppWebAuthn"] = a.SetAppWebAuthn(ctx, appID, "", nil, "")
+		calls["GrantAppAccess"] = a.GrantAppAccess(ctx, 8, appID, "")
+		calls["RevokeAppAccess"] = a.RevokeAppAccess(ctx, 8, appID, "")
+		_, calls["CreateRole"] = a.CreateRole(ctx, appID, "editor", []string{"posts:write"}, "")
+		_, calls["ListRoles"] = a.ListRoles(ctx, appID, "")
+		calls["DeleteRole"] = a.DeleteRole(ctx, appID, "editor", "")
+		calls["AssignRole"] = a.AssignRole(ctx, 8, appID, "editor", "")
+		calls["UnassignRole"] = a.UnassignRole(ctx, 8, appID, "editor", "")
+		_, calls["GetApp"] = a.GetApp(ctx, appID, "")
+		calls["UpdateApp"] = a.UpdateApp(ctx, appID, "app", "")
+		_, calls["RotateAppSecret"] = a.RotateAppSecret(ctx, appID, "")
+		_, calls["GetAppSettings"] = a.GetAppSettings(ctx, appID, "")
+		calls["UpdateAppSettings"] = a.UpdateAppSettings(ctx, appID, models.AppSettings{RegistrationClosed: true}, "")
+
+		for name, err := range calls {
+			if !errors.Is(err, wantErr) {
+				t.Errorf("%s() app %d cerror = %v, wantErr %v", name, appID, err, wantErr)
+			}
+		}
+	}
+}
+
+func TestAdmin_AdminRoles(t *testing.T) {
+	tokens := mocks.NewTokenVerifier(t)
+	tokens.On("ValidateToken", mock.Anything, "token").Return(models.TokenClaims{UserID: 7, AppID: 3}, nil)
+	tokens.On("CheckIsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 2}, nil)
+
+	svc := mocks.NewService(t)
+	svc.On("CreateRole", mock.Anything, int32(3), "admin_lvl_3", []string{"admin"}).Return(int64(1), nil).Once()
+	svc.On("DeleteRole", mock.Anything, int32(3), "admin_lvl_3").Return(nil).Once()
+	svc.On("AssignRole", mock.Anything, int64(8), int32(3), "admin_lvl_3").Return(nil).Once()
+	svc.On("UnassignRole", mock.Anything, int64(8), int32(3), "admin_lvl_3").Return(nil).Once()
+
+	a := New(slog.With(slog.String("service", "authz")), testAdminKeys(t), tokens, svc)
+	ctx := models.WithBearerToken(context.Background(), "token")
+
+	// по токену роли администраторов не меняются ни выше, ни ниже уровня вызывающего
+	for _, name := range []string{"admin_lvl_3", "admin_lvl_1"} {
+		calls := map[string]error{}
+		_, calls["CreateRole"] = a.CreateRole(ctx, 3, name, []string{"admin"}, "")
+		calls["DeleteRole"] = a.DeleteRole(ctx, 3, name, "")
+		calls["AssignRole"] = a.AssignRole(ctx, 8, 3, name, "")
+		calls["UnassignRole"] = a.UnassignRole(ctx, 8, 3, name, "")
+
+		for call, err := range calls {
+			if !errors.Is(err, cerror.ErrNotRights) {
+				t.Errorf("%s() %s cerror = %v, wantErr %v", call, name, err, cerror.ErrNotRights)
+			}
+		}
+	}
+
+	// мастер-ключ по-прежнему управляет любыми ролями
+	calls := map[string]error{}
+	_, calls["CreateRole"] = a.CreateRole(ctx, 3, "admin_lvl_3", []string{"admin"}, keyAdmin)
+	calls["DeleteRole"] = a.DeleteRole(ctx, 3, "admin_lvl_3", keyAdmin)
+	calls["AssignRole"] = a.AssignRole(ctx, 8, 3, "admin_lvl_3", keyAdmin)
+	calls["UnassignRole"] = a.UnassignRole(ctx, 8, 3, "admin_lvl_3", keyAdmin)
+
+	for call, err := range calls {
+		if err != nil {
+			t.Errorf("%s() master key cerror = %v", call, err)
+		}
+	}
+}
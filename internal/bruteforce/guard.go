@@ -0,0 +1,210 @@
+package bruteforce
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"log/slog"
+	"time"
+)
+
+// Store хранит счётчики попыток по ключу. AddFailure должен увеличивать счётчик атомарно, сбрасывая его,
+// если предыдущая неудача была раньше начала окна, и возвращать в PrevFailure время предыдущей неудачи.
+// RemoveFailure возвращает учтённую попытку, которая оказалась успешной
+type Store interface {
+	Attempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	AddFailure(ctx context.Context, key string, at time.Time, windowStart time.Time) (models.LoginAttempts, error)
+	RemoveFailure(ctx context.Context, key string) error
+	LockUntil(ctx context.Context, key string, until time.Time) error
+	ResetAttempts(ctx context.Context, key string) error
+	DeleteStaleAttempts(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+// Guard ограничивает перебор паролей. По логину действует экспоненциальная задержка между попытками
+// и временная блокировка после MaxAttempts неудач, по IP только блокировка после IPMaxAttempts,
+// чтобы не наказывать задержками клиентов за общим NAT
+type Guard struct {
+	store Store
+	cfg   config.BruteForce
+	now   func() time.Time
+}
+
+func New(store Store, cfg config.BruteForce) *Guard {
+	return &Guard{store: store, cfg: cfg, now: time.Now}
+}
+
+// Reserve учитывает попытку до проверки пароля и возвращает, сколько ещё нужно ждать до следующей попытки.
+// 0 означает, что попытка разрешена. Попытка считается неудачной, пока её не вернёт Success, поэтому
+// параллельные запросы не проходят мимо задержки и блокировки: каждый видит попытки, учтённые до него.
+// Отклонённая попытка тоже остаётся неудачной
+func (g *Guard) Reserve(ctx context.Context, login string, appID int32, ip string) (time.Duration, error) {
+	const op = "bruteforce.Reserve"
+
+	now := g.now()
+
+	wait, err := g.reserve(ctx, loginKey(login, appID), g.cfg.MaxAttempts, now, true)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ip != "" {
+		ipWait, err := g.reserve(ctx, ipKey(ip), g.cfg.IPMaxAttempts, now, false)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, ipWait)
+	}
+
+	return wait, nil
+}
+
+// Fail отмечает попытку, учтённую Reserve, неудачной и возвращает время до следующей разрешённой попытки
+func (g *Guard) Fail(ctx context.Context, login string, appID int32, ip string) (time.Duration, error) {
+	const op = "bruteforce.Fail"
+
+	now := g.now()
+
+	wait, err := g.fail(ctx, loginKey(login, appID), g.cfg.MaxAttempts, now, true)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ip != "" {
+		ipWait, err := g.fail(ctx, ipKey(ip), g.cfg.IPMaxAttempts, now, false)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, ipWait)
+	}
+
+	return wait, nil
+}
+
+// Success сбрасывает счётчик логина после успешного входа и возвращает попытку, учтённую Reserve для IP.
+// Неудачи IP затухают сами по окну
+func (g *Guard) Success(ctx context.Context, login string, appID int32, ip string) error {
+	const op = "bruteforce.Success"
+
+	if err := g.store.ResetAttempts(ctx, loginKey(login, appID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ip != "" {
+		if err := g.store.RemoveFailure(ctx, ipKey(ip)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Release возвращает попытку, учтённую Reserve, не сбрасывая неудачи до неё. Нужен, когда пароль верный,
+// но вход ещё не завершён вторым фактором
+func (g *Guard) Release(ctx context.Context, login string, appID int32, ip string) error {
+	const op = "bruteforce.Release"
+
+	if err := g.store.RemoveFailure(ctx, loginKey(login, appID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ip != "" {
+		if err := g.store.RemoveFailure(ctx, ipKey(ip)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Unlock снимает блокировку и задержку с аккаунта
+func (g *Guard) Unlock(ctx context.Context, login string, appID int32) error {
+	const op = "bruteforce.Unlock"
+
+	if err := g.store.ResetAttempts(ctx, loginKey(login, appID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RunCleanup периодически удаляет счётчики без неудач в текущем окне и без действующей блокировки
+func (g *Guard) RunCleanup(ctx context.Context, log *slog.Logger, every time.Duration) {
+	const op = "bruteforce.RunCleanup"
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := g.store.DeleteStaleAttempts(ctx, g.now().Add(-g.cfg.Window)); err != nil {
+				log.Error("cerror delete stale login attempts", slog.String("op", op), slog.String("err", err.Error()))
+			}
+		}
+	}
+}
+
+// reserve решает по состоянию счётчика до этой попытки. Если лимит уже исчерпан попытками, блокировка
+// за которые ещё не записана (они проверяются прямо сейчас), блокировку ставит эта попытка
+func (g *Guard) reserve(ctx context.Context, key string, limit int, now time.Time, backoff bool) (time.Duration, error) {
+	a, err := g.store.AddFailure(ctx, key, now, now.Add(-g.cfg.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	prev := models.LoginAttempts{Failures: a.Failures - 1, LastFailure: a.PrevFailure, LockedUntil: a.LockedUntil}
+	if limit > 0 && prev.Failures >= limit && !prev.LockedUntil.After(now) && !prev.LockedUntil.After(prev.LastFailure) {
+		prev.LockedUntil = now.Add(g.cfg.Lockout)
+		if err := g.store.LockUntil(ctx, key, prev.LockedUntil); err != nil {
+			return 0, err
+		}
+	}
+
+	return g.wait(prev, now, backoff), nil
+}
+
+func (g *Guard) fail(ctx context.Context, key string, limit int, now time.Time, backoff bool) (time.Duration, error) {
+	a, err := g.store.Attempts(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if limit > 0 && a.Failures >= limit {
+		a.LockedUntil = now.Add(g.cfg.Lockout)
+		if err := g.store.LockUntil(ctx, key, a.LockedUntil); err != nil {
+			return 0, err
+		}
+	}
+
+	return g.wait(a, now, backoff), nil
+}
+
+func (g *Guard) wait(a models.LoginAttempts, now time.Time, backoff bool) time.Duration {
+	var wait time.Duration
+	if a.LockedUntil.After(now) {
+		wait = a.LockedUntil.Sub(now)
+	}
+	if !backoff || a.Failures == 0 || a.LastFailure.Before(now.Add(-g.cfg.Window)) {
+		return wait
+	}
+
+	if next := a.LastFailure.Add(g.delay(a.Failures)); next.After(now) {
+		wait = max(wait, next.Sub(now))
+	}
+	return wait
+}
+
+// delay задержка после failures неудач подряд: BaseDelay, 2*BaseDelay, 4*BaseDelay ... но не больше MaxDelay
+func (g *Guard) delay(failures int) time.Duration {
+	d := g.cfg.BaseDelay
+	for i := 1; i < failures && d < g.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxDelay)
+}
+
+func loginKey(login string, appID int32) string {
+	return fmt.Sprintf("login:%d:%s", appID, login)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
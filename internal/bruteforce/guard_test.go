@@ -0,0 +1,195 @@
+package bruteforce
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/config"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testGuard() (*Guard, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := New(NewMemoryStore(), config.BruteForce{
+		MaxAttempts:   3,
+		IPMaxAttempts: 5,
+		Lockout:       15 * time.Minute,
+		BaseDelay:     time.Second,
+		MaxDelay:      4 * time.Second,
+		Window:        time.Hour,
+	})
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+// failAttempt проходит Reserve и отмечает попытку неудачной
+func failAttempt(t *testing.T, g *Guard, login string, ip string) time.Duration {
+	t.Helper()
+
+	ctx := context.Background()
+	if wait, err := g.Reserve(ctx, login, 1, ip); err != nil || wait != 0 {
+		t.Fatalf("Reserve() got = %v, cerror = %v, want 0", wait, err)
+	}
+	wait, err := g.Fail(ctx, login, 1, ip)
+	if err != nil {
+		t.Fatalf("Fail() cerror = %v", err)
+	}
+	return wait
+}
+
+func TestGuard_Backoff(t *testing.T) {
+	g, now := testGuard()
+	ctx := context.Background()
+
+	if wait := failAttempt(t, g, "user", "10.0.0.1"); wait != time.Second {
+		t.Fatalf("Fail() got = %v, want 1s", wait)
+	}
+
+	// вторая неудача удваивает задержку
+	*now = now.Add(time.Second)
+	if wait := failAttempt(t, g, "user", "10.0.0.1"); wait != 2*time.Second {
+		t.Errorf("Fail() got = %v, want 2s", wait)
+	}
+	if wait, _ := g.Reserve(ctx, "user", 1, "10.0.0.1"); wait != 2*time.Second {
+		t.Errorf("Reserve() got = %v, want 2s", wait)
+	}
+
+	// другой логин в том же приложении и тот же логин в другом приложении не затронуты
+	if wait, _ := g.Reserve(ctx, "other", 1, "10.0.0.2"); wait != 0 {
+		t.Errorf("Reserve(other) got = %v, want 0", wait)
+	}
+	if wait, _ := g.Reserve(ctx, "user", 2, "10.0.0.2"); wait != 0 {
+		t.Errorf("Reserve(user, app 2) got = %v, want 0", wait)
+	}
+}
+
+func TestGuard_Lockout(t *testing.T) {
+	g, now := testGuard()
+	ctx := context.Background()
+
+	var wait time.Duration
+	for i := 0; i < 3; i++ {
+		*now = now.Add(4 * time.Second)
+		wait = failAttempt(t, g, "user", "")
+	}
+	if wait != 15*time.Minute {
+		t.Errorf("Fail() got = %v, want lockout 15m", wait)
+	}
+	if wait, _ := g.Reserve(ctx, "user", 1, ""); wait != 15*time.Minute {
+		t.Errorf("Reserve() got = %v, want lockout 15m", wait)
+	}
+
+	// после блокировки счётчик продолжается в пределах окна, поэтому следующая неудача снова блокирует
+	*now = now.Add(15 * time.Minute)
+	if wait := failAttempt(t, g, "user", ""); wait != 15*time.Minute {
+		t.Errorf("Fail() got = %v, want lockout 15m", wait)
+	}
+
+	if err := g.Unlock(ctx, "user", 1); err != nil {
+		t.Fatalf("Unlock() cerror = %v", err)
+	}
+	if wait, _ := g.Reserve(ctx, "user", 1, ""); wait != 0 {
+		t.Errorf("Reserve() after unlock got = %v, want 0", wait)
+	}
+}
+
+func TestGuard_Success(t *testing.T) {
+	g, now := testGuard()
+	ctx := context.Background()
+
+	failAttempt(t, g, "user", "10.0.0.1")
+	*now = now.Add(time.Second)
+
+	// успешные входы сбрасывают счётчик логина и не копятся в счётчике IP
+	for i := 0; i < 10; i++ {
+		if wait, err := g.Reserve(ctx, "user", 1, "10.0.0.1"); err != nil || wait != 0 {
+			t.Fatalf("Reserve() got = %v, cerror = %v, want 0", wait, err)
+		}
+		if err := g.Success(ctx, "user", 1, "10.0.0.1"); err != nil {
+			t.Fatalf("Success() cerror = %v", err)
+		}
+	}
+}
+
+func TestGuard_IPLockout(t *testing.T) {
+	g, now := testGuard()
+	ctx := context.Background()
+
+	// перебор разных логинов с одного IP
+	for i := 0; i < 5; i++ {
+		*now = now.Add(time.Minute)
+		failAttempt(t, g, string(rune('a'+i)), "10.0.0.1")
+	}
+
+	if wait, _ := g.Reserve(ctx, "fresh", 1, "10.0.0.1"); wait != 15*time.Minute {
+		t.Errorf("Reserve() from locked ip got = %v, want 15m", wait)
+	}
+	if wait, _ := g.Reserve(ctx, "other", 1, "10.0.0.2"); wait != 0 {
+		t.Errorf("Reserve() from other ip got = %v, want 0", wait)
+	}
+}
+
+func TestGuard_WindowReset(t *testing.T) {
+	g, now := testGuard()
+	ctx := context.Background()
+
+	failAttempt(t, g, "user", "")
+	*now = now.Add(time.Second)
+	failAttempt(t, g, "user", "")
+
+	*now = now.Add(2 * time.Hour)
+	if wait := failAttempt(t, g, "user", ""); wait != time.Second {
+		t.Errorf("Fail() after window got = %v, want 1s", wait)
+	}
+
+	deleted, err := g.store.DeleteStaleAttempts(ctx, now.Add(time.Hour))
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteStaleAttempts() got = %v, cerror = %v, want 1", deleted, err)
+	}
+}
+
+func TestGuard_Concurrent(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseDelay time.Duration
+		want      int64
+	}{
+		// задержка после первой неудачи отклоняет все параллельные попытки, кроме одной
+		{name: "backoff", baseDelay: time.Second, want: 1},
+		// без задержки проходят ровно MaxAttempts попыток, остальные блокируются
+		{name: "lockout", baseDelay: 0, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := testGuard()
+			g.cfg.BaseDelay = tt.baseDelay
+			ctx := context.Background()
+
+			var allowed atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					wait, err := g.Reserve(ctx, "user", 1, "10.0.0.1")
+					if err != nil {
+						t.Errorf("Reserve() cerror = %v", err)
+						return
+					}
+					if wait == 0 {
+						allowed.Add(1)
+						if _, err := g.Fail(ctx, "user", 1, "10.0.0.1"); err != nil {
+							t.Errorf("Fail() cerror = %v", err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := allowed.Load(); got != tt.want {
+				t.Errorf("allowed attempts = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package bruteforce
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит счётчики в памяти процесса. Подходит для одного экземпляра сервиса:
+// счётчики не разделяются между репликами и сбрасываются при перезапуске
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: make(map[string]models.LoginAttempts)}
+}
+
+func (m *MemoryStore) Attempts(_ context.Context, key string) (models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.attempts[key], nil
+}
+
+func (m *MemoryStore) AddFailure(_ context.Context, key string, at time.Time, windowStart time.Time) (models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.attempts[key]
+	if a.LastFailure.Before(windowStart) {
+		a.Failures = 0
+		a.LastFailure = time.Time{}
+	}
+	a.Failures++
+	a.PrevFailure = a.LastFailure
+	a.LastFailure = at
+	m.attempts[key] = a
+
+	return a, nil
+}
+
+func (m *MemoryStore) RemoveFailure(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok && a.Failures > 0 {
+		a.Failures--
+		m.attempts[key] = a
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) LockUntil(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.attempts[key]
+	a.LockedUntil = until
+	m.attempts[key] = a
+
+	return nil
+}
+
+func (m *MemoryStore) ResetAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteStaleAttempts(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, a := range m.attempts {
+		if a.LastFailure.Before(before) && a.LockedUntil.Before(before) {
+			delete(m.attempts, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
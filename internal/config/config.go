@@ -9,11 +9,164 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC        GrpcConfig    `yaml:"grpc"`
-	Rest        Rest          `yaml:"rest"`
+	Env         string         `yaml:"env" env-default:"local"`
+	StoragePath string         `yaml:"storage_path" env-required:"true"`
+	TokenTTL    time.Duration  `yaml:"token_ttl" env-required:"true"`
+	RefreshTTL  time.Duration  `yaml:"refresh_token_ttl" env-default:"720h"`
+	GRPC        GrpcConfig     `yaml:"grpc"`
+	Rest        Rest           `yaml:"rest"`
+	AdminKeys   []AdminKey     `yaml:"admin_keys"`
+	KeyRotation KeyRotation    `yaml:"key_rotation"`
+	Password    PasswordPolicy `yaml:"password_policy"`
+	BruteForce  BruteForce     `yaml:"brute_force"`
+	Notifier    Notifier       `yaml:"notifier"`
+	// RevocationCleanup период удаления записей об отзыве токенов, срок которых уже истёк
+	RevocationCleanup time.Duration `yaml:"revocation_cleanup_interval" env-default:"10m"`
+	// PasswordResetTTL время жизни токена сброса пароля
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env-default:"1h"`
+	// EmailVerificationTTL время жизни токена подтверждения адреса
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl" env-default:"24h"`
+	// MFA настройки второго фактора
+	MFA MFA `yaml:"mfa"`
+	// AppSecrets шифрование секретов приложений в базе
+	AppSecrets AppSecrets `yaml:"app_secrets"`
+	// WebAuthnSessionTTL сколько действует токен церемонии WebAuthn между begin и finish
+	WebAuthnSessionTTL time.Duration `yaml:"webauthn_session_ttl" env-default:"5m"`
+	// PasswordHash алгоритм и параметры хэширования паролей
+	PasswordHash PasswordHash `yaml:"password_hash"`
+	// StorageDriver хранилище: sqlite (StoragePath путь к файлу), postgres (StoragePath DSN) или memory
+	// (данные в памяти процесса, теряются при перезапуске)
+	StorageDriver string `yaml:"storage_driver" env:"STORAGE_DRIVER" env-default:"sqlite"`
+	// MigrateOnStart применяет встроенные миграции при запуске, до начала обслуживания запросов
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+}
+
+// PasswordHash хэширование паролей. Algorithm argon2id или bcrypt. Хэши, посчитанные другим алгоритмом
+// или с другими параметрами, пересчитываются при следующем успешном входе
+type PasswordHash struct {
+	Algorithm  string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2     Argon2 `yaml:"argon2"`
+	Pepper     Pepper `yaml:"pepper"`
+}
+
+// Pepper секрет, которым пароль подписывается HMAC-SHA256 перед хэшированием. Хранится вне базы, поэтому
+// утёкшие хэши нельзя перебирать без него. Value или File задают текущий перец версии Version, Previous
+// старые версии, которые нужны для проверки ещё не пересчитанных хэшей. Version 0 отключает перец
+type Pepper struct {
+	Version  int         `yaml:"version" env:"PASSWORD_PEPPER_VERSION"`
+	Value    string      `yaml:"value" env:"PASSWORD_PEPPER"`
+	File     string      `yaml:"file" env:"PASSWORD_PEPPER_FILE"`
+	Previous []PepperKey `yaml:"previous"`
+}
+
+// PepperKey старая версия перца
+type PepperKey struct {
+	Version int    `yaml:"version"`
+	Value   string `yaml:"value"`
+	File    string `yaml:"file"`
+}
+
+// Argon2 параметры argon2id, Memory в KiB
+type Argon2 struct {
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+	SaltLength  uint32 `yaml:"salt_length" env-default:"16"`
+	KeyLength   uint32 `yaml:"key_length" env-default:"32"`
+}
+
+// MFA второй фактор TOTP. EncryptionKey 32 байта в base64, которыми шифруются секреты в базе,
+// без него включение MFA недоступно. Issuer отображается в приложении-аутентификаторе
+type MFA struct {
+	EncryptionKey string        `yaml:"encryption_key" env:"MFA_ENCRYPTION_KEY"`
+	Issuer        string        `yaml:"issuer" env-default:"auth"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// AppSecrets шифрование секретов приложений конвертом. KEK 32 байта в base64, которыми шифруются ключи данных
+// секретов. Без него новые секреты пишутся открытым текстом, а уже зашифрованные не расшифровать
+type AppSecrets struct {
+	KEK string `yaml:"kek" env:"APP_SECRET_KEK"`
+}
+
+// KeyRotation расписание ротации ключей подписи. Новый ключ публикуется в JWKS за PublishDelay до начала подписи,
+// чтобы проверяющие сервисы успели обновить кэш ключей
+type KeyRotation struct {
+	Interval      time.Duration `yaml:"interval" env-default:"720h"`
+	PublishDelay  time.Duration `yaml:"publish_delay" env-default:"0s"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1m"`
+}
+
+// AdminKey мастер-ключ для административных методов. В конфиге хранится только sha256 хэш ключа
+type AdminKey struct {
+	Name      string    `yaml:"name"`
+	Hash      string    `yaml:"hash"`
+	ExpiresAt time.Time `yaml:"expires_at"`
+	Revoked   bool      `yaml:"revoked"`
+}
+
+// PasswordPolicy требования к паролю. Default действует для всех приложений, Apps переопределяет его целиком
+// для отдельных app_id. Denylist путь к файлу с распространёнными паролями, по одному в строке
+type PasswordPolicy struct {
+	Default  PasswordRules           `yaml:"default"`
+	Apps     map[int32]PasswordRules `yaml:"apps"`
+	Denylist string                  `yaml:"denylist"`
+}
+
+type PasswordRules struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	MaxLength     int  `yaml:"max_length" env-default:"72"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	ForbidLogin   bool `yaml:"forbid_login" env-default:"true"`
+}
+
+// BruteForce защита от перебора паролей. Store выбирает хранилище счётчиков: sqlite или memory
+type BruteForce struct {
+	Store         string        `yaml:"store" env-default:"sqlite"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+	IPMaxAttempts int           `yaml:"ip_max_attempts" env-default:"50"`
+	Lockout       time.Duration `yaml:"lockout" env-default:"15m"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay      time.Duration `yaml:"max_delay" env-default:"1m"`
+	Window        time.Duration `yaml:"window" env-default:"1h"`
+}
+
+// Notifier доставка писем пользователям. Sender выбирает способ доставки: log, file или smtp.
+// Templates каталог с шаблонами писем, переопределяющими встроенные. Locales задаёт язык писем для отдельных app_id
+type Notifier struct {
+	Sender        string           `yaml:"sender" env-default:"log"`
+	FilePath      string           `yaml:"file_path" env-default:"./storage/mail.log"`
+	Templates     string           `yaml:"templates"`
+	DefaultLocale string           `yaml:"default_locale" env-default:"ru"`
+	Locales       map[int32]string `yaml:"locales"`
+	SMTP          SMTP             `yaml:"smtp"`
+	Queue         NotifierQueue    `yaml:"queue"`
+}
+
+// SMTP параметры почтового сервера. Если сервер поддерживает STARTTLS, соединение всегда шифруется,
+// RequireTLS запрещает отправку без шифрования
+type SMTP struct {
+	Host       string        `yaml:"host"`
+	Port       int           `yaml:"port" env-default:"587"`
+	Username   string        `yaml:"username"`
+	Password   string        `yaml:"password" env:"SMTP_PASSWORD"`
+	From       string        `yaml:"from"`
+	RequireTLS bool          `yaml:"require_tls" env-default:"true"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// NotifierQueue повторная доставка писем. Задержка между попытками растёт от BaseDelay до MaxDelay,
+// после MaxAttempts неудач письмо остаётся в очереди помеченным как недоставленное
+type NotifierQueue struct {
+	Interval    time.Duration `yaml:"interval" env-default:"5s"`
+	BatchSize   int           `yaml:"batch_size" env-default:"20"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"8"`
+	BaseDelay   time.Duration `yaml:"base_delay" env-default:"30s"`
+	MaxDelay    time.Duration `yaml:"max_delay" env-default:"1h"`
 }
 
 type GrpcConfig struct {
@@ -47,11 +200,33 @@ func MustLoadByPath(confPath string) *Config {
 	if err != nil {
 		panic(fmt.Sprintf("err read config: %s", err))
 	}
+	if err = cnf.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid config: %s", err))
+	}
 
 	return &cnf
 
 }
 
+// Validate проверяет периоды фоновых задач: тикер с неположительным периодом паникует уже после запуска сервиса
+func (c *Config) Validate() error {
+	intervals := []struct {
+		name  string
+		every time.Duration
+	}{
+		{"key_rotation.check_interval", c.KeyRotation.CheckInterval},
+		{"revocation_cleanup_interval", c.RevocationCleanup},
+		{"brute_force.window", c.BruteForce.Window},
+		{"notifier.queue.interval", c.Notifier.Queue.Interval},
+	}
+	for _, i := range intervals {
+		if i.every <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", i.name, i.every)
+		}
+	}
+	return nil
+}
+
 func fetchConfigPath() string {
 	var res string
 
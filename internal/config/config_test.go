@@ -0,0 +1,73 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			KeyRotation:       KeyRotation{CheckInterval: time.Minute},
+			RevocationCleanup: 10 * time.Minute,
+			BruteForce:        BruteForce{Window: time.Hour},
+			Notifier:          Notifier{Queue: NotifierQueue{Interval: 5 * time.Second}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "positive",
+			modify: func(c *Config) {},
+		},
+		{
+			name:    "zero_key_rotation_check",
+			modify:  func(c *Config) { c.KeyRotation.CheckInterval = 0 },
+			wantErr: "key_rotation.check_interval",
+		},
+		{
+			name:    "zero_revocation_cleanup",
+			modify:  func(c *Config) { c.RevocationCleanup = 0 },
+			wantErr: "revocation_cleanup_interval",
+		},
+		{
+			name:    "negative_brute_force_window",
+			modify:  func(c *Config) { c.BruteForce.Window = -time.Second },
+			wantErr: "brute_force.window",
+		},
+		{
+			name:    "zero_queue_interval",
+			modify:  func(c *Config) { c.Notifier.Queue.Interval = 0 },
+			wantErr: "notifier.queue.interval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() cerror = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() cerror = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMustLoadByPath_LocalConfig(t *testing.T) {
+	cfg := MustLoadByPath(filepath.Join("..", "..", "config", "local.yaml"))
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() local config cerror = %v", err)
+	}
+}
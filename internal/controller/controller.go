@@ -7,14 +7,51 @@ import (
 
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=Auth
 type Auth interface {
-	LoginUser(ctx context.Context, login string, password string, appID int32) (token string, err error)
+	LoginUser(ctx context.Context, login string, password string, appID int32) (tokens models.Tokens, err error)
+	Refresh(ctx context.Context, refreshToken string) (tokens models.Tokens, err error)
+	ValidateToken(ctx context.Context, token string) (models.TokenClaims, error)
+	Logout(ctx context.Context, token string, refreshToken string) error
+	ChangePassword(ctx context.Context, login string, appID int32, oldPassword string, newPassword string) error
+	RequestPasswordReset(ctx context.Context, login string, appID int32) error
+	ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, login string, appID int32) error
+	EnrollTOTP(ctx context.Context, token string) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, token string, code string) (recoveryCodes []string, err error)
+	VerifyMFA(ctx context.Context, mfaToken string, code string) (tokens models.Tokens, err error)
+	BeginWebAuthnRegistration(ctx context.Context, token string) (options []byte, sessionToken string, err error)
+	FinishWebAuthnRegistration(ctx context.Context, sessionToken string, response []byte) error
+	BeginWebAuthnLogin(ctx context.Context, login string, appID int32) (options []byte, sessionToken string, err error)
+	FinishWebAuthnLogin(ctx context.Context, sessionToken string, response []byte) (tokens models.Tokens, err error)
+	JWKS(ctx context.Context) ([]models.JWK, error)
 	RegisterNewUser(ctx context.Context, login string, password string, appid int32) (userid int64, err error)
-	CheckIsAdmin(ctx context.Context, userid int32, appID int32) (models.Admin, error)
+	CheckIsAdmin(ctx context.Context, userid int64, appID int32) (models.Admin, error)
+	CheckPermission(ctx context.Context, userID int64, appID int32, permission string) (bool, error)
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=AuthAdmin
 type AuthAdmin interface {
 	CreateAdmin(ctx context.Context, login string, lvl int32, key string, appid int32) (userid int64, err error)
-	DeleteAdmin(ctx context.Context, login string, key string) (res bool, err error)
-	AddApp(ctx context.Context, name, secret, key string) (userid int32, err error)
+	DeleteAdmin(ctx context.Context, login string, key string, appID int32) (res bool, err error)
+	AddApp(ctx context.Context, name, secret, alg, key string) (userid int32, err error)
+	RotateSigningKey(ctx context.Context, appID int32, key string) (kid string, err error)
+	RevokeAllForUser(ctx context.Context, userID int64, key string) error
+	UnlockAccount(ctx context.Context, login string, appID int32, key string) error
+	SetAppRequireVerified(ctx context.Context, appID int32, required bool, key string) error
+	SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string, key string) error
+	GrantAppAccess(ctx context.Context, userID int64, appID int32, key string) error
+	RevokeAppAccess(ctx context.Context, userID int64, appID int32, key string) error
+	CreateRole(ctx context.Context, appID int32, name string, permissions []string, key string) (int64, error)
+	ListRoles(ctx context.Context, appID int32, key string) ([]models.Role, error)
+	DeleteRole(ctx context.Context, appID int32, name string, key string) error
+	AssignRole(ctx context.Context, userID int64, appID int32, name string, key string) error
+	UnassignRole(ctx context.Context, userID int64, appID int32, name string, key string) error
+	ListApps(ctx context.Context, key string) ([]models.App, error)
+	GetApp(ctx context.Context, appID int32, key string) (models.App, error)
+	UpdateApp(ctx context.Context, appID int32, name string, key string) error
+	DisableApp(ctx context.Context, appID int32, disabled bool, key string) error
+	DeleteApp(ctx context.Context, appID int32, cascade bool, key string) error
+	RotateAppSecret(ctx context.Context, appID int32, key string) (secret string, err error)
+	GetAppSettings(ctx context.Context, appID int32, key string) (models.AppSettings, error)
+	UpdateAppSettings(ctx context.Context, appID int32, settings models.AppSettings, key string) error
 }
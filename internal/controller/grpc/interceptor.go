@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"strings"
+)
+
+// bearerPrefix схема заголовка authorization, в котором администратор передаёт свой access токен
+const bearerPrefix = "bearer "
+
+// ClientIPInterceptor кладёт IP клиента в контекст запроса для защиты от перебора паролей
+func ClientIPInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip := p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx = models.WithClientIP(ctx, ip)
+	}
+	return handler(ctx, req)
+}
+
+// BearerTokenInterceptor кладёт в контекст access токен из метаданных authorization, им администратор
+// приложения подтверждает права вместо мастер-ключа
+func BearerTokenInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			if token := parseBearer(values[0]); token != "" {
+				ctx = models.WithBearerToken(ctx, token)
+			}
+		}
+	}
+	return handler(ctx, req)
+}
+
+// parseBearer возвращает токен из значения "Bearer <token>" или пустую строку для другой схемы
+func parseBearer(value string) string {
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(value[len(bearerPrefix):])
+}
@@ -5,10 +5,15 @@ import (
 	"errors"
 	"github.com/MorZLE/auth/internal/controller"
 	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
 	authv1 "github.com/MorZLE/auth/internal/generate/grpc/gen/morzle.auth.v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"slices"
+	"time"
 )
 
 const (
@@ -34,15 +39,325 @@ func (s *serverAPI) Login(ctx context.Context, req *authv1.LoginRequest) (*authv
 		return nil, status.Error(codes.InvalidArgument, "data not exist")
 	}
 
-	token, err := s.auth.LoginUser(ctx, login, pswrd, numApp)
+	tokens, err := s.auth.LoginUser(ctx, login, pswrd, numApp)
 	if err != nil {
 		if errors.Is(err, cerror.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "login not found")
 		}
+		if errors.Is(err, cerror.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email not verified")
+		}
+		if errors.Is(err, cerror.ErrAppDisabled) {
+			return nil, status.Error(codes.FailedPrecondition, "app disabled")
+		}
+		if errors.Is(err, cerror.ErrLoginNotAllowed) {
+			return nil, status.Error(codes.FailedPrecondition, "login method not allowed")
+		}
+		if errors.Is(err, cerror.ErrMFARequired) {
+			return nil, status.Error(codes.FailedPrecondition, "mfa required")
+		}
+		var attemptsErr *cerror.TooManyAttemptsError
+		if errors.As(err, &attemptsErr) {
+			return nil, tooManyAttemptsStatus(attemptsErr)
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+
+	if tokens.MFAToken != "" {
+		return &authv1.LoginResponse{MfaRequired: true, MfaToken: tokens.MFAToken}, nil
+	}
+	if tokens.MFAEnrollToken != "" {
+		return &authv1.LoginResponse{MfaEnrollToken: tokens.MFAEnrollToken}, nil
+	}
+
+	return &authv1.LoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) Refresh(ctx context.Context, req *authv1.RefreshRequest) (*authv1.RefreshResponse, error) {
+	refreshToken := req.GetRefreshToken()
+
+	if refreshToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	tokens, err := s.auth.Refresh(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) || errors.Is(err, cerror.ErrTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		if errors.Is(err, cerror.ErrAppDisabled) {
+			return nil, status.Error(codes.FailedPrecondition, "app disabled")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+
+	return &authv1.RefreshResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
+	token := req.GetToken()
+
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	claims, err := s.auth.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+
+	return &authv1.ValidateTokenResponse{
+		UserId: claims.UserID,
+		Login:  claims.Login,
+		AppId:  claims.AppID,
+		Exp:    claims.ExpiresAt.Unix(),
+		Lvl:    claims.Lvl,
+		Roles:  claims.Roles,
+	}, nil
+}
+
+func (s *serverAPI) Logout(ctx context.Context, req *authv1.LogoutRequest) (*authv1.LogoutResponse, error) {
+	token := req.GetToken()
+
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.auth.Logout(ctx, token, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.LogoutResponse{Result: true}, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *authv1.ChangePasswordRequest) (*authv1.ChangePasswordResponse, error) {
+	login := req.GetLogin()
+	appID := req.GetAppId()
+	oldPassword := req.GetOldPassword()
+	newPassword := req.GetNewPassword()
+
+	if login == "" || appID == emptyValue || oldPassword == "" || newPassword == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.auth.ChangePassword(ctx, login, appID, oldPassword, newPassword)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "login not found")
+		}
+		var policyErr *cerror.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus(policyErr)
+		}
+		var attemptsErr *cerror.TooManyAttemptsError
+		if errors.As(err, &attemptsErr) {
+			return nil, tooManyAttemptsStatus(attemptsErr)
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.ChangePasswordResponse{Result: true}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *authv1.RequestPasswordResetRequest) (*authv1.RequestPasswordResetResponse, error) {
+	login := req.GetLogin()
+	appID := req.GetAppId()
+
+	if login == "" || appID == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.auth.RequestPasswordReset(ctx, login, appID); err != nil {
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.RequestPasswordResetResponse{Result: true}, nil
+}
+
+func (s *serverAPI) ConfirmPasswordReset(ctx context.Context, req *authv1.ConfirmPasswordResetRequest) (*authv1.ConfirmPasswordResetResponse, error) {
+	token := req.GetToken()
+	newPassword := req.GetNewPassword()
+
+	if token == "" || newPassword == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.auth.ConfirmPasswordReset(ctx, token, newPassword)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid reset token")
+		}
+		var policyErr *cerror.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus(policyErr)
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.ConfirmPasswordResetResponse{Result: true}, nil
+}
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	token := req.GetToken()
+
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.auth.VerifyEmail(ctx, token)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid verification token")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.VerifyEmailResponse{Result: true}, nil
+}
+
+func (s *serverAPI) ResendVerification(ctx context.Context, req *authv1.ResendVerificationRequest) (*authv1.ResendVerificationResponse, error) {
+	login := req.GetLogin()
+	appID := req.GetAppId()
+
+	if login == "" || appID == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.auth.ResendVerification(ctx, login, appID); err != nil {
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.ResendVerificationResponse{Result: true}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *authv1.EnrollTOTPRequest) (*authv1.EnrollTOTPResponse, error) {
+	token := req.GetToken()
+
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	secret, uri, err := s.auth.EnrollTOTP(ctx, token)
+	if err != nil {
+		return nil, mfaStatus(err)
+	}
+	return &authv1.EnrollTOTPResponse{Secret: secret, Uri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *authv1.ConfirmTOTPRequest) (*authv1.ConfirmTOTPResponse, error) {
+	token := req.GetToken()
+	code := req.GetCode()
+
+	if token == "" || code == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	recoveryCodes, err := s.auth.ConfirmTOTP(ctx, token, code)
+	if err != nil {
+		return nil, mfaStatus(err)
+	}
+	return &authv1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *authv1.VerifyMFARequest) (*authv1.VerifyMFAResponse, error) {
+	mfaToken := req.GetMfaToken()
+	code := req.GetCode()
+
+	if mfaToken == "" || code == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	tokens, err := s.auth.VerifyMFA(ctx, mfaToken, code)
+	if err != nil {
+		if errors.Is(err, cerror.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid mfa token")
+		}
+		return nil, mfaStatus(err)
+	}
+	return &authv1.VerifyMFAResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnRegistration(ctx context.Context, req *authv1.BeginWebAuthnRegistrationRequest) (*authv1.BeginWebAuthnRegistrationResponse, error) {
+	token := req.GetToken()
+
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	options, sessionToken, err := s.auth.BeginWebAuthnRegistration(ctx, token)
+	if err != nil {
+		return nil, webauthnStatus(err)
+	}
+	return &authv1.BeginWebAuthnRegistrationResponse{Options: string(options), SessionToken: sessionToken}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnRegistration(ctx context.Context, req *authv1.FinishWebAuthnRegistrationRequest) (*authv1.FinishWebAuthnRegistrationResponse, error) {
+	sessionToken := req.GetSessionToken()
+	credential := req.GetCredential()
+
+	if sessionToken == "" || credential == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.auth.FinishWebAuthnRegistration(ctx, sessionToken, []byte(credential)); err != nil {
+		return nil, webauthnStatus(err)
+	}
+	return &authv1.FinishWebAuthnRegistrationResponse{Result: true}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnLogin(ctx context.Context, req *authv1.BeginWebAuthnLoginRequest) (*authv1.BeginWebAuthnLoginResponse, error) {
+	login := req.GetLogin()
+	appID := req.GetAppId()
+
+	if login == "" || appID == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	options, sessionToken, err := s.auth.BeginWebAuthnLogin(ctx, login, appID)
+	if err != nil {
+		return nil, webauthnStatus(err)
+	}
+	return &authv1.BeginWebAuthnLoginResponse{Options: string(options), SessionToken: sessionToken}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnLogin(ctx context.Context, req *authv1.FinishWebAuthnLoginRequest) (*authv1.FinishWebAuthnLoginResponse, error) {
+	sessionToken := req.GetSessionToken()
+	credential := req.GetCredential()
+
+	if sessionToken == "" || credential == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	tokens, err := s.auth.FinishWebAuthnLogin(ctx, sessionToken, []byte(credential))
+	if err != nil {
+		return nil, webauthnStatus(err)
+	}
+	return &authv1.FinishWebAuthnLoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) GetJWKS(ctx context.Context, _ *authv1.GetJWKSRequest) (*authv1.GetJWKSResponse, error) {
+	keys, err := s.auth.JWKS(ctx)
+	if err != nil {
 		return nil, status.Error(codes.Internal, "internal cerror")
 	}
 
-	return &authv1.LoginResponse{Token: token}, nil
+	res := &authv1.GetJWKSResponse{Keys: make([]*authv1.JWK, 0, len(keys))}
+	for _, key := range keys {
+		res.Keys = append(res.Keys, &authv1.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+
+	return res, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, req *authv1.RegisterRequest) (*authv1.RegisterResponse, error) {
@@ -59,6 +374,16 @@ func (s *serverAPI) Register(ctx context.Context, req *authv1.RegisterRequest) (
 		if errors.Is(err, cerror.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, cerror.ErrRegistrationClosed) {
+			return nil, status.Error(codes.FailedPrecondition, "registration closed")
+		}
+		if errors.Is(err, cerror.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		var policyErr *cerror.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus(policyErr)
+		}
 		return nil, status.Error(codes.Internal, "internal cerror")
 	}
 
@@ -69,7 +394,7 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *authv1.IsAdminRequest) (*a
 
 	userID := req.GetUserId()
 	appID := req.GetAppId()
-	if userID == emptyValue || appID == emptyValue {
+	if userID == 0 || appID == emptyValue {
 		return nil, status.Error(codes.InvalidArgument, "userID empty")
 	}
 
@@ -87,6 +412,22 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *authv1.IsAdminRequest) (*a
 	}, nil
 }
 
+func (s *serverAPI) CheckPermission(ctx context.Context, req *authv1.CheckPermissionRequest) (*authv1.CheckPermissionResponse, error) {
+	userID := req.GetUserId()
+	appID := req.GetAppId()
+	permission := req.GetPermission()
+
+	if userID == 0 || appID == emptyValue || permission == "" {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	allowed, err := s.auth.CheckPermission(ctx, userID, appID, permission)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
 func (s *serverAPI) CreateAdmin(ctx context.Context, req *authv1.CreateAdminRequest) (*authv1.CreateAdminResponse, error) {
 	login := req.GetLogin()
 	lvl := req.GetLvl()
@@ -100,7 +441,7 @@ func (s *serverAPI) CreateAdmin(ctx context.Context, req *authv1.CreateAdminRequ
 	userid, err := s.authAdmin.CreateAdmin(ctx, login, lvl, key, appID)
 	if err != nil {
 		if errors.Is(err, cerror.ErrNotRights) {
-			return nil, status.Error(codes.Aborted, "not enough rights")
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
 		}
 		if errors.Is(err, cerror.ErrUserNotFound) {
 			return nil, status.Error(codes.NotFound, "user not found")
@@ -113,15 +454,16 @@ func (s *serverAPI) CreateAdmin(ctx context.Context, req *authv1.CreateAdminRequ
 func (s *serverAPI) DeleteAdmin(ctx context.Context, req *authv1.DeleteAdminRequest) (*authv1.DeleteAdminResponse, error) {
 	login := req.GetLogin()
 	key := req.GetKey()
+	appID := req.GetAppId()
 
-	if login == "" || key == "" {
+	if login == "" || !hasCredentials(ctx, key) || appID == emptyValue {
 		return nil, status.Error(codes.InvalidArgument, "data not exist")
 	}
 
-	res, err := s.authAdmin.DeleteAdmin(ctx, login, key)
+	res, err := s.authAdmin.DeleteAdmin(ctx, login, key, appID)
 	if err != nil {
 		if errors.Is(err, cerror.ErrNotRights) {
-			return nil, status.Error(codes.NotFound, "user not admin")
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
 		}
 		return nil, status.Error(codes.Internal, "internal cerror")
 	}
@@ -132,18 +474,560 @@ func (s *serverAPI) AddApp(ctx context.Context, req *authv1.AddAppRequest) (*aut
 	name := req.GetName()
 	secret := req.GetSecret()
 	key := req.GetKey()
+	alg := req.GetAlg()
 
-	if name == "" || secret == "" || key == "" {
+	if name == "" || secret == "" || !hasCredentials(ctx, key) {
 		return nil, status.Error(codes.InvalidArgument, "data not exist")
 	}
-	appID, err := s.authAdmin.AddApp(ctx, name, secret, key)
+	appID, err := s.authAdmin.AddApp(ctx, name, secret, alg, key)
 
 	if err != nil {
 		if errors.Is(err, cerror.ErrNotRights) {
-			return nil, status.Error(codes.NotFound, "user not admin")
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
+		}
+		if errors.Is(err, cerror.ErrUnsupportedAlg) {
+			return nil, status.Error(codes.InvalidArgument, "unsupported signing algorithm")
+		}
+		if errors.Is(err, cerror.ErrInvalidAppSecret) {
+			return nil, status.Error(codes.InvalidArgument, "app secret must not start with \"env1:\"")
+		}
+		if errors.Is(err, cerror.ErrAppExists) {
+			return nil, status.Error(codes.AlreadyExists, "app exists")
 		}
 		return nil, status.Error(codes.Internal, "internal cerror")
 	}
 	return &authv1.AddAppResponse{AppId: appID}, nil
 
 }
+
+func (s *serverAPI) RotateSigningKey(ctx context.Context, req *authv1.RotateSigningKeyRequest) (*authv1.RotateSigningKeyResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == 0 || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	kid, err := s.authAdmin.RotateSigningKey(ctx, appID, key)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNotRights) {
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
+		}
+		if errors.Is(err, cerror.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		if errors.Is(err, cerror.ErrUnsupportedAlg) {
+			return nil, status.Error(codes.FailedPrecondition, "app is not signed with managed keys")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.RotateSigningKeyResponse{Kid: kid}, nil
+}
+
+func (s *serverAPI) RevokeAllForUser(ctx context.Context, req *authv1.RevokeAllForUserRequest) (*authv1.RevokeAllForUserResponse, error) {
+	userID := req.GetUserId()
+	key := req.GetKey()
+
+	if userID == 0 || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.authAdmin.RevokeAllForUser(ctx, userID, key)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNotRights) {
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
+		}
+		if errors.Is(err, cerror.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.RevokeAllForUserResponse{Result: true}, nil
+}
+
+// passwordPolicyStatus возвращает InvalidArgument с нарушенными правилами в деталях BadRequest
+func passwordPolicyStatus(err *cerror.PasswordPolicyError) error {
+	st := status.New(codes.InvalidArgument, "password does not match policy")
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(err.Rules))
+	for _, rule := range err.Rules {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "password", Description: rule})
+	}
+
+	detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func (s *serverAPI) UnlockAccount(ctx context.Context, req *authv1.UnlockAccountRequest) (*authv1.UnlockAccountResponse, error) {
+	login := req.GetLogin()
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if login == "" || appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.authAdmin.UnlockAccount(ctx, login, appID, key)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNotRights) {
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.UnlockAccountResponse{Result: true}, nil
+}
+
+func (s *serverAPI) SetAppRequireVerified(ctx context.Context, req *authv1.SetAppRequireVerifiedRequest) (*authv1.SetAppRequireVerifiedResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	err := s.authAdmin.SetAppRequireVerified(ctx, appID, req.GetRequired(), key)
+	if err != nil {
+		if errors.Is(err, cerror.ErrNotRights) {
+			return nil, status.Error(codes.PermissionDenied, "invalid admin key")
+		}
+		if errors.Is(err, cerror.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal cerror")
+	}
+	return &authv1.SetAppRequireVerifiedResponse{Result: true}, nil
+}
+
+func (s *serverAPI) SetAppWebAuthn(ctx context.Context, req *authv1.SetAppWebAuthnRequest) (*authv1.SetAppWebAuthnResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	// пустой список origins при заданном rp_id отклоняет сервис как неверные настройки приложения
+	if err := s.authAdmin.SetAppWebAuthn(ctx, appID, req.GetRpId(), req.GetOrigins(), key); err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.SetAppWebAuthnResponse{Result: true}, nil
+}
+
+func (s *serverAPI) GrantAppAccess(ctx context.Context, req *authv1.GrantAppAccessRequest) (*authv1.GrantAppAccessResponse, error) {
+	userID := req.GetUserId()
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if userID == 0 || appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.GrantAppAccess(ctx, userID, appID, key); err != nil {
+		return nil, appAccessStatus(err)
+	}
+	return &authv1.GrantAppAccessResponse{Result: true}, nil
+}
+
+func (s *serverAPI) RevokeAppAccess(ctx context.Context, req *authv1.RevokeAppAccessRequest) (*authv1.RevokeAppAccessResponse, error) {
+	userID := req.GetUserId()
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if userID == 0 || appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.RevokeAppAccess(ctx, userID, appID, key); err != nil {
+		return nil, appAccessStatus(err)
+	}
+	return &authv1.RevokeAppAccessResponse{Result: true}, nil
+}
+
+func (s *serverAPI) CreateRole(ctx context.Context, req *authv1.CreateRoleRequest) (*authv1.CreateRoleResponse, error) {
+	appID := req.GetAppId()
+	name := req.GetName()
+	key := req.GetKey()
+
+	if appID == emptyValue || name == "" || !hasCredentials(ctx, key) || slices.Contains(req.GetPermissions(), "") {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	id, err := s.authAdmin.CreateRole(ctx, appID, name, req.GetPermissions(), key)
+	if err != nil {
+		return nil, roleStatus(err)
+	}
+	return &authv1.CreateRoleResponse{RoleId: id}, nil
+}
+
+func (s *serverAPI) ListRoles(ctx context.Context, req *authv1.ListRolesRequest) (*authv1.ListRolesResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	roles, err := s.authAdmin.ListRoles(ctx, appID, key)
+	if err != nil {
+		return nil, roleStatus(err)
+	}
+
+	res := make([]*authv1.Role, 0, len(roles))
+	for _, role := range roles {
+		res = append(res, &authv1.Role{Id: role.ID, Name: role.Name, Permissions: role.Permissions})
+	}
+	return &authv1.ListRolesResponse{Roles: res}, nil
+}
+
+func (s *serverAPI) DeleteRole(ctx context.Context, req *authv1.DeleteRoleRequest) (*authv1.DeleteRoleResponse, error) {
+	appID := req.GetAppId()
+	name := req.GetName()
+	key := req.GetKey()
+
+	if appID == emptyValue || name == "" || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.DeleteRole(ctx, appID, name, key); err != nil {
+		return nil, roleStatus(err)
+	}
+	return &authv1.DeleteRoleResponse{Result: true}, nil
+}
+
+func (s *serverAPI) AssignRole(ctx context.Context, req *authv1.AssignRoleRequest) (*authv1.AssignRoleResponse, error) {
+	userID := req.GetUserId()
+	appID := req.GetAppId()
+	name := req.GetName()
+	key := req.GetKey()
+
+	if userID == 0 || appID == emptyValue || name == "" || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.AssignRole(ctx, userID, appID, name, key); err != nil {
+		return nil, roleStatus(err)
+	}
+	return &authv1.AssignRoleResponse{Result: true}, nil
+}
+
+func (s *serverAPI) UnassignRole(ctx context.Context, req *authv1.UnassignRoleRequest) (*authv1.UnassignRoleResponse, error) {
+	userID := req.GetUserId()
+	appID := req.GetAppId()
+	name := req.GetName()
+	key := req.GetKey()
+
+	if userID == 0 || appID == emptyValue || name == "" || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.UnassignRole(ctx, userID, appID, name, key); err != nil {
+		return nil, roleStatus(err)
+	}
+	return &authv1.UnassignRoleResponse{Result: true}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *authv1.ListAppsRequest) (*authv1.ListAppsResponse, error) {
+	key := req.GetKey()
+
+	if !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	apps, err := s.authAdmin.ListApps(ctx, key)
+	if err != nil {
+		return nil, appStatus(err)
+	}
+
+	res := make([]*authv1.App, 0, len(apps))
+	for _, app := range apps {
+		res = append(res, toApp(app))
+	}
+	return &authv1.ListAppsResponse{Apps: res}, nil
+}
+
+func (s *serverAPI) GetApp(ctx context.Context, req *authv1.GetAppRequest) (*authv1.GetAppResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	app, err := s.authAdmin.GetApp(ctx, appID, key)
+	if err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.GetAppResponse{App: toApp(app)}, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *authv1.UpdateAppRequest) (*authv1.UpdateAppResponse, error) {
+	appID := req.GetAppId()
+	name := req.GetName()
+	key := req.GetKey()
+
+	if appID == emptyValue || name == "" || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.UpdateApp(ctx, appID, name, key); err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.UpdateAppResponse{Result: true}, nil
+}
+
+func (s *serverAPI) DisableApp(ctx context.Context, req *authv1.DisableAppRequest) (*authv1.DisableAppResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.DisableApp(ctx, appID, req.GetDisabled(), key); err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.DisableAppResponse{Result: true}, nil
+}
+
+func (s *serverAPI) DeleteApp(ctx context.Context, req *authv1.DeleteAppRequest) (*authv1.DeleteAppResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.DeleteApp(ctx, appID, req.GetCascade(), key); err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.DeleteAppResponse{Result: true}, nil
+}
+
+func (s *serverAPI) RotateAppSecret(ctx context.Context, req *authv1.RotateAppSecretRequest) (*authv1.RotateAppSecretResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	secret, err := s.authAdmin.RotateAppSecret(ctx, appID, key)
+	if err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.RotateAppSecretResponse{Secret: secret}, nil
+}
+
+func (s *serverAPI) GetAppSettings(ctx context.Context, req *authv1.GetAppSettingsRequest) (*authv1.GetAppSettingsResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	settings, err := s.authAdmin.GetAppSettings(ctx, appID, key)
+	if err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.GetAppSettingsResponse{Settings: toAppSettings(settings)}, nil
+}
+
+func (s *serverAPI) UpdateAppSettings(ctx context.Context, req *authv1.UpdateAppSettingsRequest) (*authv1.UpdateAppSettingsResponse, error) {
+	appID := req.GetAppId()
+	key := req.GetKey()
+
+	if appID == emptyValue || req.GetSettings() == nil || !hasCredentials(ctx, key) {
+		return nil, status.Error(codes.InvalidArgument, "data not exist")
+	}
+
+	if err := s.authAdmin.UpdateAppSettings(ctx, appID, fromAppSettings(req.GetSettings()), key); err != nil {
+		return nil, appStatus(err)
+	}
+	return &authv1.UpdateAppSettingsResponse{Result: true}, nil
+}
+
+// toAppSettings переводит настройки приложения в ответ gRPC, TTL в секундах
+func toAppSettings(settings models.AppSettings) *authv1.AppSettings {
+	return &authv1.AppSettings{
+		AccessTtl:          int64(settings.AccessTTL / time.Second),
+		RefreshTtl:         int64(settings.RefreshTTL / time.Second),
+		RegistrationClosed: settings.RegistrationClosed,
+		RequireMfa:         settings.RequireMFA,
+		LoginMethods:       settings.LoginMethods,
+		Claims:             settings.Claims,
+		PasswordPolicy:     toPasswordPolicy(settings.PasswordPolicy),
+	}
+}
+
+func fromAppSettings(settings *authv1.AppSettings) models.AppSettings {
+	return models.AppSettings{
+		AccessTTL:          time.Duration(settings.GetAccessTtl()) * time.Second,
+		RefreshTTL:         time.Duration(settings.GetRefreshTtl()) * time.Second,
+		RegistrationClosed: settings.GetRegistrationClosed(),
+		RequireMFA:         settings.GetRequireMfa(),
+		LoginMethods:       settings.GetLoginMethods(),
+		Claims:             settings.GetClaims(),
+		PasswordPolicy:     fromPasswordPolicy(settings.GetPasswordPolicy()),
+	}
+}
+
+// toPasswordPolicy переводит требования к паролю в ответ gRPC, nil остаётся незаданным
+func toPasswordPolicy(rules *models.PasswordRules) *authv1.PasswordPolicy {
+	if rules == nil {
+		return nil
+	}
+	return &authv1.PasswordPolicy{
+		MinLength:     int32(rules.MinLength),
+		MaxLength:     int32(rules.MaxLength),
+		RequireUpper:  rules.RequireUpper,
+		RequireLower:  rules.RequireLower,
+		RequireDigit:  rules.RequireDigit,
+		RequireSymbol: rules.RequireSymbol,
+		ForbidLogin:   rules.ForbidLogin,
+	}
+}
+
+func fromPasswordPolicy(policy *authv1.PasswordPolicy) *models.PasswordRules {
+	if policy == nil {
+		return nil
+	}
+	return &models.PasswordRules{
+		MinLength:     int(policy.GetMinLength()),
+		MaxLength:     int(policy.GetMaxLength()),
+		RequireUpper:  policy.GetRequireUpper(),
+		RequireLower:  policy.GetRequireLower(),
+		RequireDigit:  policy.GetRequireDigit(),
+		RequireSymbol: policy.GetRequireSymbol(),
+		ForbidLogin:   policy.GetForbidLogin(),
+	}
+}
+
+// toApp переводит приложение в ответ gRPC. Секрет в ответ не попадает
+func toApp(app models.App) *authv1.App {
+	return &authv1.App{
+		Id:              int32(app.ID),
+		Name:            app.Name,
+		Alg:             app.Alg,
+		RequireVerified: app.RequireVerified,
+		RpId:            app.RPID,
+		RpOrigins:       app.RPOrigins,
+		Disabled:        app.Disabled,
+	}
+}
+
+// hasCredentials сообщает, передал ли администратор мастер-ключ или свой access токен
+func hasCredentials(ctx context.Context, key string) bool {
+	return key != "" || models.BearerToken(ctx) != ""
+}
+
+// roleStatus переводит ошибки управления ролями в коды gRPC
+func roleStatus(err error) error {
+	switch {
+	case errors.Is(err, cerror.ErrNotRights):
+		return status.Error(codes.PermissionDenied, "invalid admin key")
+	case errors.Is(err, cerror.ErrRoleExists):
+		return status.Error(codes.AlreadyExists, "role exists")
+	case errors.Is(err, cerror.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, cerror.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, cerror.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	}
+	return status.Error(codes.Internal, "internal cerror")
+}
+
+// appStatus переводит ошибки управления приложениями в коды gRPC
+func appStatus(err error) error {
+	switch {
+	case errors.Is(err, cerror.ErrNotRights):
+		return status.Error(codes.PermissionDenied, "invalid admin key")
+	case errors.Is(err, cerror.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, cerror.ErrAppExists):
+		return status.Error(codes.AlreadyExists, "app exists")
+	case errors.Is(err, cerror.ErrAppHasUsers):
+		return status.Error(codes.FailedPrecondition, "app has users")
+	case errors.Is(err, cerror.ErrInvalidAppSettings):
+		return status.Error(codes.InvalidArgument, "invalid app settings")
+	case errors.Is(err, cerror.ErrMFANotConfigured):
+		return status.Error(codes.FailedPrecondition, "mfa is not configured")
+	}
+	return status.Error(codes.Internal, "internal cerror")
+}
+
+// appAccessStatus переводит ошибки выдачи и отзыва доступа к приложению в коды gRPC
+func appAccessStatus(err error) error {
+	switch {
+	case errors.Is(err, cerror.ErrNotRights):
+		return status.Error(codes.PermissionDenied, "invalid admin key")
+	case errors.Is(err, cerror.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, cerror.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, cerror.ErrUserExists):
+		return status.Error(codes.AlreadyExists, "login already taken in app")
+	}
+	return status.Error(codes.Internal, "internal cerror")
+}
+
+// tooManyAttemptsStatus возвращает ResourceExhausted с временем до следующей попытки в деталях RetryInfo
+func tooManyAttemptsStatus(err *cerror.TooManyAttemptsError) error {
+	st := status.New(codes.ResourceExhausted, "too many login attempts")
+
+	detailed, detailsErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(err.RetryAfter)})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// mfaStatus переводит ошибки второго фактора в коды gRPC
+func mfaStatus(err error) error {
+	switch {
+	case errors.Is(err, cerror.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	case errors.Is(err, cerror.ErrInvalidMFACode):
+		return status.Error(codes.Unauthenticated, "invalid mfa code")
+	case errors.Is(err, cerror.ErrMFAEnabled):
+		return status.Error(codes.AlreadyExists, "mfa already enabled")
+	case errors.Is(err, cerror.ErrMFANotEnrolled):
+		return status.Error(codes.FailedPrecondition, "mfa not enrolled")
+	case errors.Is(err, cerror.ErrMFANotConfigured):
+		return status.Error(codes.FailedPrecondition, "mfa is not configured")
+	case errors.Is(err, cerror.ErrAppDisabled):
+		return status.Error(codes.FailedPrecondition, "app disabled")
+	case errors.Is(err, cerror.ErrLoginNotAllowed):
+		return status.Error(codes.FailedPrecondition, "login method not allowed")
+	case errors.Is(err, cerror.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, "email not verified")
+	}
+	return status.Error(codes.Internal, "internal cerror")
+}
+
+// webauthnStatus переводит ошибки церемоний WebAuthn в коды gRPC
+func webauthnStatus(err error) error {
+	switch {
+	case errors.Is(err, cerror.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	case errors.Is(err, cerror.ErrWebAuthnFailed):
+		return status.Error(codes.Unauthenticated, "webauthn verification failed")
+	case errors.Is(err, cerror.ErrInvalidCredentials):
+		return status.Error(codes.InvalidArgument, "login not found")
+	case errors.Is(err, cerror.ErrWebAuthnDisabled):
+		return status.Error(codes.FailedPrecondition, "webauthn is not configured for app")
+	case errors.Is(err, cerror.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, "email not verified")
+	case errors.Is(err, cerror.ErrAppDisabled):
+		return status.Error(codes.FailedPrecondition, "app disabled")
+	case errors.Is(err, cerror.ErrLoginNotAllowed):
+		return status.Error(codes.FailedPrecondition, "login method not allowed")
+	case errors.Is(err, cerror.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+	return status.Error(codes.Internal, "internal cerror")
+}
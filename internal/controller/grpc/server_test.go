@@ -7,10 +7,13 @@ import (
 	"github.com/MorZLE/auth/internal/domain/cerror"
 	"github.com/MorZLE/auth/internal/domain/models"
 	authv1 "github.com/MorZLE/auth/internal/generate/grpc/gen/morzle.auth.v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_serverAPI_Login(t *testing.T) {
@@ -38,10 +41,11 @@ func Test_serverAPI_Login(t *testing.T) {
 				},
 			},
 			mck: func(m *mocks.Auth) {
-				m.On("LoginUser", context.Background(), "test", "test", int32(1)).Return("token", nil)
+				m.On("LoginUser", context.Background(), "test", "test", int32(1)).Return(models.Tokens{AccessToken: "token", RefreshToken: "refresh"}, nil)
 			},
 			want: &authv1.LoginResponse{
-				Token: "token",
+				Token:        "token",
+				RefreshToken: "refresh",
 			},
 			wantErr: nil,
 		},
@@ -56,10 +60,11 @@ func Test_serverAPI_Login(t *testing.T) {
 				},
 			},
 			mck: func(m *mocks.Auth) {
-				m.On("LoginUser", context.Background(), "12edsc231df", "test", int32(1)).Return("q3egersthg435h4wh5tjhr67ksazrtjnh54y", nil)
+				m.On("LoginUser", context.Background(), "12edsc231df", "test", int32(1)).Return(models.Tokens{AccessToken: "q3egersthg435h4wh5tjhr67ksazrtjnh54y", RefreshToken: "awfkjh1iu3hr"}, nil)
 			},
 			want: &authv1.LoginResponse{
-				Token: "q3egersthg435h4wh5tjhr67ksazrtjnh54y",
+				Token:        "q3egersthg435h4wh5tjhr67ksazrtjnh54y",
+				RefreshToken: "awfkjh1iu3hr",
 			},
 			wantErr: nil,
 		},
@@ -130,7 +135,7 @@ func Test_serverAPI_Login(t *testing.T) {
 				},
 			},
 			mck: func(m *mocks.Auth) {
-				m.On("LoginUser", context.Background(), "teset", "teset", int32(1)).Return("", cerror.ErrInvalidCredentials)
+				m.On("LoginUser", context.Background(), "teset", "teset", int32(1)).Return(models.Tokens{}, cerror.ErrInvalidCredentials)
 			},
 			want:    nil,
 			wantErr: status.Error(codes.InvalidArgument, "login not found"),
@@ -146,7 +151,7 @@ func Test_serverAPI_Login(t *testing.T) {
 				},
 			},
 			mck: func(m *mocks.Auth) {
-				m.On("LoginUser", context.Background(), "teset", "teset", int32(1)).Return("", errors.ErrUnsupported)
+				m.On("LoginUser", context.Background(), "teset", "teset", int32(1)).Return(models.Tokens{}, errors.ErrUnsupported)
 			},
 			want:    nil,
 			wantErr: status.Error(codes.Internal, "internal cerror"),
@@ -171,6 +176,207 @@ func Test_serverAPI_Login(t *testing.T) {
 	}
 }
 
+func Test_serverAPI_Refresh(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.RefreshRequest
+		mck     mck
+		want    *authv1.RefreshResponse
+		wantErr error
+	}{
+		{
+			name: "positive_1",
+			req:  &authv1.RefreshRequest{RefreshToken: "refresh"},
+			mck: func(m *mocks.Auth) {
+				m.On("Refresh", context.Background(), "refresh").
+					Return(models.Tokens{AccessToken: "token", RefreshToken: "refresh_2"}, nil)
+			},
+			want: &authv1.RefreshResponse{
+				Token:        "token",
+				RefreshToken: "refresh_2",
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.RefreshRequest{RefreshToken: ""},
+			mck:     func(m *mocks.Auth) {},
+			want:    nil,
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.RefreshRequest{RefreshToken: "refresh"},
+			mck: func(m *mocks.Auth) {
+				m.On("Refresh", context.Background(), "refresh").Return(models.Tokens{}, cerror.ErrInvalidToken)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Unauthenticated, "invalid refresh token"),
+		},
+		{
+			name: "reused_token",
+			req:  &authv1.RefreshRequest{RefreshToken: "refresh"},
+			mck: func(m *mocks.Auth) {
+				m.On("Refresh", context.Background(), "refresh").Return(models.Tokens{}, cerror.ErrTokenReused)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Unauthenticated, "invalid refresh token"),
+		},
+		{
+			name: "internal_error",
+			req:  &authv1.RefreshRequest{RefreshToken: "refresh"},
+			mck: func(m *mocks.Auth) {
+				m.On("Refresh", context.Background(), "refresh").Return(models.Tokens{}, errors.ErrUnsupported)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Internal, "internal cerror"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.Refresh(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Refresh() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Refresh() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_ValidateToken(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	exp := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		req     *authv1.ValidateTokenRequest
+		mck     mck
+		want    *authv1.ValidateTokenResponse
+		wantErr error
+	}{
+		{
+			name: "positive_1",
+			req:  &authv1.ValidateTokenRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("ValidateToken", context.Background(), "token").
+					Return(models.TokenClaims{UserID: 1, Login: "test", AppID: 2, ExpiresAt: exp, Lvl: 3}, nil)
+			},
+			want: &authv1.ValidateTokenResponse{
+				UserId: 1,
+				Login:  "test",
+				AppId:  2,
+				Exp:    exp.Unix(),
+				Lvl:    3,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.ValidateTokenRequest{Token: ""},
+			mck:     func(m *mocks.Auth) {},
+			want:    nil,
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.ValidateTokenRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("ValidateToken", context.Background(), "token").Return(models.TokenClaims{}, cerror.ErrInvalidToken)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Unauthenticated, "invalid token"),
+		},
+		{
+			name: "internal_error",
+			req:  &authv1.ValidateTokenRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("ValidateToken", context.Background(), "token").Return(models.TokenClaims{}, errors.ErrUnsupported)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Internal, "internal cerror"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.ValidateToken(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateToken() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_GetJWKS(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		mck     mck
+		want    *authv1.GetJWKSResponse
+		wantErr error
+	}{
+		{
+			name: "positive_1",
+			mck: func(m *mocks.Auth) {
+				m.On("JWKS", context.Background()).Return([]models.JWK{
+					{Kty: "RSA", Kid: "kid_1", Use: "sig", Alg: "RS256", N: "n", E: "AQAB"},
+					{Kty: "OKP", Kid: "kid_2", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"},
+				}, nil)
+			},
+			want: &authv1.GetJWKSResponse{Keys: []*authv1.JWK{
+				{Kty: "RSA", Kid: "kid_1", Use: "sig", Alg: "RS256", N: "n", E: "AQAB"},
+				{Kty: "OKP", Kid: "kid_2", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"},
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "internal_error",
+			mck: func(m *mocks.Auth) {
+				m.On("JWKS", context.Background()).Return(nil, errors.ErrUnsupported)
+			},
+			want:    nil,
+			wantErr: status.Error(codes.Internal, "internal cerror"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.GetJWKS(context.Background(), &authv1.GetJWKSRequest{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetJWKS() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetJWKS() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_serverAPI_Register(t *testing.T) {
 
 	type mck func(m *mocks.Auth)
@@ -307,6 +513,34 @@ func Test_serverAPI_Register(t *testing.T) {
 	}
 }
 
+func Test_serverAPI_Register_PasswordPolicy(t *testing.T) {
+	service := mocks.NewAuth(t)
+	service.On("RegisterNewUser", context.Background(), "login", "1", int32(1)).
+		Return(int64(0), &cerror.PasswordPolicyError{Rules: []string{"min_length", "require_digit"}})
+
+	s := &serverAPI{
+		auth: service,
+	}
+	_, err := s.Register(context.Background(), &authv1.RegisterRequest{Login: "login", Password: "1", AppId: 1})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		t.Fatalf("Register() cerror = %v, want InvalidArgument", err)
+	}
+
+	var rules []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				rules = append(rules, v.GetDescription())
+			}
+		}
+	}
+	if want := []string{"min_length", "require_digit"}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("Register() violations = %v, want %v", rules, want)
+	}
+}
+
 func Test_serverAPI_IsAdmin(t *testing.T) {
 	type mck func(m *mocks.Auth)
 	type args struct {
@@ -322,7 +556,7 @@ func Test_serverAPI_IsAdmin(t *testing.T) {
 		{
 			name: "positive_1",
 			mck: func(m *mocks.Auth) {
-				m.On("CheckIsAdmin", context.Background(), int32(1), int32(1)).Return(models.Admin{Lvl: 1}, nil)
+				m.On("CheckIsAdmin", context.Background(), int64(1), int32(1)).Return(models.Admin{Lvl: 1}, nil)
 			},
 			args: args{
 				req: &authv1.IsAdminRequest{
@@ -339,7 +573,7 @@ func Test_serverAPI_IsAdmin(t *testing.T) {
 		{
 			name: "positive_2",
 			mck: func(m *mocks.Auth) {
-				m.On("CheckIsAdmin", context.Background(), int32(2), int32(2)).Return(models.Admin{Lvl: 2}, nil)
+				m.On("CheckIsAdmin", context.Background(), int64(2), int32(2)).Return(models.Admin{Lvl: 2}, nil)
 			},
 			args: args{
 				req: &authv1.IsAdminRequest{
@@ -387,7 +621,7 @@ func Test_serverAPI_IsAdmin(t *testing.T) {
 				},
 			},
 			mck: func(m *mocks.Auth) {
-				m.On("CheckIsAdmin", context.Background(), int32(6), int32(3)).Return(models.Admin{}, cerror.ErrInvalidCredentials)
+				m.On("CheckIsAdmin", context.Background(), int64(6), int32(3)).Return(models.Admin{}, cerror.ErrInvalidCredentials)
 			},
 			want:    nil,
 			wantErr: status.Error(codes.NotFound, "user not found"),
@@ -515,7 +749,7 @@ func Test_serverAPI_CreateAdmin(t *testing.T) {
 				},
 			},
 			want:    nil,
-			wantErr: status.Error(codes.Aborted, "not enough rights"),
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
 		},
 		{
 			name: "internal_error",
@@ -568,12 +802,13 @@ func Test_serverAPI_DeleteAdmin(t *testing.T) {
 		{
 			name: "positive_1",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("DeleteAdmin", context.Background(), "sefsef", "wqrqwre").Return(true, nil)
+				m.On("DeleteAdmin", context.Background(), "sefsef", "wqrqwre", int32(1)).Return(true, nil)
 			},
 			args: args{
 				req: &authv1.DeleteAdminRequest{
 					Login: "sefsef",
 					Key:   "wqrqwre",
+					AppId: 1,
 				},
 			},
 			want: &authv1.DeleteAdminResponse{
@@ -583,12 +818,13 @@ func Test_serverAPI_DeleteAdmin(t *testing.T) {
 		{
 			name: "positive_2",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("DeleteAdmin", context.Background(), "sesfsgdb43g", "argearg").Return(true, nil)
+				m.On("DeleteAdmin", context.Background(), "sesfsgdb43g", "argearg", int32(1)).Return(true, nil)
 			},
 			args: args{
 				req: &authv1.DeleteAdminRequest{
 					Login: "sesfsgdb43g",
 					Key:   "argearg",
+					AppId: 1,
 				},
 			},
 			want: &authv1.DeleteAdminResponse{
@@ -602,6 +838,19 @@ func Test_serverAPI_DeleteAdmin(t *testing.T) {
 				req: &authv1.DeleteAdminRequest{
 					Login: "",
 					Key:   "argearg",
+					AppId: 1,
+				},
+			},
+			want:    nil,
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "empty app_id",
+			mck:  func(m *mocks.AuthAdmin) {},
+			args: args{
+				req: &authv1.DeleteAdminRequest{
+					Login: "sefsef",
+					Key:   "argearg",
 				},
 			},
 			want:    nil,
@@ -610,26 +859,28 @@ func Test_serverAPI_DeleteAdmin(t *testing.T) {
 		{
 			name: "invalid key",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("DeleteAdmin", context.Background(), "awdvzvwe", "argearg").Return(false, cerror.ErrNotRights)
+				m.On("DeleteAdmin", context.Background(), "awdvzvwe", "argearg", int32(1)).Return(false, cerror.ErrNotRights)
 			},
 			args: args{
 				req: &authv1.DeleteAdminRequest{
 					Login: "awdvzvwe",
 					Key:   "argearg",
+					AppId: 1,
 				},
 			},
 			want:    nil,
-			wantErr: status.Error(codes.NotFound, "user not admin"),
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
 		},
 		{
 			name: "internal cerror",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("DeleteAdmin", context.Background(), "awdvzvwe", "argearg").Return(false, errors.ErrUnsupported)
+				m.On("DeleteAdmin", context.Background(), "awdvzvwe", "argearg", int32(1)).Return(false, errors.ErrUnsupported)
 			},
 			args: args{
 				req: &authv1.DeleteAdminRequest{
 					Login: "awdvzvwe",
 					Key:   "argearg",
+					AppId: 1,
 				},
 			},
 			want:    nil,
@@ -671,7 +922,7 @@ func Test_serverAPI_AddApp(t *testing.T) {
 		{
 			name: "positive_1",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "sefsfe").Return(int32(1), nil)
+				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "", "sefsfe").Return(int32(1), nil)
 			},
 			args: args{
 				req: &authv1.AddAppRequest{
@@ -687,7 +938,7 @@ func Test_serverAPI_AddApp(t *testing.T) {
 		{
 			name: "positive_2",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("AddApp", context.Background(), "saZGasrgsd", "sdebdzbf", "sefsfe").Return(int32(1), nil)
+				m.On("AddApp", context.Background(), "saZGasrgsd", "sdebdzbf", "", "sefsfe").Return(int32(1), nil)
 			},
 			args: args{
 				req: &authv1.AddAppRequest{
@@ -729,7 +980,7 @@ func Test_serverAPI_AddApp(t *testing.T) {
 		{
 			name: "negative key",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "sefsfe").Return(int32(0), cerror.ErrNotRights)
+				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "", "sefsfe").Return(int32(0), cerror.ErrNotRights)
 			},
 			args: args{
 				req: &authv1.AddAppRequest{
@@ -739,12 +990,12 @@ func Test_serverAPI_AddApp(t *testing.T) {
 				},
 			},
 			want:    nil,
-			wantErr: status.Error(codes.NotFound, "user not admin"),
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
 		},
 		{
 			name: "internal cerror",
 			mck: func(m *mocks.AuthAdmin) {
-				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "sefsfe").Return(int32(0), errors.New("internal cerror"))
+				m.On("AddApp", context.Background(), "sefsef", "wqrqwre", "", "sefsfe").Return(int32(0), errors.New("internal cerror"))
 			},
 			args: args{
 				req: &authv1.AddAppRequest{
@@ -756,6 +1007,21 @@ func Test_serverAPI_AddApp(t *testing.T) {
 			want:    nil,
 			wantErr: status.Error(codes.Internal, "internal cerror"),
 		},
+		{
+			name: "reserved secret prefix",
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("AddApp", context.Background(), "sefsef", "env1:wqrqwre", "", "sefsfe").Return(int32(0), cerror.ErrInvalidAppSecret)
+			},
+			args: args{
+				req: &authv1.AddAppRequest{
+					Name:   "sefsef",
+					Secret: "env1:wqrqwre",
+					Key:    "sefsfe",
+				},
+			},
+			want:    nil,
+			wantErr: status.Error(codes.InvalidArgument, "app secret must not start with \"env1:\""),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -776,3 +1042,1354 @@ func Test_serverAPI_AddApp(t *testing.T) {
 		})
 	}
 }
+
+func Test_serverAPI_RotateSigningKey(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.RotateSigningKeyRequest
+		mck     mck
+		want    *authv1.RotateSigningKeyResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RotateSigningKey", context.Background(), int32(1), "sefsfe").Return("kid_2", nil)
+			},
+			req:  &authv1.RotateSigningKeyRequest{AppId: 1, Key: "sefsfe"},
+			want: &authv1.RotateSigningKeyResponse{Kid: "kid_2"},
+		},
+		{
+			name:    "empty key",
+			mck:     func(m *mocks.AuthAdmin) {},
+			req:     &authv1.RotateSigningKeyRequest{AppId: 1},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "negative key",
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RotateSigningKey", context.Background(), int32(1), "sefsfe").Return("", cerror.ErrNotRights)
+			},
+			req:     &authv1.RotateSigningKeyRequest{AppId: 1, Key: "sefsfe"},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+		{
+			name: "app not found",
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RotateSigningKey", context.Background(), int32(2), "sefsfe").Return("", cerror.ErrAppNotFound)
+			},
+			req:     &authv1.RotateSigningKeyRequest{AppId: 2, Key: "sefsfe"},
+			wantErr: status.Error(codes.NotFound, "app not found"),
+		},
+		{
+			name: "hs256 app",
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RotateSigningKey", context.Background(), int32(3), "sefsfe").Return("", cerror.ErrUnsupportedAlg)
+			},
+			req:     &authv1.RotateSigningKeyRequest{AppId: 3, Key: "sefsfe"},
+			wantErr: status.Error(codes.FailedPrecondition, "app is not signed with managed keys"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.RotateSigningKey(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RotateSigningKey() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RotateSigningKey() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_Logout(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.LogoutRequest
+		mck     mck
+		want    *authv1.LogoutResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.LogoutRequest{Token: "token", RefreshToken: "refresh"},
+			mck: func(m *mocks.Auth) {
+				m.On("Logout", context.Background(), "token", "refresh").Return(nil)
+			},
+			want: &authv1.LogoutResponse{Result: true},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.LogoutRequest{},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.LogoutRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("Logout", context.Background(), "token", "").Return(cerror.ErrInvalidToken)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid token"),
+		},
+		{
+			name: "internal_error",
+			req:  &authv1.LogoutRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("Logout", context.Background(), "token", "").Return(errors.ErrUnsupported)
+			},
+			wantErr: status.Error(codes.Internal, "internal cerror"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.Logout(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Logout() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Logout() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_RevokeAllForUser(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.RevokeAllForUserRequest
+		mck     mck
+		want    *authv1.RevokeAllForUserResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.RevokeAllForUserRequest{UserId: 7, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RevokeAllForUser", context.Background(), int64(7), "sefsfe").Return(nil)
+			},
+			want: &authv1.RevokeAllForUserResponse{Result: true},
+		},
+		{
+			name:    "empty user",
+			req:     &authv1.RevokeAllForUserRequest{Key: "sefsfe"},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "negative key",
+			req:  &authv1.RevokeAllForUserRequest{UserId: 7, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RevokeAllForUser", context.Background(), int64(7), "sefsfe").Return(cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+		{
+			name: "user not found",
+			req:  &authv1.RevokeAllForUserRequest{UserId: 8, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RevokeAllForUser", context.Background(), int64(8), "sefsfe").Return(cerror.ErrUserNotFound)
+			},
+			wantErr: status.Error(codes.NotFound, "user not found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.RevokeAllForUser(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RevokeAllForUser() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RevokeAllForUser() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_Login_TooManyAttempts(t *testing.T) {
+	service := mocks.NewAuth(t)
+	service.On("LoginUser", context.Background(), "login", "password", int32(1)).
+		Return(models.Tokens{}, &cerror.TooManyAttemptsError{RetryAfter: 90 * time.Second})
+
+	s := &serverAPI{
+		auth: service,
+	}
+	_, err := s.Login(context.Background(), &authv1.LoginRequest{Login: "login", Password: "password", AppId: 1})
+
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Login() cerror = %v, want ResourceExhausted", err)
+	}
+
+	var retry time.Duration
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = info.GetRetryDelay().AsDuration()
+		}
+	}
+	if retry != 90*time.Second {
+		t.Errorf("Login() retry delay = %v, want 90s", retry)
+	}
+}
+
+func Test_serverAPI_UnlockAccount(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.UnlockAccountRequest
+		mck     mck
+		want    *authv1.UnlockAccountResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.UnlockAccountRequest{Login: "login", AppId: 1, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("UnlockAccount", context.Background(), "login", int32(1), "sefsfe").Return(nil)
+			},
+			want: &authv1.UnlockAccountResponse{Result: true},
+		},
+		{
+			name:    "empty login",
+			req:     &authv1.UnlockAccountRequest{AppId: 1, Key: "sefsfe"},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "negative key",
+			req:  &authv1.UnlockAccountRequest{Login: "login", AppId: 1, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("UnlockAccount", context.Background(), "login", int32(1), "sefsfe").Return(cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.UnlockAccount(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UnlockAccount() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnlockAccount() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_ChangePassword(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name     string
+		req      *authv1.ChangePasswordRequest
+		mck      mck
+		want     *authv1.ChangePasswordResponse
+		wantCode codes.Code
+	}{
+		{
+			name: "positive",
+			req:  &authv1.ChangePasswordRequest{Login: "test", AppId: 1, OldPassword: "old", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ChangePassword", context.Background(), "test", int32(1), "old", "new").Return(nil)
+			},
+			want:     &authv1.ChangePasswordResponse{Result: true},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "empty_password",
+			req:      &authv1.ChangePasswordRequest{Login: "test", AppId: 1, OldPassword: "old"},
+			mck:      func(m *mocks.Auth) {},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "invalid_credentials",
+			req:  &authv1.ChangePasswordRequest{Login: "test", AppId: 1, OldPassword: "old", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ChangePassword", context.Background(), "test", int32(1), "old", "new").Return(cerror.ErrInvalidCredentials)
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "weak_password",
+			req:  &authv1.ChangePasswordRequest{Login: "test", AppId: 1, OldPassword: "old", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ChangePassword", context.Background(), "test", int32(1), "old", "new").
+					Return(&cerror.PasswordPolicyError{Rules: []string{"min_length"}})
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "too_many_attempts",
+			req:  &authv1.ChangePasswordRequest{Login: "test", AppId: 1, OldPassword: "old", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ChangePassword", context.Background(), "test", int32(1), "old", "new").
+					Return(&cerror.TooManyAttemptsError{RetryAfter: time.Minute})
+			},
+			wantCode: codes.ResourceExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.ChangePassword(context.Background(), tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("ChangePassword() cerror = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangePassword() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_RequestPasswordReset(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("RequestPasswordReset", context.Background(), "test", int32(1)).Return(nil).Once()
+	s := &serverAPI{
+		auth: serAuth,
+	}
+
+	got, err := s.RequestPasswordReset(context.Background(), &authv1.RequestPasswordResetRequest{Login: "test", AppId: 1})
+	if err != nil || !got.GetResult() {
+		t.Errorf("RequestPasswordReset() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.RequestPasswordReset(context.Background(), &authv1.RequestPasswordResetRequest{Login: "test"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("RequestPasswordReset() cerror = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func Test_serverAPI_ConfirmPasswordReset(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.ConfirmPasswordResetRequest
+		mck     mck
+		want    *authv1.ConfirmPasswordResetResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.ConfirmPasswordResetRequest{Token: "token", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmPasswordReset", context.Background(), "token", "new").Return(nil)
+			},
+			want: &authv1.ConfirmPasswordResetResponse{Result: true},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.ConfirmPasswordResetRequest{NewPassword: "new"},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.ConfirmPasswordResetRequest{Token: "token", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmPasswordReset", context.Background(), "token", "new").Return(cerror.ErrInvalidToken)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid reset token"),
+		},
+		{
+			name: "internal_error",
+			req:  &authv1.ConfirmPasswordResetRequest{Token: "token", NewPassword: "new"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmPasswordReset", context.Background(), "token", "new").Return(errors.ErrUnsupported)
+			},
+			wantErr: status.Error(codes.Internal, "internal cerror"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.ConfirmPasswordReset(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConfirmPasswordReset() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfirmPasswordReset() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_Login_EmailNotVerified(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(1)).Return(models.Tokens{}, cerror.ErrEmailNotVerified)
+	s := &serverAPI{
+		auth: serAuth,
+	}
+
+	_, err := s.Login(context.Background(), &authv1.LoginRequest{Login: "test", Password: "password", AppId: 1})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Login() cerror = %v, want %v", err, codes.FailedPrecondition)
+	}
+}
+
+func Test_serverAPI_Login_AppDisabled(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(1)).Return(models.Tokens{}, cerror.ErrAppDisabled)
+	s := &serverAPI{
+		auth: serAuth,
+	}
+
+	_, err := s.Login(context.Background(), &authv1.LoginRequest{Login: "test", Password: "password", AppId: 1})
+	if !errors.Is(err, status.Error(codes.FailedPrecondition, "app disabled")) {
+		t.Errorf("Login() cerror = %v, want app disabled", err)
+	}
+}
+
+func Test_serverAPI_Login_MFAEnroll(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(1)).Return(models.Tokens{MFAEnrollToken: "enroll"}, nil)
+	s := &serverAPI{
+		auth: serAuth,
+	}
+
+	got, err := s.Login(context.Background(), &authv1.LoginRequest{Login: "test", Password: "password", AppId: 1})
+	if err != nil {
+		t.Fatalf("Login() cerror = %v", err)
+	}
+	if got.GetMfaEnrollToken() != "enroll" || got.GetToken() != "" || got.GetMfaRequired() {
+		t.Errorf("Login() got = %v, want only mfa enroll token", got)
+	}
+}
+
+func Test_serverAPI_AppSettingsErrors(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(1)).Return(models.Tokens{}, cerror.ErrLoginNotAllowed)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(2)).Return(models.Tokens{}, cerror.ErrMFARequired)
+	serAuth.On("RegisterNewUser", context.Background(), "test", "password", int32(1)).Return(int64(0), cerror.ErrRegistrationClosed)
+	s := &serverAPI{
+		auth: serAuth,
+	}
+	ctx := context.Background()
+
+	_, err := s.Login(ctx, &authv1.LoginRequest{Login: "test", Password: "password", AppId: 1})
+	if !errors.Is(err, status.Error(codes.FailedPrecondition, "login method not allowed")) {
+		t.Errorf("Login() cerror = %v, want login method not allowed", err)
+	}
+	_, err = s.Login(ctx, &authv1.LoginRequest{Login: "test", Password: "password", AppId: 2})
+	if !errors.Is(err, status.Error(codes.FailedPrecondition, "mfa required")) {
+		t.Errorf("Login() cerror = %v, want mfa required", err)
+	}
+	_, err = s.Register(ctx, &authv1.RegisterRequest{Login: "test", Password: "password", AppId: 1})
+	if !errors.Is(err, status.Error(codes.FailedPrecondition, "registration closed")) {
+		t.Errorf("Register() cerror = %v, want registration closed", err)
+	}
+}
+
+func Test_serverAPI_VerifyEmail(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.VerifyEmailRequest
+		mck     mck
+		want    *authv1.VerifyEmailResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.VerifyEmailRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyEmail", context.Background(), "token").Return(nil)
+			},
+			want: &authv1.VerifyEmailResponse{Result: true},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.VerifyEmailRequest{},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.VerifyEmailRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyEmail", context.Background(), "token").Return(cerror.ErrInvalidToken)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid verification token"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.VerifyEmail(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyEmail() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyEmail() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_SetAppRequireVerified(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.SetAppRequireVerifiedRequest
+		mck     mck
+		want    *authv1.SetAppRequireVerifiedResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.SetAppRequireVerifiedRequest{AppId: 1, Required: true, Key: "key"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppRequireVerified", context.Background(), int32(1), true, "key").Return(nil)
+			},
+			want: &authv1.SetAppRequireVerifiedResponse{Result: true},
+		},
+		{
+			name:    "empty_key",
+			req:     &authv1.SetAppRequireVerifiedRequest{AppId: 1, Required: true},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "wrong_key",
+			req:  &authv1.SetAppRequireVerifiedRequest{AppId: 1, Key: "wrong"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppRequireVerified", context.Background(), int32(1), false, "wrong").Return(cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+		{
+			name: "app_not_found",
+			req:  &authv1.SetAppRequireVerifiedRequest{AppId: 2, Required: true, Key: "key"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppRequireVerified", context.Background(), int32(2), true, "key").Return(cerror.ErrAppNotFound)
+			},
+			wantErr: status.Error(codes.NotFound, "app not found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuthAdmin := mocks.NewAuthAdmin(t)
+			tt.mck(serAuthAdmin)
+			s := &serverAPI{
+				authAdmin: serAuthAdmin,
+			}
+			got, err := s.SetAppRequireVerified(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetAppRequireVerified() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SetAppRequireVerified() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_Login_MFARequired(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("LoginUser", context.Background(), "test", "password", int32(1)).Return(models.Tokens{MFAToken: "mfa"}, nil)
+	s := &serverAPI{
+		auth: serAuth,
+	}
+
+	got, err := s.Login(context.Background(), &authv1.LoginRequest{Login: "test", Password: "password", AppId: 1})
+	if err != nil {
+		t.Fatalf("Login() cerror = %v", err)
+	}
+	want := &authv1.LoginResponse{MfaRequired: true, MfaToken: "mfa"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Login() got = %v, want %v", got, want)
+	}
+}
+
+func Test_serverAPI_EnrollTOTP(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.EnrollTOTPRequest
+		mck     mck
+		want    *authv1.EnrollTOTPResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.EnrollTOTPRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("EnrollTOTP", context.Background(), "token").Return("secret", "otpauth://totp/auth:test", nil)
+			},
+			want: &authv1.EnrollTOTPResponse{Secret: "secret", Uri: "otpauth://totp/auth:test"},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.EnrollTOTPRequest{},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "already_enabled",
+			req:  &authv1.EnrollTOTPRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("EnrollTOTP", context.Background(), "token").Return("", "", cerror.ErrMFAEnabled)
+			},
+			wantErr: status.Error(codes.AlreadyExists, "mfa already enabled"),
+		},
+		{
+			name: "not_configured",
+			req:  &authv1.EnrollTOTPRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("EnrollTOTP", context.Background(), "token").Return("", "", cerror.ErrMFANotConfigured)
+			},
+			wantErr: status.Error(codes.FailedPrecondition, "mfa is not configured"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.EnrollTOTP(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("EnrollTOTP() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnrollTOTP() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_ConfirmTOTP(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.ConfirmTOTPRequest
+		mck     mck
+		want    *authv1.ConfirmTOTPResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.ConfirmTOTPRequest{Token: "token", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmTOTP", context.Background(), "token", "123456").Return([]string{"abcde-fghij"}, nil)
+			},
+			want: &authv1.ConfirmTOTPResponse{RecoveryCodes: []string{"abcde-fghij"}},
+		},
+		{
+			name:    "empty_code",
+			req:     &authv1.ConfirmTOTPRequest{Token: "token"},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_code",
+			req:  &authv1.ConfirmTOTPRequest{Token: "token", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmTOTP", context.Background(), "token", "123456").Return(nil, cerror.ErrInvalidMFACode)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid mfa code"),
+		},
+		{
+			name: "not_enrolled",
+			req:  &authv1.ConfirmTOTPRequest{Token: "token", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("ConfirmTOTP", context.Background(), "token", "123456").Return(nil, cerror.ErrMFANotEnrolled)
+			},
+			wantErr: status.Error(codes.FailedPrecondition, "mfa not enrolled"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.ConfirmTOTP(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConfirmTOTP() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConfirmTOTP() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_VerifyMFA(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.VerifyMFARequest
+		mck     mck
+		want    *authv1.VerifyMFAResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.VerifyMFARequest{MfaToken: "mfa", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyMFA", context.Background(), "mfa", "123456").
+					Return(models.Tokens{AccessToken: "access", RefreshToken: "refresh"}, nil)
+			},
+			want: &authv1.VerifyMFAResponse{Token: "access", RefreshToken: "refresh"},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.VerifyMFARequest{Code: "123456"},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "invalid_token",
+			req:  &authv1.VerifyMFARequest{MfaToken: "mfa", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyMFA", context.Background(), "mfa", "123456").Return(models.Tokens{}, cerror.ErrInvalidToken)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid mfa token"),
+		},
+		{
+			name: "invalid_code",
+			req:  &authv1.VerifyMFARequest{MfaToken: "mfa", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyMFA", context.Background(), "mfa", "123456").Return(models.Tokens{}, cerror.ErrInvalidMFACode)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid mfa code"),
+		},
+		{
+			name: "login_not_allowed",
+			req:  &authv1.VerifyMFARequest{MfaToken: "mfa", Code: "123456"},
+			mck: func(m *mocks.Auth) {
+				m.On("VerifyMFA", context.Background(), "mfa", "123456").Return(models.Tokens{}, cerror.ErrLoginNotAllowed)
+			},
+			wantErr: status.Error(codes.FailedPrecondition, "login method not allowed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.VerifyMFA(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyMFA() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyMFA() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_BeginWebAuthnRegistration(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.BeginWebAuthnRegistrationRequest
+		mck     mck
+		want    *authv1.BeginWebAuthnRegistrationResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.BeginWebAuthnRegistrationRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("BeginWebAuthnRegistration", context.Background(), "token").Return([]byte(`{"publicKey":{}}`), "session", nil)
+			},
+			want: &authv1.BeginWebAuthnRegistrationResponse{Options: `{"publicKey":{}}`, SessionToken: "session"},
+		},
+		{
+			name:    "empty_token",
+			req:     &authv1.BeginWebAuthnRegistrationRequest{},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "disabled",
+			req:  &authv1.BeginWebAuthnRegistrationRequest{Token: "token"},
+			mck: func(m *mocks.Auth) {
+				m.On("BeginWebAuthnRegistration", context.Background(), "token").Return(nil, "", cerror.ErrWebAuthnDisabled)
+			},
+			wantErr: status.Error(codes.FailedPrecondition, "webauthn is not configured for app"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.BeginWebAuthnRegistration(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("BeginWebAuthnRegistration() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BeginWebAuthnRegistration() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_FinishWebAuthnLogin(t *testing.T) {
+	type mck func(m *mocks.Auth)
+
+	tests := []struct {
+		name    string
+		req     *authv1.FinishWebAuthnLoginRequest
+		mck     mck
+		want    *authv1.FinishWebAuthnLoginResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.FinishWebAuthnLoginRequest{SessionToken: "session", Credential: "{}"},
+			mck: func(m *mocks.Auth) {
+				m.On("FinishWebAuthnLogin", context.Background(), "session", []byte("{}")).
+					Return(models.Tokens{AccessToken: "access", RefreshToken: "refresh"}, nil)
+			},
+			want: &authv1.FinishWebAuthnLoginResponse{Token: "access", RefreshToken: "refresh"},
+		},
+		{
+			name:    "empty_credential",
+			req:     &authv1.FinishWebAuthnLoginRequest{SessionToken: "session"},
+			mck:     func(m *mocks.Auth) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "verification_failed",
+			req:  &authv1.FinishWebAuthnLoginRequest{SessionToken: "session", Credential: "{}"},
+			mck: func(m *mocks.Auth) {
+				m.On("FinishWebAuthnLogin", context.Background(), "session", []byte("{}")).
+					Return(models.Tokens{}, cerror.ErrWebAuthnFailed)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "webauthn verification failed"),
+		},
+		{
+			name: "invalid_session",
+			req:  &authv1.FinishWebAuthnLoginRequest{SessionToken: "session", Credential: "{}"},
+			mck: func(m *mocks.Auth) {
+				m.On("FinishWebAuthnLogin", context.Background(), "session", []byte("{}")).
+					Return(models.Tokens{}, cerror.ErrInvalidToken)
+			},
+			wantErr: status.Error(codes.Unauthenticated, "invalid token"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuth := mocks.NewAuth(t)
+			tt.mck(serAuth)
+			s := &serverAPI{
+				auth: serAuth,
+			}
+			got, err := s.FinishWebAuthnLogin(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("FinishWebAuthnLogin() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FinishWebAuthnLogin() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_SetAppWebAuthn(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	origins := []string{"https://app.example.com"}
+
+	tests := []struct {
+		name    string
+		req     *authv1.SetAppWebAuthnRequest
+		mck     mck
+		want    *authv1.SetAppWebAuthnResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.SetAppWebAuthnRequest{AppId: 1, RpId: "app.example.com", Origins: origins, Key: "key"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppWebAuthn", context.Background(), int32(1), "app.example.com", origins, "key").Return(nil)
+			},
+			want: &authv1.SetAppWebAuthnResponse{Result: true},
+		},
+		{
+			name: "empty_origins",
+			req:  &authv1.SetAppWebAuthnRequest{AppId: 1, RpId: "app.example.com", Key: "key"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppWebAuthn", context.Background(), int32(1), "app.example.com", []string(nil), "key").
+					Return(cerror.ErrInvalidAppSettings)
+			},
+			wantErr: status.Error(codes.InvalidArgument, "invalid app settings"),
+		},
+		{
+			name: "invalid_key",
+			req:  &authv1.SetAppWebAuthnRequest{AppId: 1, RpId: "app.example.com", Origins: origins, Key: "key"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("SetAppWebAuthn", context.Background(), int32(1), "app.example.com", origins, "key").Return(cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serAuthAdmin := mocks.NewAuthAdmin(t)
+			tt.mck(serAuthAdmin)
+			s := &serverAPI{
+				authAdmin: serAuthAdmin,
+			}
+			got, err := s.SetAppWebAuthn(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetAppWebAuthn() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SetAppWebAuthn() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_GrantAppAccess(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.GrantAppAccessRequest
+		mck     mck
+		want    *authv1.GrantAppAccessResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.GrantAppAccessRequest{UserId: 7, AppId: 2, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("GrantAppAccess", context.Background(), int64(7), int32(2), "sefsfe").Return(nil)
+			},
+			want: &authv1.GrantAppAccessResponse{Result: true},
+		},
+		{
+			name:    "empty app_id",
+			req:     &authv1.GrantAppAccessRequest{UserId: 7, Key: "sefsfe"},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "negative key",
+			req:  &authv1.GrantAppAccessRequest{UserId: 7, AppId: 2, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("GrantAppAccess", context.Background(), int64(7), int32(2), "sefsfe").Return(cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+		{
+			name: "app not found",
+			req:  &authv1.GrantAppAccessRequest{UserId: 7, AppId: 9, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("GrantAppAccess", context.Background(), int64(7), int32(9), "sefsfe").Return(cerror.ErrAppNotFound)
+			},
+			wantErr: status.Error(codes.NotFound, "app not found"),
+		},
+		{
+			name: "login taken",
+			req:  &authv1.GrantAppAccessRequest{UserId: 8, AppId: 2, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("GrantAppAccess", context.Background(), int64(8), int32(2), "sefsfe").Return(cerror.ErrUserExists)
+			},
+			wantErr: status.Error(codes.AlreadyExists, "login already taken in app"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.GrantAppAccess(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GrantAppAccess() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GrantAppAccess() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_RevokeAppAccess(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.RevokeAppAccessRequest
+		mck     mck
+		want    *authv1.RevokeAppAccessResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.RevokeAppAccessRequest{UserId: 7, AppId: 2, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RevokeAppAccess", context.Background(), int64(7), int32(2), "sefsfe").Return(nil)
+			},
+			want: &authv1.RevokeAppAccessResponse{Result: true},
+		},
+		{
+			name:    "empty user",
+			req:     &authv1.RevokeAppAccessRequest{AppId: 2, Key: "sefsfe"},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "no access",
+			req:  &authv1.RevokeAppAccessRequest{UserId: 8, AppId: 2, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("RevokeAppAccess", context.Background(), int64(8), int32(2), "sefsfe").Return(cerror.ErrUserNotFound)
+			},
+			wantErr: status.Error(codes.NotFound, "user not found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.RevokeAppAccess(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RevokeAppAccess() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RevokeAppAccess() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_CreateRole(t *testing.T) {
+	type mck func(m *mocks.AuthAdmin)
+
+	tests := []struct {
+		name    string
+		req     *authv1.CreateRoleRequest
+		mck     mck
+		want    *authv1.CreateRoleResponse
+		wantErr error
+	}{
+		{
+			name: "positive",
+			req:  &authv1.CreateRoleRequest{AppId: 2, Name: "editor", Permissions: []string{"posts:write"}, Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("CreateRole", context.Background(), int32(2), "editor", []string{"posts:write"}, "sefsfe").
+					Return(int64(5), nil)
+			},
+			want: &authv1.CreateRoleResponse{RoleId: 5},
+		},
+		{
+			name:    "empty permission",
+			req:     &authv1.CreateRoleRequest{AppId: 2, Name: "editor", Permissions: []string{""}, Key: "sefsfe"},
+			mck:     func(m *mocks.AuthAdmin) {},
+			wantErr: status.Error(codes.InvalidArgument, "data not exist"),
+		},
+		{
+			name: "role exists",
+			req:  &authv1.CreateRoleRequest{AppId: 2, Name: "editor", Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("CreateRole", context.Background(), int32(2), "editor", []string(nil), "sefsfe").
+					Return(int64(0), cerror.ErrRoleExists)
+			},
+			wantErr: status.Error(codes.AlreadyExists, "role exists"),
+		},
+		{
+			name: "negative key",
+			req:  &authv1.CreateRoleRequest{AppId: 2, Name: "editor", Key: "sefsfe"},
+			mck: func(m *mocks.AuthAdmin) {
+				m.On("CreateRole", context.Background(), int32(2), "editor", []string(nil), "sefsfe").
+					Return(int64(0), cerror.ErrNotRights)
+			},
+			wantErr: status.Error(codes.PermissionDenied, "invalid admin key"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := mocks.NewAuthAdmin(t)
+			tt.mck(service)
+
+			s := &serverAPI{
+				authAdmin: service,
+			}
+			got, err := s.CreateRole(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreateRole() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateRole() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_serverAPI_ListRoles(t *testing.T) {
+	service := mocks.NewAuthAdmin(t)
+	service.On("ListRoles", context.Background(), int32(2), "sefsfe").Return([]models.Role{
+		{ID: 1, AppID: 2, Name: "editor", Permissions: []string{"posts:read", "posts:write"}},
+	}, nil)
+
+	s := &serverAPI{
+		authAdmin: service,
+	}
+	got, err := s.ListRoles(context.Background(), &authv1.ListRolesRequest{AppId: 2, Key: "sefsfe"})
+	if err != nil {
+		t.Fatalf("ListRoles() cerror = %v", err)
+	}
+	if len(got.Roles) != 1 || got.Roles[0].Id != 1 || got.Roles[0].Name != "editor" ||
+		!reflect.DeepEqual(got.Roles[0].Permissions, []string{"posts:read", "posts:write"}) {
+		t.Errorf("ListRoles() got = %v", got)
+	}
+}
+
+func Test_serverAPI_AssignRole(t *testing.T) {
+	service := mocks.NewAuthAdmin(t)
+	service.On("AssignRole", context.Background(), int64(7), int32(2), "editor", "sefsfe").Return(nil)
+	service.On("AssignRole", context.Background(), int64(7), int32(2), "unknown", "sefsfe").Return(cerror.ErrRoleNotFound)
+
+	s := &serverAPI{
+		authAdmin: service,
+	}
+	got, err := s.AssignRole(context.Background(), &authv1.AssignRoleRequest{UserId: 7, AppId: 2, Name: "editor", Key: "sefsfe"})
+	if err != nil || !got.Result {
+		t.Errorf("AssignRole() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.AssignRole(context.Background(), &authv1.AssignRoleRequest{UserId: 7, AppId: 2, Name: "unknown", Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.NotFound, "role not found")) {
+		t.Errorf("AssignRole() cerror = %v, want role not found", err)
+	}
+	_, err = s.AssignRole(context.Background(), &authv1.AssignRoleRequest{AppId: 2, Name: "editor", Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "data not exist")) {
+		t.Errorf("AssignRole() empty user cerror = %v", err)
+	}
+}
+
+func Test_serverAPI_CheckPermission(t *testing.T) {
+	serAuth := mocks.NewAuth(t)
+	serAuth.On("CheckPermission", context.Background(), int64(7), int32(2), "posts:write").Return(true, nil)
+	serAuth.On("CheckPermission", context.Background(), int64(8), int32(2), "posts:write").Return(false, cerror.ErrInternalErr)
+
+	s := &serverAPI{
+		auth: serAuth,
+	}
+	got, err := s.CheckPermission(context.Background(), &authv1.CheckPermissionRequest{UserId: 7, AppId: 2, Permission: "posts:write"})
+	if err != nil || !got.Allowed {
+		t.Errorf("CheckPermission() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.CheckPermission(context.Background(), &authv1.CheckPermissionRequest{UserId: 8, AppId: 2, Permission: "posts:write"})
+	if !errors.Is(err, status.Error(codes.Internal, "internal cerror")) {
+		t.Errorf("CheckPermission() cerror = %v", err)
+	}
+	_, err = s.CheckPermission(context.Background(), &authv1.CheckPermissionRequest{UserId: 7, AppId: 2})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "data not exist")) {
+		t.Errorf("CheckPermission() empty permission cerror = %v", err)
+	}
+}
+
+func Test_serverAPI_Apps(t *testing.T) {
+	service := mocks.NewAuthAdmin(t)
+	service.On("ListApps", context.Background(), "sefsfe").Return([]models.App{
+		{ID: 2, Name: "app", Secret: "secret", Alg: "HS256", Disabled: true},
+	}, nil)
+	service.On("GetApp", context.Background(), int32(3), "sefsfe").Return(models.App{}, cerror.ErrAppNotFound)
+	service.On("UpdateApp", context.Background(), int32(2), "taken", "sefsfe").Return(cerror.ErrAppExists)
+	service.On("DisableApp", context.Background(), int32(2), true, "sefsfe").Return(nil)
+	service.On("DeleteApp", context.Background(), int32(2), false, "sefsfe").Return(cerror.ErrAppHasUsers)
+	service.On("RotateAppSecret", context.Background(), int32(2), "sefsfe").Return("new secret", nil)
+
+	s := &serverAPI{
+		authAdmin: service,
+	}
+	ctx := context.Background()
+
+	apps, err := s.ListApps(ctx, &authv1.ListAppsRequest{Key: "sefsfe"})
+	if err != nil || len(apps.Apps) != 1 || apps.Apps[0].Id != 2 || apps.Apps[0].Name != "app" || !apps.Apps[0].Disabled {
+		t.Errorf("ListApps() got = %v, cerror = %v", apps, err)
+	}
+	_, err = s.GetApp(ctx, &authv1.GetAppRequest{AppId: 3, Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.NotFound, "app not found")) {
+		t.Errorf("GetApp() cerror = %v, want app not found", err)
+	}
+	_, err = s.UpdateApp(ctx, &authv1.UpdateAppRequest{AppId: 2, Name: "taken", Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.AlreadyExists, "app exists")) {
+		t.Errorf("UpdateApp() cerror = %v, want app exists", err)
+	}
+	if got, err := s.DisableApp(ctx, &authv1.DisableAppRequest{AppId: 2, Disabled: true, Key: "sefsfe"}); err != nil || !got.Result {
+		t.Errorf("DisableApp() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.DeleteApp(ctx, &authv1.DeleteAppRequest{AppId: 2, Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.FailedPrecondition, "app has users")) {
+		t.Errorf("DeleteApp() cerror = %v, want app has users", err)
+	}
+	if got, err := s.RotateAppSecret(ctx, &authv1.RotateAppSecretRequest{AppId: 2, Key: "sefsfe"}); err != nil || got.Secret != "new secret" {
+		t.Errorf("RotateAppSecret() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.UpdateApp(ctx, &authv1.UpdateAppRequest{AppId: 2, Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "data not exist")) {
+		t.Errorf("UpdateApp() empty name cerror = %v", err)
+	}
+}
+
+func Test_serverAPI_AppSettings(t *testing.T) {
+	settings := models.AppSettings{
+		AccessTTL:      15 * time.Minute,
+		RefreshTTL:     48 * time.Hour,
+		RequireMFA:     true,
+		LoginMethods:   []string{models.LoginPassword},
+		Claims:         map[string]string{"tenant": "acme"},
+		PasswordPolicy: &models.PasswordRules{MinLength: 12, RequireDigit: true, ForbidLogin: true},
+	}
+
+	service := mocks.NewAuthAdmin(t)
+	service.On("GetAppSettings", context.Background(), int32(2), "sefsfe").Return(settings, nil)
+	service.On("UpdateAppSettings", context.Background(), int32(2), settings, "sefsfe").Return(nil)
+	service.On("UpdateAppSettings", context.Background(), int32(3), models.AppSettings{AccessTTL: time.Hour}, "sefsfe").
+		Return(cerror.ErrInvalidAppSettings)
+
+	s := &serverAPI{
+		authAdmin: service,
+	}
+	ctx := context.Background()
+
+	got, err := s.GetAppSettings(ctx, &authv1.GetAppSettingsRequest{AppId: 2, Key: "sefsfe"})
+	if err != nil || got.Settings.AccessTtl != 900 || got.Settings.RefreshTtl != 172800 || !got.Settings.RequireMfa ||
+		got.Settings.Claims["tenant"] != "acme" {
+		t.Errorf("GetAppSettings() got = %v, cerror = %v", got, err)
+	}
+	if res, err := s.UpdateAppSettings(ctx, &authv1.UpdateAppSettingsRequest{AppId: 2, Settings: got.Settings, Key: "sefsfe"}); err != nil || !res.Result {
+		t.Errorf("UpdateAppSettings() got = %v, cerror = %v", res, err)
+	}
+	_, err = s.UpdateAppSettings(ctx, &authv1.UpdateAppSettingsRequest{AppId: 3, Settings: &authv1.AppSettings{AccessTtl: 3600}, Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "invalid app settings")) {
+		t.Errorf("UpdateAppSettings() cerror = %v, want invalid app settings", err)
+	}
+	_, err = s.UpdateAppSettings(ctx, &authv1.UpdateAppSettingsRequest{AppId: 2, Key: "sefsfe"})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "data not exist")) {
+		t.Errorf("UpdateAppSettings() without settings cerror = %v", err)
+	}
+}
+
+func Test_serverAPI_AdminBearerToken(t *testing.T) {
+	ctx := models.WithBearerToken(context.Background(), "token")
+
+	service := mocks.NewAuthAdmin(t)
+	service.On("RotateSigningKey", ctx, int32(1), "").Return("kid_2", nil)
+
+	s := &serverAPI{
+		authAdmin: service,
+	}
+	got, err := s.RotateSigningKey(ctx, &authv1.RotateSigningKeyRequest{AppId: 1})
+	if err != nil || got.Kid != "kid_2" {
+		t.Errorf("RotateSigningKey() got = %v, cerror = %v", got, err)
+	}
+	_, err = s.RotateSigningKey(context.Background(), &authv1.RotateSigningKeyRequest{AppId: 1})
+	if !errors.Is(err, status.Error(codes.InvalidArgument, "data not exist")) {
+		t.Errorf("RotateSigningKey() without credentials cerror = %v", err)
+	}
+}
+
+func TestBearerTokenInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "bearer", header: "Bearer token", want: "token"},
+		{name: "lower_case", header: "bearer token", want: "token"},
+		{name: "other_scheme", header: "Basic token", want: ""},
+		{name: "empty_token", header: "Bearer ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", tt.header))
+
+			var got string
+			_, err := BearerTokenInterceptor(ctx, nil, nil, func(ctx context.Context, _ any) (any, error) {
+				got = models.BearerToken(ctx)
+				return nil, nil
+			})
+			if err != nil || got != tt.want {
+				t.Errorf("BearerTokenInterceptor() got = %q, cerror = %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -45,11 +46,48 @@ type Handler struct {
 
 func (h *Handler) Route(app *fiber.App) {
 	app.Post("/api/auth/login", h.Login)
+	app.Post("/api/auth/refresh", h.Refresh)
+	app.Post("/api/auth/validate", h.ValidateToken)
+	app.Post("/api/auth/logout", h.Logout)
+	app.Post("/api/auth/changepassword", h.ChangePassword)
+	app.Post("/api/auth/resetpassword", h.RequestPasswordReset)
+	app.Post("/api/auth/resetpassword/confirm", h.ConfirmPasswordReset)
+	app.Post("/api/auth/verifyemail", h.VerifyEmail)
+	app.Post("/api/auth/verifyemail/resend", h.ResendVerification)
+	app.Post("/api/auth/mfa/enroll", h.EnrollTOTP)
+	app.Post("/api/auth/mfa/confirm", h.ConfirmTOTP)
+	app.Post("/api/auth/mfa/verify", h.VerifyMFA)
+	app.Post("/api/auth/webauthn/register/begin", h.BeginWebAuthnRegistration)
+	app.Post("/api/auth/webauthn/register/finish", h.FinishWebAuthnRegistration)
+	app.Post("/api/auth/webauthn/login/begin", h.BeginWebAuthnLogin)
+	app.Post("/api/auth/webauthn/login/finish", h.FinishWebAuthnLogin)
+	app.Get("/.well-known/jwks.json", h.JWKS)
 	app.Post("/api/auth/register", h.Register)
 	app.Get("/api/auth/checkadmin", h.IsAdmin)
+	app.Get("/api/auth/checkpermission", h.CheckPermission)
 	app.Post("/api/auth/createadmin", h.CreateAdmin)
 	app.Delete("/api/auth/deleteadmin", h.DeleteAdmin)
 	app.Get("/api/auth/addapp", h.AddApp)
+	app.Post("/api/auth/rotatekey", h.RotateSigningKey)
+	app.Post("/api/auth/revokeall", h.RevokeAllForUser)
+	app.Post("/api/auth/unlock", h.UnlockAccount)
+	app.Post("/api/auth/requireverified", h.SetAppRequireVerified)
+	app.Post("/api/auth/webauthn/app", h.SetAppWebAuthn)
+	app.Post("/api/auth/appaccess", h.GrantAppAccess)
+	app.Delete("/api/auth/appaccess", h.RevokeAppAccess)
+	app.Post("/api/auth/roles", h.CreateRole)
+	app.Get("/api/auth/roles", h.ListRoles)
+	app.Delete("/api/auth/roles", h.DeleteRole)
+	app.Post("/api/auth/roles/assign", h.AssignRole)
+	app.Delete("/api/auth/roles/assign", h.UnassignRole)
+	app.Get("/api/auth/apps", h.ListApps)
+	app.Get("/api/auth/app", h.GetApp)
+	app.Put("/api/auth/app", h.UpdateApp)
+	app.Post("/api/auth/app/disable", h.DisableApp)
+	app.Delete("/api/auth/app", h.DeleteApp)
+	app.Post("/api/auth/app/secret", h.RotateAppSecret)
+	app.Get("/api/auth/app/settings", h.GetAppSettings)
+	app.Put("/api/auth/app/settings", h.UpdateAppSettings)
 }
 
 func (h *Handler) Login(c *fiber.Ctx) error {
@@ -67,7 +105,7 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
 	}
 
-	token, err := h.auth.LoginUser(ctx, login, pass, int32(appID))
+	tokens, err := h.auth.LoginUser(models.WithClientIP(ctx, c.IP()), login, pass, int32(appID))
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -75,26 +113,26 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body:   models.LoginBodyResponse{Token: token}},
+			Body: models.LoginBodyResponse{
+				Token:          tokens.AccessToken,
+				RefreshToken:   tokens.RefreshToken,
+				MFARequired:    tokens.MFAToken != "",
+				MFAToken:       tokens.MFAToken,
+				MFAEnrollToken: tokens.MFAEnrollToken,
+			}},
 	)
 }
 
-func (h *Handler) Register(c *fiber.Ctx) error {
-	var appID int64
-
+func (h *Handler) Refresh(c *fiber.Ctx) error {
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
 
-	login := c.Query("login")
-	pass := c.Query("password")
-	app := c.Query("app_id")
-
-	appID, err := strconv.ParseInt(app, 10, 32)
-	if err != nil || login == "" || pass == "" || appID == 0 {
+	refreshToken := c.Query("refresh_token")
+	if refreshToken == "" {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
 	}
 
-	userID, err := h.auth.RegisterNewUser(ctx, login, pass, int32(appID))
+	tokens, err := h.auth.Refresh(ctx, refreshToken)
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -102,28 +140,78 @@ func (h *Handler) Register(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body:   models.RegisterBodyResponse{UserID: userID}},
+			Body: models.LoginBodyResponse{
+				Token:        tokens.AccessToken,
+				RefreshToken: tokens.RefreshToken,
+				MFARequired:  tokens.MFAToken != "",
+				MFAToken:     tokens.MFAToken,
+			}},
 	)
 }
 
-func (h *Handler) IsAdmin(c *fiber.Ctx) error {
+func (h *Handler) ValidateToken(c *fiber.Ctx) error {
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
 
-	userID := c.Query("user_id")
-	appID := c.Query("app_id")
+	token := c.Query("token")
+	if token == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
 
-	userIDint, err := strconv.ParseInt(userID, 10, 32)
+	claims, err := h.auth.ValidateToken(ctx, token)
 	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body: models.ValidateTokenBodyResponse{
+				UserID: claims.UserID,
+				Login:  claims.Login,
+				AppID:  claims.AppID,
+				Exp:    claims.ExpiresAt.Unix(),
+				LVL:    claims.Lvl,
+				Roles:  claims.Roles,
+			},
+		},
+	)
+}
+
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	if token == "" {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
 
+	if err := h.auth.Logout(ctx, token, c.Query("refresh_token")); err != nil {
+		return cerror.ErrorHandler(c, err)
 	}
-	intAPP, err := strconv.ParseInt(appID, 10, 32)
 
-	if err != nil || intAPP == 0 || userIDint == 0 {
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.LogoutBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	login := c.Query("login")
+	oldPass := c.Query("old_password")
+	newPass := c.Query("new_password")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || login == "" || oldPass == "" || newPass == "" || appID == 0 {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
 	}
-	admin, err := h.auth.CheckIsAdmin(ctx, int32(userIDint), int32(intAPP))
+
+	err = h.auth.ChangePassword(models.WithClientIP(ctx, c.IP()), login, int32(appID), oldPass, newPass)
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -131,33 +219,176 @@ func (h *Handler) IsAdmin(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body: models.IsAdminBodyResponse{
-				Result: true,
-				LVL:    admin.Lvl},
+			Body:   models.ChangePasswordBodyResponse{Result: true},
 		},
 	)
 }
 
-func (h *Handler) CreateAdmin(c *fiber.Ctx) error {
+func (h *Handler) RequestPasswordReset(c *fiber.Ctx) error {
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
 
 	login := c.Query("login")
-	lvlAdmin := c.Query("lvl")
-	key := c.Query("key")
-	appID := c.Query("app_id")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || login == "" || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
 
-	intLVL, err := strconv.ParseInt(lvlAdmin, 10, 32)
+	if err := h.auth.RequestPasswordReset(ctx, login, int32(appID)); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RequestPasswordResetBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) ConfirmPasswordReset(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	newPass := c.Query("new_password")
+	if token == "" || newPass == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.auth.ConfirmPasswordReset(ctx, token, newPass); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.ConfirmPasswordResetBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	if token == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.auth.VerifyEmail(ctx, token); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.VerifyEmailBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	login := c.Query("login")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || login == "" || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.auth.ResendVerification(ctx, login, int32(appID)); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.ResendVerificationBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) EnrollTOTP(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	if token == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	secret, uri, err := h.auth.EnrollTOTP(ctx, token)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.EnrollTOTPBodyResponse{Secret: secret, URI: uri},
+		},
+	)
+}
+
+func (h *Handler) ConfirmTOTP(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	code := c.Query("code")
+	if token == "" || code == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	recoveryCodes, err := h.auth.ConfirmTOTP(ctx, token, code)
 	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.ConfirmTOTPBodyResponse{RecoveryCodes: recoveryCodes},
+		},
+	)
+}
+
+func (h *Handler) VerifyMFA(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	mfaToken := c.Query("mfa_token")
+	code := c.Query("code")
+	if mfaToken == "" || code == "" {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
 
+	tokens, err := h.auth.VerifyMFA(ctx, mfaToken, code)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
 	}
-	intAPP, err := strconv.ParseInt(appID, 10, 32)
 
-	if err != nil || login == "" || intLVL == 0 || key == "" || intAPP == 0 {
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.VerifyMFABodyResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken},
+		},
+	)
+}
+
+func (h *Handler) BeginWebAuthnRegistration(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	token := c.Query("token")
+	if token == "" {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
 	}
-	adminID, err := h.authAdmin.CreateAdmin(ctx, login, int32(intLVL), key, int32(intAPP))
+
+	options, sessionToken, err := h.auth.BeginWebAuthnRegistration(ctx, token)
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -165,22 +396,67 @@ func (h *Handler) CreateAdmin(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body:   models.CreateAdminBodyResponse{AdminID: adminID}},
+			Body:   models.BeginWebAuthnRegistrationBodyResponse{Options: options, SessionToken: sessionToken},
+		},
 	)
 }
 
-func (h *Handler) DeleteAdmin(c *fiber.Ctx) error {
+// FinishWebAuthnRegistration принимает ответ navigator.credentials.create в теле запроса
+func (h *Handler) FinishWebAuthnRegistration(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	sessionToken := c.Query("session_token")
+	if sessionToken == "" || len(c.Body()) == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.auth.FinishWebAuthnRegistration(ctx, sessionToken, c.Body()); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.FinishWebAuthnRegistrationBodyResponse{Result: true},
+		},
+	)
+}
+
+func (h *Handler) BeginWebAuthnLogin(c *fiber.Ctx) error {
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
 
 	login := c.Query("login")
-	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || login == "" || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	options, sessionToken, err := h.auth.BeginWebAuthnLogin(ctx, login, int32(appID))
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
 
-	if login == "" || key == "" {
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.BeginWebAuthnLoginBodyResponse{Options: options, SessionToken: sessionToken},
+		},
+	)
+}
+
+// FinishWebAuthnLogin принимает ответ navigator.credentials.get в теле запроса
+func (h *Handler) FinishWebAuthnLogin(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	sessionToken := c.Query("session_token")
+	if sessionToken == "" || len(c.Body()) == 0 {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
 	}
 
-	res, err := h.authAdmin.DeleteAdmin(ctx, login, key)
+	tokens, err := h.auth.FinishWebAuthnLogin(ctx, sessionToken, c.Body())
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -188,24 +464,69 @@ func (h *Handler) DeleteAdmin(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body:   models.DeleteAdminBodyResponse{Result: res}},
+			Body:   models.FinishWebAuthnLoginBodyResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken},
+		},
 	)
 }
 
-func (h *Handler) AddApp(c *fiber.Ctx) error {
+// JWKS отдаёт ключи в стандартном формате JWK Set, без обёртки Response, чтобы его понимали JWT библиотеки
+func (h *Handler) JWKS(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	keys, err := h.auth.JWKS(ctx)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(models.JWKSResponse{Keys: keys})
+}
+
+func (h *Handler) Register(c *fiber.Ctx) error {
+	var appID int64
 
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
 
-	name := c.Query("name")
-	secret := c.Query("secret")
-	key := c.Query("key")
+	login := c.Query("login")
+	pass := c.Query("password")
+	app := c.Query("app_id")
+
+	appID, err := strconv.ParseInt(app, 10, 32)
+	if err != nil || login == "" || pass == "" || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	userID, err := h.auth.RegisterNewUser(ctx, login, pass, int32(appID))
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RegisterBodyResponse{UserID: userID}},
+	)
+}
+
+func (h *Handler) IsAdmin(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	userID := c.Query("user_id")
+	appID := c.Query("app_id")
 
-	if name == "" || secret == "" || key == "" {
+	userIDint, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
 		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+
 	}
+	intAPP, err := strconv.ParseInt(appID, 10, 32)
 
-	appid, err := h.authAdmin.AddApp(ctx, name, secret, key)
+	if err != nil || intAPP == 0 || userIDint == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	admin, err := h.auth.CheckIsAdmin(ctx, userIDint, int32(intAPP))
 	if err != nil {
 		return cerror.ErrorHandler(c, err)
 	}
@@ -213,6 +534,729 @@ func (h *Handler) AddApp(c *fiber.Ctx) error {
 	return c.JSON(
 		models.Response{
 			Status: 200,
-			Body:   models.AddAppBodyResponse{AppID: appid},
-		})
+			Body: models.IsAdminBodyResponse{
+				Result: true,
+				LVL:    admin.Lvl},
+		},
+	)
+}
+
+func (h *Handler) CheckPermission(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	permission := c.Query("permission")
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userID == 0 || permission == "" {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	allowed, err := h.auth.CheckPermission(ctx, userID, int32(appID), permission)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.CheckPermissionBodyResponse{Allowed: allowed},
+		})
+}
+
+func (h *Handler) CreateAdmin(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	login := c.Query("login")
+	lvlAdmin := c.Query("lvl")
+	key := c.Query("key")
+	appID := c.Query("app_id")
+
+	intLVL, err := strconv.ParseInt(lvlAdmin, 10, 32)
+	if err != nil {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+
+	}
+	intAPP, err := strconv.ParseInt(appID, 10, 32)
+
+	if err != nil || login == "" || intLVL == 0 || !hasCredentials(c, key) || intAPP == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	adminID, err := h.authAdmin.CreateAdmin(ctx, login, int32(intLVL), key, int32(intAPP))
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.CreateAdminBodyResponse{AdminID: adminID}},
+	)
+}
+
+func (h *Handler) DeleteAdmin(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	login := c.Query("login")
+	key := c.Query("key")
+	appID := c.Query("app_id")
+
+	intAPP, err := strconv.ParseInt(appID, 10, 32)
+	if err != nil || login == "" || !hasCredentials(c, key) || intAPP == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	res, err := h.authAdmin.DeleteAdmin(ctx, login, key, int32(intAPP))
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.DeleteAdminBodyResponse{Result: res}},
+	)
+}
+
+func (h *Handler) AddApp(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	name := c.Query("name")
+	secret := c.Query("secret")
+	key := c.Query("key")
+	alg := c.Query("alg")
+
+	if name == "" || secret == "" || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	appid, err := h.authAdmin.AddApp(ctx, name, secret, alg, key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.AddAppBodyResponse{AppID: appid},
+		})
+}
+
+func (h *Handler) RotateSigningKey(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	kid, err := h.authAdmin.RotateSigningKey(ctx, int32(appID), key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RotateSigningKeyBodyResponse{KID: kid},
+		})
+}
+
+func (h *Handler) RevokeAllForUser(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.RevokeAllForUser(ctx, userID, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RevokeAllForUserBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) UnlockAccount(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	login := c.Query("login")
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || login == "" || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.UnlockAccount(ctx, login, int32(appID), key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.UnlockAccountBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) SetAppRequireVerified(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	required, err := strconv.ParseBool(c.Query("required"))
+	if err != nil {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.SetAppRequireVerified(ctx, int32(appID), required, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.SetAppRequireVerifiedBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) SetAppWebAuthn(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	rpID := c.Query("rp_id")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	var origins []string
+	if o := c.Query("origins"); o != "" {
+		origins = strings.Split(o, ",")
+	}
+
+	if err := h.authAdmin.SetAppWebAuthn(ctx, int32(appID), rpID, origins, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.SetAppWebAuthnBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) GrantAppAccess(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.GrantAppAccess(ctx, userID, int32(appID), key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.GrantAppAccessBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) RevokeAppAccess(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	userID, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || userID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.RevokeAppAccess(ctx, userID, int32(appID), key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RevokeAppAccessBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) CreateRole(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	name := c.Query("name")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || name == "" || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	var permissions []string
+	if p := c.Query("permissions"); p != "" {
+		permissions = strings.Split(p, ",")
+	}
+
+	id, err := h.authAdmin.CreateRole(ctx, int32(appID), name, permissions, key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.CreateRoleBodyResponse{RoleID: id},
+		})
+}
+
+func (h *Handler) ListRoles(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	roles, err := h.authAdmin.ListRoles(ctx, int32(appID), key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.ListRolesBodyResponse{Roles: roles},
+		})
+}
+
+func (h *Handler) DeleteRole(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	name := c.Query("name")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || name == "" || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.DeleteRole(ctx, int32(appID), name, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.DeleteRoleBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) AssignRole(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	userID, appID, name, key, ok := roleAssignmentQuery(c)
+	if !ok {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.AssignRole(ctx, userID, appID, name, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.AssignRoleBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) UnassignRole(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	userID, appID, name, key, ok := roleAssignmentQuery(c)
+	if !ok {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.UnassignRole(ctx, userID, appID, name, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.UnassignRoleBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) ListApps(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	if !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	apps, err := h.authAdmin.ListApps(ctx, key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.ListAppsBodyResponse{Apps: apps},
+		})
+}
+
+func (h *Handler) GetApp(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	app, err := h.authAdmin.GetApp(ctx, int32(appID), key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.GetAppBodyResponse{App: app},
+		})
+}
+
+func (h *Handler) UpdateApp(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	name := c.Query("name")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || name == "" || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.UpdateApp(ctx, int32(appID), name, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.UpdateAppBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) DisableApp(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	disabled, err := strconv.ParseBool(c.Query("disabled"))
+	if err != nil {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.DisableApp(ctx, int32(appID), disabled, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.DisableAppBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) DeleteApp(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	// без cascade приложение с пользователями не удаляется
+	cascade := false
+	if v := c.Query("cascade"); v != "" {
+		if cascade, err = strconv.ParseBool(v); err != nil {
+			return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+		}
+	}
+
+	if err := h.authAdmin.DeleteApp(ctx, int32(appID), cascade, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.DeleteAppBodyResponse{Result: true},
+		})
+}
+
+func (h *Handler) RotateAppSecret(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	secret, err := h.authAdmin.RotateAppSecret(ctx, int32(appID), key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.RotateAppSecretBodyResponse{Secret: secret},
+		})
+}
+
+func (h *Handler) GetAppSettings(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	settings, err := h.authAdmin.GetAppSettings(ctx, int32(appID), key)
+	if err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body: models.GetAppSettingsBodyResponse{
+				AccessTTL:          int64(settings.AccessTTL / time.Second),
+				RefreshTTL:         int64(settings.RefreshTTL / time.Second),
+				RegistrationClosed: settings.RegistrationClosed,
+				RequireMFA:         settings.RequireMFA,
+				LoginMethods:       settings.LoginMethods,
+				Claims:             settings.Claims,
+				PasswordPolicy:     settings.PasswordPolicy,
+			},
+		})
+}
+
+// UpdateAppSettings заменяет настройки целиком: не переданный параметр сбрасывается в значение по умолчанию.
+// TTL в секундах, login_methods через запятую, claims парами name:value через запятую,
+// password_policy правилами через запятую: min_length:N, max_length:N и флаги вроде require_digit
+func (h *Handler) UpdateAppSettings(c *fiber.Ctx) error {
+
+	ctx, cancel := context.WithCancel(adminContext(c))
+	defer cancel()
+
+	key := c.Query("key")
+	appID, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || appID == 0 || !hasCredentials(c, key) {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+	settings, err := appSettingsQuery(c)
+	if err != nil {
+		return cerror.ErrorHandler(c, cerror.ErrInvalidCredentials)
+	}
+
+	if err := h.authAdmin.UpdateAppSettings(ctx, int32(appID), settings, key); err != nil {
+		return cerror.ErrorHandler(c, err)
+	}
+
+	return c.JSON(
+		models.Response{
+			Status: 200,
+			Body:   models.UpdateAppSettingsBodyResponse{Result: true},
+		})
+}
+
+// appSettingsQuery разбирает настройки приложения из параметров запроса
+func appSettingsQuery(c *fiber.Ctx) (models.AppSettings, error) {
+	var settings models.AppSettings
+
+	for name, ttl := range map[string]*time.Duration{"access_ttl": &settings.AccessTTL, "refresh_ttl": &settings.RefreshTTL} {
+		if v := c.Query(name); v != "" {
+			seconds, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return settings, err
+			}
+			*ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	for name, flag := range map[string]*bool{"registration_closed": &settings.RegistrationClosed, "require_mfa": &settings.RequireMFA} {
+		if v := c.Query(name); v != "" {
+			var err error
+			if *flag, err = strconv.ParseBool(v); err != nil {
+				return settings, err
+			}
+		}
+	}
+	if v := c.Query("login_methods"); v != "" {
+		settings.LoginMethods = strings.Split(v, ",")
+	}
+	if v := c.Query("claims"); v != "" {
+		settings.Claims = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(pair, ":")
+			if !ok {
+				return settings, fmt.Errorf("claim %q without value", pair)
+			}
+			settings.Claims[name] = value
+		}
+	}
+	if v := c.Query("password_policy"); v != "" {
+		rules, err := passwordPolicyQuery(v)
+		if err != nil {
+			return settings, err
+		}
+		settings.PasswordPolicy = &rules
+	}
+	return settings, nil
+}
+
+// passwordPolicyQuery разбирает требования к паролю вида "min_length:12,require_digit,forbid_login"
+func passwordPolicyQuery(v string) (models.PasswordRules, error) {
+	var rules models.PasswordRules
+
+	lengths := map[string]*int{"min_length": &rules.MinLength, "max_length": &rules.MaxLength}
+	flags := map[string]*bool{
+		"require_upper":  &rules.RequireUpper,
+		"require_lower":  &rules.RequireLower,
+		"require_digit":  &rules.RequireDigit,
+		"require_symbol": &rules.RequireSymbol,
+		"forbid_login":   &rules.ForbidLogin,
+	}
+	for _, rule := range strings.Split(v, ",") {
+		name, value, hasValue := strings.Cut(rule, ":")
+		if length, ok := lengths[name]; ok && hasValue {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return rules, err
+			}
+			*length = n
+			continue
+		}
+		if flag, ok := flags[name]; ok && !hasValue {
+			*flag = true
+			continue
+		}
+		return rules, fmt.Errorf("unknown password rule %q", rule)
+	}
+	return rules, nil
+}
+
+// bearerPrefix схема заголовка Authorization с access токеном администратора
+const bearerPrefix = "bearer "
+
+// adminContext кладёт в контекст access токен из заголовка Authorization, им администратор приложения
+// подтверждает права вместо мастер-ключа
+func adminContext(c *fiber.Ctx) context.Context {
+	ctx := context.Context(c.Context())
+	if token := bearerToken(c); token != "" {
+		ctx = models.WithBearerToken(ctx, token)
+	}
+	return ctx
+}
+
+// hasCredentials сообщает, передал ли администратор мастер-ключ или свой access токен
+func hasCredentials(c *fiber.Ctx, key string) bool {
+	return key != "" || bearerToken(c) != ""
+}
+
+// bearerToken возвращает токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(bearerPrefix):])
+}
+
+// roleAssignmentQuery разбирает параметры назначения роли: user_id, app_id, name и key
+func roleAssignmentQuery(c *fiber.Ctx) (userID int64, appID int32, name string, key string, ok bool) {
+	key = c.Query("key")
+	name = c.Query("name")
+	uid, err := strconv.ParseInt(c.Query("user_id"), 10, 64)
+	if err != nil || uid == 0 || name == "" || !hasCredentials(c, key) {
+		return 0, 0, "", "", false
+	}
+	app, err := strconv.ParseInt(c.Query("app_id"), 10, 32)
+	if err != nil || app == 0 {
+		return 0, 0, "", "", false
+	}
+	return uid, int32(app), name, key, true
 }
@@ -1,6 +1,11 @@
 package cerror
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
 
 var (
 	ErrNotRights   = errors.New("not enough rights")
@@ -13,4 +18,51 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user exists")
 	ErrAppExists          = errors.New("app exists")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenReused        = errors.New("token reused")
+	ErrUnsupportedAlg     = errors.New("unsupported signing algorithm")
+	ErrWeakPassword       = errors.New("password does not match policy")
+	ErrTooManyAttempts    = errors.New("too many login attempts")
+	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+	ErrMFAEnabled         = errors.New("mfa already enabled")
+	ErrMFANotEnrolled     = errors.New("mfa not enrolled")
+	ErrMFANotConfigured   = errors.New("mfa is not configured")
+	ErrWebAuthnFailed     = errors.New("webauthn verification failed")
+	ErrWebAuthnDisabled   = errors.New("webauthn is not configured for app")
+	ErrRoleExists         = errors.New("role exists")
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrAppDisabled        = errors.New("app disabled")
+	ErrAppHasUsers        = errors.New("app has users")
+	ErrInvalidAppSettings = errors.New("invalid app settings")
+	ErrRegistrationClosed = errors.New("registration closed")
+	ErrLoginNotAllowed    = errors.New("login method not allowed")
+	ErrMFARequired        = errors.New("mfa required")
+	ErrInvalidAppSecret   = errors.New("invalid app secret")
 )
+
+// PasswordPolicyError перечисляет нарушенные правила политики паролей
+type PasswordPolicyError struct {
+	Rules []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(e.Rules, ", "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// TooManyAttemptsError отказ во входе из-за перебора. RetryAfter через сколько можно повторить попытку
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrTooManyAttempts, e.RetryAfter)
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return ErrTooManyAttempts
+}
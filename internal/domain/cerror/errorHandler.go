@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"math"
+	"strconv"
 )
 
 func ErrorHandler(c *fiber.Ctx, err error) error {
@@ -15,24 +17,140 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 				"Message": err,
 			})
 		}
+		if errors.Is(err, ErrRoleExists) {
+			err := fmt.Sprintf("role is already exists")
+			return c.Status(409).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
 		if errors.Is(err, ErrAppExists) {
 			err := fmt.Sprintf("app is already exists")
 			return c.Status(409).JSON(fiber.Map{
 				"Message": err,
 			})
 		}
+		if errors.Is(err, ErrAppHasUsers) {
+			err := fmt.Sprintf("app has users")
+			return c.Status(409).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrAppDisabled) {
+			err := fmt.Sprintf("app disabled")
+			return c.Status(403).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrRegistrationClosed) || errors.Is(err, ErrLoginNotAllowed) || errors.Is(err, ErrMFARequired) {
+			return c.Status(403).JSON(fiber.Map{
+				"Message": err.Error(),
+			})
+		}
+		if errors.Is(err, ErrInvalidAppSettings) {
+			err := fmt.Sprintf("invalid app settings")
+			return c.Status(400).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
 		if errors.Is(err, ErrInvalidCredentials) {
 			err := fmt.Sprintf("incorrect data")
 			return c.Status(400).JSON(fiber.Map{
 				"Message": err,
 			})
 		}
+		var policyErr *PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return c.Status(400).JSON(fiber.Map{
+				"Message": "password does not match policy",
+				"Rules":   policyErr.Rules,
+			})
+		}
+		var attemptsErr *TooManyAttemptsError
+		if errors.As(err, &attemptsErr) {
+			retryAfter := int(math.Ceil(attemptsErr.RetryAfter.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(429).JSON(fiber.Map{
+				"Message":    "too many login attempts",
+				"RetryAfter": retryAfter,
+			})
+		}
+		if errors.Is(err, ErrEmailNotVerified) {
+			err := fmt.Sprintf("email not verified")
+			return c.Status(403).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrInvalidMFACode) {
+			err := fmt.Sprintf("invalid mfa code")
+			return c.Status(401).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrMFAEnabled) || errors.Is(err, ErrMFANotEnrolled) {
+			return c.Status(409).JSON(fiber.Map{
+				"Message": err.Error(),
+			})
+		}
+		if errors.Is(err, ErrMFANotConfigured) {
+			err := fmt.Sprintf("mfa is not configured")
+			return c.Status(501).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrWebAuthnFailed) {
+			err := fmt.Sprintf("webauthn verification failed")
+			return c.Status(401).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrWebAuthnDisabled) {
+			err := fmt.Sprintf("webauthn is not configured for app")
+			return c.Status(409).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrNotRights) {
+			err := fmt.Sprintf("invalid admin key")
+			return c.Status(403).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenReused) {
+			err := fmt.Sprintf("invalid token")
+			return c.Status(401).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrInvalidAppSecret) {
+			err := fmt.Sprintf("app secret must not start with %q", "env1:")
+			return c.Status(400).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrUnsupportedAlg) {
+			err := fmt.Sprintf("unsupported signing algorithm")
+			return c.Status(400).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
 		if errors.Is(err, ErrAppNotFound) {
 			err := fmt.Sprintf("app not found")
 			return c.Status(400).JSON(fiber.Map{
 				"Message": err,
 			})
 		}
+		if errors.Is(err, ErrRoleNotFound) {
+			err := fmt.Sprintf("role not found")
+			return c.Status(404).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
+		if errors.Is(err, ErrUserNotFound) {
+			err := fmt.Sprintf("user not found")
+			return c.Status(404).JSON(fiber.Map{
+				"Message": err,
+			})
+		}
 
 		err := fmt.Sprintf("internal error server")
 		return c.Status(500).JSON(fiber.Map{
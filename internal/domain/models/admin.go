@@ -1,8 +1,23 @@
 package models
 
+import "context"
+
 type Admin struct {
 	Id     int64
 	Lvl    int32
 	UserID int64
 	AppID  int32
 }
+
+type bearerTokenKey struct{}
+
+// WithBearerToken сохраняет access токен вызывающего администратора в контексте запроса
+func WithBearerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, bearerTokenKey{}, token)
+}
+
+// BearerToken возвращает access токен вызывающего из контекста или пустую строку
+func BearerToken(ctx context.Context) string {
+	token, _ := ctx.Value(bearerTokenKey{}).(string)
+	return token
+}
@@ -1,7 +1,61 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
 type App struct {
 	ID     int64
 	Name   string
-	Secret string
+	Secret string `json:"-"`
+	Alg    string
+	// RequireVerified запрещает вход пользователям с неподтверждённым адресом
+	RequireVerified bool
+	// RPID и RPOrigins relying party для WebAuthn, пустой RPID отключает вход по ключам доступа
+	RPID      string
+	RPOrigins []string
+	// Disabled запрещает вход в приложение и выпуск его токенов
+	Disabled bool
+	// Settings отдаются отдельным запросом настроек, а не вместе с приложением
+	Settings AppSettings `json:"-"`
+}
+
+// Способы входа, которые можно разрешить приложению
+const (
+	LoginPassword = "password"
+	LoginWebAuthn = "webauthn"
+)
+
+// AppSettings настройки приложения. Нулевые значения оставляют поведение сервиса по умолчанию
+type AppSettings struct {
+	// AccessTTL и RefreshTTL время жизни токенов приложения, 0 берёт token_ttl и refresh_token_ttl из конфига
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// RegistrationClosed запрещает регистрацию новых пользователей в приложении
+	RegistrationClosed bool
+	// RequireMFA пускает по паролю только пользователей с включённым TOTP
+	RequireMFA bool
+	// LoginMethods разрешённые способы входа, пустой список разрешает все
+	LoginMethods []string
+	// Claims добавляются в каждый access токен приложения
+	Claims map[string]string
+	// PasswordPolicy заменяет для приложения требования к паролю из конфига, nil оставляет их
+	PasswordPolicy *PasswordRules
+}
+
+// PasswordRules требования к паролю. MaxLength 0 ограничивает пароль только пределом bcrypt
+type PasswordRules struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	ForbidLogin   bool
+}
+
+// LoginAllowed сообщает, разрешён ли в приложении способ входа method
+func (s AppSettings) LoginAllowed(method string) bool {
+	return len(s.LoginMethods) == 0 || slices.Contains(s.LoginMethods, method)
 }
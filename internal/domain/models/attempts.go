@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempts счётчик неудачных попыток входа по логину или IP клиента. PrevFailure время неудачи
+// перед LastFailure, по нему видно состояние счётчика до последней учтённой попытки
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	PrevFailure time.Time
+	LockedUntil time.Time
+}
+
+type clientIPKey struct{}
+
+// WithClientIP сохраняет IP клиента в контексте запроса
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP возвращает IP клиента из контекста или пустую строку
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Жизненный цикл ключа подписи: pending публикуется в JWKS, но ещё не подписывает токены,
+// active подписывает новые токены, retired только проверяет выданные ранее, deleted больше не используется
+const (
+	KeyStatusPending = "pending"
+	KeyStatusActive  = "active"
+	KeyStatusRetired = "retired"
+	KeyStatusDeleted = "deleted"
+)
+
+// SigningKey асимметричный ключ подписи приложения. Ключи хранятся в PEM: приватный в PKCS8, публичный в PKIX
+type SigningKey struct {
+	ID          int64
+	KID         string
+	AppID       int32
+	Alg         string
+	PrivateKey  []byte
+	PublicKey   []byte
+	Status      string
+	CreatedAt   time.Time
+	ActivatedAt time.Time
+	RetiredAt   time.Time
+}
+
+// JWK публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
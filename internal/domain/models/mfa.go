@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// MFA настройки TOTP пользователя. Secret хранится зашифрованным, LastStep последний принятый интервал,
+// коды с интервалом не больше него отклоняются как повторные
+type MFA struct {
+	UserID   int64
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// MFAChallenge выдаётся после проверки пароля, если у пользователя включена MFA, и обменивается на токены
+// вместе с кодом. Хранится в виде хэша. Enroll выдаётся, если приложение требует MFA, а у пользователя
+// она не включена, и принимается только для подключения второго фактора
+type MFAChallenge struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	AppID     int32
+	ExpiresAt time.Time
+	Attempts  int
+	Used      bool
+	Enroll    bool
+}
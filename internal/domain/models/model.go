@@ -1,7 +1,10 @@
 package models
 
 type User struct {
-	ID       int64
-	Login    string
-	PassHash []byte
+	ID            int64
+	Login         string
+	PassHash      []byte
+	EmailVerified bool
+	// Roles имена ролей пользователя в приложении, для которого выпускается токен
+	Roles []string
 }
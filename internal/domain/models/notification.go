@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Notification письмо в очереди доставки. Failed выставляется, когда попытки доставки исчерпаны
+type Notification struct {
+	ID            int64
+	Recipient     string
+	Subject       string
+	Body          string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	Failed        bool
+	CreatedAt     time.Time
+}
@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 // Response RESTAPI
 type Response struct {
 	Status int
@@ -8,7 +10,26 @@ type Response struct {
 
 // LoginBodyResponse body LoginResponse
 type LoginBodyResponse struct {
-	Token string
+	Token          string
+	RefreshToken   string
+	MFARequired    bool   `json:",omitempty"`
+	MFAToken       string `json:",omitempty"`
+	MFAEnrollToken string `json:",omitempty"`
+}
+
+// ValidateTokenBodyResponse body ValidateTokenResponse
+type ValidateTokenBodyResponse struct {
+	UserID int64
+	Login  string
+	AppID  int32
+	Exp    int64
+	LVL    int32
+	Roles  []string
+}
+
+// JWKSResponse JWK Set (RFC 7517)
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
 }
 
 // RegisterBodyResponse body RegisterResponse
@@ -21,6 +42,11 @@ type AddAppBodyResponse struct {
 	AppID int32
 }
 
+// RotateSigningKeyBodyResponse body RotateSigningKeyResponse
+type RotateSigningKeyBodyResponse struct {
+	KID string
+}
+
 type CreateAdminBodyResponse struct {
 	AdminID int64
 }
@@ -29,7 +55,183 @@ type DeleteAdminBodyResponse struct {
 	Result bool
 }
 
+// LogoutBodyResponse body LogoutResponse
+type LogoutBodyResponse struct {
+	Result bool
+}
+
+// RevokeAllForUserBodyResponse body RevokeAllForUserResponse
+type RevokeAllForUserBodyResponse struct {
+	Result bool
+}
+
+// UnlockAccountBodyResponse body UnlockAccountResponse
+type UnlockAccountBodyResponse struct {
+	Result bool
+}
+
+// ChangePasswordBodyResponse body ChangePasswordResponse
+type ChangePasswordBodyResponse struct {
+	Result bool
+}
+
+// RequestPasswordResetBodyResponse body RequestPasswordResetResponse
+type RequestPasswordResetBodyResponse struct {
+	Result bool
+}
+
+// ConfirmPasswordResetBodyResponse body ConfirmPasswordResetResponse
+type ConfirmPasswordResetBodyResponse struct {
+	Result bool
+}
+
+// VerifyEmailBodyResponse body VerifyEmailResponse
+type VerifyEmailBodyResponse struct {
+	Result bool
+}
+
+// ResendVerificationBodyResponse body ResendVerificationResponse
+type ResendVerificationBodyResponse struct {
+	Result bool
+}
+
+// EnrollTOTPBodyResponse body EnrollTOTPResponse
+type EnrollTOTPBodyResponse struct {
+	Secret string
+	URI    string
+}
+
+// ConfirmTOTPBodyResponse body ConfirmTOTPResponse
+type ConfirmTOTPBodyResponse struct {
+	RecoveryCodes []string
+}
+
+// VerifyMFABodyResponse body VerifyMFAResponse
+type VerifyMFABodyResponse struct {
+	Token        string
+	RefreshToken string
+}
+
+// BeginWebAuthnRegistrationBodyResponse body BeginWebAuthnRegistrationResponse
+type BeginWebAuthnRegistrationBodyResponse struct {
+	Options      json.RawMessage
+	SessionToken string
+}
+
+// FinishWebAuthnRegistrationBodyResponse body FinishWebAuthnRegistrationResponse
+type FinishWebAuthnRegistrationBodyResponse struct {
+	Result bool
+}
+
+// BeginWebAuthnLoginBodyResponse body BeginWebAuthnLoginResponse
+type BeginWebAuthnLoginBodyResponse struct {
+	Options      json.RawMessage
+	SessionToken string
+}
+
+// FinishWebAuthnLoginBodyResponse body FinishWebAuthnLoginResponse
+type FinishWebAuthnLoginBodyResponse struct {
+	Token        string
+	RefreshToken string
+}
+
+// SetAppRequireVerifiedBodyResponse body SetAppRequireVerifiedResponse
+type SetAppRequireVerifiedBodyResponse struct {
+	Result bool
+}
+
 type IsAdminBodyResponse struct {
 	Result bool
 	LVL    int32
 }
+
+// SetAppWebAuthnBodyResponse body SetAppWebAuthnResponse
+type SetAppWebAuthnBodyResponse struct {
+	Result bool
+}
+
+// GrantAppAccessBodyResponse body GrantAppAccessResponse
+type GrantAppAccessBodyResponse struct {
+	Result bool
+}
+
+// RevokeAppAccessBodyResponse body RevokeAppAccessResponse
+type RevokeAppAccessBodyResponse struct {
+	Result bool
+}
+
+// CheckPermissionBodyResponse body CheckPermissionResponse
+type CheckPermissionBodyResponse struct {
+	Allowed bool
+}
+
+// CreateRoleBodyResponse body CreateRoleResponse
+type CreateRoleBodyResponse struct {
+	RoleID int64
+}
+
+// ListRolesBodyResponse body ListRolesResponse
+type ListRolesBodyResponse struct {
+	Roles []Role
+}
+
+// DeleteRoleBodyResponse body DeleteRoleResponse
+type DeleteRoleBodyResponse struct {
+	Result bool
+}
+
+// AssignRoleBodyResponse body AssignRoleResponse
+type AssignRoleBodyResponse struct {
+	Result bool
+}
+
+// UnassignRoleBodyResponse body UnassignRoleResponse
+type UnassignRoleBodyResponse struct {
+	Result bool
+}
+
+// ListAppsBodyResponse body ListAppsResponse
+type ListAppsBodyResponse struct {
+	Apps []App
+}
+
+// GetAppBodyResponse body GetAppResponse
+type GetAppBodyResponse struct {
+	App App
+}
+
+// UpdateAppBodyResponse body UpdateAppResponse
+type UpdateAppBodyResponse struct {
+	Result bool
+}
+
+// DisableAppBodyResponse body DisableAppResponse
+type DisableAppBodyResponse struct {
+	Result bool
+}
+
+// DeleteAppBodyResponse body DeleteAppResponse
+type DeleteAppBodyResponse struct {
+	Result bool
+}
+
+// RotateAppSecretBodyResponse body RotateAppSecretResponse
+type RotateAppSecretBodyResponse struct {
+	Secret string
+}
+
+// GetAppSettingsBodyResponse body GetAppSettingsResponse. AccessTTL и RefreshTTL в секундах
+type GetAppSettingsBodyResponse struct {
+	AccessTTL          int64
+	RefreshTTL         int64
+	RegistrationClosed bool
+	RequireMFA         bool
+	LoginMethods       []string
+	Claims             map[string]string
+	PasswordPolicy     *PasswordRules `json:",omitempty"`
+}
+
+// UpdateAppSettingsBodyResponse body UpdateAppSettingsResponse
+type UpdateAppSettingsBodyResponse struct {
+	Result bool
+}
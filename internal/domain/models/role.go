@@ -0,0 +1,9 @@
+package models
+
+// Role именованный набор разрешений в приложении
+type Role struct {
+	ID          int64
+	AppID       int32
+	Name        string
+	Permissions []string
+}
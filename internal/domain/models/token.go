@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Tokens пара токенов, выдаваемая при авторизации
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	// MFAToken выдаётся вместо токенов доступа, если у пользователя включена MFA, и обменивается на них в VerifyMFA
+	MFAToken string
+	// MFAEnrollToken выдаётся вместо токенов доступа, если приложение требует MFA, а у пользователя она не включена.
+	// Принимается только в EnrollTOTP, ConfirmTOTP и BeginWebAuthnRegistration
+	MFAEnrollToken string
+}
+
+// RefreshToken одноразовый токен обновления, хранится в виде хэша
+type RefreshToken struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	AppID     int32
+	FamilyID  string
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// TokenClaims данные, извлечённые из проверенного access токена
+type TokenClaims struct {
+	ID        string
+	UserID    int64
+	Login     string
+	AppID     int32
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Lvl       int32
+	Roles     []string
+}
+
+// RevokedToken отозванный до истечения access токен. Хранится, пока токен не истечёт сам
+type RevokedToken struct {
+	ID        string
+	UserID    int64
+	AppID     int32
+	ExpiresAt time.Time
+}
+
+// PasswordReset одноразовый токен сброса пароля, хранится в виде хэша
+type PasswordReset struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	AppID     int32
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// EmailVerification одноразовый токен подтверждения адреса, хранится в виде хэша
+type EmailVerification struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	AppID     int32
+	ExpiresAt time.Time
+	Used      bool
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnCredential ключ доступа пользователя, зарегистрированный через WebAuthn
+type WebAuthnCredential struct {
+	ID              int64
+	UserID          int64
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+}
+
+// WebAuthnSession незавершённая церемония регистрации или входа. Data хранит состояние церемонии в JSON
+type WebAuthnSession struct {
+	ID        int64
+	TokenHash string
+	UserID    int64
+	AppID     int32
+	Kind      string
+	Data      []byte
+	ExpiresAt time.Time
+	Used      bool
+}
@@ -1,19 +1,33 @@
 package jwtgen
 
 import (
+	"errors"
+	"fmt"
 	"github.com/MorZLE/auth/internal/domain/models"
 	"github.com/golang-jwt/jwt/v5"
+	"slices"
 	"time"
 )
 
+var ErrInvalidClaims = errors.New("invalid token claims")
+
+// reservedClaims заполняет сервис или стандарт JWT, claims приложения их не перекрывают
+var reservedClaims = []string{"jti", "uid", "login", "app_id", "iat", "iat_ms", "exp", "roles", "iss", "sub", "aud", "nbf"}
+
+// ReservedClaim сообщает, что claim name нельзя задать в настройках приложения
+func ReservedClaim(name string) bool {
+	return slices.Contains(reservedClaims, name)
+}
+
+// NewJWT подписывает токен секретом приложения (HS256)
 func NewJWT(user models.User, app models.App, timeS time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+	claims, err := newClaims(user, app, timeS)
+	if err != nil {
+		return "", err
+	}
 
-	claims["uid"] = user.ID
-	claims["login"] = user.Login
-	claims["app_id"] = app.ID
-	claims["exp"] = time.Now().Add(timeS).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = SecretKeyID(app.ID)
 
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -22,3 +36,133 @@ func NewJWT(user models.User, app models.App, timeS time.Duration) (string, erro
 
 	return tokenString, nil
 }
+
+// NewSignedJWT подписывает токен асимметричным ключом приложения
+func NewSignedJWT(user models.User, app models.App, key models.SigningKey, timeS time.Duration) (string, error) {
+	method := jwt.GetSigningMethod(key.Alg)
+	if method == nil || !IsAsymmetric(key.Alg) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedAlg, key.Alg)
+	}
+
+	private, err := PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := newClaims(user, app, timeS)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.KID
+
+	tokenString, err := token.SignedString(private)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// SecretKeyID идентификатор ключа для токенов, подписанных секретом приложения
+func SecretKeyID(appID int64) string {
+	return fmt.Sprintf("app-%d", appID)
+}
+
+// newClaims заполняет claims токена. jti позволяет отозвать отдельный токен, iat_ms - все токены пользователя, выданные до момента отзыва:
+// iat хранит только секунды, и по нему вход в ту же секунду после отзыва тоже считался бы отозванным.
+// roles перечисляет роли пользователя в приложении. Следом добавляются claims из настроек приложения
+func newClaims(user models.User, app models.App, timeS time.Duration) (jwt.MapClaims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":    jti,
+		"uid":    user.ID,
+		"login":  user.Login,
+		"app_id": app.ID,
+		"iat":    now.Unix(),
+		"iat_ms": now.UnixMilli(),
+		"exp":    now.Add(timeS).Unix(),
+	}
+	if len(user.Roles) > 0 {
+		claims["roles"] = user.Roles
+	}
+	for name, value := range app.Settings.Claims {
+		if !ReservedClaim(name) {
+			claims[name] = value
+		}
+	}
+	return claims, nil
+}
+
+// ParseJWT проверяет подпись и срок действия токена. Ключ проверки запрашивается через key
+// по claim app_id и заголовкам kid и alg, поэтому потребителю не нужно знать ключи заранее.
+// Для HS256 key должен вернуть []byte секрета, для остальных алгоритмов - публичный ключ
+func ParseJWT(tokenString string, key func(appID int32, kid string, alg string) (interface{}, error)) (models.TokenClaims, error) {
+	var res models.TokenClaims
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, ErrInvalidClaims
+		}
+		appID, ok := claims["app_id"].(float64)
+		if !ok {
+			return nil, ErrInvalidClaims
+		}
+		kid, _ := token.Header["kid"].(string)
+
+		return key(int32(appID), kid, token.Method.Alg())
+	}, jwt.WithValidMethods(supportedAlgs), jwt.WithExpirationRequired())
+	if err != nil {
+		return res, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	uid, okUID := claims["uid"].(float64)
+	login, okLogin := claims["login"].(string)
+	appID, okApp := claims["app_id"].(float64)
+	if !okUID || !okLogin || !okApp {
+		return res, fmt.Errorf("%w: uid, login and app_id are required", ErrInvalidClaims)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return res, err
+	}
+	// токены, выпущенные до появления jti и iat, остаются валидными до истечения
+	iat, err := claims.GetIssuedAt()
+	if err != nil {
+		return res, err
+	}
+	if iat != nil {
+		res.IssuedAt = iat.Time
+	}
+	if iatMS, ok := claims["iat_ms"].(float64); ok {
+		res.IssuedAt = time.UnixMilli(int64(iatMS))
+	}
+	res.ID, _ = claims["jti"].(string)
+	// roles есть только у пользователей с ролями в приложении
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			name, ok := role.(string)
+			if !ok {
+				return res, fmt.Errorf("%w: roles must be strings", ErrInvalidClaims)
+			}
+			res.Roles = append(res.Roles, name)
+		}
+	}
+
+	res.UserID = int64(uid)
+	res.Login = login
+	res.AppID = int32(appID)
+	res.ExpiresAt = exp.Time
+
+	return res, nil
+}
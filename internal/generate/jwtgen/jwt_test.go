@@ -0,0 +1,165 @@
+package jwtgen
+
+import (
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/golang-jwt/jwt/v5"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSignedJWT_ParseJWT(t *testing.T) {
+	user := models.User{ID: 5, Login: "test"}
+
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatalf("GenerateKey() cerror = %v", err)
+			}
+			other, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatalf("GenerateKey() cerror = %v", err)
+			}
+			app := models.App{ID: 3, Alg: alg}
+
+			token, err := NewSignedJWT(user, app, key, time.Hour)
+			if err != nil {
+				t.Fatalf("NewSignedJWT() cerror = %v", err)
+			}
+
+			var gotKID, gotAlg string
+			claims, err := ParseJWT(token, func(appID int32, kid string, alg string) (interface{}, error) {
+				gotKID, gotAlg = kid, alg
+				return PublicKey(key)
+			})
+			if err != nil {
+				t.Fatalf("ParseJWT() cerror = %v", err)
+			}
+			if gotKID != key.KID || gotAlg != alg {
+				t.Errorf("ParseJWT() kid = %v, alg = %v, want %v, %v", gotKID, gotAlg, key.KID, alg)
+			}
+			if claims.UserID != user.ID || claims.Login != user.Login || claims.AppID != int32(app.ID) {
+				t.Errorf("ParseJWT() got = %v", claims)
+			}
+
+			_, err = ParseJWT(token, func(appID int32, kid string, alg string) (interface{}, error) {
+				return PublicKey(other)
+			})
+			if err == nil {
+				t.Errorf("ParseJWT() with foreign key cerror = nil, want error")
+			}
+
+			jwk, err := PublicJWK(key)
+			if err != nil {
+				t.Fatalf("PublicJWK() cerror = %v", err)
+			}
+			if jwk.Kid != key.KID || jwk.Alg != alg || jwk.Use != "sig" || jwk.Kty == "" {
+				t.Errorf("PublicJWK() got = %v", jwk)
+			}
+		})
+	}
+}
+
+func TestParseJWT_AlgConfusion(t *testing.T) {
+	key, err := GenerateKey(AlgRS256)
+	if err != nil {
+		t.Fatalf("GenerateKey() cerror = %v", err)
+	}
+
+	// токен подписан публичным ключом как HMAC секретом
+	token, err := NewJWT(models.User{ID: 1, Login: "test"}, models.App{ID: 1, Secret: string(key.PublicKey)}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+
+	_, err = ParseJWT(token, func(appID int32, kid string, alg string) (interface{}, error) {
+		return PublicKey(key)
+	})
+	if err == nil {
+		t.Errorf("ParseJWT() cerror = nil, want error")
+	}
+}
+
+func TestNewJWT_Roles(t *testing.T) {
+	app := models.App{ID: 3, Secret: "secret"}
+	key := func(appID int32, kid string, alg string) (interface{}, error) {
+		return []byte(app.Secret), nil
+	}
+
+	token, err := NewJWT(models.User{ID: 5, Login: "test", Roles: []string{"editor", "viewer"}}, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	claims, err := ParseJWT(token, key)
+	if err != nil {
+		t.Fatalf("ParseJWT() cerror = %v", err)
+	}
+	if !reflect.DeepEqual(claims.Roles, []string{"editor", "viewer"}) {
+		t.Errorf("ParseJWT() roles = %v, want [editor viewer]", claims.Roles)
+	}
+
+	token, err = NewJWT(models.User{ID: 5, Login: "test"}, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	claims, err = ParseJWT(token, key)
+	if err != nil {
+		t.Fatalf("ParseJWT() cerror = %v", err)
+	}
+	if claims.Roles != nil {
+		t.Errorf("ParseJWT() roles = %v, want none", claims.Roles)
+	}
+}
+
+func TestParseJWT_IssuedAtMillis(t *testing.T) {
+	app := models.App{ID: 3, Secret: "secret"}
+
+	before := time.Now().Truncate(time.Millisecond)
+	token, err := NewJWT(models.User{ID: 5, Login: "test"}, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	after := time.Now()
+
+	claims, err := ParseJWT(token, func(appID int32, kid string, alg string) (interface{}, error) {
+		return []byte(app.Secret), nil
+	})
+	if err != nil {
+		t.Fatalf("ParseJWT() cerror = %v", err)
+	}
+	// время выпуска с точностью до миллисекунды, а не до секунды из iat
+	if claims.IssuedAt.Before(before) || claims.IssuedAt.After(after) {
+		t.Errorf("ParseJWT() issued at = %v, want between %v and %v", claims.IssuedAt, before, after)
+	}
+}
+
+func TestNewJWT_AppClaims(t *testing.T) {
+	app := models.App{ID: 3, Secret: "secret", Settings: models.AppSettings{
+		Claims: map[string]string{"tenant": "acme", "uid": "42"},
+	}}
+
+	token, err := NewJWT(models.User{ID: 5, Login: "test"}, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(app.Secret), nil
+	}); err != nil {
+		t.Fatalf("ParseWithClaims() cerror = %v", err)
+	}
+	// claim приложения добавляется, но не перекрывает claim сервиса
+	if claims["tenant"] != "acme" || claims["uid"] != float64(5) {
+		t.Errorf("NewJWT() claims = %v", claims)
+	}
+}
+
+func TestGenerateKey_Unsupported(t *testing.T) {
+	for _, alg := range []string{AlgHS256, "none", ""} {
+		if _, err := GenerateKey(alg); !errors.Is(err, ErrUnsupportedAlg) {
+			t.Errorf("GenerateKey(%q) cerror = %v, wantErr %v", alg, err, ErrUnsupportedAlg)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package jwtgen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"math/big"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+	kidLen     = 16
+)
+
+var ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+
+var supportedAlgs = []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA}
+
+// ValidAlg сообщает, поддерживается ли алгоритм подписи
+func ValidAlg(alg string) bool {
+	for _, a := range supportedAlgs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAsymmetric сообщает, подписывается ли алгоритм ключом, которым управляет сервис
+func IsAsymmetric(alg string) bool {
+	return alg == AlgRS256 || alg == AlgES256 || alg == AlgEdDSA
+}
+
+// GenerateKey создаёт новую пару ключей для алгоритма alg
+func GenerateKey(alg string) (models.SigningKey, error) {
+	var res models.SigningKey
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return res, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	if err != nil {
+		return res, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return res, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return res, err
+	}
+
+	kid := make([]byte, kidLen)
+	if _, err := rand.Read(kid); err != nil {
+		return res, err
+	}
+
+	res.KID = base64.RawURLEncoding.EncodeToString(kid)
+	res.Alg = alg
+	res.PrivateKey = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	res.PublicKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	res.CreatedAt = time.Now()
+
+	return res, nil
+}
+
+// PrivateKey разбирает приватный ключ подписи
+func PrivateKey(key models.SigningKey) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(key.PrivateKey)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: invalid private key pem", key.KID)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// PublicKey разбирает публичный ключ подписи
+func PublicKey(key models.SigningKey) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(key.PublicKey)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: invalid public key pem", key.KID)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// PublicJWK представляет публичный ключ в формате JWK для публикации в JWKS
+func PublicJWK(key models.SigningKey) (models.JWK, error) {
+	res := models.JWK{Kid: key.KID, Use: "sig", Alg: key.Alg}
+
+	public, err := PublicKey(key)
+	if err != nil {
+		return res, err
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		res.Kty = "RSA"
+		res.N = enc(pub.N.Bytes())
+		res.E = enc(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		res.Kty = "EC"
+		res.Crv = pub.Curve.Params().Name
+		res.X = enc(pub.X.FillBytes(make([]byte, size)))
+		res.Y = enc(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		res.Kty = "OKP"
+		res.Crv = "Ed25519"
+		res.X = enc(pub)
+	default:
+		return res, fmt.Errorf("%w: %T", ErrUnsupportedAlg, public)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,37 @@
+package jwtgen
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	randomTokenLen = 32
+	tokenIDLen     = 16
+)
+
+// NewRandomToken генерирует непрозрачный случайный токен (refresh, сброс пароля и т.п.)
+func NewRandomToken() (string, error) {
+	b := make([]byte, randomTokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken возвращает хэш токена, в котором он хранится в базе
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenID генерирует идентификатор access токена (claim jti)
+func NewTokenID() (string, error) {
+	b := make([]byte, tokenIDLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,263 @@
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// pepperPrefix перед хэшем, посчитанным с перцем: $pepper$v=2$argon2id$...
+const pepperPrefix = "$pepper$v="
+
+// minPepperLen короче перец не защитит от перебора
+const minPepperLen = 16
+
+var (
+	ErrMismatch      = errors.New("hasher: password does not match")
+	ErrUnknownFormat = errors.New("hasher: unknown hash format")
+	ErrUnknownPepper = errors.New("hasher: unknown pepper version")
+)
+
+// Hasher считает хэши паролей в формате PHC ($argon2id$v=19$m=..,t=..,p=..$salt$hash). bcrypt хранится
+// в собственном формате $2a$cost$..., поэтому старые хэши проверяются без миграции
+type Hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon      config.Argon2
+
+	pepperVersion int
+	peppers       map[int][]byte
+}
+
+// New проверяет параметры из конфигурации
+func New(cfg config.PasswordHash) (*Hasher, error) {
+	const op = "hasher.New"
+
+	switch cfg.Algorithm {
+	case Argon2id:
+		a := cfg.Argon2
+		if a.Memory == 0 || a.Iterations == 0 || a.Parallelism == 0 || a.SaltLength == 0 || a.KeyLength == 0 {
+			return nil, fmt.Errorf("%s: argon2 parameters must be positive", op)
+		}
+	case Bcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%s: bcrypt cost must be between %d and %d", op, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown algorithm %q", op, cfg.Algorithm)
+	}
+
+	peppers, err := loadPeppers(cfg.Pepper)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Hasher{
+		algorithm:     cfg.Algorithm,
+		bcryptCost:    cfg.BcryptCost,
+		argon:         cfg.Argon2,
+		pepperVersion: cfg.Pepper.Version,
+		peppers:       peppers,
+	}, nil
+}
+
+// Hash считает хэш пароля текущим алгоритмом и текущим перцем
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	const op = "hasher.Hash"
+
+	if h.pepperVersion == 0 {
+		return h.hash(password)
+	}
+
+	hash, err := h.hash(pepper(h.peppers[h.pepperVersion], password))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return append([]byte(pepperPrefix+strconv.Itoa(h.pepperVersion)), hash...), nil
+}
+
+// Verify сверяет пароль с хэшем. needsRehash true, если хэш посчитан не текущим алгоритмом,
+// с другими параметрами или другой версией перца и его стоит пересчитать
+func (h *Hasher) Verify(hash []byte, password string) (needsRehash bool, err error) {
+	version, hash, err := splitPepper(hash)
+	if err != nil {
+		return false, err
+	}
+	if version != 0 {
+		key, ok := h.peppers[version]
+		if !ok {
+			return false, ErrUnknownPepper
+		}
+		password = pepper(key, password)
+	}
+
+	needsRehash, err = h.verify(hash, password)
+	if err != nil {
+		return false, err
+	}
+
+	return needsRehash || version != h.pepperVersion, nil
+}
+
+func (h *Hasher) hash(password string) ([]byte, error) {
+	const op = "hasher.hash"
+
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return hash, nil
+	}
+
+	salt := make([]byte, h.argon.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon.Iterations, h.argon.Memory, h.argon.Parallelism, h.argon.KeyLength)
+
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		h.argon.Memory, h.argon.Iterations, h.argon.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+func (h *Hasher) verify(hash []byte, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(string(hash), "$"+Argon2id+"$"):
+		return h.verifyArgon(string(hash), password)
+	case strings.HasPrefix(string(hash), "$2"):
+		return h.verifyBcrypt(hash, password)
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+func (h *Hasher) verifyBcrypt(hash []byte, password string) (bool, error) {
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrMismatch
+		}
+		return false, ErrUnknownFormat
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false, ErrUnknownFormat
+	}
+
+	return h.algorithm != Bcrypt || cost != h.bcryptCost, nil
+}
+
+func (h *Hasher) verifyArgon(hash string, password string) (bool, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnknownFormat
+	}
+
+	var params config.Argon2
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, ErrUnknownFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, ErrMismatch
+	}
+
+	return h.algorithm != Argon2id || params != h.argon, nil
+}
+
+// pepper подписывает пароль перцем. Результат в base64, чтобы bcrypt не обрезал его на нулевом байте
+// и он укладывался в 72 байта
+func pepper(key []byte, password string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// splitPepper отделяет версию перца от хэша, 0 если хэш посчитан без перца
+func splitPepper(hash []byte) (int, []byte, error) {
+	if !strings.HasPrefix(string(hash), pepperPrefix) {
+		return 0, hash, nil
+	}
+
+	rest := string(hash[len(pepperPrefix):])
+	i := strings.IndexByte(rest, '$')
+	if i <= 0 {
+		return 0, nil, ErrUnknownFormat
+	}
+	version, err := strconv.Atoi(rest[:i])
+	if err != nil || version <= 0 {
+		return 0, nil, ErrUnknownFormat
+	}
+
+	return version, []byte(rest[i:]), nil
+}
+
+// loadPeppers собирает текущую и старые версии перца. Значение берётся из Value или из файла File
+func loadPeppers(cfg config.Pepper) (map[int][]byte, error) {
+	keys := append([]config.PepperKey{{Version: cfg.Version, Value: cfg.Value, File: cfg.File}}, cfg.Previous...)
+	if cfg.Version == 0 {
+		if cfg.Value != "" || cfg.File != "" {
+			return nil, errors.New("pepper version must be positive")
+		}
+		keys = cfg.Previous
+	}
+
+	peppers := make(map[int][]byte, len(keys))
+	for _, k := range keys {
+		if k.Version <= 0 {
+			return nil, fmt.Errorf("pepper version must be positive, got %d", k.Version)
+		}
+		if _, ok := peppers[k.Version]; ok {
+			return nil, fmt.Errorf("duplicate pepper version %d", k.Version)
+		}
+
+		value := []byte(k.Value)
+		if k.File != "" {
+			raw, err := os.ReadFile(k.File)
+			if err != nil {
+				return nil, fmt.Errorf("read pepper %d: %w", k.Version, err)
+			}
+			value = []byte(strings.TrimRight(string(raw), "\r\n"))
+		}
+		if len(value) < minPepperLen {
+			return nil, fmt.Errorf("pepper %d must be at least %d bytes", k.Version, minPepperLen)
+		}
+		peppers[k.Version] = value
+	}
+
+	return peppers, nil
+}
@@ -0,0 +1,166 @@
+package hasher
+
+import (
+	"errors"
+	"github.com/MorZLE/auth/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testArgon = config.Argon2{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher_HashVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.PasswordHash
+		prefix string
+	}{
+		{name: "argon2id", cfg: config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon}, prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "bcrypt", cfg: config.PasswordHash{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}, prefix: "$2a$04$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New() cerror = %v", err)
+			}
+
+			hash, err := h.Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash() cerror = %v", err)
+			}
+			if !strings.HasPrefix(string(hash), tt.prefix) {
+				t.Errorf("Hash() = %s, want prefix %s", hash, tt.prefix)
+			}
+
+			rehash, err := h.Verify(hash, "secret")
+			if err != nil || rehash {
+				t.Errorf("Verify() = %v, %v, want false, nil", rehash, err)
+			}
+			if _, err := h.Verify(hash, "wrong"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify() wrong password cerror = %v, want %v", err, ErrMismatch)
+			}
+		})
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	oldBcrypt, _ := New(config.PasswordHash{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	newBcrypt, _ := New(config.PasswordHash{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1})
+	oldArgon, _ := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon})
+	stronger := testArgon
+	stronger.Iterations = 2
+	newArgon, _ := New(config.PasswordHash{Algorithm: Argon2id, Argon2: stronger})
+
+	bcryptHash, _ := oldBcrypt.Hash("secret")
+	argonHash, _ := oldArgon.Hash("secret")
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   []byte
+		want   bool
+	}{
+		{name: "same_bcrypt", hasher: oldBcrypt, hash: bcryptHash, want: false},
+		{name: "bcrypt_cost_raised", hasher: newBcrypt, hash: bcryptHash, want: true},
+		{name: "bcrypt_to_argon2id", hasher: oldArgon, hash: bcryptHash, want: true},
+		{name: "same_argon2id", hasher: oldArgon, hash: argonHash, want: false},
+		{name: "argon2id_params_changed", hasher: newArgon, hash: argonHash, want: true},
+		{name: "argon2id_to_bcrypt", hasher: oldBcrypt, hash: argonHash, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.hasher.Verify(tt.hash, "secret")
+			if err != nil {
+				t.Fatalf("Verify() cerror = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() needsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasher_Verify_UnknownFormat(t *testing.T) {
+	h, _ := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon})
+
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1024$salt", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if _, err := h.Verify([]byte(hash), "secret"); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Verify(%q) cerror = %v, want %v", hash, err, ErrUnknownFormat)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []config.PasswordHash{
+		{Algorithm: "md5"},
+		{Algorithm: Bcrypt, BcryptCost: 1},
+		{Algorithm: Argon2id},
+		{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost, Pepper: config.Pepper{Version: 1, Value: "short"}},
+		{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost, Pepper: config.Pepper{Value: "0123456789abcdef"}},
+		{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost, Pepper: config.Pepper{Version: 1, File: "/nonexistent/pepper"}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) cerror = nil", cfg)
+		}
+	}
+}
+
+func TestHasher_Pepper(t *testing.T) {
+	const pepperV1 = "0123456789abcdef-v1"
+	pepperFile := filepath.Join(t.TempDir(), "pepper")
+	if err := os.WriteFile(pepperFile, []byte("0123456789abcdef-v2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, _ := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon})
+	v1, err := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon,
+		Pepper: config.Pepper{Version: 1, Value: pepperV1}})
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+	v2, err := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon,
+		Pepper: config.Pepper{Version: 2, File: pepperFile, Previous: []config.PepperKey{{Version: 1, Value: pepperV1}}}})
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+	wrongV1, _ := New(config.PasswordHash{Algorithm: Argon2id, Argon2: testArgon,
+		Pepper: config.Pepper{Version: 1, Value: "fedcba9876543210-v1"}})
+
+	plainHash, _ := plain.Hash("secret")
+	v1Hash, _ := v1.Hash("secret")
+	v2Hash, _ := v2.Hash("secret")
+	if !strings.HasPrefix(string(v1Hash), "$pepper$v=1$argon2id$") {
+		t.Errorf("Hash() = %s, want pepper prefix", v1Hash)
+	}
+
+	tests := []struct {
+		name       string
+		hasher     *Hasher
+		hash       []byte
+		wantRehash bool
+		wantErr    error
+	}{
+		{name: "same_pepper", hasher: v1, hash: v1Hash},
+		{name: "pepper_from_file", hasher: v2, hash: v2Hash},
+		{name: "previous_pepper", hasher: v2, hash: v1Hash, wantRehash: true},
+		{name: "pepper_added", hasher: v1, hash: plainHash, wantRehash: true},
+		{name: "pepper_removed", hasher: plain, hash: v1Hash, wantErr: ErrUnknownPepper},
+		{name: "unknown_version", hasher: v1, hash: v2Hash, wantErr: ErrUnknownPepper},
+		{name: "wrong_pepper", hasher: wrongV1, hash: v1Hash, wantErr: ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.hasher.Verify(tt.hash, "secret")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantRehash {
+				t.Errorf("Verify() needsRehash = %v, want %v", got, tt.wantRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/storage/postgres"
+	"github.com/MorZLE/auth/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io/fs"
+	"os"
+)
+
+// Table таблица версий схемы по умолчанию
+const Table = "migrations"
+
+var (
+	ErrSchemaTooNew = errors.New("database schema is newer than the binary supports")
+	ErrDirty        = errors.New("database schema is dirty, fix the failed migration and run migrator force")
+	ErrNoMigrations = errors.New("no migrations for storage driver")
+)
+
+// Source возвращает миграции, встроенные в бинарник, для драйвера хранилища
+func Source(driver string) (fs.FS, error) {
+	const op = "migrator.Source"
+	switch driver {
+	case "sqlite", "":
+		return migrations.SQLite, nil
+	case "postgres":
+		sub, err := fs.Sub(migrations.Postgres, "postgres")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return sub, nil
+	}
+	return nil, fmt.Errorf("%s: %w: %q", op, ErrNoMigrations, driver)
+}
+
+// New готовит миграции src для базы storagePath. table таблица версий схемы
+func New(src fs.FS, driver string, storagePath string, table string) (*migrate.Migrate, error) {
+	const op = "migrator.New"
+
+	var databaseURL string
+	switch driver {
+	case "sqlite", "":
+		databaseURL = fmt.Sprintf("sqlite3://%s?x-migration-table=%s", storagePath, table)
+	case "postgres":
+		databaseURL = postgres.MigrateURL(storagePath, table)
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrNoMigrations, driver)
+	}
+
+	source, err := iofs.New(src, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return m, nil
+}
+
+// Up применяет все новые миграции. Актуальная схема не считается ошибкой
+func Up(m *migrate.Migrate) error {
+	const op = "migrator.Up"
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Latest возвращает номер последней миграции в src
+func Latest(src fs.FS) (uint, error) {
+	const op = "migrator.Latest"
+
+	source, err := iofs.New(src, ".")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		version = next
+	}
+}
+
+// Check сравнивает версию схемы в базе с последней миграцией src. Схема новее бинарника или оставшаяся
+// после упавшей миграции означает, что запросы сервиса могут не совпасть со схемой, и работать с ней нельзя.
+// Пустая база имеет версию 0
+func Check(m *migrate.Migrate, src fs.FS) (version uint, latest uint, err error) {
+	const op = "migrator.Check"
+
+	latest, err = Latest(src)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return 0, latest, fmt.Errorf("%s: %w", op, err)
+	}
+	if dirty {
+		return version, latest, fmt.Errorf("%s: version %d: %w", op, version, ErrDirty)
+	}
+	if version > latest {
+		return version, latest, fmt.Errorf("%s: version %d, latest known %d: %w", op, version, latest, ErrSchemaTooNew)
+	}
+	return version, latest, nil
+}
@@ -0,0 +1,61 @@
+package migrator
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLatest(t *testing.T) {
+	latest := make(map[string]uint)
+	for _, driver := range []string{"sqlite", "postgres"} {
+		src, err := Source(driver)
+		if err != nil {
+			t.Fatalf("Source(%s) cerror = %v", driver, err)
+		}
+		if latest[driver], err = Latest(src); err != nil {
+			t.Fatalf("Latest(%s) cerror = %v", driver, err)
+		}
+	}
+	if latest["sqlite"] == 0 || latest["sqlite"] != latest["postgres"] {
+		t.Errorf("Latest() sqlite = %d, postgres = %d, want equal", latest["sqlite"], latest["postgres"])
+	}
+
+	if _, err := Source("memory"); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("Source(memory) cerror = %v, want %v", err, ErrNoMigrations)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	src, err := Source("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(src, "sqlite", filepath.Join(t.TempDir(), "auth.db"), Table)
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+	defer m.Close()
+
+	version, latest, err := Check(m, src)
+	if err != nil || version != 0 || latest == 0 {
+		t.Fatalf("Check() empty got = %d, %d, cerror = %v", version, latest, err)
+	}
+
+	if err := Up(m); err != nil {
+		t.Fatalf("Up() cerror = %v", err)
+	}
+	if err := Up(m); err != nil {
+		t.Fatalf("Up() repeated cerror = %v", err)
+	}
+	if version, _, err = Check(m, src); err != nil || version != latest {
+		t.Fatalf("Check() after up got = %d, cerror = %v", version, err)
+	}
+
+	if err := m.Force(int(latest) + 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Check(m, src); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Check() newer cerror = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
@@ -0,0 +1,24 @@
+package notifier
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log пишет письма в лог вместо доставки пользователю. Только для локального окружения:
+// токены из писем попадают в лог в открытом виде
+type Log struct {
+	log *slog.Logger
+}
+
+func NewLog(log *slog.Logger) *Log {
+	return &Log{log: log}
+}
+
+func (l *Log) Send(_ context.Context, msg Message) error {
+	l.log.Info("notification",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body))
+	return nil
+}
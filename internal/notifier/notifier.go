@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+)
+
+// Виды писем. Совпадают с именами файлов шаблонов
+const (
+	KindPasswordReset = "password_reset"
+	KindVerifyEmail   = "verify_email"
+)
+
+// Message готовое к отправке письмо
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender доставляет письмо получателю
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Data данные, доступные в шаблонах писем
+type Data struct {
+	Login string
+	AppID int32
+	Token string
+}
+
+// Notifier формирует письма по шаблонам и ставит их в очередь доставки. Адресом получателя служит логин пользователя
+type Notifier struct {
+	templates *Templates
+	queue     *Queue
+}
+
+func New(templates *Templates, queue *Queue) *Notifier {
+	return &Notifier{templates: templates, queue: queue}
+}
+
+// SendPasswordReset отправляет пользователю токен сброса пароля
+func (n *Notifier) SendPasswordReset(ctx context.Context, user models.User, appID int32, token string) error {
+	const op = "notifier.SendPasswordReset"
+
+	err := n.send(ctx, KindPasswordReset, user.Login, appID, Data{Login: user.Login, AppID: appID, Token: token})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SendVerification отправляет пользователю токен подтверждения адреса
+func (n *Notifier) SendVerification(ctx context.Context, user models.User, appID int32, token string) error {
+	const op = "notifier.SendVerification"
+
+	err := n.send(ctx, KindVerifyEmail, user.Login, appID, Data{Login: user.Login, AppID: appID, Token: token})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (n *Notifier) send(ctx context.Context, kind string, to string, appID int32, data Data) error {
+	subject, body, err := n.templates.Render(appID, kind, data)
+	if err != nil {
+		return err
+	}
+	return n.queue.Enqueue(ctx, Message{To: to, Subject: subject, Body: body})
+}
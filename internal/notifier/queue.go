@@ -0,0 +1,132 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"log/slog"
+	"time"
+)
+
+// Store хранит очередь писем, чтобы недоставленные письма переживали перезапуск сервиса
+type Store interface {
+	EnqueueNotification(ctx context.Context, n models.Notification) (id int64, err error)
+	DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error)
+	DeleteNotification(ctx context.Context, id int64) error
+	RetryNotification(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error
+	FailNotification(ctx context.Context, id int64, attempts int, lastErr string) error
+}
+
+// Queue доставляет письма из очереди через Sender и повторяет неудачные попытки с растущей задержкой
+type Queue struct {
+	log    *slog.Logger
+	store  Store
+	sender Sender
+	cfg    config.NotifierQueue
+	now    func() time.Time
+	wake   chan struct{}
+}
+
+func NewQueue(log *slog.Logger, store Store, sender Sender, cfg config.NotifierQueue) *Queue {
+	return &Queue{
+		log:    log,
+		store:  store,
+		sender: sender,
+		cfg:    cfg,
+		now:    time.Now,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue сохраняет письмо в очереди. Доставка выполняется в Run, письмо не теряется при ошибке отправки
+func (q *Queue) Enqueue(ctx context.Context, msg Message) error {
+	const op = "notifier.Enqueue"
+
+	now := q.now()
+	_, err := q.store.EnqueueNotification(ctx, models.Notification{
+		Recipient:     msg.To,
+		Subject:       msg.Subject,
+		Body:          msg.Body,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Flush делает одну попытку доставки для писем, время которых наступило, и возвращает число доставленных
+func (q *Queue) Flush(ctx context.Context) (sent int, err error) {
+	const op = "notifier.Flush"
+
+	due, err := q.store.DueNotifications(ctx, q.now(), q.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, n := range due {
+		log := q.log.With(slog.String("op", op), slog.Int64("notification_id", n.ID))
+
+		sendErr := q.sender.Send(ctx, Message{To: n.Recipient, Subject: n.Subject, Body: n.Body})
+		if sendErr == nil {
+			sent++
+			if err := q.store.DeleteNotification(ctx, n.ID); err != nil {
+				return sent, fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+
+		attempts := n.Attempts + 1
+		if attempts >= q.cfg.MaxAttempts {
+			log.Error("notification dropped", slog.Int("attempts", attempts), slog.String("err", sendErr.Error()))
+			err = q.store.FailNotification(ctx, n.ID, attempts, sendErr.Error())
+		} else {
+			log.Warn("cerror send notification", slog.Int("attempts", attempts), slog.String("err", sendErr.Error()))
+			err = q.store.RetryNotification(ctx, n.ID, attempts, q.now().Add(q.backoff(attempts)), sendErr.Error())
+		}
+		if err != nil {
+			return sent, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return sent, nil
+}
+
+// Run доставляет письма сразу после постановки в очередь и повторяет неудачные каждые every
+func (q *Queue) Run(ctx context.Context, every time.Duration) {
+	const op = "notifier.Run"
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+		if _, err := q.Flush(ctx); err != nil {
+			q.log.Error("cerror flush notifications", slog.String("op", op), slog.String("err", err.Error()))
+		}
+	}
+}
+
+// backoff задержка перед попыткой номер attempts+1: BaseDelay, удваиваемая с каждой неудачей, не больше MaxDelay
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.cfg.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= q.cfg.MaxDelay {
+			return q.cfg.MaxDelay
+		}
+	}
+	return min(delay, q.cfg.MaxDelay)
+}
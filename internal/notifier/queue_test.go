@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"log/slog"
+	"sort"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	next  int64
+	items map[int64]models.Notification
+}
+
+func newMemStore() *memStore {
+	return &memStore{items: make(map[int64]models.Notification)}
+}
+
+func (m *memStore) EnqueueNotification(_ context.Context, n models.Notification) (int64, error) {
+	m.next++
+	n.ID = m.next
+	m.items[n.ID] = n
+	return n.ID, nil
+}
+
+func (m *memStore) DueNotifications(_ context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	var res []models.Notification
+	for _, n := range m.items {
+		if !n.Failed && !n.NextAttemptAt.After(now) {
+			res = append(res, n)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (m *memStore) DeleteNotification(_ context.Context, id int64) error {
+	delete(m.items, id)
+	return nil
+}
+
+func (m *memStore) RetryNotification(_ context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	n := m.items[id]
+	n.Attempts, n.NextAttemptAt, n.LastError = attempts, next, lastErr
+	m.items[id] = n
+	return nil
+}
+
+func (m *memStore) FailNotification(_ context.Context, id int64, attempts int, lastErr string) error {
+	n := m.items[id]
+	n.Attempts, n.LastError, n.Failed = attempts, lastErr, true
+	m.items[id] = n
+	return nil
+}
+
+type fakeSender struct {
+	err  error
+	sent []Message
+}
+
+func (f *fakeSender) Send(_ context.Context, msg Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestQueue_Flush(t *testing.T) {
+	store := newMemStore()
+	sender := &fakeSender{err: errors.New("smtp unavailable")}
+	q := NewQueue(slog.Default(), store, sender, config.NotifierQueue{
+		BatchSize:   10,
+		MaxAttempts: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    90 * time.Second,
+	})
+	now := time.Unix(1700000000, 0)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, Message{To: "user@example.com", Subject: "s", Body: "b"}); err != nil {
+		t.Fatalf("Enqueue() cerror = %v", err)
+	}
+
+	// первая неудача откладывает письмо на BaseDelay
+	if sent, err := q.Flush(ctx); err != nil || sent != 0 {
+		t.Fatalf("Flush() sent = %d, cerror = %v", sent, err)
+	}
+	if n := store.items[1]; n.Attempts != 1 || !n.NextAttemptAt.Equal(now.Add(time.Minute)) || n.LastError == "" {
+		t.Fatalf("Flush() after failure got = %+v", n)
+	}
+
+	// до наступления времени повтора письмо не отправляется
+	if sent, _ := q.Flush(ctx); sent != 0 || store.items[1].Attempts != 1 {
+		t.Fatalf("Flush() before retry time got attempts = %d", store.items[1].Attempts)
+	}
+
+	// задержка удваивается, но не превышает MaxDelay
+	now = now.Add(time.Minute)
+	q.Flush(ctx)
+	if n := store.items[1]; n.Attempts != 2 || !n.NextAttemptAt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("Flush() second failure got = %+v", n)
+	}
+
+	// после MaxAttempts письмо помечается недоставленным
+	now = now.Add(90 * time.Second)
+	q.Flush(ctx)
+	if n := store.items[1]; n.Attempts != 3 || !n.Failed {
+		t.Fatalf("Flush() last failure got = %+v", n)
+	}
+
+	// доставленное письмо удаляется из очереди
+	sender.err = nil
+	if err := q.Enqueue(ctx, Message{To: "user@example.com", Subject: "s2", Body: "b2"}); err != nil {
+		t.Fatalf("Enqueue() cerror = %v", err)
+	}
+	if sent, err := q.Flush(ctx); err != nil || sent != 1 {
+		t.Fatalf("Flush() sent = %d, cerror = %v", sent, err)
+	}
+	if _, ok := store.items[2]; ok || len(sender.sent) != 1 || sender.sent[0].Subject != "s2" {
+		t.Errorf("Flush() delivered message left in queue or not sent: %+v", sender.sent)
+	}
+}
+
+func TestNotifier_SendPasswordReset(t *testing.T) {
+	store := newMemStore()
+	templates, err := NewTemplates("", "en", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := New(templates, NewQueue(slog.Default(), store, &fakeSender{}, config.NotifierQueue{BatchSize: 10, MaxAttempts: 1}))
+
+	err = n.SendPasswordReset(context.Background(), models.User{ID: 1, Login: "user@example.com"}, 1, "token")
+	if err != nil {
+		t.Fatalf("SendPasswordReset() cerror = %v", err)
+	}
+	got := store.items[1]
+	if got.Recipient != "user@example.com" || got.Subject != "Password reset" {
+		t.Errorf("SendPasswordReset() queued = %+v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+var errNoTLS = errors.New("smtp server does not support STARTTLS")
+
+// SMTP отправляет письма через почтовый сервер
+type SMTP struct {
+	cfg       config.SMTP
+	tlsConfig *tls.Config
+}
+
+func NewSMTP(cfg config.SMTP) (*SMTP, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is empty")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("smtp from: %w", err)
+	}
+	return &SMTP{cfg: cfg, tlsConfig: &tls.Config{ServerName: cfg.Host}}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	const op = "notifier.SMTP.Send"
+
+	if err := s.send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *SMTP) send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	dialer := net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	if s.cfg.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.cfg.Timeout)); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	} else if s.cfg.RequireTLS {
+		return errNoTLS
+	}
+
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(from, to, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// buildMessage собирает письмо в формате RFC 5322. Тема кодируется по RFC 2047, тело в quoted-printable
+func buildMessage(from *mail.Address, to *mail.Address, msg Message) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(msg.Body))
+	qp.Close()
+
+	return buf.Bytes()
+}
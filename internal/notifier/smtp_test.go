@@ -0,0 +1,167 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/config"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP минимальный SMTP сервер, который принимает одно письмо и сохраняет его
+type fakeSMTP struct {
+	ln   net.Listener
+	from string
+	rcpt string
+	data chan string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, data: make(chan string, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = envelopeAddr(cmd)
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = envelopeAddr(cmd)
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data <- data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// envelopeAddr достаёт адрес из команды MAIL FROM:<addr> или RCPT TO:<addr>
+func envelopeAddr(cmd string) string {
+	start, end := strings.Index(cmd, "<"), strings.Index(cmd, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return cmd[start+1 : end]
+}
+
+func TestSMTP_Send(t *testing.T) {
+	srv := newFakeSMTP(t)
+
+	sender, err := NewSMTP(config.SMTP{
+		Host:    "127.0.0.1",
+		Port:    srv.port(),
+		From:    "Auth <auth@example.com>",
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP() cerror = %v", err)
+	}
+
+	err = sender.Send(context.Background(), Message{To: "user@example.com", Subject: "Сброс пароля", Body: "token: abc"})
+	if err != nil {
+		t.Fatalf("Send() cerror = %v", err)
+	}
+
+	var data string
+	select {
+	case data = <-srv.data:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not received")
+	}
+	if srv.from != "auth@example.com" || srv.rcpt != "user@example.com" {
+		t.Errorf("Send() envelope from = %q, rcpt = %q", srv.from, srv.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage() cerror = %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Сброс пароля" {
+		t.Errorf("Send() subject = %q, cerror = %v", subject, err)
+	}
+	if !strings.Contains(data, "token: abc") {
+		t.Errorf("Send() body does not contain token: %q", data)
+	}
+}
+
+func TestSMTP_RequireTLS(t *testing.T) {
+	srv := newFakeSMTP(t)
+
+	sender, err := NewSMTP(config.SMTP{
+		Host:       "127.0.0.1",
+		Port:       srv.port(),
+		From:       "auth@example.com",
+		RequireTLS: true,
+		Timeout:    5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP() cerror = %v", err)
+	}
+
+	err = sender.Send(context.Background(), Message{To: "user@example.com", Subject: "test", Body: "test"})
+	if !errors.Is(err, errNoTLS) {
+		t.Errorf("Send() cerror = %v, want %v", err, errNoTLS)
+	}
+}
+
+func TestNewSMTP_InvalidConfig(t *testing.T) {
+	if _, err := NewSMTP(config.SMTP{From: "auth@example.com", Port: 25}); err == nil {
+		t.Error("NewSMTP() without host: want cerror")
+	}
+	if _, err := NewSMTP(config.SMTP{Host: "localhost", From: "not an address", Port: 25}); err == nil {
+		t.Error("NewSMTP() with invalid from: want cerror")
+	}
+}
@@ -0,0 +1,104 @@
+package notifier
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"text/template"
+)
+
+// fallbackLocale язык встроенных шаблонов, если для нужного языка шаблона нет
+const fallbackLocale = "en"
+
+//go:embed templates
+var embedded embed.FS
+
+// Templates шаблоны писем. Шаблон вида kind на языке приложения ищется по порядку в
+// <dir>/<app_id>/<locale>/<kind>.tmpl, <dir>/<locale>/<kind>.tmpl, затем среди встроенных шаблонов.
+// Файл шаблона определяет блоки subject и body
+type Templates struct {
+	dir           fs.FS
+	builtin       fs.FS
+	defaultLocale string
+	locales       map[int32]string
+}
+
+// NewTemplates dir может быть пустым, тогда используются только встроенные шаблоны
+func NewTemplates(dir string, defaultLocale string, locales map[int32]string) (*Templates, error) {
+	builtin, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{builtin: builtin, defaultLocale: defaultLocale, locales: locales}
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("notifier templates: %w", err)
+		}
+		t.dir = os.DirFS(dir)
+	}
+	return t, nil
+}
+
+// Render возвращает тему и текст письма
+func (t *Templates) Render(appID int32, kind string, data Data) (subject string, body string, err error) {
+	const op = "notifier.Render"
+
+	tmpl, err := t.lookup(appID, kind)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	subject = buf.String()
+
+	buf.Reset()
+	if err := tmpl.ExecuteTemplate(&buf, "body", data); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return subject, buf.String(), nil
+}
+
+func (t *Templates) lookup(appID int32, kind string) (*template.Template, error) {
+	locale := t.defaultLocale
+	if l, ok := t.locales[appID]; ok {
+		locale = l
+	}
+	name := kind + ".tmpl"
+
+	type source struct {
+		fsys fs.FS
+		path string
+	}
+	var sources []source
+	if t.dir != nil {
+		sources = append(sources,
+			source{t.dir, path.Join(strconv.Itoa(int(appID)), locale, name)},
+			source{t.dir, path.Join(locale, name)},
+		)
+	}
+	sources = append(sources,
+		source{t.builtin, path.Join(locale, name)},
+		source{t.builtin, path.Join(fallbackLocale, name)},
+	)
+
+	for _, src := range sources {
+		if _, err := fs.Stat(src.fsys, src.path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		return template.ParseFS(src.fsys, src.path)
+	}
+	return nil, fmt.Errorf("template %s not found", kind)
+}
@@ -0,0 +1,70 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplates_Render(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path string, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2/en/password_reset.tmpl", `{{define "subject"}}App 2 reset{{end}}{{define "body"}}code {{.Token}}{{end}}`)
+	write("ru/password_reset.tmpl", `{{define "subject"}}Сброс{{end}}{{define "body"}}токен {{.Token}}{{end}}`)
+
+	templates, err := NewTemplates(dir, "ru", map[int32]string{2: "en", 3: "en", 4: "de"})
+	if err != nil {
+		t.Fatalf("NewTemplates() cerror = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		appID       int32
+		wantSubject string
+		wantBody    string
+	}{
+		{name: "app_override", appID: 2, wantSubject: "App 2 reset", wantBody: "code abc"},
+		{name: "locale_override", appID: 1, wantSubject: "Сброс", wantBody: "токен abc"},
+		{name: "builtin", appID: 3, wantSubject: "Password reset", wantBody: "abc"},
+		{name: "builtin_fallback_locale", appID: 4, wantSubject: "Password reset", wantBody: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := templates.Render(tt.appID, KindPasswordReset, Data{Login: "user", AppID: tt.appID, Token: "abc"})
+			if err != nil {
+				t.Fatalf("Render() cerror = %v", err)
+			}
+			if subject != tt.wantSubject || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("Render() subject = %q, body = %q, want %q, %q", subject, body, tt.wantSubject, tt.wantBody)
+			}
+		})
+	}
+
+	if _, _, err := templates.Render(1, "unknown", Data{}); err == nil {
+		t.Error("Render() unknown kind: want cerror")
+	}
+}
+
+func TestTemplates_Builtin(t *testing.T) {
+	templates, err := NewTemplates("", "ru", nil)
+	if err != nil {
+		t.Fatalf("NewTemplates() cerror = %v", err)
+	}
+
+	subject, body, err := templates.Render(1, KindPasswordReset, Data{Login: "user", Token: "abc"})
+	if err != nil {
+		t.Fatalf("Render() cerror = %v", err)
+	}
+	if subject != "Сброс пароля" || !strings.Contains(body, "abc") || !strings.Contains(body, "user") {
+		t.Errorf("Render() subject = %q, body = %q", subject, body)
+	}
+}
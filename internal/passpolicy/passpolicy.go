@@ -0,0 +1,179 @@
+package passpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxLen bcrypt молча отбрасывает всё после 72 байт, поэтому более длинные пароли не принимаем
+const bcryptMaxLen = 72
+
+// Имена правил, которые возвращаются клиенту при отказе
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxLength     = "max_length"
+	RuleUpper         = "require_upper"
+	RuleLower         = "require_lower"
+	RuleDigit         = "require_digit"
+	RuleSymbol        = "require_symbol"
+	RuleContainsLogin = "forbid_login"
+	RuleDenylist      = "denylist"
+)
+
+// Policy проверяет пароль по правилам приложения
+type Policy struct {
+	def      config.PasswordRules
+	apps     map[int32]config.PasswordRules
+	denylist map[string]struct{}
+}
+
+// New собирает политику из конфигурации и загружает список запрещённых паролей
+func New(cfg config.PasswordPolicy) (*Policy, error) {
+	const op = "passpolicy.New"
+
+	if err := checkRules(cfg.Default); err != nil {
+		return nil, fmt.Errorf("%s: default: %w", op, err)
+	}
+	for appID, rules := range cfg.Apps {
+		if err := checkRules(rules); err != nil {
+			return nil, fmt.Errorf("%s: app %d: %w", op, appID, err)
+		}
+	}
+
+	p := &Policy{def: cfg.Default, apps: cfg.Apps}
+	if cfg.Denylist == "" {
+		return p, nil
+	}
+
+	denylist, err := loadDenylist(cfg.Denylist)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	p.denylist = denylist
+
+	return p, nil
+}
+
+// Validate возвращает список нарушенных правил, пустой если пароль подходит
+func (p *Policy) Validate(appID int32, login string, password string) []string {
+	rules, ok := p.apps[appID]
+	if !ok {
+		rules = p.def
+	}
+	return p.validate(rules, login, password)
+}
+
+// ValidateRules проверяет пароль по требованиям из настроек приложения вместо конфига. Список запрещённых
+// паролей действует и для них
+func (p *Policy) ValidateRules(rules models.PasswordRules, login string, password string) []string {
+	return p.validate(configRules(rules), login, password)
+}
+
+// CheckRules проверяет требования из настроек приложения перед сохранением
+func (p *Policy) CheckRules(rules models.PasswordRules) error {
+	return checkRules(configRules(rules))
+}
+
+func (p *Policy) validate(rules config.PasswordRules, login string, password string) []string {
+	var failed []string
+
+	if utf8.RuneCountInString(password) < rules.MinLength {
+		failed = append(failed, RuleMinLength)
+	}
+	if len(password) > maxLen(rules) {
+		failed = append(failed, RuleMaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if rules.RequireUpper && !upper {
+		failed = append(failed, RuleUpper)
+	}
+	if rules.RequireLower && !lower {
+		failed = append(failed, RuleLower)
+	}
+	if rules.RequireDigit && !digit {
+		failed = append(failed, RuleDigit)
+	}
+	if rules.RequireSymbol && !symbol {
+		failed = append(failed, RuleSymbol)
+	}
+
+	lowered := strings.ToLower(password)
+	if rules.ForbidLogin && login != "" && strings.Contains(lowered, strings.ToLower(login)) {
+		failed = append(failed, RuleContainsLogin)
+	}
+	if _, ok := p.denylist[lowered]; ok {
+		failed = append(failed, RuleDenylist)
+	}
+
+	return failed
+}
+
+func configRules(rules models.PasswordRules) config.PasswordRules {
+	return config.PasswordRules{
+		MinLength:     rules.MinLength,
+		MaxLength:     rules.MaxLength,
+		RequireUpper:  rules.RequireUpper,
+		RequireLower:  rules.RequireLower,
+		RequireDigit:  rules.RequireDigit,
+		RequireSymbol: rules.RequireSymbol,
+		ForbidLogin:   rules.ForbidLogin,
+	}
+}
+
+func checkRules(rules config.PasswordRules) error {
+	if rules.MaxLength > bcryptMaxLen {
+		return fmt.Errorf("max_length %d exceeds bcrypt limit %d", rules.MaxLength, bcryptMaxLen)
+	}
+	if rules.MinLength < 0 || rules.MinLength > maxLen(rules) {
+		return fmt.Errorf("min_length %d must be between 0 and max_length", rules.MinLength)
+	}
+	return nil
+}
+
+func maxLen(rules config.PasswordRules) int {
+	if rules.MaxLength <= 0 {
+		return bcryptMaxLen
+	}
+	return rules.MaxLength
+}
+
+func loadDenylist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
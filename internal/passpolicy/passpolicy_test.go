@@ -0,0 +1,127 @@
+package passpolicy
+
+import (
+	"github.com/MorZLE/auth/internal/config"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	if err := os.WriteFile(denylist, []byte("# common\nPassword123\nqwerty\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := New(config.PasswordPolicy{
+		Default: config.PasswordRules{MinLength: 8, MaxLength: 72, ForbidLogin: true},
+		Apps: map[int32]config.PasswordRules{
+			2: {MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true},
+		},
+		Denylist: denylist,
+	})
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		appID    int32
+		login    string
+		password string
+		want     []string
+	}{
+		{name: "positive_default", appID: 1, login: "user", password: "correct horse", want: nil},
+		{name: "positive_app", appID: 2, login: "user", password: "Str0ng!pass", want: nil},
+		{name: "too_short", appID: 1, login: "user", password: "1", want: []string{RuleMinLength}},
+		{name: "multibyte_length", appID: 1, login: "user", password: "пароль12", want: nil},
+		{name: "too_long", appID: 1, login: "user", password: strings.Repeat("a", 73), want: []string{RuleMaxLength}},
+		{name: "contains_login", appID: 1, login: "Alice", password: "xxalicexx", want: []string{RuleContainsLogin}},
+		{name: "denylist", appID: 1, login: "user", password: "PASSWORD123", want: []string{RuleDenylist}},
+		{
+			name: "app_classes", appID: 2, login: "user", password: "lowercaseonly",
+			want: []string{RuleUpper, RuleDigit, RuleSymbol},
+		},
+		// правила приложения заменяют default целиком, поэтому логин в пароле здесь допустим
+		{name: "app_without_login_rule", appID: 2, login: "user", password: "Us3r!user!", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Validate(tt.appID, tt.login, tt.password)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_ValidateRules(t *testing.T) {
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	if err := os.WriteFile(denylist, []byte("Password123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := New(config.PasswordPolicy{
+		Default:  config.PasswordRules{MinLength: 8, MaxLength: 72},
+		Apps:     map[int32]config.PasswordRules{2: {MinLength: 4}},
+		Denylist: denylist,
+	})
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+	rules := models.PasswordRules{MinLength: 12, RequireDigit: true, ForbidLogin: true}
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     []string
+	}{
+		{name: "positive", login: "user", password: "long enough 1", want: nil},
+		// настройки приложения заменяют и default, и правила приложения из конфига
+		{name: "too_short", login: "user", password: "short 1", want: []string{RuleMinLength}},
+		{name: "no_digit", login: "user", password: "long enough pass", want: []string{RuleDigit}},
+		{name: "contains_login", login: "user", password: "user password 1", want: []string{RuleContainsLogin}},
+		{name: "denylist", login: "user", password: "password123", want: []string{RuleMinLength, RuleDenylist}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.ValidateRules(rules, tt.login, tt.password)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateRules() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := policy.CheckRules(models.PasswordRules{MaxLength: 73}); err == nil {
+		t.Errorf("CheckRules() max over bcrypt cerror = nil, want error")
+	}
+	if err := policy.CheckRules(models.PasswordRules{MinLength: 20, MaxLength: 10}); err == nil {
+		t.Errorf("CheckRules() min over max cerror = nil, want error")
+	}
+	if err := policy.CheckRules(rules); err != nil {
+		t.Errorf("CheckRules() cerror = %v", err)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PasswordPolicy
+	}{
+		{name: "max_over_bcrypt", cfg: config.PasswordPolicy{Default: config.PasswordRules{MaxLength: 100}}},
+		{name: "min_over_max", cfg: config.PasswordPolicy{Default: config.PasswordRules{MinLength: 20, MaxLength: 10}}},
+		{name: "app_rules", cfg: config.PasswordPolicy{Apps: map[int32]config.PasswordRules{1: {MaxLength: 73}}}},
+		{name: "missing_denylist", cfg: config.PasswordPolicy{Denylist: "/nonexistent/denylist.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Errorf("New() cerror = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const KeySize = 32
+
+var ErrDecrypt = errors.New("secretbox: decryption failed")
+
+// Box шифрует небольшие секреты (например, TOTP) для хранения в базе. AES-256-GCM, случайный nonce
+// хранится вместе с шифртекстом
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New принимает ключ длиной KeySize в base64
+func New(key string) (*Box, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: decode key: %w", err)
+	}
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("secretbox: key must be %d bytes, got %d", KeySize, len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: %w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Encrypt возвращает base64(nonce || шифртекст)
+func (b *Box) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("secretbox: %w", err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *Box) Decrypt(ciphertext string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	size := b.aead.NonceSize()
+	if len(raw) < size {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := b.aead.Open(nil, raw[:size], raw[size:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
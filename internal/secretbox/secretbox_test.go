@@ -0,0 +1,48 @@
+package secretbox
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", KeySize)))
+
+func TestBox_EncryptDecrypt(t *testing.T) {
+	box, err := New(testKey)
+	if err != nil {
+		t.Fatalf("New() cerror = %v", err)
+	}
+
+	first, err := box.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt() cerror = %v", err)
+	}
+	second, _ := box.Encrypt([]byte("secret"))
+	if first == second {
+		t.Error("Encrypt() returned the same ciphertext twice")
+	}
+
+	got, err := box.Decrypt(first)
+	if err != nil || string(got) != "secret" {
+		t.Errorf("Decrypt() got = %q, cerror = %v", got, err)
+	}
+
+	other, _ := New(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", KeySize))))
+	if _, err := other.Decrypt(first); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt() with other key cerror = %v, want %v", err, ErrDecrypt)
+	}
+	if _, err := box.Decrypt("bm90IGVub3VnaA"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt() garbage cerror = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	if _, err := New("not base64!"); err == nil {
+		t.Error("New() invalid base64: want cerror")
+	}
+	if _, err := New(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("New() short key: want cerror")
+	}
+}
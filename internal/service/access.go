@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+)
+
+// GrantAppAccess открывает пользователю вход в приложение appID с тем же логином и паролем
+func (s *Auth) GrantAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "auth.GrantAppAccess"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID), slog.Int("app_id", int(appID)))
+
+	if err := s.admProvider.GrantAppAccess(ctx, userID, appID); err != nil {
+		return accessError(log, "cerror grant app access", err)
+	}
+	log.Info("app access granted")
+
+	return nil
+}
+
+// RevokeAppAccess закрывает пользователю вход в приложение appID, снимает права администратора в нём
+// и отзывает выданные для него refresh токены
+func (s *Auth) RevokeAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "auth.RevokeAppAccess"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID), slog.Int("app_id", int(appID)))
+
+	if err := s.admProvider.RevokeAppAccess(ctx, userID, appID); err != nil {
+		return accessError(log, "cerror revoke app access", err)
+	}
+	log.Info("app access revoked")
+
+	return nil
+}
+
+// checkAppAccess не даёт выпустить токены приложения пользователю, у которого забрали доступ к нему
+func (s *Auth) checkAppAccess(ctx context.Context, log *slog.Logger, userID int64, appID int32) error {
+	ok, err := s.usrProvider.HasAppAccess(ctx, userID, appID)
+	if err != nil {
+		log.Error("cerror check app access", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("user has no access to app")
+		return cerror.ErrInvalidToken
+	}
+	return nil
+}
+
+// accessError переводит ошибку хранилища при изменении доступа в ошибку сервиса
+func accessError(log *slog.Logger, msg string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		log.Warn("user not found")
+		return cerror.ErrUserNotFound
+	case errors.Is(err, storage.ErrAppNotFound):
+		log.Warn("app not found")
+		return cerror.ErrAppNotFound
+	case errors.Is(err, storage.ErrUserExists):
+		log.Warn("login already taken in app")
+		return cerror.ErrUserExists
+	}
+	log.Error(msg, slog.String("err", err.Error()))
+	return cerror.ErrInternalErr
+}
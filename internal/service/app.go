@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+)
+
+// ListApps возвращает все приложения. Секреты приложений не возвращаются
+func (s *Auth) ListApps(ctx context.Context) ([]models.App, error) {
+	const op = "auth.ListApps"
+
+	log := s.log.With(slog.String("op", op))
+
+	apps, err := s.admProvider.Apps(ctx)
+	if err != nil {
+		log.Error("cerror get apps", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+	for i := range apps {
+		apps[i].Secret = ""
+	}
+	return apps, nil
+}
+
+// GetApp возвращает приложение без секрета
+func (s *Auth) GetApp(ctx context.Context, appID int32) (models.App, error) {
+	const op = "auth.GetApp"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	app, err := s.appProvider.App(ctx, appID)
+	if err != nil {
+		return models.App{}, appError(log, "cerror get app", err)
+	}
+	app.Secret = ""
+
+	return app, nil
+}
+
+// UpdateApp переименовывает приложение
+func (s *Auth) UpdateApp(ctx context.Context, appID int32, name string) error {
+	const op = "auth.UpdateApp"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("name", name))
+
+	if err := s.admProvider.UpdateApp(ctx, appID, name); err != nil {
+		return appError(log, "cerror update app", err)
+	}
+	log.Info("app renamed")
+
+	return nil
+}
+
+// DisableApp выключает или снова включает приложение. В выключенное приложение нельзя войти
+// и обновить его токены, уже выданные access токены действуют до истечения
+func (s *Auth) DisableApp(ctx context.Context, appID int32, disabled bool) error {
+	const op = "auth.DisableApp"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Bool("disabled", disabled))
+
+	if err := s.admProvider.SetAppDisabled(ctx, appID, disabled); err != nil {
+		return appError(log, "cerror disable app", err)
+	}
+	log.Info("app disabled changed")
+
+	return nil
+}
+
+// DeleteApp удаляет приложение. Если у приложения есть пользователи, без cascade удаление запрещено,
+// с cascade пользователи без других приложений удаляются вместе с ним
+func (s *Auth) DeleteApp(ctx context.Context, appID int32, cascade bool) error {
+	const op = "auth.DeleteApp"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Bool("cascade", cascade))
+
+	if err := s.admProvider.DeleteApp(ctx, appID, cascade); err != nil {
+		return appError(log, "cerror delete app", err)
+	}
+	log.Info("app deleted")
+
+	return nil
+}
+
+// RotateAppSecret заменяет секрет приложения случайным и возвращает новый. Токены, подписанные
+// старым секретом, сразу перестают проходить проверку
+func (s *Auth) RotateAppSecret(ctx context.Context, appID int32) (string, error) {
+	const op = "auth.RotateAppSecret"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	secret, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate secret", slog.String("err", err.Error()))
+		return "", cerror.ErrInternalErr
+	}
+	if err = s.admProvider.SetAppSecret(ctx, appID, secret); err != nil {
+		return "", appError(log, "cerror set app secret", err)
+	}
+	log.Info("app secret rotated")
+
+	return secret, nil
+}
+
+// GetAppSettings возвращает настройки приложения
+func (s *Auth) GetAppSettings(ctx context.Context, appID int32) (models.AppSettings, error) {
+	const op = "auth.GetAppSettings"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	app, err := s.appProvider.App(ctx, appID)
+	if err != nil {
+		return models.AppSettings{}, appError(log, "cerror get app", err)
+	}
+	return app.Settings, nil
+}
+
+// UpdateAppSettings заменяет настройки приложения целиком. Access TTL не может превышать token_ttl сервиса:
+// по нему считается, сколько хранить отзывы токенов и выведенные из работы ключи подписи
+func (s *Auth) UpdateAppSettings(ctx context.Context, appID int32, settings models.AppSettings) error {
+	const op = "auth.UpdateAppSettings"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	if err := s.checkAppSettings(settings); err != nil {
+		log.Warn("invalid app settings", slog.String("err", err.Error()))
+		return err
+	}
+
+	if err := s.admProvider.SetAppSettings(ctx, appID, settings); err != nil {
+		return appError(log, "cerror set app settings", err)
+	}
+	log.Info("app settings changed")
+
+	return nil
+}
+
+// checkAppSettings проверяет настройки приложения перед сохранением
+func (s *Auth) checkAppSettings(settings models.AppSettings) error {
+	if settings.AccessTTL < 0 || settings.RefreshTTL < 0 {
+		return fmt.Errorf("%w: negative ttl", cerror.ErrInvalidAppSettings)
+	}
+	if settings.AccessTTL > s.tokenTTL {
+		return fmt.Errorf("%w: access ttl exceeds token_ttl %s", cerror.ErrInvalidAppSettings, s.tokenTTL)
+	}
+	for _, method := range settings.LoginMethods {
+		if method != models.LoginPassword && method != models.LoginWebAuthn {
+			return fmt.Errorf("%w: unknown login method %q", cerror.ErrInvalidAppSettings, method)
+		}
+	}
+	for name := range settings.Claims {
+		if name == "" || jwtgen.ReservedClaim(name) {
+			return fmt.Errorf("%w: reserved claim %q", cerror.ErrInvalidAppSettings, name)
+		}
+	}
+	if settings.PasswordPolicy != nil && s.passPolicy != nil {
+		if err := s.passPolicy.CheckRules(*settings.PasswordPolicy); err != nil {
+			return fmt.Errorf("%w: password policy: %w", cerror.ErrInvalidAppSettings, err)
+		}
+	}
+	if settings.RequireMFA && s.mfaCipher == nil {
+		return cerror.ErrMFANotConfigured
+	}
+	return nil
+}
+
+// appError переводит ошибку хранилища при работе с приложением в ошибку сервиса
+func appError(log *slog.Logger, msg string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrAppNotFound):
+		log.Warn("app not found")
+		return cerror.ErrAppNotFound
+	case errors.Is(err, storage.ErrUniqueApp):
+		log.Warn("app exists")
+		return cerror.ErrAppExists
+	case errors.Is(err, storage.ErrAppHasUsers):
+		log.Warn("app has users")
+		return cerror.ErrAppHasUsers
+	}
+	log.Error(msg, slog.String("err", err.Error()))
+	return cerror.ErrInternalErr
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"log/slog"
+)
+
+// UnlockAccount снимает блокировку входа, наложенную за перебор паролей
+func (s *Auth) UnlockAccount(ctx context.Context, login string, appID int32) error {
+	const op = "auth.UnlockAccount"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login), slog.Int("app_id", int(appID)))
+
+	if s.guard == nil {
+		return nil
+	}
+
+	if err := s.guard.Unlock(ctx, login, appID); err != nil {
+		log.Error("cerror unlock account", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	log.Info("account unlocked")
+
+	return nil
+}
+
+// checkAttempts учитывает попытку входа до проверки пароля и отклоняет её, пока для логина или IP действует
+// задержка или блокировка. Попытка остаётся неудачной, пока её не вернёт releaseAttempt или resetAttempts
+func (s *Auth) checkAttempts(ctx context.Context, log *slog.Logger, login string, appID int32, ip string) error {
+	if s.guard == nil {
+		return nil
+	}
+
+	wait, err := s.guard.Reserve(ctx, login, appID, ip)
+	if err != nil {
+		log.Error("cerror check login attempts", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if wait > 0 {
+		log.Warn("login throttled", slog.String("ip", ip), slog.Duration("retry_after", wait))
+		return &cerror.TooManyAttemptsError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// failAttempt отмечает учтённую попытку неудачной. Для клиента это всегда неверные учётные данные,
+// задержка сработает на следующей попытке
+func (s *Auth) failAttempt(ctx context.Context, log *slog.Logger, login string, appID int32, ip string) error {
+	if s.guard == nil {
+		return cerror.ErrInvalidCredentials
+	}
+
+	if _, err := s.guard.Fail(ctx, login, appID, ip); err != nil {
+		log.Error("cerror save login attempt", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	return cerror.ErrInvalidCredentials
+}
+
+// releaseAttempt возвращает попытку, учтённую checkAttempts, если пароль верный. Неудачи, накопленные
+// до неё, остаются в силе до полного входа
+func (s *Auth) releaseAttempt(ctx context.Context, log *slog.Logger, login string, appID int32, ip string) {
+	if s.guard == nil {
+		return
+	}
+
+	if err := s.guard.Release(ctx, login, appID, ip); err != nil {
+		log.Error("cerror release login attempt", slog.String("err", err.Error()))
+	}
+}
+
+// resetAttempts сбрасывает счётчик логина после полного входа, включая второй фактор
+func (s *Auth) resetAttempts(ctx context.Context, log *slog.Logger, login string, appID int32, ip string) {
+	if s.guard == nil {
+		return
+	}
+
+	if err := s.guard.Success(ctx, login, appID, ip); err != nil {
+		log.Error("cerror reset login attempts", slog.String("err", err.Error()))
+	}
+}
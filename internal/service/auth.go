@@ -4,11 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/MorZLE/auth/internal/appsecret"
 	"github.com/MorZLE/auth/internal/domain/cerror"
 	"github.com/MorZLE/auth/internal/domain/models"
 	"github.com/MorZLE/auth/internal/generate/jwtgen"
 	"github.com/MorZLE/auth/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"time"
 )
@@ -16,12 +16,15 @@ import (
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=UserSaver
 type UserSaver interface {
 	SaveUser(ctx context.Context, login string, pswdHash []byte, appid int32) (uid int64, err error)
+	UpdatePassword(ctx context.Context, uid int64, pswdHash []byte) error
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=UserProvider
 type UserProvider interface {
 	User(ctx context.Context, login string, appid int32) (models.User, error)
-	IsAdmin(ctx context.Context, userID int32, appid int32) (models.Admin, error)
+	UserByID(ctx context.Context, uid int64) (models.User, error)
+	IsAdmin(ctx context.Context, userID int64, appid int32) (models.Admin, error)
+	HasAppAccess(ctx context.Context, userID int64, appID int32) (bool, error)
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=AppProvider
@@ -32,8 +35,137 @@ type AppProvider interface {
 //go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=AdminProvider
 type AdminProvider interface {
 	CreateAdmin(ctx context.Context, login string, lvl int32, appID int32) (uid int64, err error)
-	DeleteAdmin(ctx context.Context, login string) (res bool, err error)
-	AddApp(ctx context.Context, name, secret string) (uid int32, err error)
+	DeleteAdmin(ctx context.Context, login string, appID int32) (res bool, err error)
+	AddApp(ctx context.Context, name, secret, alg string) (uid int32, err error)
+	SetAppRequireVerified(ctx context.Context, appID int32, required bool) error
+	SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error
+	GrantAppAccess(ctx context.Context, userID int64, appID int32) error
+	RevokeAppAccess(ctx context.Context, userID int64, appID int32) error
+	Apps(ctx context.Context) ([]models.App, error)
+	UpdateApp(ctx context.Context, appID int32, name string) error
+	SetAppDisabled(ctx context.Context, appID int32, disabled bool) error
+	SetAppSecret(ctx context.Context, appID int32, secret string) error
+	DeleteApp(ctx context.Context, appID int32, cascade bool) error
+	SetAppSettings(ctx context.Context, appID int32, settings models.AppSettings) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=KeyProvider
+type KeyProvider interface {
+	SaveSigningKey(ctx context.Context, key models.SigningKey) (id int64, err error)
+	SigningKey(ctx context.Context, appID int32, alg string) (models.SigningKey, error)
+	SigningKeyByKID(ctx context.Context, kid string) (models.SigningKey, error)
+	SigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	ActivateSigningKey(ctx context.Context, id int64, at time.Time) error
+	DeleteSigningKey(ctx context.Context, id int64) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=RevocationProvider
+type RevocationProvider interface {
+	RevokeToken(ctx context.Context, token models.RevokedToken) error
+	TokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID int64, at time.Time, expiresAt time.Time) error
+	UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error)
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (deleted int64, err error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=PasswordValidator
+type PasswordValidator interface {
+	Validate(appID int32, login string, password string) (failedRules []string)
+	ValidateRules(rules models.PasswordRules, login string, password string) (failedRules []string)
+	CheckRules(rules models.PasswordRules) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=PasswordHasher
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (needsRehash bool, err error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=LoginGuard
+type LoginGuard interface {
+	Reserve(ctx context.Context, login string, appID int32, ip string) (retryAfter time.Duration, err error)
+	Fail(ctx context.Context, login string, appID int32, ip string) (retryAfter time.Duration, err error)
+	Success(ctx context.Context, login string, appID int32, ip string) error
+	Release(ctx context.Context, login string, appID int32, ip string) error
+	Unlock(ctx context.Context, login string, appID int32) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=ResetProvider
+type ResetProvider interface {
+	SavePasswordReset(ctx context.Context, reset models.PasswordReset) (id int64, err error)
+	PasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error)
+	UsePasswordReset(ctx context.Context, id int64) (ok bool, err error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=VerificationProvider
+type VerificationProvider interface {
+	SaveEmailVerification(ctx context.Context, v models.EmailVerification) (id int64, err error)
+	EmailVerification(ctx context.Context, tokenHash string) (models.EmailVerification, error)
+	UseEmailVerification(ctx context.Context, id int64) (ok bool, err error)
+	SetEmailVerified(ctx context.Context, uid int64) error
+}
+
+// MFAProvider хранит секреты TOTP, коды восстановления и незавершённые входы со вторым фактором
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=MFAProvider
+type MFAProvider interface {
+	SaveMFASecret(ctx context.Context, userID int64, secret string) error
+	MFA(ctx context.Context, userID int64) (models.MFA, error)
+	EnableMFA(ctx context.Context, userID int64, step int64, recoveryHashes []string) error
+	UseMFAStep(ctx context.Context, userID int64, step int64) (ok bool, err error)
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (ok bool, err error)
+	SaveMFAChallenge(ctx context.Context, c models.MFAChallenge) (id int64, err error)
+	MFAChallenge(ctx context.Context, tokenHash string) (models.MFAChallenge, error)
+	AttemptMFAChallenge(ctx context.Context, id int64, maxAttempts int) (ok bool, err error)
+	UseMFAChallenge(ctx context.Context, id int64) (ok bool, err error)
+}
+
+// WebAuthnProvider хранит ключи доступа пользователей и незавершённые церемонии WebAuthn
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=WebAuthnProvider
+type WebAuthnProvider interface {
+	SaveWebAuthnCredential(ctx context.Context, c models.WebAuthnCredential) (id int64, err error)
+	WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error
+	SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) (id int64, err error)
+	WebAuthnSession(ctx context.Context, tokenHash string) (models.WebAuthnSession, error)
+	UseWebAuthnSession(ctx context.Context, id int64) (ok bool, err error)
+}
+
+// RoleProvider хранит роли приложений, их разрешения и назначения пользователям
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=RoleProvider
+type RoleProvider interface {
+	SaveRole(ctx context.Context, role models.Role) (id int64, err error)
+	Roles(ctx context.Context, appID int32) ([]models.Role, error)
+	UserRoles(ctx context.Context, userID int64, appID int32) ([]models.Role, error)
+	DeleteRole(ctx context.Context, appID int32, name string) error
+	AssignRole(ctx context.Context, userID int64, appID int32, name string) error
+	UnassignRole(ctx context.Context, userID int64, appID int32, name string) error
+}
+
+// SecretCipher шифрует секреты перед сохранением в базу
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=SecretCipher
+type SecretCipher interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+// UserNotifier доставляет пользователю токены сброса пароля и подтверждения адреса
+//
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=UserNotifier
+type UserNotifier interface {
+	SendPasswordReset(ctx context.Context, user models.User, appID int32, token string) error
+	SendVerification(ctx context.Context, user models.User, appID int32, token string) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.20.0 --name=TokenProvider
+type TokenProvider interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) (id int64, err error)
+	RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, id int64) (ok bool, err error)
+	RevokeTokenFamily(ctx context.Context, familyID string) error
 }
 
 // NewAuth возвращает новый экземпляр сервиса
@@ -42,62 +174,381 @@ func NewAuth(log *slog.Logger,
 	usrSaver UserSaver,
 	appProvider AppProvider,
 	admProvider AdminProvider,
+	tknProvider TokenProvider,
+	keyProvider KeyProvider,
+	revProvider RevocationProvider,
+	rstProvider ResetProvider,
+	vrfProvider VerificationProvider,
+	mfaProvider MFAProvider,
+	waProvider WebAuthnProvider,
+	roleProvider RoleProvider,
+	notifier UserNotifier,
+	passPolicy PasswordValidator,
+	guard LoginGuard,
+	hasher PasswordHasher,
+	mfaCipher SecretCipher,
+	mfaIssuer string,
 	tokenTTL time.Duration,
+	refreshTTL time.Duration,
+	resetTTL time.Duration,
+	verifyTTL time.Duration,
+	mfaChallengeTTL time.Duration,
+	webauthnTTL time.Duration,
+	keyRotation time.Duration,
+	keyPublishDelay time.Duration,
 ) *Auth {
-	return &Auth{log: log, usrProvider: usrProvider, usrSaver: usrSaver, appProvider: appProvider, admProvider: admProvider, tokenTTL: tokenTTL}
+	return &Auth{
+		log:          log,
+		usrProvider:  usrProvider,
+		usrSaver:     usrSaver,
+		appProvider:  appProvider,
+		admProvider:  admProvider,
+		tknProvider:  tknProvider,
+		keyProvider:  keyProvider,
+		revProvider:  revProvider,
+		rstProvider:  rstProvider,
+		vrfProvider:  vrfProvider,
+		mfaProvider:  mfaProvider,
+		waProvider:   waProvider,
+		roleProvider: roleProvider,
+		notifier:     notifier,
+		passPolicy:   passPolicy,
+		guard:        guard,
+		hasher:       hasher,
+		tokenTTL:     tokenTTL,
+		refreshTTL:   refreshTTL,
+		resetTTL:     resetTTL,
+		verifyTTL:    verifyTTL,
+
+		mfaCipher:       mfaCipher,
+		mfaIssuer:       mfaIssuer,
+		mfaChallengeTTL: mfaChallengeTTL,
+		webauthnTTL:     webauthnTTL,
+
+		keyRotation:     keyRotation,
+		keyPublishDelay: keyPublishDelay,
+	}
 }
 
 type Auth struct {
-	log         *slog.Logger
-	usrProvider UserProvider
-	usrSaver    UserSaver
-	appProvider AppProvider
-	admProvider AdminProvider
-	tokenTTL    time.Duration
+	log          *slog.Logger
+	usrProvider  UserProvider
+	usrSaver     UserSaver
+	appProvider  AppProvider
+	admProvider  AdminProvider
+	tknProvider  TokenProvider
+	keyProvider  KeyProvider
+	revProvider  RevocationProvider
+	rstProvider  ResetProvider
+	vrfProvider  VerificationProvider
+	mfaProvider  MFAProvider
+	waProvider   WebAuthnProvider
+	roleProvider RoleProvider
+	notifier     UserNotifier
+	passPolicy   PasswordValidator
+	guard        LoginGuard
+	hasher       PasswordHasher
+	tokenTTL     time.Duration
+	refreshTTL   time.Duration
+	resetTTL     time.Duration
+	verifyTTL    time.Duration
+
+	mfaCipher       SecretCipher
+	mfaIssuer       string
+	mfaChallengeTTL time.Duration
+	webauthnTTL     time.Duration
+
+	keyRotation     time.Duration
+	keyPublishDelay time.Duration
 }
 
-func (s *Auth) LoginUser(ctx context.Context, login string, password string, appID int32) (token string, err error) {
+func (s *Auth) LoginUser(ctx context.Context, login string, password string, appID int32) (tokens models.Tokens, err error) {
 	const op = "Auth.LoginUser"
 
 	log := s.log.With(slog.String("op", op),
 		slog.String("login", login))
 	log.Info("login user")
 
+	ip := models.ClientIP(ctx)
+	if err := s.checkAttempts(ctx, log, login, appID, ip); err != nil {
+		return tokens, err
+	}
+
 	user, err := s.usrProvider.User(ctx, login, appID)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			s.log.Warn("user not found", slog.String("login", login),
 				slog.String("op", op),
 				slog.String("err", err.Error()))
-			return "", cerror.ErrInvalidCredentials
+			return tokens, s.failAttempt(ctx, log, login, appID, ip)
 		}
-		return "", fmt.Errorf("cerror get user %s: %w", op, err)
+		return tokens, fmt.Errorf("cerror get user %s: %w", op, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
+	needsRehash, err := s.hasher.Verify(user.PassHash, password)
+	if err != nil {
 		s.log.Error("invalid password", slog.String("err", err.Error()))
 
-		return "", fmt.Errorf("%s : %w", op, cerror.ErrInvalidCredentials)
+		return tokens, fmt.Errorf("%s : %w", op, s.failAttempt(ctx, log, login, appID, ip))
+	}
+
+	// счётчик неудач сбрасывается только после второго фактора, иначе вход с верным паролем
+	// обнулял бы неудачи перебора кодов MFA
+	s.releaseAttempt(ctx, log, login, appID, ip)
+
+	if needsRehash {
+		s.rehashPassword(ctx, log, user.ID, password)
 	}
 
 	app, err := s.appProvider.App(ctx, appID)
 	if err != nil {
 		s.log.Error("cerror get app", slog.String("err", err.Error()))
 		if errors.Is(err, storage.ErrAppNotFound) {
-			return "", cerror.ErrAppNotFound
+			return tokens, cerror.ErrAppNotFound
+		}
+		return tokens, err
+	}
+	if app.Disabled {
+		log.Warn("app disabled")
+		return tokens, cerror.ErrAppDisabled
+	}
+	if !app.Settings.LoginAllowed(models.LoginPassword) {
+		log.Warn("password login not allowed")
+		return tokens, cerror.ErrLoginNotAllowed
+	}
+
+	if app.RequireVerified && !user.EmailVerified {
+		log.Warn("email not verified")
+		return tokens, cerror.ErrEmailNotVerified
+	}
+
+	mfaEnabled, err := s.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("cerror get mfa", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if mfaEnabled {
+		return s.mfaChallenge(ctx, log, user, appID, false)
+	}
+	if app.Settings.RequireMFA {
+		// без ключа шифрования подключить MFA нельзя, иначе выдаётся токен только для её подключения
+		if s.mfaCipher == nil || s.mfaProvider == nil {
+			log.Warn("mfa required by app")
+			return tokens, cerror.ErrMFARequired
 		}
-		return "", err
+		return s.mfaChallenge(ctx, log, user, appID, true)
 	}
+	s.resetAttempts(ctx, log, login, appID, "")
 
-	token, err = jwtgen.NewJWT(user, app, s.tokenTTL)
+	familyID, err := jwtgen.NewRandomToken()
+	if err != nil {
+		s.log.Error("cerror generate token family", slog.String("err", err.Error()))
+		return tokens, fmt.Errorf("cerror generate token family %s: %w", op, err)
+	}
+
+	tokens, err = s.issueTokens(ctx, user, app, familyID)
 	if err != nil {
 		s.log.Error("cerror generate token", slog.String("err", err.Error()))
-		return "", fmt.Errorf("cerror generate token %s: %w", op, err)
+		return tokens, fmt.Errorf("cerror generate token %s: %w", op, err)
 	}
 
 	log.Info("user login success")
 
-	return token, nil
+	return tokens, nil
+}
+
+// Refresh обменивает refresh токен на новую пару токенов. Использованный токен становится недействительным,
+// а его повторное предъявление отзывает всё семейство токенов, выданных от одного входа
+func (s *Auth) Refresh(ctx context.Context, refreshToken string) (tokens models.Tokens, err error) {
+	const op = "Auth.Refresh"
+
+	log := s.log.With(slog.String("op", op))
+
+	stored, err := s.tknProvider.RefreshToken(ctx, jwtgen.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("refresh token not found")
+			return tokens, cerror.ErrInvalidToken
+		}
+		log.Error("cerror get refresh token", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	log = log.With(slog.Int64("userid", stored.UserID), slog.String("family", stored.FamilyID))
+
+	if stored.Revoked {
+		log.Warn("refresh token revoked")
+		return tokens, cerror.ErrInvalidToken
+	}
+	if stored.Used {
+		return tokens, s.revokeFamily(ctx, log, stored.FamilyID)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		log.Warn("refresh token expired")
+		return tokens, cerror.ErrInvalidToken
+	}
+
+	ok, err := s.tknProvider.UseRefreshToken(ctx, stored.ID)
+	if err != nil {
+		log.Error("cerror use refresh token", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if !ok {
+		return tokens, s.revokeFamily(ctx, log, stored.FamilyID)
+	}
+
+	user, err := s.usrProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return tokens, cerror.ErrInvalidToken
+		}
+		return tokens, cerror.ErrInternalErr
+	}
+	if err = s.checkAppAccess(ctx, log, user.ID, stored.AppID); err != nil {
+		return tokens, err
+	}
+
+	app, err := s.appProvider.App(ctx, stored.AppID)
+	if err != nil {
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return tokens, cerror.ErrAppNotFound
+		}
+		return tokens, cerror.ErrInternalErr
+	}
+	if app.Disabled {
+		log.Warn("app disabled")
+		return tokens, cerror.ErrAppDisabled
+	}
+
+	tokens, err = s.issueTokens(ctx, user, app, stored.FamilyID)
+	if err != nil {
+		log.Error("cerror generate token", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	log.Info("refresh token rotated")
+
+	return tokens, nil
+}
+
+// ValidateToken проверяет access токен от имени сервиса-потребителя и возвращает его claims
+func (s *Auth) ValidateToken(ctx context.Context, token string) (models.TokenClaims, error) {
+	const op = "Auth.ValidateToken"
+
+	log := s.log.With(slog.String("op", op))
+
+	claims, err := s.parseToken(ctx, log, token)
+	if err != nil {
+		return claims, err
+	}
+
+	log = log.With(slog.Int64("userid", claims.UserID), slog.Int("app_id", int(claims.AppID)))
+
+	admin, err := s.usrProvider.IsAdmin(ctx, claims.UserID, claims.AppID)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		log.Error("cerror check is admin", slog.String("err", err.Error()))
+		return claims, cerror.ErrInternalErr
+	}
+	claims.Lvl = admin.Lvl
+
+	log.Info("token validated")
+
+	return claims, nil
+}
+
+// parseToken проверяет подпись, срок действия и отзыв access токена
+func (s *Auth) parseToken(ctx context.Context, log *slog.Logger, token string) (models.TokenClaims, error) {
+	// ошибки хранилища отделяем от невалидного токена, чтобы не отвечать клиенту "токен невалиден" при сбое базы
+	var storageErr error
+	claims, err := jwtgen.ParseJWT(token, func(appID int32, kid string, alg string) (interface{}, error) {
+		key, err := s.verificationKey(ctx, appID, kid, alg)
+		if err != nil && !errors.Is(err, storage.ErrAppNotFound) && !errors.Is(err, storage.ErrKeyNotFound) {
+			storageErr = err
+		}
+		return key, err
+	})
+	if storageErr != nil {
+		log.Error("cerror get app", slog.String("err", storageErr.Error()))
+		return claims, cerror.ErrInternalErr
+	}
+	if err != nil {
+		log.Info("invalid token", slog.String("err", err.Error()))
+		return claims, cerror.ErrInvalidToken
+	}
+
+	revoked, err := s.tokenRevoked(ctx, claims)
+	if err != nil {
+		log.Error("cerror check token revocation", slog.String("err", err.Error()))
+		return claims, cerror.ErrInternalErr
+	}
+	if revoked {
+		log.Info("token revoked", slog.Int64("userid", claims.UserID), slog.String("jti", claims.ID))
+		return claims, cerror.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (s *Auth) revokeFamily(ctx context.Context, log *slog.Logger, familyID string) error {
+	log.Warn("refresh token reused, revoke family")
+
+	if err := s.tknProvider.RevokeTokenFamily(ctx, familyID); err != nil {
+		log.Error("cerror revoke token family", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	return cerror.ErrTokenReused
+}
+
+// accessTokenTTL время жизни access токенов приложения
+func (s *Auth) accessTokenTTL(app models.App) time.Duration {
+	if app.Settings.AccessTTL > 0 {
+		return app.Settings.AccessTTL
+	}
+	return s.tokenTTL
+}
+
+// refreshTokenTTL время жизни refresh токенов приложения
+func (s *Auth) refreshTokenTTL(app models.App) time.Duration {
+	if app.Settings.RefreshTTL > 0 {
+		return app.Settings.RefreshTTL
+	}
+	return s.refreshTTL
+}
+
+// issueTokens выпускает access JWT и новый refresh токен в указанном семействе
+func (s *Auth) issueTokens(ctx context.Context, user models.User, app models.App, familyID string) (models.Tokens, error) {
+	var tokens models.Tokens
+
+	roles, err := s.userRoles(ctx, user.ID, int32(app.ID))
+	if err != nil {
+		return tokens, err
+	}
+	user.Roles = roles
+
+	access, err := s.signJWT(ctx, user, app)
+	if err != nil {
+		return tokens, err
+	}
+
+	refresh, err := jwtgen.NewRandomToken()
+	if err != nil {
+		return tokens, err
+	}
+
+	_, err = s.tknProvider.SaveRefreshToken(ctx, models.RefreshToken{
+		TokenHash: jwtgen.HashToken(refresh),
+		UserID:    user.ID,
+		AppID:     int32(app.ID),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL(app)),
+	})
+	if err != nil {
+		return tokens, err
+	}
+
+	return models.Tokens{AccessToken: access, RefreshToken: refresh}, nil
 }
 
 func (s *Auth) RegisterNewUser(ctx context.Context, login string, password string, appid int32) (userid int64, err error) {
@@ -105,7 +556,25 @@ func (s *Auth) RegisterNewUser(ctx context.Context, login string, password strin
 
 	log := s.log.With(slog.String("op", op), slog.String("login", login))
 
-	passhash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	app, err := s.appProvider.App(ctx, appid)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return 0, cerror.ErrAppNotFound
+		}
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		return 0, cerror.ErrInternalErr
+	}
+	if app.Settings.RegistrationClosed {
+		log.Warn("registration closed")
+		return 0, cerror.ErrRegistrationClosed
+	}
+
+	if err := s.validatePassword(log, app, login, password); err != nil {
+		return 0, err
+	}
+
+	passhash, err := s.hasher.Hash(password)
 	if err != nil {
 		log.Error("failed generate passhash")
 		return 0, fmt.Errorf("failed generate passhash %s: %w", op, err)
@@ -121,13 +590,17 @@ func (s *Auth) RegisterNewUser(ctx context.Context, login string, password strin
 	}
 
 	log.Info("register user")
+
+	// аккаунт уже создан, поэтому ошибка отправки не отменяет регистрацию: письмо можно запросить повторно
+	s.sendVerification(ctx, log, models.User{ID: uid, Login: login}, appid)
+
 	return uid, nil
 }
 
-func (s *Auth) CheckIsAdmin(ctx context.Context, userid int32, appid int32) (models.Admin, error) {
+func (s *Auth) CheckIsAdmin(ctx context.Context, userid int64, appid int32) (models.Admin, error) {
 	const op = "auth.checkIsAdmin"
 
-	log := s.log.With(slog.String("op", op), slog.Int64("userid", int64(userid)))
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userid))
 
 	res, err := s.usrProvider.IsAdmin(ctx, userid, appid)
 	if err != nil {
@@ -143,12 +616,29 @@ func (s *Auth) CheckIsAdmin(ctx context.Context, userid int32, appid int32) (mod
 	return res, nil
 }
 
-func (s *Auth) CreateAdmin(ctx context.Context, login string, lvl int32, key string, appID int32) (userid int64, err error) {
+// AdminByLogin возвращает запись администратора приложения по логину пользователя.
+// ErrInvalidCredentials, если такого пользователя нет или он не администратор
+func (s *Auth) AdminByLogin(ctx context.Context, login string, appID int32) (models.Admin, error) {
+	const op = "auth.AdminByLogin"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login), slog.Int("app_id", int(appID)))
+
+	user, err := s.usrProvider.User(ctx, login, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.Admin{}, cerror.ErrInvalidCredentials
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return models.Admin{}, cerror.ErrInternalErr
+	}
+
+	return s.CheckIsAdmin(ctx, user.ID, appID)
+}
+
+func (s *Auth) CreateAdmin(ctx context.Context, login string, lvl int32, appID int32) (userid int64, err error) {
 	const op = "auth.CreateAdmin"
 	log := s.log.With(slog.String("op", op), slog.String("login", login), slog.Int("lvl", int(lvl)))
-	if !checkKeyAdmin(key) {
-		return 0, cerror.ErrNotRights
-	}
 
 	uid, err := s.admProvider.CreateAdmin(ctx, login, lvl, appID)
 	if err != nil {
@@ -164,16 +654,12 @@ func (s *Auth) CreateAdmin(ctx context.Context, login string, lvl int32, key str
 	return uid, nil
 }
 
-func (s *Auth) DeleteAdmin(ctx context.Context, login string, key string) (res bool, err error) {
+func (s *Auth) DeleteAdmin(ctx context.Context, login string, appID int32) (res bool, err error) {
 	const op = "auth.DeleteAdmin"
 
-	if !checkKeyAdmin(key) {
-		return false, cerror.ErrNotRights
-	}
-
-	log := s.log.With(slog.String("op", op), slog.String("login", login))
+	log := s.log.With(slog.String("op", op), slog.String("login", login), slog.Int("app_id", int(appID)))
 
-	uid, err := s.admProvider.DeleteAdmin(ctx, login)
+	uid, err := s.admProvider.DeleteAdmin(ctx, login, appID)
 	if err != nil {
 		log.Error("cerror DeleteAdmin", slog.String("err", err.Error()))
 
@@ -187,19 +673,28 @@ func (s *Auth) DeleteAdmin(ctx context.Context, login string, key string) (res b
 
 	return uid, nil
 }
-func (s *Auth) AddApp(ctx context.Context, name, secret, key string) (userid int32, err error) {
+func (s *Auth) AddApp(ctx context.Context, name, secret, alg string) (userid int32, err error) {
 	const op = "auth.AddApp"
 
-	if !checkKeyAdmin(key) {
-		return 0, cerror.ErrNotRights
-	}
-
 	log := s.log.With(slog.String("op", op), slog.String("name", name))
 
-	uid, err := s.admProvider.AddApp(ctx, name, secret)
+	if alg == "" {
+		alg = jwtgen.AlgHS256
+	}
+	if !jwtgen.ValidAlg(alg) {
+		log.Warn("unsupported alg", slog.String("alg", alg))
+		return 0, cerror.ErrUnsupportedAlg
+	}
+	// открытый секрет с префиксом шифрования нельзя отличить от зашифрованного
+	if appsecret.Encrypted(secret) {
+		log.Warn("app secret has reserved prefix")
+		return 0, cerror.ErrInvalidAppSecret
+	}
+
+	uid, err := s.admProvider.AddApp(ctx, name, secret, alg)
 	if err != nil {
 		log.Error("cerror AddApp", slog.String("err", err.Error()))
-		if errors.Is(err, storage.ErrAppExists) {
+		if errors.Is(err, storage.ErrAppExists) || errors.Is(err, storage.ErrUniqueApp) {
 			return 0, cerror.ErrAppExists
 		}
 		return 0, cerror.ErrInternalErr
@@ -209,6 +704,39 @@ func (s *Auth) AddApp(ctx context.Context, name, secret, key string) (userid int
 	return uid, nil
 }
 
-func checkKeyAdmin(key string) bool {
-	return key != ""
+// checkPassword проверяет пароль по политике приложения appID
+func (s *Auth) checkPassword(ctx context.Context, log *slog.Logger, appID int32, login string, password string) error {
+	if s.passPolicy == nil {
+		return nil
+	}
+
+	app, err := s.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return cerror.ErrAppNotFound
+		}
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	return s.validatePassword(log, app, login, password)
+}
+
+// validatePassword проверяет пароль по требованиям из настроек приложения, а если они не заданы, по конфигу
+func (s *Auth) validatePassword(log *slog.Logger, app models.App, login string, password string) error {
+	if s.passPolicy == nil {
+		return nil
+	}
+
+	var failed []string
+	if rules := app.Settings.PasswordPolicy; rules != nil {
+		failed = s.passPolicy.ValidateRules(*rules, login, password)
+	} else {
+		failed = s.passPolicy.Validate(int32(app.ID), login, password)
+	}
+	if len(failed) != 0 {
+		log.Info("password rejected by policy", slog.Any("rules", failed))
+		return &cerror.PasswordPolicyError{Rules: failed}
+	}
+	return nil
 }
@@ -3,17 +3,34 @@ package service
 import (
 	"context"
 	"errors"
+	"github.com/MorZLE/auth/internal/bruteforce"
+	"github.com/MorZLE/auth/internal/config"
 	"github.com/MorZLE/auth/internal/domain/cerror"
 	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/hasher"
+	"github.com/MorZLE/auth/internal/passpolicy"
+	"github.com/MorZLE/auth/internal/secretbox"
 	"github.com/MorZLE/auth/internal/service/mocks"
 	"github.com/MorZLE/auth/internal/storage"
+	"github.com/MorZLE/auth/internal/storage/memory"
+	"github.com/MorZLE/auth/internal/totp"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"reflect"
 	"testing"
+	"time"
 )
 
-const keyAdmin = "test"
+func testHasher(t *testing.T) *hasher.Hasher {
+	h, err := hasher.New(config.PasswordHash{Algorithm: hasher.Bcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("hasher.New() cerror = %v", err)
+	}
+	return h
+}
 
 func TestAuth_AddApp(t *testing.T) {
 
@@ -22,7 +39,7 @@ func TestAuth_AddApp(t *testing.T) {
 	type args struct {
 		name   string
 		secret string
-		key    string
+		alg    string
 	}
 	tests := []struct {
 		name       string
@@ -36,10 +53,9 @@ func TestAuth_AddApp(t *testing.T) {
 			args: args{
 				name:   "test",
 				secret: "test",
-				key:    keyAdmin,
 			},
 			mck: func(s *mocks.AdminProvider) {
-				s.On("AddApp", mock.Anything, "test", "test").Return(int32(1), nil)
+				s.On("AddApp", mock.Anything, "test", "test", "HS256").Return(int32(1), nil)
 			},
 			wantUserid: int32(1),
 			wantErr:    nil,
@@ -49,34 +65,55 @@ func TestAuth_AddApp(t *testing.T) {
 			args: args{
 				name:   "qwreqwrqwr",
 				secret: "qwqwr",
-				key:    keyAdmin,
 			},
 			mck: func(s *mocks.AdminProvider) {
-				s.On("AddApp", mock.Anything, "qwreqwrqwr", "qwqwr").Return(int32(1), nil)
+				s.On("AddApp", mock.Anything, "qwreqwrqwr", "qwqwr", "HS256").Return(int32(1), nil)
 			},
 			wantUserid: int32(1),
 			wantErr:    nil,
 		},
 		{
-			name: "negative_1",
+			name: "positive_rs256",
 			args: args{
 				name:   "qwreqwrqwr",
-				secret: "teqwrst",
-				key:    "",
+				secret: "qwqwr",
+				alg:    "RS256",
+			},
+			mck: func(s *mocks.AdminProvider) {
+				s.On("AddApp", mock.Anything, "qwreqwrqwr", "qwqwr", "RS256").Return(int32(2), nil)
+			},
+			wantUserid: int32(2),
+			wantErr:    nil,
+		},
+		{
+			name: "unsupported_alg",
+			args: args{
+				name:   "qwreqwrqwr",
+				secret: "qwqwr",
+				alg:    "none",
+			},
+			mck:        func(s *mocks.AdminProvider) {},
+			wantUserid: 0,
+			wantErr:    cerror.ErrUnsupportedAlg,
+		},
+		{
+			name: "reserved_secret_prefix",
+			args: args{
+				name:   "qwreqwrqwr",
+				secret: "env1:qwqwr",
 			},
 			mck:        func(s *mocks.AdminProvider) {},
 			wantUserid: 0,
-			wantErr:    cerror.ErrNotRights,
+			wantErr:    cerror.ErrInvalidAppSecret,
 		},
 		{
 			name: "negative_2",
 			args: args{
 				name:   "qwreqwrqwr",
 				secret: "teqwrst",
-				key:    keyAdmin,
 			},
 			mck: func(s *mocks.AdminProvider) {
-				s.On("AddApp", mock.Anything, "qwreqwrqwr", "teqwrst").Return(int32(0), storage.ErrAppExists)
+				s.On("AddApp", mock.Anything, "qwreqwrqwr", "teqwrst", "HS256").Return(int32(0), storage.ErrAppExists)
 			},
 			wantUserid: 0,
 			wantErr:    cerror.ErrAppExists,
@@ -86,10 +123,9 @@ func TestAuth_AddApp(t *testing.T) {
 			args: args{
 				name:   "qwreqwrqwr",
 				secret: "teqwrst",
-				key:    keyAdmin,
 			},
 			mck: func(s *mocks.AdminProvider) {
-				s.On("AddApp", mock.Anything, "qwreqwrqwr", "teqwrst").Return(int32(0), errors.ErrUnsupported)
+				s.On("AddApp", mock.Anything, "qwreqwrqwr", "teqwrst", "HS256").Return(int32(0), errors.ErrUnsupported)
 			},
 			wantUserid: 0,
 			wantErr:    cerror.ErrInternalErr,
@@ -104,7 +140,7 @@ func TestAuth_AddApp(t *testing.T) {
 				log:         slog.With(slog.String("service", "auth")),
 				admProvider: sqlite,
 			}
-			gotUserid, err := s.AddApp(context.Background(), tt.args.name, tt.args.secret, tt.args.key)
+			gotUserid, err := s.AddApp(context.Background(), tt.args.name, tt.args.secret, tt.args.alg)
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("AddApp() cerror = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -120,7 +156,7 @@ func TestAuth_CheckIsAdmin(t *testing.T) {
 	type mck func(s *mocks.UserProvider)
 
 	type args struct {
-		userid int32
+		userid int64
 		appid  int32
 	}
 	tests := []struct {
@@ -133,11 +169,11 @@ func TestAuth_CheckIsAdmin(t *testing.T) {
 		{
 			name: "positive_1",
 			args: args{
-				userid: int32(2),
+				userid: int64(2),
 				appid:  int32(1),
 			},
 			mck: func(s *mocks.UserProvider) {
-				s.On("IsAdmin", mock.Anything, int32(2), int32(1)).
+				s.On("IsAdmin", mock.Anything, int64(2), int32(1)).
 					Return(models.Admin{Lvl: int32(2)}, nil)
 			},
 			want: models.Admin{
@@ -148,11 +184,11 @@ func TestAuth_CheckIsAdmin(t *testing.T) {
 		{
 			name: "positive_2",
 			args: args{
-				userid: int32(1324546134),
+				userid: int64(1324546134),
 				appid:  int32(56),
 			},
 			mck: func(s *mocks.UserProvider) {
-				s.On("IsAdmin", mock.Anything, int32(1324546134), int32(56)).
+				s.On("IsAdmin", mock.Anything, int64(1324546134), int32(56)).
 					Return(models.Admin{Lvl: int32(2)}, nil)
 			},
 			want: models.Admin{
@@ -163,11 +199,11 @@ func TestAuth_CheckIsAdmin(t *testing.T) {
 		{
 			name: "negative_1",
 			args: args{
-				userid: int32(1324546134),
+				userid: int64(1324546134),
 				appid:  int32(56),
 			},
 			mck: func(s *mocks.UserProvider) {
-				s.On("IsAdmin", mock.Anything, int32(1324546134), int32(56)).
+				s.On("IsAdmin", mock.Anything, int64(1324546134), int32(56)).
 					Return(models.Admin{}, storage.ErrUserNotFound)
 			},
 			want:    models.Admin{},
@@ -176,11 +212,11 @@ func TestAuth_CheckIsAdmin(t *testing.T) {
 		{
 			name: "negative_2",
 			args: args{
-				userid: int32(1324546134),
+				userid: int64(1324546134),
 				appid:  int32(56),
 			},
 			mck: func(s *mocks.UserProvider) {
-				s.On("IsAdmin", mock.Anything, int32(1324546134), int32(56)).
+				s.On("IsAdmin", mock.Anything, int64(1324546134), int32(56)).
 					Return(models.Admin{}, errors.ErrUnsupported)
 			},
 			want:    models.Admin{},
@@ -213,7 +249,6 @@ func TestAuth_CreateAdmin(t *testing.T) {
 	type args struct {
 		login string
 		lvl   int32
-		key   string
 		appID int32
 	}
 	tests := []struct {
@@ -231,7 +266,6 @@ func TestAuth_CreateAdmin(t *testing.T) {
 			args: args{
 				login: "sefsef",
 				lvl:   int32(2),
-				key:   keyAdmin,
 				appID: int32(1),
 			},
 			wantUserid: int64(1),
@@ -245,7 +279,6 @@ func TestAuth_CreateAdmin(t *testing.T) {
 			args: args{
 				login: "awfawfawfawf",
 				lvl:   int32(2342),
-				key:   keyAdmin,
 				appID: int32(143),
 			},
 			wantUserid: int64(234652346),
@@ -259,7 +292,6 @@ func TestAuth_CreateAdmin(t *testing.T) {
 			args: args{
 				login: "awfawfawfawf",
 				lvl:   int32(2342),
-				key:   keyAdmin,
 				appID: int32(143),
 			},
 			wantUserid: int64(0),
@@ -273,24 +305,11 @@ func TestAuth_CreateAdmin(t *testing.T) {
 			args: args{
 				login: "awfawfawfawf",
 				lvl:   int32(2342),
-				key:   keyAdmin,
 				appID: int32(143),
 			},
 			wantUserid: int64(0),
 			wantErr:    cerror.ErrInternalErr,
 		},
-		{
-			name: "invalid_key",
-			mck:  func(m *mocks.AdminProvider) {},
-			args: args{
-				login: "awfawfawfawf",
-				lvl:   int32(2342),
-				key:   "",
-				appID: int32(143),
-			},
-			wantUserid: int64(0),
-			wantErr:    cerror.ErrNotRights,
-		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -300,7 +319,7 @@ func TestAuth_CreateAdmin(t *testing.T) {
 				log:         slog.With(slog.String("service", "auth")),
 				admProvider: sqlite,
 			}
-			gotUserid, err := s.CreateAdmin(context.Background(), tt.args.login, tt.args.lvl, tt.args.key, tt.args.appID)
+			gotUserid, err := s.CreateAdmin(context.Background(), tt.args.login, tt.args.lvl, tt.args.appID)
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("CreateAdmin() cerror = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -317,7 +336,7 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 
 	type args struct {
 		login string
-		key   string
+		appID int32
 	}
 
 	tests := []struct {
@@ -330,11 +349,11 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 		{
 			name: "positive_1",
 			mck: func(m *mocks.AdminProvider) {
-				m.On("DeleteAdmin", mock.Anything, "sefsef").Return(true, nil)
+				m.On("DeleteAdmin", mock.Anything, "sefsef", int32(1)).Return(true, nil)
 			},
 			args: args{
 				login: "sefsef",
-				key:   keyAdmin,
+				appID: 1,
 			},
 			wantRes: true,
 			wantErr: nil,
@@ -342,33 +361,35 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 		{
 			name: "positive_2",
 			mck: func(m *mocks.AdminProvider) {
-				m.On("DeleteAdmin", mock.Anything, "awdgresbh").Return(true, nil)
+				m.On("DeleteAdmin", mock.Anything, "awdgresbh", int32(1)).Return(true, nil)
 			},
 			args: args{
 				login: "awdgresbh",
-				key:   keyAdmin,
+				appID: 1,
 			},
 			wantRes: true,
 			wantErr: nil,
 		},
 		{
-			name: "invalid_key",
-			mck:  func(m *mocks.AdminProvider) {},
+			name: "other_app",
+			mck: func(m *mocks.AdminProvider) {
+				m.On("DeleteAdmin", mock.Anything, "sefsef", int32(2)).Return(true, nil)
+			},
 			args: args{
-				login: "awdgresbh",
-				key:   "",
+				login: "sefsef",
+				appID: 2,
 			},
-			wantRes: false,
-			wantErr: cerror.ErrNotRights,
+			wantRes: true,
+			wantErr: nil,
 		},
 		{
 			name: "negative_1",
 			mck: func(m *mocks.AdminProvider) {
-				m.On("DeleteAdmin", mock.Anything, "awdgresbh").Return(false, storage.ErrUserNotFound)
+				m.On("DeleteAdmin", mock.Anything, "awdgresbh", int32(1)).Return(false, storage.ErrUserNotFound)
 			},
 			args: args{
 				login: "awdgresbh",
-				key:   keyAdmin,
+				appID: 1,
 			},
 			wantRes: false,
 			wantErr: cerror.ErrInvalidCredentials,
@@ -376,11 +397,11 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 		{
 			name: "negative_2",
 			mck: func(m *mocks.AdminProvider) {
-				m.On("DeleteAdmin", mock.Anything, "awdgresbh").Return(false, errors.ErrUnsupported)
+				m.On("DeleteAdmin", mock.Anything, "awdgresbh", int32(1)).Return(false, errors.ErrUnsupported)
 			},
 			args: args{
 				login: "awdgresbh",
-				key:   keyAdmin,
+				appID: 1,
 			},
 			wantRes: false,
 			wantErr: cerror.ErrInternalErr,
@@ -396,7 +417,7 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 				admProvider: sqlite,
 			}
 
-			gotRes, err := s.DeleteAdmin(context.Background(), tt.args.login, tt.args.key)
+			gotRes, err := s.DeleteAdmin(context.Background(), tt.args.login, tt.args.appID)
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("DeleteAdmin() cerror = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -407,3 +428,2146 @@ func TestAuth_DeleteAdmin(t *testing.T) {
 		})
 	}
 }
+
+func TestAuth_AdminByLogin(t *testing.T) {
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "admin", int32(3)).Return(models.User{ID: 7, Login: "admin"}, nil)
+	usrProvider.On("User", mock.Anything, "user", int32(3)).Return(models.User{ID: 8, Login: "user"}, nil)
+	usrProvider.On("User", mock.Anything, "unknown", int32(3)).Return(models.User{}, storage.ErrUserNotFound)
+	usrProvider.On("IsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{UserID: 7, AppID: 3, Lvl: 2}, nil)
+	usrProvider.On("IsAdmin", mock.Anything, int64(8), int32(3)).Return(models.Admin{}, storage.ErrUserNotFound)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+	}
+	ctx := context.Background()
+
+	if admin, err := s.AdminByLogin(ctx, "admin", 3); err != nil || admin.Lvl != 2 {
+		t.Errorf("AdminByLogin() got = %+v, cerror = %v", admin, err)
+	}
+	for _, login := range []string{"user", "unknown"} {
+		if _, err := s.AdminByLogin(ctx, login, 3); !errors.Is(err, cerror.ErrInvalidCredentials) {
+			t.Errorf("AdminByLogin(%s) cerror = %v, wantErr %v", login, err, cerror.ErrInvalidCredentials)
+		}
+	}
+}
+
+func TestAuth_Refresh(t *testing.T) {
+	type mck func(t *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider)
+
+	const refresh = "refresh"
+	hash := jwtgen.HashToken(refresh)
+	stored := models.RefreshToken{
+		ID:        1,
+		TokenHash: hash,
+		UserID:    2,
+		AppID:     3,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name    string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "positive_1",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(stored, nil)
+				tp.On("UseRefreshToken", mock.Anything, int64(1)).Return(true, nil)
+				u.On("UserByID", mock.Anything, int64(2)).Return(models.User{ID: 2, Login: "test"}, nil)
+				u.On("HasAppAccess", mock.Anything, int64(2), int32(3)).Return(true, nil)
+				a.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Name: "app", Secret: "secret"}, nil)
+				tp.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(rt models.RefreshToken) bool {
+					return rt.FamilyID == "family" && rt.UserID == 2 && rt.AppID == 3 && rt.TokenHash != hash
+				})).Return(int64(2), nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "not_found",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(models.RefreshToken{}, storage.ErrTokenNotFound)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "access_revoked",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(stored, nil)
+				tp.On("UseRefreshToken", mock.Anything, int64(1)).Return(true, nil)
+				u.On("UserByID", mock.Anything, int64(2)).Return(models.User{ID: 2, Login: "test"}, nil)
+				u.On("HasAppAccess", mock.Anything, int64(2), int32(3)).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "app_disabled",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(stored, nil)
+				tp.On("UseRefreshToken", mock.Anything, int64(1)).Return(true, nil)
+				u.On("UserByID", mock.Anything, int64(2)).Return(models.User{ID: 2, Login: "test"}, nil)
+				u.On("HasAppAccess", mock.Anything, int64(2), int32(3)).Return(true, nil)
+				a.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Name: "app", Secret: "secret", Disabled: true}, nil)
+			},
+			wantErr: cerror.ErrAppDisabled,
+		},
+		{
+			name: "expired",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				expired := stored
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				tp.On("RefreshToken", mock.Anything, hash).Return(expired, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "revoked",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				revoked := stored
+				revoked.Revoked = true
+				tp.On("RefreshToken", mock.Anything, hash).Return(revoked, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "reused",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				used := stored
+				used.Used = true
+				tp.On("RefreshToken", mock.Anything, hash).Return(used, nil)
+				tp.On("RevokeTokenFamily", mock.Anything, "family").Return(nil)
+			},
+			wantErr: cerror.ErrTokenReused,
+		},
+		{
+			name: "reused_concurrently",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(stored, nil)
+				tp.On("UseRefreshToken", mock.Anything, int64(1)).Return(false, nil)
+				tp.On("RevokeTokenFamily", mock.Anything, "family").Return(nil)
+			},
+			wantErr: cerror.ErrTokenReused,
+		},
+		{
+			name: "storage_error",
+			mck: func(tp *mocks.TokenProvider, u *mocks.UserProvider, a *mocks.AppProvider) {
+				tp.On("RefreshToken", mock.Anything, hash).Return(models.RefreshToken{}, errors.ErrUnsupported)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tknProvider := mocks.NewTokenProvider(t)
+			usrProvider := mocks.NewUserProvider(t)
+			appProvider := mocks.NewAppProvider(t)
+			tt.mck(tknProvider, usrProvider, appProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				appProvider: appProvider,
+				tknProvider: tknProvider,
+				tokenTTL:    time.Hour,
+				refreshTTL:  time.Hour,
+			}
+			got, err := s.Refresh(context.Background(), refresh)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Refresh() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && (got.AccessToken == "" || got.RefreshToken == "" || got.RefreshToken == refresh) {
+				t.Errorf("Refresh() got = %v, want new token pair", got)
+			}
+		})
+	}
+}
+
+func TestAuth_ValidateToken(t *testing.T) {
+	type mck func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider)
+
+	user := models.User{ID: 7, Login: "test"}
+	app := models.App{ID: 3, Name: "app", Secret: "secret"}
+
+	valid, err := jwtgen.NewJWT(user, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	expired, err := jwtgen.NewJWT(user, app, -time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	foreign, err := jwtgen.NewJWT(user, models.App{ID: 3, Secret: "other"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		mck     mck
+		want    models.TokenClaims
+		wantErr error
+	}{
+		{
+			name:  "positive_admin",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+				r.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+				u.On("IsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{Lvl: 2}, nil)
+			},
+			want:    models.TokenClaims{UserID: 7, Login: "test", AppID: 3, Lvl: 2},
+			wantErr: nil,
+		},
+		{
+			name:  "positive_not_admin",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+				r.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+				u.On("IsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{}, storage.ErrUserNotFound)
+			},
+			want:    models.TokenClaims{UserID: 7, Login: "test", AppID: 3},
+			wantErr: nil,
+		},
+		{
+			name:  "revoked_token",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(true, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "revoked_all_user_tokens",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+				r.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Now().Add(time.Second), nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "revoked_before_issue",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+				r.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Now().Add(-time.Hour), nil)
+				u.On("IsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{}, storage.ErrUserNotFound)
+			},
+			want:    models.TokenClaims{UserID: 7, Login: "test", AppID: 3},
+			wantErr: nil,
+		},
+		{
+			name:  "revocation_storage_error",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, errors.ErrUnsupported)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+		{
+			name:  "expired",
+			token: expired,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil).Maybe()
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "wrong_signature",
+			token: foreign,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(app, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:    "malformed",
+			token:   "not.a.token",
+			mck:     func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "app_not_found",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(models.App{}, storage.ErrAppNotFound)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "storage_error",
+			token: valid,
+			mck: func(u *mocks.UserProvider, a *mocks.AppProvider, r *mocks.RevocationProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(models.App{}, errors.ErrUnsupported)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usrProvider := mocks.NewUserProvider(t)
+			appProvider := mocks.NewAppProvider(t)
+			revProvider := mocks.NewRevocationProvider(t)
+			tt.mck(usrProvider, appProvider, revProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				appProvider: appProvider,
+				revProvider: revProvider,
+			}
+			got, err := s.ValidateToken(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.ID == "" {
+				t.Errorf("ValidateToken() jti is empty")
+			}
+			got.ID, got.IssuedAt, got.ExpiresAt = "", time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateToken() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth_AsymmetricSigning(t *testing.T) {
+	keyProvider := mocks.NewKeyProvider(t)
+	usrProvider := mocks.NewUserProvider(t)
+	revProvider := mocks.NewRevocationProvider(t)
+
+	app := models.App{ID: 3, Name: "app", Secret: "secret", Alg: jwtgen.AlgES256}
+	user := models.User{ID: 7, Login: "test"}
+
+	var saved models.SigningKey
+	keyProvider.On("SigningKey", mock.Anything, int32(3), jwtgen.AlgES256).Return(models.SigningKey{}, storage.ErrKeyNotFound).Once()
+	keyProvider.On("SaveSigningKey", mock.Anything, mock.MatchedBy(func(key models.SigningKey) bool {
+		saved = key
+		return key.AppID == 3 && key.Alg == jwtgen.AlgES256 && key.KID != ""
+	})).Return(int64(1), nil).Once()
+	usrProvider.On("IsAdmin", mock.Anything, int64(7), int32(3)).Return(models.Admin{}, storage.ErrUserNotFound)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		keyProvider: keyProvider,
+		revProvider: revProvider,
+		tokenTTL:    time.Hour,
+	}
+
+	token, err := s.signJWT(context.Background(), user, app)
+	if err != nil {
+		t.Fatalf("signJWT() cerror = %v", err)
+	}
+
+	keyProvider.On("SigningKeyByKID", mock.Anything, saved.KID).Return(saved, nil)
+	revProvider.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+	revProvider.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+
+	claims, err := s.ValidateToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("ValidateToken() cerror = %v", err)
+	}
+	if claims.UserID != user.ID || claims.AppID != int32(app.ID) {
+		t.Errorf("ValidateToken() got = %v", claims)
+	}
+}
+
+func TestAuth_RotateKeys(t *testing.T) {
+	keyProvider := mocks.NewKeyProvider(t)
+
+	now := time.Now()
+	keys := []models.SigningKey{
+		// активный ключ старше интервала ротации без замены
+		{ID: 1, KID: "old_active", AppID: 1, Alg: jwtgen.AlgRS256, Status: models.KeyStatusActive, ActivatedAt: now.Add(-48 * time.Hour)},
+		// ожидающий ключ, опубликованный дольше publish delay
+		{ID: 2, KID: "ready", AppID: 2, Alg: jwtgen.AlgEdDSA, Status: models.KeyStatusPending, CreatedAt: now.Add(-time.Hour)},
+		{ID: 3, KID: "active_2", AppID: 2, Alg: jwtgen.AlgEdDSA, Status: models.KeyStatusActive, ActivatedAt: now.Add(-48 * time.Hour)},
+		// ожидающий ключ, ещё не успевший разойтись по кэшам
+		{ID: 4, KID: "fresh", AppID: 3, Alg: jwtgen.AlgEdDSA, Status: models.KeyStatusPending, CreatedAt: now},
+		// выведенный ключ, чьи токены уже истекли, и выведенный недавно
+		{ID: 5, KID: "expired", AppID: 1, Alg: jwtgen.AlgRS256, Status: models.KeyStatusRetired, RetiredAt: now.Add(-2 * time.Hour)},
+		{ID: 6, KID: "recent", AppID: 1, Alg: jwtgen.AlgRS256, Status: models.KeyStatusRetired, RetiredAt: now.Add(-time.Minute)},
+	}
+
+	keyProvider.On("SigningKeys", mock.Anything).Return(keys, nil)
+	keyProvider.On("SaveSigningKey", mock.Anything, mock.MatchedBy(func(key models.SigningKey) bool {
+		return key.AppID == 1 && key.Alg == jwtgen.AlgRS256 && key.Status == models.KeyStatusPending
+	})).Return(int64(7), nil).Once()
+	keyProvider.On("ActivateSigningKey", mock.Anything, int64(2), mock.Anything).Return(nil).Once()
+	keyProvider.On("DeleteSigningKey", mock.Anything, int64(5)).Return(nil).Once()
+
+	s := &Auth{
+		log:             slog.With(slog.String("service", "auth")),
+		keyProvider:     keyProvider,
+		tokenTTL:        time.Hour,
+		keyRotation:     24 * time.Hour,
+		keyPublishDelay: 10 * time.Minute,
+	}
+
+	if err := s.RotateKeys(context.Background()); err != nil {
+		t.Fatalf("RotateKeys() cerror = %v", err)
+	}
+}
+
+func TestAuth_RotateSigningKey(t *testing.T) {
+	type mck func(a *mocks.AppProvider, k *mocks.KeyProvider)
+
+	tests := []struct {
+		name    string
+		appID   int32
+		mck     mck
+		wantErr error
+	}{
+		{
+			name:  "positive",
+			appID: 1,
+			mck: func(a *mocks.AppProvider, k *mocks.KeyProvider) {
+				a.On("App", mock.Anything, int32(1)).Return(models.App{ID: 1, Alg: jwtgen.AlgES256}, nil)
+				k.On("SaveSigningKey", mock.Anything, mock.MatchedBy(func(key models.SigningKey) bool {
+					return key.AppID == 1 && key.Status == models.KeyStatusPending
+				})).Return(int64(5), nil)
+				k.On("ActivateSigningKey", mock.Anything, int64(5), mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:  "app not found",
+			appID: 2,
+			mck: func(a *mocks.AppProvider, k *mocks.KeyProvider) {
+				a.On("App", mock.Anything, int32(2)).Return(models.App{}, storage.ErrAppNotFound)
+			},
+			wantErr: cerror.ErrAppNotFound,
+		},
+		{
+			name:  "hs256 app",
+			appID: 3,
+			mck: func(a *mocks.AppProvider, k *mocks.KeyProvider) {
+				a.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Alg: jwtgen.AlgHS256}, nil)
+			},
+			wantErr: cerror.ErrUnsupportedAlg,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appProvider := mocks.NewAppProvider(t)
+			keyProvider := mocks.NewKeyProvider(t)
+			tt.mck(appProvider, keyProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				appProvider: appProvider,
+				keyProvider: keyProvider,
+			}
+			kid, err := s.RotateSigningKey(context.Background(), tt.appID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RotateSigningKey() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && kid == "" {
+				t.Errorf("RotateSigningKey() returned empty kid")
+			}
+		})
+	}
+}
+
+func TestAuth_Logout(t *testing.T) {
+	type mck func(tp *mocks.TokenProvider, r *mocks.RevocationProvider)
+
+	user := models.User{ID: 7, Login: "test"}
+	app := models.App{ID: 3, Name: "app", Secret: "secret"}
+	token, err := jwtgen.NewJWT(user, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+
+	const refresh = "refresh"
+	hash := jwtgen.HashToken(refresh)
+	notRevoked := func(r *mocks.RevocationProvider) {
+		r.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+		r.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+	}
+	revoked := mock.MatchedBy(func(rt models.RevokedToken) bool {
+		return rt.ID != "" && rt.UserID == 7 && rt.AppID == 3 && rt.ExpiresAt.After(time.Now())
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		refresh string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name:  "positive",
+			token: token,
+			mck: func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {
+				notRevoked(r)
+				r.On("RevokeToken", mock.Anything, revoked).Return(nil)
+			},
+		},
+		{
+			name:    "positive_with_refresh",
+			token:   token,
+			refresh: refresh,
+			mck: func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {
+				notRevoked(r)
+				r.On("RevokeToken", mock.Anything, revoked).Return(nil)
+				tp.On("RefreshToken", mock.Anything, hash).Return(models.RefreshToken{ID: 1, UserID: 7, FamilyID: "family"}, nil)
+				tp.On("RevokeTokenFamily", mock.Anything, "family").Return(nil)
+			},
+		},
+		{
+			name:    "foreign_refresh",
+			token:   token,
+			refresh: refresh,
+			mck: func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {
+				notRevoked(r)
+				r.On("RevokeToken", mock.Anything, revoked).Return(nil)
+				tp.On("RefreshToken", mock.Anything, hash).Return(models.RefreshToken{ID: 1, UserID: 8, FamilyID: "family"}, nil)
+			},
+		},
+		{
+			name:  "already_revoked",
+			token: token,
+			mck: func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {
+				r.On("TokenRevoked", mock.Anything, mock.Anything).Return(true, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:    "invalid_token",
+			token:   "not.a.token",
+			mck:     func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name:  "storage_error",
+			token: token,
+			mck: func(tp *mocks.TokenProvider, r *mocks.RevocationProvider) {
+				notRevoked(r)
+				r.On("RevokeToken", mock.Anything, revoked).Return(errors.ErrUnsupported)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appProvider := mocks.NewAppProvider(t)
+			tknProvider := mocks.NewTokenProvider(t)
+			revProvider := mocks.NewRevocationProvider(t)
+			appProvider.On("App", mock.Anything, int32(3)).Return(app, nil).Maybe()
+			tt.mck(tknProvider, revProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				appProvider: appProvider,
+				tknProvider: tknProvider,
+				revProvider: revProvider,
+			}
+			if err := s.Logout(context.Background(), tt.token, tt.refresh); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Logout() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuth_RevokeAllForUser(t *testing.T) {
+	type mck func(u *mocks.UserProvider, r *mocks.RevocationProvider)
+
+	tests := []struct {
+		name    string
+		userID  int64
+		mck     mck
+		wantErr error
+	}{
+		{
+			name:   "positive",
+			userID: 7,
+			mck: func(u *mocks.UserProvider, r *mocks.RevocationProvider) {
+				u.On("UserByID", mock.Anything, int64(7)).Return(models.User{ID: 7}, nil)
+				r.On("RevokeUserTokens", mock.Anything, int64(7), mock.Anything, mock.MatchedBy(func(exp time.Time) bool {
+					return exp.After(time.Now().Add(59 * time.Minute))
+				})).Return(nil)
+			},
+		},
+		{
+			name:   "user not found",
+			userID: 8,
+			mck: func(u *mocks.UserProvider, r *mocks.RevocationProvider) {
+				u.On("UserByID", mock.Anything, int64(8)).Return(models.User{}, storage.ErrUserNotFound)
+			},
+			wantErr: cerror.ErrUserNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usrProvider := mocks.NewUserProvider(t)
+			revProvider := mocks.NewRevocationProvider(t)
+			tt.mck(usrProvider, revProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				revProvider: revProvider,
+				tokenTTL:    time.Hour,
+			}
+			if err := s.RevokeAllForUser(context.Background(), tt.userID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RevokeAllForUser() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// memoryAuth собирает сервис на хранилище в памяти для сценариев из нескольких шагов
+func memoryAuth(t *testing.T) (*Auth, *memory.Storage) {
+	store := memory.New()
+	return &Auth{
+		log:          slog.With(slog.String("service", "auth")),
+		usrProvider:  store,
+		usrSaver:     store,
+		appProvider:  store,
+		admProvider:  store,
+		tknProvider:  store,
+		keyProvider:  store,
+		revProvider:  store,
+		roleProvider: store,
+		hasher:       testHasher(t),
+		tokenTTL:     time.Hour,
+		refreshTTL:   time.Hour,
+	}, store
+}
+
+// waitNextSecond ждёт начала следующей секунды, чтобы следующие шаги теста уложились в одну секунду
+func waitNextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+func TestAuth_RevokeAllForUser_SameSecondLogin(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	uid, err := s.RegisterNewUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+
+	waitNextSecond()
+	old, err := s.LoginUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	// токен той же миллисекунды, что и отзыв, считается выпущенным после него
+	time.Sleep(2 * time.Millisecond)
+	if err := s.RevokeAllForUser(ctx, uid); err != nil {
+		t.Fatalf("RevokeAllForUser() cerror = %v", err)
+	}
+	// вход в ту же секунду, что и отзыв, выдаёт рабочий токен, а выданный до отзыва отклоняется
+	tokens, err := s.LoginUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("ValidateToken() new token cerror = %v, want nil", err)
+	}
+	if _, err := s.ValidateToken(ctx, old.AccessToken); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("ValidateToken() old token cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+}
+
+func TestAuth_RegisterNewUser_PasswordPolicy(t *testing.T) {
+	passPolicy := mocks.NewPasswordValidator(t)
+	passPolicy.On("Validate", int32(1), "login", "1").Return([]string{"min_length"})
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(1)).Return(models.App{ID: 1}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		appProvider: appProvider,
+		passPolicy:  passPolicy,
+	}
+
+	_, err := s.RegisterNewUser(context.Background(), "login", "1", 1)
+	var policyErr *cerror.PasswordPolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, cerror.ErrWeakPassword) {
+		t.Fatalf("RegisterNewUser() cerror = %v, want PasswordPolicyError", err)
+	}
+	if !reflect.DeepEqual(policyErr.Rules, []string{"min_length"}) {
+		t.Errorf("RegisterNewUser() rules = %v", policyErr.Rules)
+	}
+}
+
+func TestAuth_LoginUser_BruteForce(t *testing.T) {
+	type mck func(g *mocks.LoginGuard, u *mocks.UserProvider)
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: 7, Login: "test", PassHash: passHash}
+	ctx := models.WithClientIP(context.Background(), "10.0.0.1")
+
+	tests := []struct {
+		name     string
+		password string
+		mck      mck
+		wantErr  error
+	}{
+		{
+			name:     "throttled",
+			password: "password",
+			mck: func(g *mocks.LoginGuard, u *mocks.UserProvider) {
+				g.On("Reserve", ctx, "test", int32(3), "10.0.0.1").Return(time.Minute, nil)
+			},
+			wantErr: cerror.ErrTooManyAttempts,
+		},
+		{
+			name:     "wrong_password",
+			password: "wrong",
+			mck: func(g *mocks.LoginGuard, u *mocks.UserProvider) {
+				g.On("Reserve", ctx, "test", int32(3), "10.0.0.1").Return(time.Duration(0), nil)
+				u.On("User", ctx, "test", int32(3)).Return(user, nil)
+				g.On("Fail", ctx, "test", int32(3), "10.0.0.1").Return(time.Second, nil)
+			},
+			wantErr: cerror.ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown_user",
+			password: "password",
+			mck: func(g *mocks.LoginGuard, u *mocks.UserProvider) {
+				g.On("Reserve", ctx, "test", int32(3), "10.0.0.1").Return(time.Duration(0), nil)
+				u.On("User", ctx, "test", int32(3)).Return(models.User{}, storage.ErrUserNotFound)
+				g.On("Fail", ctx, "test", int32(3), "10.0.0.1").Return(time.Second, nil)
+			},
+			wantErr: cerror.ErrInvalidCredentials,
+		},
+		{
+			name:     "guard_error",
+			password: "password",
+			mck: func(g *mocks.LoginGuard, u *mocks.UserProvider) {
+				g.On("Reserve", ctx, "test", int32(3), "10.0.0.1").Return(time.Duration(0), errors.ErrUnsupported)
+			},
+			wantErr: cerror.ErrInternalErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := mocks.NewLoginGuard(t)
+			usrProvider := mocks.NewUserProvider(t)
+			tt.mck(guard, usrProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				guard:       guard,
+				hasher:      testHasher(t),
+			}
+			_, err := s.LoginUser(ctx, "test", tt.password, 3)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoginUser() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuth_UnlockAccount(t *testing.T) {
+	guard := mocks.NewLoginGuard(t)
+	guard.On("Unlock", mock.Anything, "test", int32(3)).Return(nil).Once()
+
+	s := &Auth{
+		log:   slog.With(slog.String("service", "auth")),
+		guard: guard,
+	}
+
+	if err := s.UnlockAccount(context.Background(), "test", 3); err != nil {
+		t.Errorf("UnlockAccount() cerror = %v", err)
+	}
+}
+
+func TestAuth_ChangePassword(t *testing.T) {
+	type mck func(u *mocks.UserProvider, us *mocks.UserSaver, r *mocks.RevocationProvider)
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: 7, Login: "test", PassHash: passHash}
+
+	tests := []struct {
+		name        string
+		oldPassword string
+		newPassword string
+		mck         mck
+		wantErr     error
+	}{
+		{
+			name:        "positive",
+			oldPassword: "password",
+			newPassword: "newpassword",
+			mck: func(u *mocks.UserProvider, us *mocks.UserSaver, r *mocks.RevocationProvider) {
+				u.On("User", mock.Anything, "test", int32(3)).Return(user, nil)
+				us.On("UpdatePassword", mock.Anything, int64(7), mock.Anything).Return(nil)
+				r.On("RevokeUserTokens", mock.Anything, int64(7), mock.Anything, mock.Anything).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name:        "wrong_password",
+			oldPassword: "wrong",
+			newPassword: "newpassword",
+			mck: func(u *mocks.UserProvider, us *mocks.UserSaver, r *mocks.RevocationProvider) {
+				u.On("User", mock.Anything, "test", int32(3)).Return(user, nil)
+			},
+			wantErr: cerror.ErrInvalidCredentials,
+		},
+		{
+			name:        "unknown_user",
+			oldPassword: "password",
+			newPassword: "newpassword",
+			mck: func(u *mocks.UserProvider, us *mocks.UserSaver, r *mocks.RevocationProvider) {
+				u.On("User", mock.Anything, "test", int32(3)).Return(models.User{}, storage.ErrUserNotFound)
+			},
+			wantErr: cerror.ErrInvalidCredentials,
+		},
+		{
+			name:        "weak_password",
+			oldPassword: "password",
+			newPassword: "weak",
+			mck: func(u *mocks.UserProvider, us *mocks.UserSaver, r *mocks.RevocationProvider) {
+				u.On("User", mock.Anything, "test", int32(3)).Return(user, nil)
+			},
+			wantErr: cerror.ErrWeakPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usrProvider := mocks.NewUserProvider(t)
+			usrSaver := mocks.NewUserSaver(t)
+			revProvider := mocks.NewRevocationProvider(t)
+			passPolicy := mocks.NewPasswordValidator(t)
+			tt.mck(usrProvider, usrSaver, revProvider)
+			passPolicy.On("Validate", int32(3), "test", "weak").Return([]string{"min_length"}).Maybe()
+			passPolicy.On("Validate", int32(3), "test", "newpassword").Return([]string(nil)).Maybe()
+			appProvider := mocks.NewAppProvider(t)
+			appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3}, nil).Maybe()
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				usrSaver:    usrSaver,
+				appProvider: appProvider,
+				revProvider: revProvider,
+				passPolicy:  passPolicy,
+				hasher:      testHasher(t),
+				tokenTTL:    time.Hour,
+			}
+			err := s.ChangePassword(context.Background(), "test", 3, tt.oldPassword, tt.newPassword)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ChangePassword() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuth_ChangePassword_LoginAgain(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if _, err := s.RegisterNewUser(ctx, "test", "password", appID); err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+
+	waitNextSecond()
+	old, err := s.LoginUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := s.ChangePassword(ctx, "test", appID, "password", "newpassword"); err != nil {
+		t.Fatalf("ChangePassword() cerror = %v", err)
+	}
+	// клиент входит с новым паролем сразу после смены, в ту же секунду
+	tokens, err := s.LoginUser(ctx, "test", "newpassword", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("ValidateToken() new token cerror = %v, want nil", err)
+	}
+	if _, err := s.ValidateToken(ctx, old.AccessToken); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("ValidateToken() old token cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+}
+
+func TestAuth_AppPasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	policy, err := passpolicy.New(config.PasswordPolicy{Default: config.PasswordRules{MinLength: 4}})
+	if err != nil {
+		t.Fatalf("passpolicy.New() cerror = %v", err)
+	}
+	s.passPolicy = policy
+	s.rstProvider = store
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	invalid := models.AppSettings{PasswordPolicy: &models.PasswordRules{MinLength: 20, MaxLength: 10}}
+	if err := s.UpdateAppSettings(ctx, appID, invalid); !errors.Is(err, cerror.ErrInvalidAppSettings) {
+		t.Fatalf("UpdateAppSettings() invalid policy cerror = %v, want %v", err, cerror.ErrInvalidAppSettings)
+	}
+	settings := models.AppSettings{PasswordPolicy: &models.PasswordRules{MinLength: 12, RequireDigit: true}}
+	if err := s.UpdateAppSettings(ctx, appID, settings); err != nil {
+		t.Fatalf("UpdateAppSettings() cerror = %v", err)
+	}
+
+	// пароль проходит default из конфига, но не требования приложения
+	if _, err := s.RegisterNewUser(ctx, "test", "short1", appID); !errors.Is(err, cerror.ErrWeakPassword) {
+		t.Errorf("RegisterNewUser() cerror = %v, want %v", err, cerror.ErrWeakPassword)
+	}
+	uid, err := s.RegisterNewUser(ctx, "test", "long password 1", appID)
+	if err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+	if err := s.ChangePassword(ctx, "test", appID, "long password 1", "long password"); !errors.Is(err, cerror.ErrWeakPassword) {
+		t.Errorf("ChangePassword() cerror = %v, want %v", err, cerror.ErrWeakPassword)
+	}
+
+	_, err = store.SavePasswordReset(ctx, models.PasswordReset{TokenHash: jwtgen.HashToken("token"), UserID: uid,
+		AppID: appID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SavePasswordReset() cerror = %v", err)
+	}
+	if err := s.ConfirmPasswordReset(ctx, "token", "short2"); !errors.Is(err, cerror.ErrWeakPassword) {
+		t.Errorf("ConfirmPasswordReset() cerror = %v, want %v", err, cerror.ErrWeakPassword)
+	}
+	if err := s.ConfirmPasswordReset(ctx, "token", "another password 2"); err != nil {
+		t.Errorf("ConfirmPasswordReset() cerror = %v", err)
+	}
+}
+
+func TestAuth_RequestPasswordReset(t *testing.T) {
+	user := models.User{ID: 7, Login: "test"}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(user, nil).Once()
+	usrProvider.On("User", mock.Anything, "unknown", int32(3)).Return(models.User{}, storage.ErrUserNotFound).Once()
+
+	var sent string
+	notifier := mocks.NewUserNotifier(t)
+	notifier.On("SendPasswordReset", mock.Anything, user, int32(3), mock.Anything).
+		Run(func(args mock.Arguments) { sent = args.String(3) }).Return(nil).Once()
+
+	rstProvider := mocks.NewResetProvider(t)
+	rstProvider.On("SavePasswordReset", mock.Anything, mock.MatchedBy(func(r models.PasswordReset) bool {
+		return r.UserID == 7 && r.AppID == 3 && r.TokenHash != "" && r.ExpiresAt.After(time.Now())
+	})).Return(int64(1), nil).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		rstProvider: rstProvider,
+		notifier:    notifier,
+		resetTTL:    time.Hour,
+	}
+
+	if err := s.RequestPasswordReset(context.Background(), "test", 3); err != nil {
+		t.Fatalf("RequestPasswordReset() cerror = %v", err)
+	}
+	saved := rstProvider.Calls[0].Arguments.Get(1).(models.PasswordReset)
+	if saved.TokenHash != jwtgen.HashToken(sent) {
+		t.Errorf("RequestPasswordReset() stored hash does not match sent token")
+	}
+
+	if err := s.RequestPasswordReset(context.Background(), "unknown", 3); err != nil {
+		t.Errorf("RequestPasswordReset() for unknown user cerror = %v, want nil", err)
+	}
+}
+
+func TestAuth_ConfirmPasswordReset(t *testing.T) {
+	type mck func(r *mocks.ResetProvider, u *mocks.UserProvider, us *mocks.UserSaver, rv *mocks.RevocationProvider)
+
+	user := models.User{ID: 7, Login: "test"}
+	reset := models.PasswordReset{ID: 1, UserID: 7, AppID: 3, ExpiresAt: time.Now().Add(time.Hour)}
+	hash := jwtgen.HashToken("token")
+
+	tests := []struct {
+		name    string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "positive",
+			mck: func(r *mocks.ResetProvider, u *mocks.UserProvider, us *mocks.UserSaver, rv *mocks.RevocationProvider) {
+				r.On("PasswordReset", mock.Anything, hash).Return(reset, nil)
+				u.On("UserByID", mock.Anything, int64(7)).Return(user, nil)
+				r.On("UsePasswordReset", mock.Anything, int64(1)).Return(true, nil)
+				us.On("UpdatePassword", mock.Anything, int64(7), mock.Anything).Return(nil)
+				rv.On("RevokeUserTokens", mock.Anything, int64(7), mock.Anything, mock.Anything).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "not_found",
+			mck: func(r *mocks.ResetProvider, u *mocks.UserProvider, us *mocks.UserSaver, rv *mocks.RevocationProvider) {
+				r.On("PasswordReset", mock.Anything, hash).Return(models.PasswordReset{}, storage.ErrTokenNotFound)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			mck: func(r *mocks.ResetProvider, u *mocks.UserProvider, us *mocks.UserSaver, rv *mocks.RevocationProvider) {
+				expired := reset
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				r.On("PasswordReset", mock.Anything, hash).Return(expired, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "already_used",
+			mck: func(r *mocks.ResetProvider, u *mocks.UserProvider, us *mocks.UserSaver, rv *mocks.RevocationProvider) {
+				r.On("PasswordReset", mock.Anything, hash).Return(reset, nil)
+				u.On("UserByID", mock.Anything, int64(7)).Return(user, nil)
+				r.On("UsePasswordReset", mock.Anything, int64(1)).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rstProvider := mocks.NewResetProvider(t)
+			usrProvider := mocks.NewUserProvider(t)
+			usrSaver := mocks.NewUserSaver(t)
+			revProvider := mocks.NewRevocationProvider(t)
+			tt.mck(rstProvider, usrProvider, usrSaver, revProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				usrSaver:    usrSaver,
+				revProvider: revProvider,
+				rstProvider: rstProvider,
+				hasher:      testHasher(t),
+				tokenTTL:    time.Hour,
+			}
+			err := s.ConfirmPasswordReset(context.Background(), "token", "newpassword")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConfirmPasswordReset() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuth_RegisterNewUser_SendsVerification(t *testing.T) {
+	usrSaver := mocks.NewUserSaver(t)
+	usrSaver.On("SaveUser", mock.Anything, "test", mock.Anything, int32(3)).Return(int64(7), nil)
+
+	vrfProvider := mocks.NewVerificationProvider(t)
+	vrfProvider.On("SaveEmailVerification", mock.Anything, mock.MatchedBy(func(v models.EmailVerification) bool {
+		return v.UserID == 7 && v.AppID == 3 && v.TokenHash != "" && v.ExpiresAt.After(time.Now())
+	})).Return(int64(1), nil).Once()
+
+	notifier := mocks.NewUserNotifier(t)
+	notifier.On("SendVerification", mock.Anything, models.User{ID: 7, Login: "test"}, int32(3), mock.Anything).
+		Return(errors.New("queue unavailable")).Once()
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		appProvider: appProvider,
+		usrSaver:    usrSaver,
+		vrfProvider: vrfProvider,
+		notifier:    notifier,
+		hasher:      testHasher(t),
+		verifyTTL:   time.Hour,
+	}
+
+	// ошибка отправки письма не отменяет регистрацию
+	uid, err := s.RegisterNewUser(context.Background(), "test", "password", 3)
+	if err != nil || uid != 7 {
+		t.Errorf("RegisterNewUser() got = %v, cerror = %v", uid, err)
+	}
+}
+
+func TestAuth_LoginUser_EmailNotVerified(t *testing.T) {
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test", PassHash: passHash}, nil)
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Secret: "secret", RequireVerified: true}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		appProvider: appProvider,
+		hasher:      testHasher(t),
+	}
+
+	if _, err := s.LoginUser(context.Background(), "test", "password", 3); !errors.Is(err, cerror.ErrEmailNotVerified) {
+		t.Errorf("LoginUser() cerror = %v, wantErr %v", err, cerror.ErrEmailNotVerified)
+	}
+}
+
+func TestAuth_LoginUser_AppDisabled(t *testing.T) {
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test", PassHash: passHash}, nil)
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Secret: "secret", Disabled: true}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		appProvider: appProvider,
+		hasher:      testHasher(t),
+	}
+
+	if _, err := s.LoginUser(context.Background(), "test", "password", 3); !errors.Is(err, cerror.ErrAppDisabled) {
+		t.Errorf("LoginUser() cerror = %v, wantErr %v", err, cerror.ErrAppDisabled)
+	}
+}
+
+func TestAuth_RegisterNewUser_RegistrationClosed(t *testing.T) {
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).
+		Return(models.App{ID: 3, Settings: models.AppSettings{RegistrationClosed: true}}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		appProvider: appProvider,
+	}
+
+	if _, err := s.RegisterNewUser(context.Background(), "test", "password", 3); !errors.Is(err, cerror.ErrRegistrationClosed) {
+		t.Errorf("RegisterNewUser() cerror = %v, wantErr %v", err, cerror.ErrRegistrationClosed)
+	}
+}
+
+func TestAuth_LoginUser_AppSettings(t *testing.T) {
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings models.AppSettings
+		wantErr  error
+	}{
+		{name: "password_not_allowed", settings: models.AppSettings{LoginMethods: []string{models.LoginWebAuthn}},
+			wantErr: cerror.ErrLoginNotAllowed},
+		{name: "mfa_required", settings: models.AppSettings{RequireMFA: true}, wantErr: cerror.ErrMFARequired},
+		{name: "ttl_and_claims", settings: models.AppSettings{AccessTTL: time.Minute, RefreshTTL: 2 * time.Hour,
+			LoginMethods: []string{models.LoginPassword}, Claims: map[string]string{"tenant": "acme"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usrProvider := mocks.NewUserProvider(t)
+			usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test", PassHash: passHash}, nil)
+			appProvider := mocks.NewAppProvider(t)
+			appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Secret: "secret", Settings: tt.settings}, nil)
+			tknProvider := mocks.NewTokenProvider(t)
+			roleProvider := mocks.NewRoleProvider(t)
+			if tt.wantErr == nil {
+				roleProvider.On("UserRoles", mock.Anything, int64(7), int32(3)).Return(nil, nil)
+				tknProvider.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(r models.RefreshToken) bool {
+					return r.ExpiresAt.After(time.Now().Add(time.Hour)) && r.ExpiresAt.Before(time.Now().Add(3*time.Hour))
+				})).Return(int64(1), nil).Once()
+			}
+
+			s := &Auth{
+				log:          slog.With(slog.String("service", "auth")),
+				usrProvider:  usrProvider,
+				appProvider:  appProvider,
+				tknProvider:  tknProvider,
+				roleProvider: roleProvider,
+				hasher:       testHasher(t),
+				tokenTTL:     time.Hour,
+				refreshTTL:   24 * time.Hour,
+			}
+
+			got, err := s.LoginUser(context.Background(), "test", "password", 3)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoginUser() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			claims := jwt.MapClaims{}
+			if _, err = jwt.ParseWithClaims(got.AccessToken, claims, func(*jwt.Token) (interface{}, error) {
+				return []byte("secret"), nil
+			}); err != nil {
+				t.Fatalf("ParseWithClaims() cerror = %v", err)
+			}
+			exp, _ := claims.GetExpirationTime()
+			if claims["tenant"] != "acme" || exp == nil || exp.After(time.Now().Add(2*time.Minute)) {
+				t.Errorf("LoginUser() access token claims = %v", claims)
+			}
+		})
+	}
+}
+
+func TestAuth_AppSettings(t *testing.T) {
+	settings := models.AppSettings{AccessTTL: time.Minute, LoginMethods: []string{models.LoginPassword},
+		Claims: map[string]string{"tenant": "acme"}}
+
+	admProvider := mocks.NewAdminProvider(t)
+	admProvider.On("SetAppSettings", mock.Anything, int32(3), settings).Return(nil).Once()
+	admProvider.On("SetAppSettings", mock.Anything, int32(4), models.AppSettings{}).Return(storage.ErrAppNotFound).Once()
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Settings: settings}, nil).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		admProvider: admProvider,
+		appProvider: appProvider,
+		tokenTTL:    time.Hour,
+	}
+	ctx := context.Background()
+
+	if got, err := s.GetAppSettings(ctx, 3); err != nil || !reflect.DeepEqual(got, settings) {
+		t.Errorf("GetAppSettings() got = %+v, cerror = %v", got, err)
+	}
+	if err := s.UpdateAppSettings(ctx, 3, settings); err != nil {
+		t.Errorf("UpdateAppSettings() cerror = %v", err)
+	}
+	if err := s.UpdateAppSettings(ctx, 4, models.AppSettings{}); !errors.Is(err, cerror.ErrAppNotFound) {
+		t.Errorf("UpdateAppSettings() cerror = %v, wantErr %v", err, cerror.ErrAppNotFound)
+	}
+
+	for name, invalid := range map[string]models.AppSettings{
+		"access_ttl_over_token_ttl": {AccessTTL: 2 * time.Hour},
+		"negative_ttl":              {RefreshTTL: -time.Second},
+		"unknown_login_method":      {LoginMethods: []string{"sms"}},
+		"reserved_claim":            {Claims: map[string]string{"uid": "1"}},
+	} {
+		if err := s.UpdateAppSettings(ctx, 3, invalid); !errors.Is(err, cerror.ErrInvalidAppSettings) {
+			t.Errorf("UpdateAppSettings() %s cerror = %v, wantErr %v", name, err, cerror.ErrInvalidAppSettings)
+		}
+	}
+	if err := s.UpdateAppSettings(ctx, 3, models.AppSettings{RequireMFA: true}); !errors.Is(err, cerror.ErrMFANotConfigured) {
+		t.Errorf("UpdateAppSettings() require mfa cerror = %v, wantErr %v", err, cerror.ErrMFANotConfigured)
+	}
+}
+
+func TestAuth_VerifyEmail(t *testing.T) {
+	type mck func(v *mocks.VerificationProvider)
+
+	verification := models.EmailVerification{ID: 1, UserID: 7, AppID: 3, ExpiresAt: time.Now().Add(time.Hour)}
+	hash := jwtgen.HashToken("token")
+
+	tests := []struct {
+		name    string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "positive",
+			mck: func(v *mocks.VerificationProvider) {
+				v.On("EmailVerification", mock.Anything, hash).Return(verification, nil)
+				v.On("UseEmailVerification", mock.Anything, int64(1)).Return(true, nil)
+				v.On("SetEmailVerified", mock.Anything, int64(7)).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "not_found",
+			mck: func(v *mocks.VerificationProvider) {
+				v.On("EmailVerification", mock.Anything, hash).Return(models.EmailVerification{}, storage.ErrTokenNotFound)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			mck: func(v *mocks.VerificationProvider) {
+				expired := verification
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				v.On("EmailVerification", mock.Anything, hash).Return(expired, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "already_used",
+			mck: func(v *mocks.VerificationProvider) {
+				v.On("EmailVerification", mock.Anything, hash).Return(verification, nil)
+				v.On("UseEmailVerification", mock.Anything, int64(1)).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vrfProvider := mocks.NewVerificationProvider(t)
+			tt.mck(vrfProvider)
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				vrfProvider: vrfProvider,
+			}
+			if err := s.VerifyEmail(context.Background(), "token"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyEmail() cerror = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuth_ResendVerification(t *testing.T) {
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "verified", int32(3)).Return(models.User{ID: 8, Login: "verified", EmailVerified: true}, nil).Once()
+	usrProvider.On("User", mock.Anything, "unknown", int32(3)).Return(models.User{}, storage.ErrUserNotFound).Once()
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test"}, nil).Once()
+
+	vrfProvider := mocks.NewVerificationProvider(t)
+	vrfProvider.On("SaveEmailVerification", mock.Anything, mock.Anything).Return(int64(1), nil).Once()
+	notifier := mocks.NewUserNotifier(t)
+	notifier.On("SendVerification", mock.Anything, models.User{ID: 7, Login: "test"}, int32(3), mock.Anything).Return(nil).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		vrfProvider: vrfProvider,
+		notifier:    notifier,
+		verifyTTL:   time.Hour,
+	}
+
+	for _, login := range []string{"verified", "unknown", "test"} {
+		if err := s.ResendVerification(context.Background(), login, 3); err != nil {
+			t.Errorf("ResendVerification(%s) cerror = %v", login, err)
+		}
+	}
+}
+
+func TestAuth_SetAppRequireVerified(t *testing.T) {
+	admProvider := mocks.NewAdminProvider(t)
+	admProvider.On("SetAppRequireVerified", mock.Anything, int32(3), true).Return(nil).Once()
+	admProvider.On("SetAppRequireVerified", mock.Anything, int32(4), true).Return(storage.ErrAppNotFound).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		admProvider: admProvider,
+	}
+
+	if err := s.SetAppRequireVerified(context.Background(), 3, true); err != nil {
+		t.Errorf("SetAppRequireVerified() cerror = %v", err)
+	}
+	if err := s.SetAppRequireVerified(context.Background(), 4, true); !errors.Is(err, cerror.ErrAppNotFound) {
+		t.Errorf("SetAppRequireVerified() cerror = %v, wantErr %v", err, cerror.ErrAppNotFound)
+	}
+}
+
+func TestAuth_AppAccess(t *testing.T) {
+	admProvider := mocks.NewAdminProvider(t)
+	admProvider.On("GrantAppAccess", mock.Anything, int64(7), int32(3)).Return(nil).Once()
+	admProvider.On("GrantAppAccess", mock.Anything, int64(8), int32(3)).Return(storage.ErrUserNotFound).Once()
+	admProvider.On("GrantAppAccess", mock.Anything, int64(7), int32(4)).Return(storage.ErrAppNotFound).Once()
+	admProvider.On("GrantAppAccess", mock.Anything, int64(9), int32(3)).Return(storage.ErrUserExists).Once()
+	admProvider.On("RevokeAppAccess", mock.Anything, int64(7), int32(3)).Return(nil).Once()
+	admProvider.On("RevokeAppAccess", mock.Anything, int64(8), int32(3)).Return(storage.ErrUserNotFound).Once()
+	admProvider.On("RevokeAppAccess", mock.Anything, int64(9), int32(3)).Return(errors.ErrUnsupported).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		admProvider: admProvider,
+	}
+	ctx := context.Background()
+
+	if err := s.GrantAppAccess(ctx, 7, 3); err != nil {
+		t.Errorf("GrantAppAccess() cerror = %v", err)
+	}
+	if err := s.GrantAppAccess(ctx, 8, 3); !errors.Is(err, cerror.ErrUserNotFound) {
+		t.Errorf("GrantAppAccess() cerror = %v, wantErr %v", err, cerror.ErrUserNotFound)
+	}
+	if err := s.GrantAppAccess(ctx, 7, 4); !errors.Is(err, cerror.ErrAppNotFound) {
+		t.Errorf("GrantAppAccess() cerror = %v, wantErr %v", err, cerror.ErrAppNotFound)
+	}
+	if err := s.GrantAppAccess(ctx, 9, 3); !errors.Is(err, cerror.ErrUserExists) {
+		t.Errorf("GrantAppAccess() cerror = %v, wantErr %v", err, cerror.ErrUserExists)
+	}
+
+	if err := s.RevokeAppAccess(ctx, 7, 3); err != nil {
+		t.Errorf("RevokeAppAccess() cerror = %v", err)
+	}
+	if err := s.RevokeAppAccess(ctx, 8, 3); !errors.Is(err, cerror.ErrUserNotFound) {
+		t.Errorf("RevokeAppAccess() cerror = %v, wantErr %v", err, cerror.ErrUserNotFound)
+	}
+	if err := s.RevokeAppAccess(ctx, 9, 3); !errors.Is(err, cerror.ErrInternalErr) {
+		t.Errorf("RevokeAppAccess() cerror = %v, wantErr %v", err, cerror.ErrInternalErr)
+	}
+}
+
+func TestAuth_Roles(t *testing.T) {
+	roleProvider := mocks.NewRoleProvider(t)
+	roleProvider.On("SaveRole", mock.Anything, models.Role{AppID: 3, Name: "editor", Permissions: []string{"posts:write"}}).
+		Return(int64(1), nil).Once()
+	roleProvider.On("SaveRole", mock.Anything, models.Role{AppID: 3, Name: "editor"}).Return(int64(0), storage.ErrRoleExists).Once()
+	roleProvider.On("Roles", mock.Anything, int32(3)).Return([]models.Role{{ID: 1, AppID: 3, Name: "editor"}}, nil).Once()
+	roleProvider.On("DeleteRole", mock.Anything, int32(3), "unknown").Return(storage.ErrRoleNotFound).Once()
+	roleProvider.On("AssignRole", mock.Anything, int64(7), int32(3), "editor").Return(nil).Once()
+	roleProvider.On("AssignRole", mock.Anything, int64(8), int32(3), "editor").Return(storage.ErrUserNotFound).Once()
+	roleProvider.On("UnassignRole", mock.Anything, int64(7), int32(3), "editor").Return(nil).Once()
+
+	s := &Auth{
+		log:          slog.With(slog.String("service", "auth")),
+		roleProvider: roleProvider,
+	}
+	ctx := context.Background()
+
+	if id, err := s.CreateRole(ctx, 3, "editor", []string{"posts:write"}); err != nil || id != 1 {
+		t.Errorf("CreateRole() got = %v, cerror = %v", id, err)
+	}
+	if _, err := s.CreateRole(ctx, 3, "editor", nil); !errors.Is(err, cerror.ErrRoleExists) {
+		t.Errorf("CreateRole() cerror = %v, wantErr %v", err, cerror.ErrRoleExists)
+	}
+	if roles, err := s.ListRoles(ctx, 3); err != nil || len(roles) != 1 {
+		t.Errorf("ListRoles() got = %v, cerror = %v", roles, err)
+	}
+	if err := s.DeleteRole(ctx, 3, "unknown"); !errors.Is(err, cerror.ErrRoleNotFound) {
+		t.Errorf("DeleteRole() cerror = %v, wantErr %v", err, cerror.ErrRoleNotFound)
+	}
+	if err := s.AssignRole(ctx, 7, 3, "editor"); err != nil {
+		t.Errorf("AssignRole() cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, 8, 3, "editor"); !errors.Is(err, cerror.ErrUserNotFound) {
+		t.Errorf("AssignRole() cerror = %v, wantErr %v", err, cerror.ErrUserNotFound)
+	}
+	if err := s.UnassignRole(ctx, 7, 3, "editor"); err != nil {
+		t.Errorf("UnassignRole() cerror = %v", err)
+	}
+}
+
+func TestAuth_Apps(t *testing.T) {
+	admProvider := mocks.NewAdminProvider(t)
+	admProvider.On("Apps", mock.Anything).Return([]models.App{{ID: 3, Name: "app", Secret: "secret"}}, nil).Once()
+	admProvider.On("UpdateApp", mock.Anything, int32(3), "taken").Return(storage.ErrUniqueApp).Once()
+	admProvider.On("SetAppDisabled", mock.Anything, int32(3), true).Return(nil).Once()
+	admProvider.On("SetAppDisabled", mock.Anything, int32(4), true).Return(storage.ErrAppNotFound).Once()
+	admProvider.On("DeleteApp", mock.Anything, int32(3), false).Return(storage.ErrAppHasUsers).Once()
+	admProvider.On("DeleteApp", mock.Anything, int32(3), true).Return(nil).Once()
+	admProvider.On("SetAppSecret", mock.Anything, int32(3), mock.AnythingOfType("string")).Return(nil).Once()
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Name: "app", Secret: "secret"}, nil).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		admProvider: admProvider,
+		appProvider: appProvider,
+	}
+	ctx := context.Background()
+
+	// секрет приложения не возвращается ни в списке, ни по id
+	if apps, err := s.ListApps(ctx); err != nil || len(apps) != 1 || apps[0].Secret != "" {
+		t.Errorf("ListApps() got = %+v, cerror = %v", apps, err)
+	}
+	if app, err := s.GetApp(ctx, 3); err != nil || app.Name != "app" || app.Secret != "" {
+		t.Errorf("GetApp() got = %+v, cerror = %v", app, err)
+	}
+	if err := s.UpdateApp(ctx, 3, "taken"); !errors.Is(err, cerror.ErrAppExists) {
+		t.Errorf("UpdateApp() cerror = %v, wantErr %v", err, cerror.ErrAppExists)
+	}
+	if err := s.DisableApp(ctx, 3, true); err != nil {
+		t.Errorf("DisableApp() cerror = %v", err)
+	}
+	if err := s.DisableApp(ctx, 4, true); !errors.Is(err, cerror.ErrAppNotFound) {
+		t.Errorf("DisableApp() cerror = %v, wantErr %v", err, cerror.ErrAppNotFound)
+	}
+	if err := s.DeleteApp(ctx, 3, false); !errors.Is(err, cerror.ErrAppHasUsers) {
+		t.Errorf("DeleteApp() cerror = %v, wantErr %v", err, cerror.ErrAppHasUsers)
+	}
+	if err := s.DeleteApp(ctx, 3, true); err != nil {
+		t.Errorf("DeleteApp() cascade cerror = %v", err)
+	}
+	if secret, err := s.RotateAppSecret(ctx, 3); err != nil || secret == "" {
+		t.Errorf("RotateAppSecret() got = %q, cerror = %v", secret, err)
+	}
+}
+
+func TestAuth_CheckPermission(t *testing.T) {
+	roleProvider := mocks.NewRoleProvider(t)
+	roleProvider.On("UserRoles", mock.Anything, int64(7), int32(3)).Return([]models.Role{
+		{ID: 1, AppID: 3, Name: "viewer", Permissions: []string{"posts:read"}},
+		{ID: 2, AppID: 3, Name: "editor", Permissions: []string{"posts:read", "posts:write"}},
+	}, nil)
+	roleProvider.On("UserRoles", mock.Anything, int64(8), int32(3)).Return(nil, errors.ErrUnsupported)
+
+	s := &Auth{
+		log:          slog.With(slog.String("service", "auth")),
+		roleProvider: roleProvider,
+	}
+	ctx := context.Background()
+
+	if ok, err := s.CheckPermission(ctx, 7, 3, "posts:write"); err != nil || !ok {
+		t.Errorf("CheckPermission() got = %v, cerror = %v, want true", ok, err)
+	}
+	if ok, err := s.CheckPermission(ctx, 7, 3, "posts:delete"); err != nil || ok {
+		t.Errorf("CheckPermission() got = %v, cerror = %v, want false", ok, err)
+	}
+	if _, err := s.CheckPermission(ctx, 8, 3, "posts:read"); !errors.Is(err, cerror.ErrInternalErr) {
+		t.Errorf("CheckPermission() cerror = %v, wantErr %v", err, cerror.ErrInternalErr)
+	}
+
+	// роли пользователя попадают в claim roles выпущенного токена
+	tknProvider := mocks.NewTokenProvider(t)
+	tknProvider.On("SaveRefreshToken", mock.Anything, mock.Anything).Return(int64(1), nil)
+	s.tknProvider = tknProvider
+	s.tokenTTL = time.Hour
+
+	app := models.App{ID: 3, Name: "app", Secret: "secret"}
+	tokens, err := s.issueTokens(ctx, models.User{ID: 7, Login: "test"}, app, "family")
+	if err != nil {
+		t.Fatalf("issueTokens() cerror = %v", err)
+	}
+	claims, err := jwtgen.ParseJWT(tokens.AccessToken, func(appID int32, kid string, alg string) (interface{}, error) {
+		return []byte(app.Secret), nil
+	})
+	if err != nil {
+		t.Fatalf("ParseJWT() cerror = %v", err)
+	}
+	if !reflect.DeepEqual(claims.Roles, []string{"viewer", "editor"}) {
+		t.Errorf("issueTokens() roles = %v, want [viewer editor]", claims.Roles)
+	}
+}
+
+func TestAuth_CheckPermission_AdminRole(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	uid, err := s.RegisterNewUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+
+	if _, err := s.CreateAdmin(ctx, "test", 2, appID); err != nil {
+		t.Fatalf("CreateAdmin() cerror = %v", err)
+	}
+	if ok, err := s.CheckPermission(ctx, uid, appID, storage.AdminPermission); err != nil || !ok {
+		t.Errorf("CheckPermission() admin got = %v, cerror = %v, want true", ok, err)
+	}
+
+	if _, err := s.DeleteAdmin(ctx, "test", appID); err != nil {
+		t.Fatalf("DeleteAdmin() cerror = %v", err)
+	}
+	if ok, err := s.CheckPermission(ctx, uid, appID, storage.AdminPermission); err != nil || ok {
+		t.Errorf("CheckPermission() deleted admin got = %v, cerror = %v, want false", ok, err)
+	}
+}
+
+func TestAuth_LoginUser_MFARequired(t *testing.T) {
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test", PassHash: passHash}, nil)
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Secret: "secret"}, nil)
+	mfaProvider := mocks.NewMFAProvider(t)
+	mfaProvider.On("MFA", mock.Anything, int64(7)).Return(models.MFA{UserID: 7, Enabled: true}, nil)
+	mfaProvider.On("SaveMFAChallenge", mock.Anything, mock.MatchedBy(func(c models.MFAChallenge) bool {
+		return c.UserID == 7 && c.AppID == 3 && c.TokenHash != "" && c.ExpiresAt.After(time.Now())
+	})).Return(int64(1), nil).Once()
+
+	s := &Auth{
+		log:             slog.With(slog.String("service", "auth")),
+		usrProvider:     usrProvider,
+		appProvider:     appProvider,
+		mfaProvider:     mfaProvider,
+		hasher:          testHasher(t),
+		mfaChallengeTTL: time.Minute,
+	}
+
+	got, err := s.LoginUser(context.Background(), "test", "password", 3)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	if got.MFAToken == "" || got.AccessToken != "" || got.RefreshToken != "" {
+		t.Errorf("LoginUser() got = %v, want only mfa token", got)
+	}
+}
+
+func TestAuth_LoginUser_MFAEnrollment(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	box, err := secretbox.New("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("secretbox.New() cerror = %v", err)
+	}
+	s.mfaProvider = store
+	s.mfaCipher = box
+	s.mfaChallengeTTL = time.Minute
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if err := store.SetAppSettings(ctx, appID, models.AppSettings{RequireMFA: true}); err != nil {
+		t.Fatalf("SetAppSettings() cerror = %v", err)
+	}
+	if _, err := s.RegisterNewUser(ctx, "test", "password", appID); err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+
+	// без MFA вход выдаёт только токен для её подключения
+	tokens, err := s.LoginUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() cerror = %v", err)
+	}
+	if tokens.MFAEnrollToken == "" || tokens.AccessToken != "" || tokens.RefreshToken != "" || tokens.MFAToken != "" {
+		t.Fatalf("LoginUser() got = %v, want only mfa enroll token", tokens)
+	}
+	enrollToken := tokens.MFAEnrollToken
+	if _, err := s.VerifyMFA(ctx, enrollToken, "1"); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("VerifyMFA() enroll token cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+	if _, err := s.ValidateToken(ctx, enrollToken); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("ValidateToken() enroll token cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+
+	secret, _, err := s.EnrollTOTP(ctx, enrollToken)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() cerror = %v", err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := s.ConfirmTOTP(ctx, enrollToken, code)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP() cerror = %v", err)
+	}
+	if _, _, err := s.EnrollTOTP(ctx, enrollToken); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("EnrollTOTP() used enroll token cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+
+	tokens, err = s.LoginUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("LoginUser() after enrollment cerror = %v", err)
+	}
+	if tokens.MFAToken == "" || tokens.MFAEnrollToken != "" {
+		t.Fatalf("LoginUser() after enrollment got = %v, want mfa token", tokens)
+	}
+	tokens, err = s.VerifyMFA(ctx, tokens.MFAToken, recovery[0])
+	if err != nil {
+		t.Fatalf("VerifyMFA() cerror = %v", err)
+	}
+	if _, err := s.ValidateToken(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("ValidateToken() cerror = %v", err)
+	}
+}
+
+func TestAuth_LoginUser_Rehash(t *testing.T) {
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argon, err := hasher.New(config.PasswordHash{
+		Algorithm: hasher.Argon2id,
+		Argon2:    config.Argon2{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(models.User{ID: 7, Login: "test", PassHash: passHash}, nil)
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Secret: "secret", RequireVerified: true}, nil)
+
+	var saved []byte
+	usrSaver := mocks.NewUserSaver(t)
+	usrSaver.On("UpdatePassword", mock.Anything, int64(7), mock.Anything).
+		Run(func(args mock.Arguments) { saved = args.Get(2).([]byte) }).
+		Return(nil).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		usrSaver:    usrSaver,
+		appProvider: appProvider,
+		hasher:      argon,
+	}
+
+	// хэш пересчитывается сразу после проверки пароля, до остальных проверок входа
+	if _, err := s.LoginUser(context.Background(), "test", "password", 3); !errors.Is(err, cerror.ErrEmailNotVerified) {
+		t.Fatalf("LoginUser() cerror = %v, wantErr %v", err, cerror.ErrEmailNotVerified)
+	}
+
+	needsRehash, err := argon.Verify(saved, "password")
+	if err != nil || needsRehash {
+		t.Errorf("saved hash %s: needsRehash = %v, cerror = %v", saved, needsRehash, err)
+	}
+}
+
+func TestAuth_EnrollTOTP(t *testing.T) {
+	user := models.User{ID: 7, Login: "test"}
+	app := models.App{ID: 3, Name: "app", Secret: "secret"}
+	token, err := jwtgen.NewJWT(user, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+
+	box, err := secretbox.New("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("secretbox.New() cerror = %v", err)
+	}
+
+	newAuth := func(t *testing.T, m *mocks.MFAProvider) *Auth {
+		appProvider := mocks.NewAppProvider(t)
+		appProvider.On("App", mock.Anything, int32(3)).Return(app, nil)
+		revProvider := mocks.NewRevocationProvider(t)
+		revProvider.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+		revProvider.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+		usrProvider := mocks.NewUserProvider(t)
+		usrProvider.On("UserByID", mock.Anything, int64(7)).Return(user, nil)
+
+		return &Auth{
+			log:         slog.With(slog.String("service", "auth")),
+			usrProvider: usrProvider,
+			appProvider: appProvider,
+			revProvider: revProvider,
+			mfaProvider: m,
+			mfaCipher:   box,
+			mfaIssuer:   "auth",
+		}
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		var saved string
+		mfaProvider := mocks.NewMFAProvider(t)
+		mfaProvider.On("SaveMFASecret", mock.Anything, int64(7), mock.Anything).
+			Run(func(args mock.Arguments) { saved = args.String(2) }).Return(nil).Once()
+
+		secret, uri, err := newAuth(t, mfaProvider).EnrollTOTP(context.Background(), token)
+		if err != nil {
+			t.Fatalf("EnrollTOTP() cerror = %v", err)
+		}
+		// в базу секрет попадает только зашифрованным
+		if plain, err := box.Decrypt(saved); err != nil || saved == secret || string(plain) != secret {
+			t.Errorf("EnrollTOTP() saved secret %q, cerror = %v", saved, err)
+		}
+		if uri != totp.URI("auth", "test", secret) {
+			t.Errorf("EnrollTOTP() uri = %v", uri)
+		}
+	})
+	t.Run("already_enabled", func(t *testing.T) {
+		mfaProvider := mocks.NewMFAProvider(t)
+		mfaProvider.On("SaveMFASecret", mock.Anything, int64(7), mock.Anything).Return(storage.ErrMFAEnabled).Once()
+
+		if _, _, err := newAuth(t, mfaProvider).EnrollTOTP(context.Background(), token); !errors.Is(err, cerror.ErrMFAEnabled) {
+			t.Errorf("EnrollTOTP() cerror = %v, wantErr %v", err, cerror.ErrMFAEnabled)
+		}
+	})
+	t.Run("not_configured", func(t *testing.T) {
+		s := &Auth{log: slog.With(slog.String("service", "auth"))}
+
+		if _, _, err := s.EnrollTOTP(context.Background(), token); !errors.Is(err, cerror.ErrMFANotConfigured) {
+			t.Errorf("EnrollTOTP() cerror = %v, wantErr %v", err, cerror.ErrMFANotConfigured)
+		}
+	})
+}
+
+func TestAuth_ConfirmTOTP(t *testing.T) {
+	type mck func(m *mocks.MFAProvider)
+
+	user := models.User{ID: 7, Login: "test"}
+	app := models.App{ID: 3, Name: "app", Secret: "secret"}
+	token, err := jwtgen.NewJWT(user, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := models.MFA{UserID: 7, Secret: "enc:" + secret}
+
+	tests := []struct {
+		name    string
+		code    string
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "positive",
+			code: code,
+			mck: func(m *mocks.MFAProvider) {
+				m.On("MFA", mock.Anything, int64(7)).Return(pending, nil)
+				m.On("EnableMFA", mock.Anything, int64(7), mock.Anything, mock.MatchedBy(func(h []string) bool {
+					return len(h) == recoveryCodeCount
+				})).Return(nil)
+			},
+			wantErr: nil,
+		},
+		{
+			name: "invalid_code",
+			code: "000000x",
+			mck: func(m *mocks.MFAProvider) {
+				m.On("MFA", mock.Anything, int64(7)).Return(pending, nil)
+			},
+			wantErr: cerror.ErrInvalidMFACode,
+		},
+		{
+			name: "not_enrolled",
+			code: code,
+			mck: func(m *mocks.MFAProvider) {
+				m.On("MFA", mock.Anything, int64(7)).Return(models.MFA{}, storage.ErrMFANotFound)
+			},
+			wantErr: cerror.ErrMFANotEnrolled,
+		},
+		{
+			name: "already_enabled",
+			code: code,
+			mck: func(m *mocks.MFAProvider) {
+				enabled := pending
+				enabled.Enabled = true
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+			},
+			wantErr: cerror.ErrMFAEnabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appProvider := mocks.NewAppProvider(t)
+			appProvider.On("App", mock.Anything, int32(3)).Return(app, nil)
+			revProvider := mocks.NewRevocationProvider(t)
+			revProvider.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+			revProvider.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+			mfaProvider := mocks.NewMFAProvider(t)
+			tt.mck(mfaProvider)
+			mfaCipher := mocks.NewSecretCipher(t)
+			mfaCipher.On("Decrypt", "enc:"+secret).Return([]byte(secret), nil).Maybe()
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				appProvider: appProvider,
+				revProvider: revProvider,
+				mfaProvider: mfaProvider,
+				mfaCipher:   mfaCipher,
+			}
+			got, err := s.ConfirmTOTP(context.Background(), token, tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConfirmTOTP() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && len(got) != recoveryCodeCount {
+				t.Errorf("ConfirmTOTP() got %d recovery codes, want %d", len(got), recoveryCodeCount)
+			}
+		})
+	}
+}
+
+func TestAuth_VerifyMFA(t *testing.T) {
+	type mck func(m *mocks.MFAProvider, tp *mocks.TokenProvider)
+
+	const mfaToken = "mfa_token"
+	hash := jwtgen.HashToken(mfaToken)
+	challenge := models.MFAChallenge{ID: 1, TokenHash: hash, UserID: 7, AppID: 3, ExpiresAt: time.Now().Add(time.Minute)}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := models.MFA{UserID: 7, Secret: "enc:" + secret, Enabled: true}
+	issued := func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+		m.On("UseMFAChallenge", mock.Anything, int64(1)).Return(true, nil)
+		tp.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(rt models.RefreshToken) bool {
+			return rt.UserID == 7 && rt.AppID == 3 && rt.FamilyID != ""
+		})).Return(int64(1), nil)
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		app     *models.App
+		mck     mck
+		wantErr error
+	}{
+		{
+			name: "positive_totp",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(true, nil)
+				issued(m, tp)
+			},
+		},
+		{
+			name: "positive_recovery_code",
+			code: "ABCDE-FGHIJ",
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseRecoveryCode", mock.Anything, int64(7), jwtgen.HashToken("abcdefghij")).Return(true, nil)
+				issued(m, tp)
+			},
+		},
+		{
+			name: "totp_replay",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidMFACode,
+		},
+		{
+			name: "invalid_code",
+			code: "1",
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+			},
+			wantErr: cerror.ErrInvalidMFACode,
+		},
+		{
+			name: "not_found",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(models.MFAChallenge{}, storage.ErrTokenNotFound)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				expired := challenge
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				m.On("MFAChallenge", mock.Anything, hash).Return(expired, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "too_many_attempts",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				exhausted := challenge
+				exhausted.Attempts = maxMFAAttempts
+				m.On("MFAChallenge", mock.Anything, hash).Return(exhausted, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "exhausted_concurrently",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "used_concurrently",
+			code: code,
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(true, nil)
+				m.On("UseMFAChallenge", mock.Anything, int64(1)).Return(false, nil)
+			},
+			wantErr: cerror.ErrInvalidToken,
+		},
+		{
+			name: "app_disabled_after_login",
+			code: code,
+			app:  &models.App{ID: 3, Name: "app", Secret: "secret", Disabled: true},
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(true, nil)
+				m.On("UseMFAChallenge", mock.Anything, int64(1)).Return(true, nil)
+			},
+			wantErr: cerror.ErrAppDisabled,
+		},
+		{
+			name: "password_login_disabled_after_login",
+			code: code,
+			app: &models.App{ID: 3, Name: "app", Secret: "secret",
+				Settings: models.AppSettings{LoginMethods: []string{models.LoginWebAuthn}}},
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(true, nil)
+				m.On("UseMFAChallenge", mock.Anything, int64(1)).Return(true, nil)
+			},
+			wantErr: cerror.ErrLoginNotAllowed,
+		},
+		{
+			name: "email_not_verified",
+			code: code,
+			app:  &models.App{ID: 3, Name: "app", Secret: "secret", RequireVerified: true},
+			mck: func(m *mocks.MFAProvider, tp *mocks.TokenProvider) {
+				m.On("MFAChallenge", mock.Anything, hash).Return(challenge, nil)
+				m.On("AttemptMFAChallenge", mock.Anything, int64(1), maxMFAAttempts).Return(true, nil)
+				m.On("MFA", mock.Anything, int64(7)).Return(enabled, nil)
+				m.On("UseMFAStep", mock.Anything, int64(7), mock.Anything).Return(true, nil)
+				m.On("UseMFAChallenge", mock.Anything, int64(1)).Return(true, nil)
+			},
+			wantErr: cerror.ErrEmailNotVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mfaProvider := mocks.NewMFAProvider(t)
+			tknProvider := mocks.NewTokenProvider(t)
+			tt.mck(mfaProvider, tknProvider)
+			usrProvider := mocks.NewUserProvider(t)
+			usrProvider.On("UserByID", mock.Anything, int64(7)).Return(models.User{ID: 7, Login: "test"}, nil).Maybe()
+			usrProvider.On("HasAppAccess", mock.Anything, int64(7), int32(3)).Return(true, nil).Maybe()
+			app := models.App{ID: 3, Name: "app", Secret: "secret"}
+			if tt.app != nil {
+				app = *tt.app
+			}
+			appProvider := mocks.NewAppProvider(t)
+			appProvider.On("App", mock.Anything, int32(3)).Return(app, nil).Maybe()
+			mfaCipher := mocks.NewSecretCipher(t)
+			mfaCipher.On("Decrypt", "enc:"+secret).Return([]byte(secret), nil).Maybe()
+
+			s := &Auth{
+				log:         slog.With(slog.String("service", "auth")),
+				usrProvider: usrProvider,
+				appProvider: appProvider,
+				tknProvider: tknProvider,
+				mfaProvider: mfaProvider,
+				mfaCipher:   mfaCipher,
+				tokenTTL:    time.Hour,
+				refreshTTL:  time.Hour,
+			}
+			got, err := s.VerifyMFA(context.Background(), mfaToken, tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyMFA() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && (got.AccessToken == "" || got.RefreshToken == "") {
+				t.Errorf("VerifyMFA() got = %v, want token pair", got)
+			}
+		})
+	}
+}
+
+func TestAuth_VerifyMFA_BruteForce(t *testing.T) {
+	ctx := context.Background()
+	s, store := memoryAuth(t)
+
+	box, err := secretbox.New("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("secretbox.New() cerror = %v", err)
+	}
+	s.mfaProvider = store
+	s.mfaCipher = box
+	s.mfaChallengeTTL = time.Minute
+	s.guard = bruteforce.New(store, config.BruteForce{MaxAttempts: 3, IPMaxAttempts: 50, Lockout: time.Hour, Window: time.Hour})
+
+	appID, err := store.AddApp(ctx, "test", "secret", jwtgen.AlgHS256)
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	uid, err := s.RegisterNewUser(ctx, "test", "password", appID)
+	if err != nil {
+		t.Fatalf("RegisterNewUser() cerror = %v", err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := box.Encrypt([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveMFASecret(ctx, uid, encrypted); err != nil {
+		t.Fatalf("SaveMFASecret() cerror = %v", err)
+	}
+	if err := store.EnableMFA(ctx, uid, 0, nil); err != nil {
+		t.Fatalf("EnableMFA() cerror = %v", err)
+	}
+
+	verify := func(code string) error {
+		tokens, err := s.LoginUser(ctx, "test", "password", appID)
+		if err != nil {
+			return err
+		}
+		_, err = s.VerifyMFA(ctx, tokens.MFAToken, code)
+		return err
+	}
+
+	// успешный второй фактор сбрасывает неудачи
+	for i := 0; i < 2; i++ {
+		if err := verify("1"); !errors.Is(err, cerror.ErrInvalidMFACode) {
+			t.Fatalf("VerifyMFA() wrong code cerror = %v, want %v", err, cerror.ErrInvalidMFACode)
+		}
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(code); err != nil {
+		t.Fatalf("VerifyMFA() cerror = %v", err)
+	}
+
+	// верный пароль с новым challenge не обнуляет неверные коды
+	for i := 0; i < 3; i++ {
+		if err := verify("1"); !errors.Is(err, cerror.ErrInvalidMFACode) {
+			t.Fatalf("VerifyMFA() wrong code %d cerror = %v, want %v", i, err, cerror.ErrInvalidMFACode)
+		}
+	}
+	if _, err := s.LoginUser(ctx, "test", "password", appID); !errors.Is(err, cerror.ErrTooManyAttempts) {
+		t.Errorf("LoginUser() after wrong codes cerror = %v, want %v", err, cerror.ErrTooManyAttempts)
+	}
+}
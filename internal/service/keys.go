@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// JWKS возвращает публичные ключи всех приложений для проверки токенов без обращения к сервису
+func (s *Auth) JWKS(ctx context.Context) ([]models.JWK, error) {
+	const op = "Auth.JWKS"
+
+	log := s.log.With(slog.String("op", op))
+
+	keys, err := s.keyProvider.SigningKeys(ctx)
+	if err != nil {
+		log.Error("cerror get signing keys", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+
+	res := make([]models.JWK, 0, len(keys))
+	for _, key := range keys {
+		jwk, err := jwtgen.PublicJWK(key)
+		if err != nil {
+			log.Error("cerror encode jwk", slog.String("kid", key.KID), slog.String("err", err.Error()))
+			return nil, cerror.ErrInternalErr
+		}
+		res = append(res, jwk)
+	}
+
+	return res, nil
+}
+
+// signJWT подписывает токен алгоритмом, выбранным для приложения
+func (s *Auth) signJWT(ctx context.Context, user models.User, app models.App) (string, error) {
+	if !jwtgen.IsAsymmetric(app.Alg) {
+		return jwtgen.NewJWT(user, app, s.accessTokenTTL(app))
+	}
+
+	key, err := s.appSigningKey(ctx, app)
+	if err != nil {
+		return "", err
+	}
+
+	return jwtgen.NewSignedJWT(user, app, key, s.accessTokenTTL(app))
+}
+
+// appSigningKey возвращает ключ подписи приложения, создавая его при первом обращении
+func (s *Auth) appSigningKey(ctx context.Context, app models.App) (models.SigningKey, error) {
+	const op = "Auth.appSigningKey"
+
+	key, err := s.keyProvider.SigningKey(ctx, int32(app.ID), app.Alg)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, storage.ErrKeyNotFound) {
+		return key, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err = jwtgen.GenerateKey(app.Alg)
+	if err != nil {
+		return key, fmt.Errorf("%s: %w", op, err)
+	}
+	key.AppID = int32(app.ID)
+	key.Status = models.KeyStatusActive
+	key.ActivatedAt = key.CreatedAt
+
+	key.ID, err = s.keyProvider.SaveSigningKey(ctx, key)
+	if err != nil {
+		return key, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.Info("signing key created", slog.String("op", op), slog.Int64("app_id", app.ID),
+		slog.String("alg", key.Alg), slog.String("kid", key.KID))
+
+	return key, nil
+}
+
+// verificationKey подбирает ключ для проверки подписи токена. Токены, подписанные секретом приложения,
+// продолжают проверяться после перевода приложения на асимметричный алгоритм
+func (s *Auth) verificationKey(ctx context.Context, appID int32, kid string, alg string) (interface{}, error) {
+	if !jwtgen.IsAsymmetric(alg) {
+		app, err := s.appProvider.App(ctx, appID)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(app.Secret), nil
+	}
+
+	key, err := s.keyProvider.SigningKeyByKID(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.AppID != appID || key.Alg != alg {
+		return nil, fmt.Errorf("signing key %s does not belong to app %d", kid, appID)
+	}
+	if key.Status != models.KeyStatusActive && key.Status != models.KeyStatusRetired {
+		return nil, fmt.Errorf("signing key %s is %s", kid, key.Status)
+	}
+
+	return jwtgen.PublicKey(key)
+}
+
+// RotateSigningKey выпускает новый ключ подписи приложения по запросу администратора. Ключ сначала публикуется в JWKS
+// и начинает подписывать токены через keyPublishDelay, прежний ключ продолжает проверять выданные им токены
+func (s *Auth) RotateSigningKey(ctx context.Context, appID int32) (kid string, err error) {
+	const op = "auth.RotateSigningKey"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	app, err := s.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return "", cerror.ErrAppNotFound
+		}
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		return "", cerror.ErrInternalErr
+	}
+	if !jwtgen.IsAsymmetric(app.Alg) {
+		log.Warn("app is not signed with managed keys", slog.String("alg", app.Alg))
+		return "", cerror.ErrUnsupportedAlg
+	}
+
+	newKey, err := s.newPendingKey(ctx, app.ID, app.Alg)
+	if err != nil {
+		log.Error("cerror create signing key", slog.String("err", err.Error()))
+		return "", cerror.ErrInternalErr
+	}
+	if s.keyPublishDelay == 0 {
+		if err := s.keyProvider.ActivateSigningKey(ctx, newKey.ID, time.Now()); err != nil {
+			log.Error("cerror activate signing key", slog.String("err", err.Error()))
+			return "", cerror.ErrInternalErr
+		}
+	}
+	log.Info("signing key rotated", slog.String("kid", newKey.KID))
+
+	return newKey.KID, nil
+}
+
+// RotateKeys продвигает ключи по жизненному циклу: публикует замену для устаревших активных ключей,
+// активирует ожидающие после keyPublishDelay и удаляет выведенные ключи, когда истекли все подписанные ими токены
+func (s *Auth) RotateKeys(ctx context.Context) error {
+	const op = "Auth.RotateKeys"
+
+	keys, err := s.keyProvider.SigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	type appAlg struct {
+		appID int32
+		alg   string
+	}
+	pending := make(map[appAlg]bool)
+	for _, key := range keys {
+		if key.Status == models.KeyStatusPending {
+			pending[appAlg{key.AppID, key.Alg}] = true
+		}
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		log := s.log.With(slog.String("op", op), slog.String("kid", key.KID), slog.Int("app_id", int(key.AppID)))
+
+		switch key.Status {
+		case models.KeyStatusPending:
+			if now.Sub(key.CreatedAt) < s.keyPublishDelay {
+				continue
+			}
+			if err := s.keyProvider.ActivateSigningKey(ctx, key.ID, now); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			log.Info("signing key activated")
+		case models.KeyStatusActive:
+			if s.keyRotation == 0 || pending[appAlg{key.AppID, key.Alg}] || now.Sub(key.ActivatedAt) < s.keyRotation {
+				continue
+			}
+			newKey, err := s.newPendingKey(ctx, int64(key.AppID), key.Alg)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			log.Info("signing key scheduled for rotation", slog.String("new_kid", newKey.KID))
+		case models.KeyStatusRetired:
+			if now.Sub(key.RetiredAt) < s.tokenTTL {
+				continue
+			}
+			if err := s.keyProvider.DeleteSigningKey(ctx, key.ID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			log.Info("signing key deleted")
+		}
+	}
+
+	return nil
+}
+
+// RunKeyRotation периодически вызывает RotateKeys до отмены ctx
+func (s *Auth) RunKeyRotation(ctx context.Context, every time.Duration) {
+	const op = "Auth.RunKeyRotation"
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RotateKeys(ctx); err != nil {
+				s.log.Error("cerror rotate signing keys", slog.String("op", op), slog.String("err", err.Error()))
+			}
+		}
+	}
+}
+
+func (s *Auth) newPendingKey(ctx context.Context, appID int64, alg string) (models.SigningKey, error) {
+	key, err := jwtgen.GenerateKey(alg)
+	if err != nil {
+		return key, err
+	}
+	key.AppID = int32(appID)
+	key.Status = models.KeyStatusPending
+
+	key.ID, err = s.keyProvider.SaveSigningKey(ctx, key)
+	return key, err
+}
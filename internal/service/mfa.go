@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"github.com/MorZLE/auth/internal/totp"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// recoveryCodeCount сколько кодов восстановления выдаётся при включении MFA
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+	// maxMFAAttempts после стольких попыток ввести код challenge перестаёт приниматься и нужно войти заново
+	maxMFAAttempts = 5
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// EnrollTOTP создаёт новый секрет TOTP для владельца access токена или токена подключения MFA из LoginUser.
+// MFA включается только после ConfirmTOTP, до этого повторный вызов заменяет секрет
+func (s *Auth) EnrollTOTP(ctx context.Context, token string) (secret string, uri string, err error) {
+	const op = "Auth.EnrollTOTP"
+
+	log := s.log.With(slog.String("op", op))
+
+	if s.mfaCipher == nil {
+		log.Warn("mfa encryption key not configured")
+		return "", "", cerror.ErrMFANotConfigured
+	}
+
+	claims, _, err := s.parseEnrollToken(ctx, log, token)
+	if err != nil {
+		return "", "", err
+	}
+	log = log.With(slog.Int64("userid", claims.UserID))
+
+	user, err := s.usrProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return "", "", cerror.ErrInvalidToken
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return "", "", cerror.ErrInternalErr
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		log.Error("cerror generate totp secret", slog.String("err", err.Error()))
+		return "", "", cerror.ErrInternalErr
+	}
+	encrypted, err := s.mfaCipher.Encrypt([]byte(secret))
+	if err != nil {
+		log.Error("cerror encrypt totp secret", slog.String("err", err.Error()))
+		return "", "", cerror.ErrInternalErr
+	}
+
+	if err := s.mfaProvider.SaveMFASecret(ctx, user.ID, encrypted); err != nil {
+		if errors.Is(err, storage.ErrMFAEnabled) {
+			log.Warn("mfa already enabled")
+			return "", "", cerror.ErrMFAEnabled
+		}
+		log.Error("cerror save totp secret", slog.String("err", err.Error()))
+		return "", "", cerror.ErrInternalErr
+	}
+
+	log.Info("totp enrollment started")
+
+	return secret, totp.URI(s.mfaIssuer, user.Login, secret), nil
+}
+
+// ConfirmTOTP включает MFA, если код из приложения-аутентификатора совпал с секретом из EnrollTOTP.
+// Токен подключения MFA после этого перестаёт приниматься.
+// Возвращает коды восстановления, они показываются пользователю один раз и хранятся только в виде хэшей
+func (s *Auth) ConfirmTOTP(ctx context.Context, token string, code string) (recoveryCodes []string, err error) {
+	const op = "Auth.ConfirmTOTP"
+
+	log := s.log.With(slog.String("op", op))
+
+	if s.mfaCipher == nil {
+		log.Warn("mfa encryption key not configured")
+		return nil, cerror.ErrMFANotConfigured
+	}
+
+	claims, enrollID, err := s.parseEnrollToken(ctx, log, token)
+	if err != nil {
+		return nil, err
+	}
+	log = log.With(slog.Int64("userid", claims.UserID))
+
+	mfa, err := s.mfaProvider.MFA(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			log.Warn("mfa not enrolled")
+			return nil, cerror.ErrMFANotEnrolled
+		}
+		log.Error("cerror get mfa", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+	if mfa.Enabled {
+		log.Warn("mfa already enabled")
+		return nil, cerror.ErrMFAEnabled
+	}
+
+	secret, err := s.mfaCipher.Decrypt(mfa.Secret)
+	if err != nil {
+		log.Error("cerror decrypt totp secret", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		log.Warn("invalid totp code")
+		return nil, cerror.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Error("cerror generate recovery codes", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+
+	if err := s.mfaProvider.EnableMFA(ctx, claims.UserID, step, hashes); err != nil {
+		if errors.Is(err, storage.ErrMFAEnabled) {
+			log.Warn("mfa already enabled")
+			return nil, cerror.ErrMFAEnabled
+		}
+		log.Error("cerror enable mfa", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+	// токен подключения больше не нужен, дальше пользователь входит через VerifyMFA
+	if enrollID != 0 {
+		if _, err := s.mfaProvider.UseMFAChallenge(ctx, enrollID); err != nil {
+			log.Error("cerror use mfa enroll token", slog.String("err", err.Error()))
+		}
+	}
+
+	log.Info("mfa enabled")
+
+	return codes, nil
+}
+
+// VerifyMFA обменивает challenge из LoginUser и код TOTP или код восстановления на пару токенов
+func (s *Auth) VerifyMFA(ctx context.Context, mfaToken string, code string) (tokens models.Tokens, err error) {
+	const op = "Auth.VerifyMFA"
+
+	log := s.log.With(slog.String("op", op))
+
+	if s.mfaCipher == nil {
+		log.Warn("mfa encryption key not configured")
+		return tokens, cerror.ErrMFANotConfigured
+	}
+
+	challenge, err := s.mfaProvider.MFAChallenge(ctx, jwtgen.HashToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("mfa challenge not found")
+			return tokens, cerror.ErrInvalidToken
+		}
+		log.Error("cerror get mfa challenge", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	log = log.With(slog.Int64("userid", challenge.UserID))
+
+	if challenge.Enroll || challenge.Used || challenge.Attempts >= maxMFAAttempts || time.Now().After(challenge.ExpiresAt) {
+		log.Warn("mfa challenge used, expired or exhausted")
+		return tokens, cerror.ErrInvalidToken
+	}
+
+	user, err := s.usrProvider.UserByID(ctx, challenge.UserID)
+	if err != nil {
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	// неверные коды считаются неудачами входа пользователя, как и неверные пароли, поэтому перебор
+	// не продолжается через новые challenge
+	ip := models.ClientIP(ctx)
+	if err := s.checkAttempts(ctx, log, user.Login, challenge.AppID, ip); err != nil {
+		return tokens, err
+	}
+
+	ok, err := s.mfaProvider.AttemptMFAChallenge(ctx, challenge.ID, maxMFAAttempts)
+	if err != nil {
+		log.Error("cerror count mfa attempt", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("mfa challenge used or exhausted")
+		return tokens, cerror.ErrInvalidToken
+	}
+
+	ok, err = s.checkMFACode(ctx, challenge.UserID, code)
+	if err != nil {
+		log.Error("cerror check mfa code", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("invalid mfa code")
+		if err := s.failAttempt(ctx, log, user.Login, challenge.AppID, ip); errors.Is(err, cerror.ErrInternalErr) {
+			return tokens, err
+		}
+		return tokens, cerror.ErrInvalidMFACode
+	}
+
+	used, err := s.mfaProvider.UseMFAChallenge(ctx, challenge.ID)
+	if err != nil {
+		log.Error("cerror use mfa challenge", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if !used {
+		log.Warn("mfa challenge already used")
+		return tokens, cerror.ErrInvalidToken
+	}
+
+	s.resetAttempts(ctx, log, user.Login, challenge.AppID, ip)
+
+	if err = s.checkAppAccess(ctx, log, user.ID, challenge.AppID); err != nil {
+		return tokens, err
+	}
+	app, err := s.appProvider.App(ctx, challenge.AppID)
+	if err != nil {
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return tokens, cerror.ErrAppNotFound
+		}
+		return tokens, cerror.ErrInternalErr
+	}
+	// настройки приложения могли измениться, пока пользователь вводил код, поэтому проверки Login повторяются
+	if app.Disabled {
+		log.Warn("app disabled")
+		return tokens, cerror.ErrAppDisabled
+	}
+	if !app.Settings.LoginAllowed(models.LoginPassword) {
+		log.Warn("password login not allowed")
+		return tokens, cerror.ErrLoginNotAllowed
+	}
+	if app.RequireVerified && !user.EmailVerified {
+		log.Warn("email not verified")
+		return tokens, cerror.ErrEmailNotVerified
+	}
+
+	familyID, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate token family", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	tokens, err = s.issueTokens(ctx, user, app, familyID)
+	if err != nil {
+		log.Error("cerror generate token", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	log.Info("mfa login success")
+
+	return tokens, nil
+}
+
+// mfaEnabled сообщает, нужно ли пользователю подтверждать вход вторым фактором
+func (s *Auth) mfaEnabled(ctx context.Context, userID int64) (bool, error) {
+	if s.mfaProvider == nil {
+		return false, nil
+	}
+
+	mfa, err := s.mfaProvider.MFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return mfa.Enabled, nil
+}
+
+// mfaChallenge выдаёт вместо токенов доступа одноразовый токен для VerifyMFA. С enroll токен
+// принимается только для подключения второго фактора
+func (s *Auth) mfaChallenge(ctx context.Context, log *slog.Logger, user models.User, appID int32, enroll bool) (models.Tokens, error) {
+	token, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate mfa challenge", slog.String("err", err.Error()))
+		return models.Tokens{}, cerror.ErrInternalErr
+	}
+
+	_, err = s.mfaProvider.SaveMFAChallenge(ctx, models.MFAChallenge{
+		TokenHash: jwtgen.HashToken(token),
+		UserID:    user.ID,
+		AppID:     appID,
+		ExpiresAt: time.Now().Add(s.mfaChallengeTTL),
+		Enroll:    enroll,
+	})
+	if err != nil {
+		log.Error("cerror save mfa challenge", slog.String("err", err.Error()))
+		return models.Tokens{}, cerror.ErrInternalErr
+	}
+
+	if enroll {
+		log.Info("mfa enrollment required")
+		return models.Tokens{MFAEnrollToken: token}, nil
+	}
+
+	log.Info("mfa required")
+
+	return models.Tokens{MFAToken: token}, nil
+}
+
+// parseEnrollToken принимает access токен или токен подключения MFA из LoginUser. Для второго возвращает
+// id challenge, который нужно погасить после включения MFA
+func (s *Auth) parseEnrollToken(ctx context.Context, log *slog.Logger, token string) (models.TokenClaims, int64, error) {
+	claims, err := s.parseToken(ctx, log, token)
+	if !errors.Is(err, cerror.ErrInvalidToken) || s.mfaProvider == nil {
+		return claims, 0, err
+	}
+
+	challenge, err := s.mfaProvider.MFAChallenge(ctx, jwtgen.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return claims, 0, cerror.ErrInvalidToken
+		}
+		log.Error("cerror get mfa challenge", slog.String("err", err.Error()))
+		return claims, 0, cerror.ErrInternalErr
+	}
+	if !challenge.Enroll || challenge.Used || time.Now().After(challenge.ExpiresAt) {
+		log.Warn("mfa enroll token not accepted")
+		return claims, 0, cerror.ErrInvalidToken
+	}
+
+	return models.TokenClaims{UserID: challenge.UserID, AppID: challenge.AppID}, challenge.ID, nil
+}
+
+// checkMFACode принимает код TOTP, который ещё не использовался, или неиспользованный код восстановления
+func (s *Auth) checkMFACode(ctx context.Context, userID int64, code string) (bool, error) {
+	mfa, err := s.mfaProvider.MFA(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	secret, err := s.mfaCipher.Decrypt(mfa.Secret)
+	if err != nil {
+		return false, fmt.Errorf("decrypt totp secret: %w", err)
+	}
+
+	if step, ok := totp.Validate(string(secret), code, time.Now()); ok {
+		return s.mfaProvider.UseMFAStep(ctx, userID, step)
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != recoveryCodeLen {
+		return false, nil
+	}
+	return s.mfaProvider.UseRecoveryCode(ctx, userID, jwtgen.HashToken(normalized))
+}
+
+// newRecoveryCodes возвращает коды в виде xxxxx-xxxxx и их хэши
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLen*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)
+
+		codes = append(codes, code[:recoveryCodeLen/2]+"-"+code[recoveryCodeLen/2:])
+		hashes = append(hashes, jwtgen.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// ChangePassword меняет пароль по текущему паролю. Все выданные ранее токены пользователя отзываются
+func (s *Auth) ChangePassword(ctx context.Context, login string, appID int32, oldPassword string, newPassword string) error {
+	const op = "Auth.ChangePassword"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login))
+
+	ip := models.ClientIP(ctx)
+	if err := s.checkAttempts(ctx, log, login, appID, ip); err != nil {
+		return err
+	}
+
+	user, err := s.usrProvider.User(ctx, login, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return s.failAttempt(ctx, log, login, appID, ip)
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	if _, err := s.hasher.Verify(user.PassHash, oldPassword); err != nil {
+		log.Warn("invalid password")
+		return s.failAttempt(ctx, log, login, appID, ip)
+	}
+	// смена пароля не проходит второй фактор, поэтому накопленные неудачи не сбрасываются
+	s.releaseAttempt(ctx, log, login, appID, ip)
+
+	if err := s.checkPassword(ctx, log, appID, login, newPassword); err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		log.Error("cerror set password", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log.Info("password changed")
+
+	return nil
+}
+
+// RequestPasswordReset выпускает одноразовый токен сброса и передаёт его пользователю через notifier.
+// Ответ не зависит от того, существует ли пользователь, чтобы метод нельзя было использовать для перебора логинов
+func (s *Auth) RequestPasswordReset(ctx context.Context, login string, appID int32) error {
+	const op = "Auth.RequestPasswordReset"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login))
+
+	user, err := s.usrProvider.User(ctx, login, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset for unknown user")
+			return nil
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	token, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate reset token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	_, err = s.rstProvider.SavePasswordReset(ctx, models.PasswordReset{
+		TokenHash: jwtgen.HashToken(token),
+		UserID:    user.ID,
+		AppID:     appID,
+		ExpiresAt: time.Now().Add(s.resetTTL),
+	})
+	if err != nil {
+		log.Error("cerror save reset token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	if err := s.notifier.SendPasswordReset(ctx, user, appID, token); err != nil {
+		log.Error("cerror send reset token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log.Info("password reset requested")
+
+	return nil
+}
+
+// ConfirmPasswordReset устанавливает новый пароль по токену сброса и отзывает все сессии пользователя
+func (s *Auth) ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error {
+	const op = "Auth.ConfirmPasswordReset"
+
+	log := s.log.With(slog.String("op", op))
+
+	reset, err := s.rstProvider.PasswordReset(ctx, jwtgen.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("reset token not found")
+			return cerror.ErrInvalidToken
+		}
+		log.Error("cerror get reset token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log = log.With(slog.Int64("userid", reset.UserID))
+
+	if reset.Used || time.Now().After(reset.ExpiresAt) {
+		log.Warn("reset token used or expired")
+		return cerror.ErrInvalidToken
+	}
+
+	user, err := s.usrProvider.UserByID(ctx, reset.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return cerror.ErrInvalidToken
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	// политику проверяем до того, как погасить токен, чтобы пользователь мог повторить с другим паролем
+	if err := s.checkPassword(ctx, log, reset.AppID, user.Login, newPassword); err != nil {
+		return err
+	}
+
+	ok, err := s.rstProvider.UsePasswordReset(ctx, reset.ID)
+	if err != nil {
+		log.Error("cerror use reset token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("reset token already used")
+		return cerror.ErrInvalidToken
+	}
+
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		log.Error("cerror set password", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if s.guard != nil {
+		if err := s.guard.Unlock(ctx, user.Login, reset.AppID); err != nil {
+			log.Error("cerror reset login attempts", slog.String("err", err.Error()))
+		}
+	}
+
+	log.Info("password reset")
+
+	return nil
+}
+
+// setPassword сохраняет новый пароль и отзывает токены, выданные со старым
+func (s *Auth) setPassword(ctx context.Context, userID int64, password string) error {
+	passhash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("generate passhash: %w", err)
+	}
+
+	if err := s.usrSaver.UpdatePassword(ctx, userID, passhash); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return s.revProvider.RevokeUserTokens(ctx, userID, now, now.Add(s.tokenTTL))
+}
+
+// rehashPassword пересчитывает хэш пароля текущим алгоритмом после успешного входа. Токены не отзываются,
+// пароль не менялся. Ошибка не мешает входу, хэш будет пересчитан при следующем входе
+func (s *Auth) rehashPassword(ctx context.Context, log *slog.Logger, userID int64, password string) {
+	passhash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Error("cerror rehash password", slog.String("err", err.Error()))
+		return
+	}
+
+	if err := s.usrSaver.UpdatePassword(ctx, userID, passhash); err != nil {
+		log.Error("cerror save rehashed password", slog.String("err", err.Error()))
+		return
+	}
+
+	log.Info("password rehashed")
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// Logout отзывает access токен до истечения его срока. Если передан refresh токен того же пользователя,
+// отзывается и всё его семейство, чтобы по нему нельзя было получить новый access токен
+func (s *Auth) Logout(ctx context.Context, token string, refreshToken string) error {
+	const op = "Auth.Logout"
+
+	log := s.log.With(slog.String("op", op))
+
+	claims, err := s.parseToken(ctx, log, token)
+	if err != nil {
+		return err
+	}
+
+	log = log.With(slog.Int64("userid", claims.UserID), slog.Int("app_id", int(claims.AppID)))
+
+	// токены без jti выпущены до появления отзыва и отозвать их по отдельности нельзя
+	if claims.ID == "" {
+		log.Warn("token without jti")
+		return cerror.ErrInvalidToken
+	}
+
+	err = s.revProvider.RevokeToken(ctx, models.RevokedToken{
+		ID:        claims.ID,
+		UserID:    claims.UserID,
+		AppID:     claims.AppID,
+		ExpiresAt: claims.ExpiresAt,
+	})
+	if err != nil {
+		log.Error("cerror revoke token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	if refreshToken != "" {
+		stored, err := s.tknProvider.RefreshToken(ctx, jwtgen.HashToken(refreshToken))
+		switch {
+		case errors.Is(err, storage.ErrTokenNotFound):
+			log.Warn("refresh token not found")
+		case err != nil:
+			log.Error("cerror get refresh token", slog.String("err", err.Error()))
+			return cerror.ErrInternalErr
+		case stored.UserID != claims.UserID:
+			log.Warn("refresh token belongs to another user")
+		default:
+			if err := s.tknProvider.RevokeTokenFamily(ctx, stored.FamilyID); err != nil {
+				log.Error("cerror revoke token family", slog.String("err", err.Error()))
+				return cerror.ErrInternalErr
+			}
+		}
+	}
+
+	log.Info("user logout", slog.String("jti", claims.ID))
+
+	return nil
+}
+
+// RevokeAllForUser отзывает все access и refresh токены пользователя, выданные до текущего момента
+func (s *Auth) RevokeAllForUser(ctx context.Context, userID int64) error {
+	const op = "auth.RevokeAllForUser"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID))
+
+	if _, err := s.usrProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return cerror.ErrUserNotFound
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	now := time.Now()
+	if err := s.revProvider.RevokeUserTokens(ctx, userID, now, now.Add(s.tokenTTL)); err != nil {
+		log.Error("cerror revoke user tokens", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log.Info("all user tokens revoked")
+
+	return nil
+}
+
+// RunRevocationCleanup периодически удаляет записи об отзыве истёкших токенов до отмены ctx
+func (s *Auth) RunRevocationCleanup(ctx context.Context, every time.Duration) {
+	const op = "Auth.RunRevocationCleanup"
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.revProvider.DeleteExpiredRevocations(ctx, time.Now())
+			if err != nil {
+				s.log.Error("cerror delete expired revocations", slog.String("op", op), slog.String("err", err.Error()))
+				continue
+			}
+			if deleted > 0 {
+				s.log.Debug("expired revocations deleted", slog.String("op", op), slog.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+// tokenRevoked проверяет отзыв конкретного токена и массовый отзыв токенов пользователя. Время выпуска и отзыва
+// сравниваются с точностью до миллисекунды, и токен, выпущенный в ту же миллисекунду, что и отзыв, считается выпущенным
+// после него: иначе вход сразу после смены пароля или RevokeAllForUser возвращал бы отозванный токен
+func (s *Auth) tokenRevoked(ctx context.Context, claims models.TokenClaims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.revProvider.TokenRevoked(ctx, claims.ID)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	revokedAt, err := s.revProvider.UserTokensRevokedAt(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	return !revokedAt.IsZero() && claims.IssuedAt.Before(revokedAt), nil
+}
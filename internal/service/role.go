@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+)
+
+// CreateRole создаёт роль приложения с набором разрешений
+func (s *Auth) CreateRole(ctx context.Context, appID int32, name string, permissions []string) (int64, error) {
+	const op = "auth.CreateRole"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("role", name))
+
+	id, err := s.roleProvider.SaveRole(ctx, models.Role{AppID: appID, Name: name, Permissions: permissions})
+	if err != nil {
+		return 0, roleError(log, "cerror save role", err)
+	}
+	log.Info("role created", slog.Any("permissions", permissions))
+
+	return id, nil
+}
+
+// ListRoles возвращает роли приложения с их разрешениями
+func (s *Auth) ListRoles(ctx context.Context, appID int32) ([]models.Role, error) {
+	const op = "auth.ListRoles"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)))
+
+	roles, err := s.roleProvider.Roles(ctx, appID)
+	if err != nil {
+		log.Error("cerror get roles", slog.String("err", err.Error()))
+		return nil, cerror.ErrInternalErr
+	}
+	return roles, nil
+}
+
+// DeleteRole удаляет роль приложения и снимает её со всех пользователей
+func (s *Auth) DeleteRole(ctx context.Context, appID int32, name string) error {
+	const op = "auth.DeleteRole"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("role", name))
+
+	if err := s.roleProvider.DeleteRole(ctx, appID, name); err != nil {
+		return roleError(log, "cerror delete role", err)
+	}
+	log.Info("role deleted")
+
+	return nil
+}
+
+// AssignRole назначает роль приложения пользователю. Роль попадёт в токены, выпущенные после назначения
+func (s *Auth) AssignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "auth.AssignRole"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID), slog.Int("app_id", int(appID)),
+		slog.String("role", name))
+
+	if err := s.roleProvider.AssignRole(ctx, userID, appID, name); err != nil {
+		return roleError(log, "cerror assign role", err)
+	}
+	log.Info("role assigned")
+
+	return nil
+}
+
+// UnassignRole снимает роль с пользователя
+func (s *Auth) UnassignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "auth.UnassignRole"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID), slog.Int("app_id", int(appID)),
+		slog.String("role", name))
+
+	if err := s.roleProvider.UnassignRole(ctx, userID, appID, name); err != nil {
+		return roleError(log, "cerror unassign role", err)
+	}
+	log.Info("role unassigned")
+
+	return nil
+}
+
+// CheckPermission сообщает, даёт ли какая-либо роль пользователя в приложении разрешение permission
+func (s *Auth) CheckPermission(ctx context.Context, userID int64, appID int32, permission string) (bool, error) {
+	const op = "auth.CheckPermission"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("userid", userID), slog.Int("app_id", int(appID)),
+		slog.String("permission", permission))
+
+	roles, err := s.roleProvider.UserRoles(ctx, userID, appID)
+	if err != nil {
+		log.Error("cerror get user roles", slog.String("err", err.Error()))
+		return false, cerror.ErrInternalErr
+	}
+
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if p == permission {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// userRoles возвращает имена ролей пользователя для claim roles
+func (s *Auth) userRoles(ctx context.Context, userID int64, appID int32) ([]string, error) {
+	if s.roleProvider == nil {
+		return nil, nil
+	}
+
+	roles, err := s.roleProvider.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names, nil
+}
+
+// roleError переводит ошибку хранилища при работе с ролями в ошибку сервиса
+func roleError(log *slog.Logger, msg string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrRoleExists):
+		log.Warn("role exists")
+		return cerror.ErrRoleExists
+	case errors.Is(err, storage.ErrRoleNotFound):
+		log.Warn("role not found")
+		return cerror.ErrRoleNotFound
+	case errors.Is(err, storage.ErrAppNotFound):
+		log.Warn("app not found")
+		return cerror.ErrAppNotFound
+	case errors.Is(err, storage.ErrUserNotFound):
+		log.Warn("user has no access to app")
+		return cerror.ErrUserNotFound
+	}
+	log.Error(msg, slog.String("err", err.Error()))
+	return cerror.ErrInternalErr
+}
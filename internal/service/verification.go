@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"log/slog"
+	"time"
+)
+
+// VerifyEmail подтверждает адрес пользователя по токену из письма
+func (s *Auth) VerifyEmail(ctx context.Context, token string) error {
+	const op = "Auth.VerifyEmail"
+
+	log := s.log.With(slog.String("op", op))
+
+	v, err := s.vrfProvider.EmailVerification(ctx, jwtgen.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("verification token not found")
+			return cerror.ErrInvalidToken
+		}
+		log.Error("cerror get verification token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log = log.With(slog.Int64("userid", v.UserID))
+
+	if v.Used || time.Now().After(v.ExpiresAt) {
+		log.Warn("verification token used or expired")
+		return cerror.ErrInvalidToken
+	}
+
+	ok, err := s.vrfProvider.UseEmailVerification(ctx, v.ID)
+	if err != nil {
+		log.Error("cerror use verification token", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("verification token already used")
+		return cerror.ErrInvalidToken
+	}
+
+	if err := s.vrfProvider.SetEmailVerified(ctx, v.UserID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return cerror.ErrInvalidToken
+		}
+		log.Error("cerror set email verified", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log.Info("email verified")
+
+	return nil
+}
+
+// ResendVerification повторно отправляет письмо с подтверждением. Как и RequestPasswordReset, отвечает одинаково
+// для неизвестных и уже подтверждённых пользователей
+func (s *Auth) ResendVerification(ctx context.Context, login string, appID int32) error {
+	const op = "Auth.ResendVerification"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login))
+
+	user, err := s.usrProvider.User(ctx, login, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("verification for unknown user")
+			return nil
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	if user.EmailVerified {
+		log.Info("email already verified")
+		return nil
+	}
+
+	if !s.sendVerification(ctx, log, user, appID) {
+		return cerror.ErrInternalErr
+	}
+	return nil
+}
+
+// SetAppRequireVerified включает или выключает для приложения запрет входа без подтверждённого адреса
+func (s *Auth) SetAppRequireVerified(ctx context.Context, appID int32, required bool) error {
+	const op = "auth.SetAppRequireVerified"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.Bool("required", required))
+
+	if err := s.admProvider.SetAppRequireVerified(ctx, appID, required); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return cerror.ErrAppNotFound
+		}
+		log.Error("cerror set app require verified", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	log.Info("app verification setting changed")
+
+	return nil
+}
+
+// sendVerification выпускает токен подтверждения и отправляет его пользователю. Ошибки только логируются,
+// результат сообщает, удалось ли отправить письмо
+func (s *Auth) sendVerification(ctx context.Context, log *slog.Logger, user models.User, appID int32) bool {
+	if s.vrfProvider == nil || s.notifier == nil {
+		return false
+	}
+
+	token, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate verification token", slog.String("err", err.Error()))
+		return false
+	}
+
+	_, err = s.vrfProvider.SaveEmailVerification(ctx, models.EmailVerification{
+		TokenHash: jwtgen.HashToken(token),
+		UserID:    user.ID,
+		AppID:     appID,
+		ExpiresAt: time.Now().Add(s.verifyTTL),
+	})
+	if err != nil {
+		log.Error("cerror save verification token", slog.String("err", err.Error()))
+		return false
+	}
+
+	if err := s.notifier.SendVerification(ctx, user, appID, token); err != nil {
+		log.Error("cerror send verification token", slog.String("err", err.Error()))
+		return false
+	}
+	return true
+}
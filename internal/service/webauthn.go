@@ -0,0 +1,453 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/storage"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"log/slog"
+	"time"
+)
+
+// BeginWebAuthnRegistration начинает регистрацию ключа доступа для владельца access токена или токена
+// подключения MFA из LoginUser. Возвращает
+// PublicKeyCredentialCreationOptions в JSON для navigator.credentials.create и токен церемонии
+func (s *Auth) BeginWebAuthnRegistration(ctx context.Context, token string) (options []byte, sessionToken string, err error) {
+	const op = "Auth.BeginWebAuthnRegistration"
+
+	log := s.log.With(slog.String("op", op))
+
+	claims, _, err := s.parseEnrollToken(ctx, log, token)
+	if err != nil {
+		return nil, "", err
+	}
+	log = log.With(slog.Int64("userid", claims.UserID), slog.Int("app_id", int(claims.AppID)))
+
+	user, err := s.usrProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return nil, "", cerror.ErrInvalidToken
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	rp, _, err := s.relyingParty(ctx, log, claims.AppID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	waUser, err := s.webauthnUser(ctx, user)
+	if err != nil {
+		log.Error("cerror get webauthn credentials", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	// уже зарегистрированные ключи исключаются, чтобы один аутентификатор не добавлялся дважды
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waUser.creds))
+	for _, c := range waUser.creds {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	creation, session, err := rp.BeginRegistration(waUser, webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		log.Error("cerror begin webauthn registration", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	return s.startWebAuthnSession(ctx, log, models.WebAuthnRegistration, user.ID, claims.AppID, creation, session)
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет новый ключ доступа
+func (s *Auth) FinishWebAuthnRegistration(ctx context.Context, sessionToken string, response []byte) error {
+	const op = "Auth.FinishWebAuthnRegistration"
+
+	log := s.log.With(slog.String("op", op))
+
+	session, data, err := s.useWebAuthnSession(ctx, log, sessionToken, models.WebAuthnRegistration)
+	if err != nil {
+		return err
+	}
+	log = log.With(slog.Int64("userid", session.UserID), slog.Int("app_id", int(session.AppID)))
+
+	user, err := s.usrProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	rp, _, err := s.relyingParty(ctx, log, session.AppID)
+	if err != nil {
+		return err
+	}
+	waUser, err := s.webauthnUser(ctx, user)
+	if err != nil {
+		log.Error("cerror get webauthn credentials", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Warn("invalid webauthn registration response", slog.String("err", err.Error()))
+		return cerror.ErrWebAuthnFailed
+	}
+	cred, err := rp.CreateCredential(waUser, data, parsed)
+	if err != nil {
+		log.Warn("webauthn registration rejected", slog.String("err", err.Error()))
+		return cerror.ErrWebAuthnFailed
+	}
+
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	_, err = s.waProvider.SaveWebAuthnCredential(ctx, models.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrCredentialExists) {
+			log.Warn("webauthn credential already registered")
+			return cerror.ErrWebAuthnFailed
+		}
+		log.Error("cerror save webauthn credential", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+
+	log.Info("webauthn credential registered")
+
+	return nil
+}
+
+// BeginWebAuthnLogin начинает вход по ключу доступа. Возвращает PublicKeyCredentialRequestOptions в JSON
+// для navigator.credentials.get и токен церемонии
+func (s *Auth) BeginWebAuthnLogin(ctx context.Context, login string, appID int32) (options []byte, sessionToken string, err error) {
+	const op = "Auth.BeginWebAuthnLogin"
+
+	log := s.log.With(slog.String("op", op), slog.String("login", login), slog.Int("app_id", int(appID)))
+
+	rp, app, err := s.relyingParty(ctx, log, appID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !app.Settings.LoginAllowed(models.LoginWebAuthn) {
+		log.Warn("webauthn login not allowed")
+		return nil, "", cerror.ErrLoginNotAllowed
+	}
+
+	user, err := s.usrProvider.User(ctx, login, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return nil, "", cerror.ErrInvalidCredentials
+		}
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	waUser, err := s.webauthnUser(ctx, user)
+	if err != nil {
+		log.Error("cerror get webauthn credentials", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+	if len(waUser.creds) == 0 {
+		log.Warn("user has no webauthn credentials")
+		return nil, "", cerror.ErrInvalidCredentials
+	}
+
+	assertion, session, err := rp.BeginLogin(waUser)
+	if err != nil {
+		log.Error("cerror begin webauthn login", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	return s.startWebAuthnSession(ctx, log, models.WebAuthnLogin, user.ID, appID, assertion, session)
+}
+
+// FinishWebAuthnLogin проверяет подпись аутентификатора и выдаёт пару токенов. Ключ доступа сам является
+// вторым фактором, поэтому TOTP при таком входе не запрашивается
+func (s *Auth) FinishWebAuthnLogin(ctx context.Context, sessionToken string, response []byte) (tokens models.Tokens, err error) {
+	const op = "Auth.FinishWebAuthnLogin"
+
+	log := s.log.With(slog.String("op", op))
+
+	session, data, err := s.useWebAuthnSession(ctx, log, sessionToken, models.WebAuthnLogin)
+	if err != nil {
+		return tokens, err
+	}
+	log = log.With(slog.Int64("userid", session.UserID), slog.Int("app_id", int(session.AppID)))
+
+	user, err := s.usrProvider.UserByID(ctx, session.UserID)
+	if err != nil {
+		log.Error("cerror get user", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+	if err = s.checkAppAccess(ctx, log, user.ID, session.AppID); err != nil {
+		return tokens, err
+	}
+	app, err := s.appProvider.App(ctx, session.AppID)
+	if err != nil {
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return tokens, cerror.ErrAppNotFound
+		}
+		return tokens, cerror.ErrInternalErr
+	}
+	if app.Disabled {
+		log.Warn("app disabled")
+		return tokens, cerror.ErrAppDisabled
+	}
+	if !app.Settings.LoginAllowed(models.LoginWebAuthn) {
+		log.Warn("webauthn login not allowed")
+		return tokens, cerror.ErrLoginNotAllowed
+	}
+	rp, err := newRelyingParty(app)
+	if err != nil {
+		log.Warn("webauthn not configured", slog.String("err", err.Error()))
+		return tokens, cerror.ErrWebAuthnDisabled
+	}
+	waUser, err := s.webauthnUser(ctx, user)
+	if err != nil {
+		log.Error("cerror get webauthn credentials", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Warn("invalid webauthn login response", slog.String("err", err.Error()))
+		return tokens, cerror.ErrWebAuthnFailed
+	}
+	cred, err := rp.ValidateLogin(waUser, data, parsed)
+	if err != nil {
+		log.Warn("webauthn login rejected", slog.String("err", err.Error()))
+		return tokens, cerror.ErrWebAuthnFailed
+	}
+	if cred.Authenticator.CloneWarning {
+		log.Warn("webauthn sign count did not increase, credential may be cloned")
+		return tokens, cerror.ErrWebAuthnFailed
+	}
+
+	err = s.waProvider.UpdateWebAuthnCredential(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState)
+	if err != nil {
+		log.Error("cerror update webauthn credential", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	if app.RequireVerified && !user.EmailVerified {
+		log.Warn("email not verified")
+		return tokens, cerror.ErrEmailNotVerified
+	}
+
+	familyID, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate token family", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	tokens, err = s.issueTokens(ctx, user, app, familyID)
+	if err != nil {
+		log.Error("cerror generate token", slog.String("err", err.Error()))
+		return tokens, cerror.ErrInternalErr
+	}
+
+	log.Info("webauthn login success")
+
+	return tokens, nil
+}
+
+// SetAppWebAuthn задаёт relying party ID и разрешённые origins приложения. Пустой rpID отключает WebAuthn
+func (s *Auth) SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error {
+	const op = "auth.SetAppWebAuthn"
+
+	log := s.log.With(slog.String("op", op), slog.Int("app_id", int(appID)), slog.String("rp_id", rpID))
+
+	if rpID != "" && len(origins) == 0 {
+		log.Warn("webauthn origins are empty")
+		return cerror.ErrInvalidAppSettings
+	}
+
+	if err := s.admProvider.SetAppWebAuthn(ctx, appID, rpID, origins); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return cerror.ErrAppNotFound
+		}
+		log.Error("cerror set app webauthn", slog.String("err", err.Error()))
+		return cerror.ErrInternalErr
+	}
+	log.Info("app webauthn setting changed")
+
+	return nil
+}
+
+// relyingParty возвращает настройки WebAuthn приложения вместе с самим приложением
+func (s *Auth) relyingParty(ctx context.Context, log *slog.Logger, appID int32) (*webauthn.WebAuthn, models.App, error) {
+	app, err := s.appProvider.App(ctx, appID)
+	if err != nil {
+		log.Error("cerror get app", slog.String("err", err.Error()))
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, app, cerror.ErrAppNotFound
+		}
+		return nil, app, cerror.ErrInternalErr
+	}
+
+	rp, err := newRelyingParty(app)
+	if err != nil {
+		log.Warn("webauthn not configured", slog.String("err", err.Error()))
+		return nil, app, cerror.ErrWebAuthnDisabled
+	}
+	return rp, app, nil
+}
+
+func newRelyingParty(app models.App) (*webauthn.WebAuthn, error) {
+	if app.RPID == "" {
+		return nil, cerror.ErrWebAuthnDisabled
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          app.RPID,
+		RPDisplayName: app.Name,
+		RPOrigins:     app.RPOrigins,
+	})
+}
+
+// startWebAuthnSession сохраняет состояние церемонии и возвращает опции для браузера вместе с токеном церемонии
+func (s *Auth) startWebAuthnSession(ctx context.Context, log *slog.Logger, kind string, userID int64, appID int32,
+	options interface{}, session *webauthn.SessionData) ([]byte, string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Error("cerror marshal webauthn session", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+	opts, err := json.Marshal(options)
+	if err != nil {
+		log.Error("cerror marshal webauthn options", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	token, err := jwtgen.NewRandomToken()
+	if err != nil {
+		log.Error("cerror generate webauthn session", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	_, err = s.waProvider.SaveWebAuthnSession(ctx, models.WebAuthnSession{
+		TokenHash: jwtgen.HashToken(token),
+		UserID:    userID,
+		AppID:     appID,
+		Kind:      kind,
+		Data:      data,
+		ExpiresAt: time.Now().Add(s.webauthnTTL),
+	})
+	if err != nil {
+		log.Error("cerror save webauthn session", slog.String("err", err.Error()))
+		return nil, "", cerror.ErrInternalErr
+	}
+
+	log.Info("webauthn ceremony started", slog.String("kind", kind))
+
+	return opts, token, nil
+}
+
+// useWebAuthnSession гасит токен церемонии. Церемония одноразовая, повторить её после ошибки можно только заново
+func (s *Auth) useWebAuthnSession(ctx context.Context, log *slog.Logger, token string,
+	kind string) (models.WebAuthnSession, webauthn.SessionData, error) {
+	var data webauthn.SessionData
+
+	session, err := s.waProvider.WebAuthnSession(ctx, jwtgen.HashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			log.Warn("webauthn session not found")
+			return session, data, cerror.ErrInvalidToken
+		}
+		log.Error("cerror get webauthn session", slog.String("err", err.Error()))
+		return session, data, cerror.ErrInternalErr
+	}
+
+	if session.Used || session.Kind != kind || time.Now().After(session.ExpiresAt) {
+		log.Warn("webauthn session used, expired or of another kind")
+		return session, data, cerror.ErrInvalidToken
+	}
+
+	ok, err := s.waProvider.UseWebAuthnSession(ctx, session.ID)
+	if err != nil {
+		log.Error("cerror use webauthn session", slog.String("err", err.Error()))
+		return session, data, cerror.ErrInternalErr
+	}
+	if !ok {
+		log.Warn("webauthn session already used")
+		return session, data, cerror.ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(session.Data, &data); err != nil {
+		log.Error("cerror unmarshal webauthn session", slog.String("err", err.Error()))
+		return session, data, cerror.ErrInternalErr
+	}
+	return session, data, nil
+}
+
+// webauthnUser пользователь вместе с его ключами доступа в виде, который ожидает библиотека webauthn
+type webauthnUser struct {
+	user  models.User
+	creds []webauthn.Credential
+}
+
+func (s *Auth) webauthnUser(ctx context.Context, user models.User) (webauthnUser, error) {
+	stored, err := s.waProvider.WebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return webauthnUser{}, err
+	}
+
+	creds := make([]webauthn.Credential, 0, len(stored))
+	for _, c := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, t := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		creds = append(creds, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: c.BackupEligible, BackupState: c.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return webauthnUser{user: user, creds: creds}, nil
+}
+
+// WebAuthnID user handle, по нему аутентификатор связывает ключ с пользователем
+func (u webauthnUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(u.user.ID))
+}
+
+func (u webauthnUser) WebAuthnName() string {
+	return u.user.Login
+}
+
+func (u webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Login
+}
+
+func (u webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.creds
+}
+
+func (u webauthnUser) WebAuthnIcon() string {
+	return ""
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/cerror"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/generate/jwtgen"
+	"github.com/MorZLE/auth/internal/service/mocks"
+	"github.com/MorZLE/auth/internal/storage"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/mock"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// softAuthenticator программный аутентификатор с одним ключом ES256, заменяет браузер и устройство в тестах
+type softAuthenticator struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+// create отвечает на PublicKeyCredentialCreationOptions так же, как navigator.credentials.create
+func (a *softAuthenticator) create(options []byte, origin string) []byte {
+	var creation protocol.CredentialCreation
+	if err := json.Unmarshal(options, &creation); err != nil {
+		a.t.Fatalf("unmarshal creation options: %v", err)
+	}
+
+	clientData := a.clientData("webauthn.create", creation.Response.Challenge, origin)
+
+	pub, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1,
+		XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	authData := a.authData(creation.Response.RelyingParty.ID, 0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+	authData = append(authData, a.id...)
+	authData = append(authData, pub...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get отвечает на PublicKeyCredentialRequestOptions так же, как navigator.credentials.get
+func (a *softAuthenticator) get(options []byte, origin string, userHandle []byte) []byte {
+	var assertion protocol.CredentialAssertion
+	if err := json.Unmarshal(options, &assertion); err != nil {
+		a.t.Fatalf("unmarshal assertion options: %v", err)
+	}
+
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge, origin)
+
+	a.counter++
+	authData := a.authData(assertion.Response.RelyingPartyID, 0x05)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(sig),
+		"userHandle":        b64(userHandle),
+	})
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge []byte, origin string) []byte {
+	data, err := json.Marshal(map[string]string{"type": typ, "challenge": b64(challenge), "origin": origin})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpHash := sha256.Sum256([]byte(rpID))
+	data := append(rpHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.counter)
+}
+
+func (a *softAuthenticator) credential(response map[string]interface{}) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.id),
+		"rawId":    b64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// memWebAuthn хранилище ключей и церемоний в памяти, церемония проходит через него целиком
+type memWebAuthn struct {
+	credentials []models.WebAuthnCredential
+	sessions    map[string]models.WebAuthnSession
+}
+
+func (m *memWebAuthn) SaveWebAuthnCredential(_ context.Context, c models.WebAuthnCredential) (int64, error) {
+	for _, stored := range m.credentials {
+		if bytes.Equal(stored.CredentialID, c.CredentialID) {
+			return 0, storage.ErrCredentialExists
+		}
+	}
+	c.ID = int64(len(m.credentials) + 1)
+	m.credentials = append(m.credentials, c)
+	return c.ID, nil
+}
+
+func (m *memWebAuthn) WebAuthnCredentials(_ context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	var res []models.WebAuthnCredential
+	for _, c := range m.credentials {
+		if c.UserID == userID {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (m *memWebAuthn) UpdateWebAuthnCredential(_ context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	for i, c := range m.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			m.credentials[i].SignCount = signCount
+			m.credentials[i].BackupState = backupState
+			return nil
+		}
+	}
+	return storage.ErrTokenNotFound
+}
+
+func (m *memWebAuthn) SaveWebAuthnSession(_ context.Context, session models.WebAuthnSession) (int64, error) {
+	session.ID = int64(len(m.sessions) + 1)
+	m.sessions[session.TokenHash] = session
+	return session.ID, nil
+}
+
+func (m *memWebAuthn) WebAuthnSession(_ context.Context, tokenHash string) (models.WebAuthnSession, error) {
+	session, ok := m.sessions[tokenHash]
+	if !ok {
+		return session, storage.ErrTokenNotFound
+	}
+	return session, nil
+}
+
+func (m *memWebAuthn) UseWebAuthnSession(_ context.Context, id int64) (bool, error) {
+	for hash, session := range m.sessions {
+		if session.ID == id && !session.Used {
+			session.Used = true
+			m.sessions[hash] = session
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestAuth_WebAuthn(t *testing.T) {
+	const origin = "https://app.example.com"
+
+	user := models.User{ID: 7, Login: "test"}
+	app := models.App{ID: 3, Name: "app", Secret: "secret", RPID: "app.example.com", RPOrigins: []string{origin}}
+	token, err := jwtgen.NewJWT(user, app, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWT() cerror = %v", err)
+	}
+
+	usrProvider := mocks.NewUserProvider(t)
+	usrProvider.On("UserByID", mock.Anything, int64(7)).Return(user, nil)
+	usrProvider.On("HasAppAccess", mock.Anything, int64(7), int32(3)).Return(true, nil)
+	usrProvider.On("User", mock.Anything, "test", int32(3)).Return(user, nil)
+	usrProvider.On("User", mock.Anything, "unknown", int32(3)).Return(models.User{}, storage.ErrUserNotFound)
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(app, nil)
+	revProvider := mocks.NewRevocationProvider(t)
+	revProvider.On("TokenRevoked", mock.Anything, mock.Anything).Return(false, nil)
+	revProvider.On("UserTokensRevokedAt", mock.Anything, int64(7)).Return(time.Time{}, nil)
+	tknProvider := mocks.NewTokenProvider(t)
+	tknProvider.On("SaveRefreshToken", mock.Anything, mock.MatchedBy(func(rt models.RefreshToken) bool {
+		return rt.UserID == 7 && rt.AppID == 3
+	})).Return(int64(1), nil)
+
+	store := &memWebAuthn{sessions: map[string]models.WebAuthnSession{}}
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		usrProvider: usrProvider,
+		appProvider: appProvider,
+		revProvider: revProvider,
+		tknProvider: tknProvider,
+		waProvider:  store,
+		tokenTTL:    time.Hour,
+		refreshTTL:  time.Hour,
+		webauthnTTL: time.Minute,
+	}
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+
+	if _, _, err := s.BeginWebAuthnLogin(ctx, "test", 3); !errors.Is(err, cerror.ErrInvalidCredentials) {
+		t.Fatalf("BeginWebAuthnLogin() without credentials cerror = %v, want %v", err, cerror.ErrInvalidCredentials)
+	}
+
+	options, sessionToken, err := s.BeginWebAuthnRegistration(ctx, token)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration() cerror = %v", err)
+	}
+	response := authenticator.create(options, origin)
+	if err := s.FinishWebAuthnRegistration(ctx, sessionToken, response); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration() cerror = %v", err)
+	}
+	if len(store.credentials) != 1 || !bytes.Equal(store.credentials[0].CredentialID, authenticator.id) {
+		t.Fatalf("FinishWebAuthnRegistration() saved = %v", store.credentials)
+	}
+	if err := s.FinishWebAuthnRegistration(ctx, sessionToken, response); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("FinishWebAuthnRegistration() repeat cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+
+	// повторная регистрация того же аутентификатора отклоняется
+	options, sessionToken, err = s.BeginWebAuthnRegistration(ctx, token)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration() cerror = %v", err)
+	}
+	if err := s.FinishWebAuthnRegistration(ctx, sessionToken, authenticator.create(options, origin)); !errors.Is(err, cerror.ErrWebAuthnFailed) {
+		t.Errorf("FinishWebAuthnRegistration() duplicate cerror = %v, want %v", err, cerror.ErrWebAuthnFailed)
+	}
+
+	if _, _, err := s.BeginWebAuthnLogin(ctx, "unknown", 3); !errors.Is(err, cerror.ErrInvalidCredentials) {
+		t.Errorf("BeginWebAuthnLogin() unknown cerror = %v, want %v", err, cerror.ErrInvalidCredentials)
+	}
+
+	userHandle := webauthnUser{user: user}.WebAuthnID()
+
+	options, sessionToken, err = s.BeginWebAuthnLogin(ctx, "test", 3)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin() cerror = %v", err)
+	}
+	tokens, err := s.FinishWebAuthnLogin(ctx, sessionToken, authenticator.get(options, origin, userHandle))
+	if err != nil {
+		t.Fatalf("FinishWebAuthnLogin() cerror = %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("FinishWebAuthnLogin() got = %v, want token pair", tokens)
+	}
+	if store.credentials[0].SignCount != authenticator.counter {
+		t.Errorf("FinishWebAuthnLogin() sign count = %v, want %v", store.credentials[0].SignCount, authenticator.counter)
+	}
+
+	// ответ для чужого origin не принимается
+	options, sessionToken, err = s.BeginWebAuthnLogin(ctx, "test", 3)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin() cerror = %v", err)
+	}
+	response = authenticator.get(options, "https://evil.example.com", userHandle)
+	if _, err := s.FinishWebAuthnLogin(ctx, sessionToken, response); !errors.Is(err, cerror.ErrWebAuthnFailed) {
+		t.Errorf("FinishWebAuthnLogin() foreign origin cerror = %v, want %v", err, cerror.ErrWebAuthnFailed)
+	}
+
+	// счётчик подписей не вырос, ключ мог быть скопирован
+	options, sessionToken, err = s.BeginWebAuthnLogin(ctx, "test", 3)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin() cerror = %v", err)
+	}
+	authenticator.counter = 0
+	response = authenticator.get(options, origin, userHandle)
+	if _, err := s.FinishWebAuthnLogin(ctx, sessionToken, response); !errors.Is(err, cerror.ErrWebAuthnFailed) {
+		t.Errorf("FinishWebAuthnLogin() cloned cerror = %v, want %v", err, cerror.ErrWebAuthnFailed)
+	}
+
+	// токен регистрации не подходит для входа
+	options, sessionToken, err = s.BeginWebAuthnRegistration(ctx, token)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration() cerror = %v", err)
+	}
+	if _, err := s.FinishWebAuthnLogin(ctx, sessionToken, authenticator.get(options, origin, userHandle)); !errors.Is(err, cerror.ErrInvalidToken) {
+		t.Errorf("FinishWebAuthnLogin() registration session cerror = %v, want %v", err, cerror.ErrInvalidToken)
+	}
+}
+
+func TestAuth_WebAuthn_Disabled(t *testing.T) {
+	appProvider := mocks.NewAppProvider(t)
+	appProvider.On("App", mock.Anything, int32(3)).Return(models.App{ID: 3, Name: "app", Secret: "secret"}, nil)
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		appProvider: appProvider,
+	}
+
+	if _, _, err := s.BeginWebAuthnLogin(context.Background(), "test", 3); !errors.Is(err, cerror.ErrWebAuthnDisabled) {
+		t.Errorf("BeginWebAuthnLogin() cerror = %v, wantErr %v", err, cerror.ErrWebAuthnDisabled)
+	}
+}
+
+func TestAuth_SetAppWebAuthn(t *testing.T) {
+	admProvider := mocks.NewAdminProvider(t)
+	admProvider.On("SetAppWebAuthn", mock.Anything, int32(3), "app.example.com", []string{"https://app.example.com"}).
+		Return(nil).Once()
+	admProvider.On("SetAppWebAuthn", mock.Anything, int32(4), "", []string(nil)).Return(storage.ErrAppNotFound).Once()
+
+	s := &Auth{
+		log:         slog.With(slog.String("service", "auth")),
+		admProvider: admProvider,
+	}
+	ctx := context.Background()
+
+	if err := s.SetAppWebAuthn(ctx, 3, "app.example.com", nil); !errors.Is(err, cerror.ErrInvalidAppSettings) {
+		t.Errorf("SetAppWebAuthn() without origins cerror = %v, wantErr %v", err, cerror.ErrInvalidAppSettings)
+	}
+	if err := s.SetAppWebAuthn(ctx, 3, "app.example.com", []string{"https://app.example.com"}); err != nil {
+		t.Errorf("SetAppWebAuthn() cerror = %v", err)
+	}
+	if err := s.SetAppWebAuthn(ctx, 4, "", nil); !errors.Is(err, cerror.ErrAppNotFound) {
+		t.Errorf("SetAppWebAuthn() cerror = %v, wantErr %v", err, cerror.ErrAppNotFound)
+	}
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+// GrantAppAccess даёт пользователю доступ к приложению. Повторная выдача не ошибка. ErrUserExists, если
+// среди пользователей приложения уже есть другой с тем же логином
+func (s *Storage) GrantAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "memory.GrantAppAccess"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if uid, ok := s.appUsers[appID][u.Login]; ok {
+		if uid == userID {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+
+	s.addAppUser(appID, u.Login, userID)
+	return nil
+}
+
+// RevokeAppAccess забирает доступ к приложению вместе с правами администратора и ролями в нём и отзывает
+// refresh токены пользователя для этого приложения. ErrUserNotFound, если доступа не было
+func (s *Storage) RevokeAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "memory.RevokeAppAccess"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || s.appUsers[appID][u.Login] != userID {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	delete(s.appUsers[appID], u.Login)
+
+	for id, a := range s.admins {
+		if a.UserID == userID && a.AppID == appID {
+			delete(s.admins, id)
+		}
+	}
+	for roleID := range s.userRoles[userID] {
+		if s.roles[roleID].AppID == appID {
+			delete(s.userRoles[userID], roleID)
+		}
+	}
+	for _, t := range s.refreshTokens {
+		if t.UserID == userID && t.AppID == appID {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (s *Storage) HasAppAccess(ctx context.Context, userID int64, appID int32) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	return ok && s.appUsers[appID][u.Login] == userID, nil
+}
+
+// addAppUser записывает логин пользователя в пространство имён приложения
+func (s *Storage) addAppUser(appID int32, login string, userID int64) {
+	if s.appUsers[appID] == nil {
+		s.appUsers[appID] = make(map[string]int64)
+	}
+	s.appUsers[appID][login] = userID
+}
@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// Apps возвращает все приложения по возрастанию id
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]models.App, 0, len(s.apps))
+	for _, app := range s.apps {
+		res = append(res, *app)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// UpdateApp переименовывает приложение. ErrUniqueApp, если имя занято другим приложением
+func (s *Storage) UpdateApp(ctx context.Context, appID int32, name string) error {
+	const op = "memory.UpdateApp"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	for id, other := range s.apps {
+		if id != appID && other.Name == name {
+			return fmt.Errorf("%s: %w", op, storage.ErrUniqueApp)
+		}
+	}
+	app.Name = name
+	return nil
+}
+
+// SetAppDisabled выключает или включает приложение
+func (s *Storage) SetAppDisabled(ctx context.Context, appID int32, disabled bool) error {
+	const op = "memory.SetAppDisabled"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	app.Disabled = disabled
+	return nil
+}
+
+// SetAppSecret заменяет секрет приложения
+func (s *Storage) SetAppSecret(ctx context.Context, appID int32, secret string) error {
+	const op = "memory.SetAppSecret"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	app.Secret = secret
+	return nil
+}
+
+// SetAppSettings заменяет настройки приложения целиком
+func (s *Storage) SetAppSettings(ctx context.Context, appID int32, settings models.AppSettings) error {
+	const op = "memory.SetAppSettings"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	settings.LoginMethods = slices.Clone(settings.LoginMethods)
+	settings.Claims = maps.Clone(settings.Claims)
+	if settings.PasswordPolicy != nil {
+		rules := *settings.PasswordPolicy
+		settings.PasswordPolicy = &rules
+	}
+	app.Settings = settings
+	return nil
+}
+
+// DeleteApp удаляет приложение вместе с его ролями, ключами, токенами и доступами пользователей.
+// Пока у приложения есть пользователи, удаление без cascade возвращает ErrAppHasUsers. С cascade
+// пользователи, у которых нет других приложений, удаляются, а остальные переносятся в одно из своих приложений
+func (s *Storage) DeleteApp(ctx context.Context, appID int32, cascade bool) error {
+	const op = "memory.DeleteApp"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+
+	var members []int64
+	for _, uid := range sortedIDs(s.users) {
+		if u := s.users[uid]; u.appID == appID || s.appUsers[appID][u.Login] == uid {
+			members = append(members, uid)
+		}
+	}
+	if len(members) > 0 && !cascade {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppHasUsers)
+	}
+
+	for _, uid := range members {
+		if other, ok := s.otherApp(uid, appID); ok {
+			if s.users[uid].appID == appID {
+				s.users[uid].appID = other
+			}
+			continue
+		}
+		s.deleteUser(uid)
+	}
+
+	for id, r := range s.roles {
+		if r.AppID == appID {
+			for _, roles := range s.userRoles {
+				delete(roles, id)
+			}
+			delete(s.roles, id)
+		}
+	}
+	deleteWhere(s.admins, func(a *models.Admin) bool { return a.AppID == appID })
+	deleteWhere(s.refreshTokens, func(t *models.RefreshToken) bool { return t.AppID == appID })
+	deleteWhere(s.resets, func(r *models.PasswordReset) bool { return r.AppID == appID })
+	deleteWhere(s.verifications, func(v *models.EmailVerification) bool { return v.AppID == appID })
+	deleteWhere(s.mfaChallenges, func(c *models.MFAChallenge) bool { return c.AppID == appID })
+	deleteWhere(s.webauthnSessions, func(w *models.WebAuthnSession) bool { return w.AppID == appID })
+	deleteWhere(s.signingKeys, func(k *models.SigningKey) bool { return k.AppID == appID })
+	deleteWhere(s.revokedTokens, func(t models.RevokedToken) bool { return t.AppID == appID })
+	delete(s.appUsers, appID)
+	delete(s.apps, appID)
+	return nil
+}
+
+// otherApp возвращает приложение с наименьшим id, кроме appID, к которому у пользователя есть доступ
+func (s *Storage) otherApp(userID int64, appID int32) (int32, bool) {
+	login := s.users[userID].Login
+
+	var res int32
+	found := false
+	for id, users := range s.appUsers {
+		if id != appID && users[login] == userID && (!found || id < res) {
+			res, found = id, true
+		}
+	}
+	return res, found
+}
+
+// deleteUser удаляет пользователя вместе со всеми его данными
+func (s *Storage) deleteUser(userID int64) {
+	u := s.users[userID]
+	for _, users := range s.appUsers {
+		if users[u.Login] == userID {
+			delete(users, u.Login)
+		}
+	}
+
+	delete(s.mfa, userID)
+	delete(s.recoveryCodes, userID)
+	delete(s.userRevocations, userID)
+	delete(s.userRoles, userID)
+	deleteWhere(s.mfaChallenges, func(c *models.MFAChallenge) bool { return c.UserID == userID })
+	deleteWhere(s.webauthnCreds, func(c *models.WebAuthnCredential) bool { return c.UserID == userID })
+	deleteWhere(s.webauthnSessions, func(w *models.WebAuthnSession) bool { return w.UserID == userID })
+	deleteWhere(s.admins, func(a *models.Admin) bool { return a.UserID == userID })
+	deleteWhere(s.refreshTokens, func(t *models.RefreshToken) bool { return t.UserID == userID })
+	deleteWhere(s.resets, func(r *models.PasswordReset) bool { return r.UserID == userID })
+	deleteWhere(s.verifications, func(v *models.EmailVerification) bool { return v.UserID == userID })
+	delete(s.users, userID)
+}
+
+// deleteWhere удаляет из m записи, подходящие под match
+func deleteWhere[K comparable, V any](m map[K]V, match func(V) bool) {
+	for k, v := range m {
+		if match(v) {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) Attempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok {
+		return *a, nil
+	}
+	return models.LoginAttempts{}, nil
+}
+
+// AddFailure увеличивает счётчик отказов, сбрасывая его, если прошлый отказ был до начала окна windowStart
+func (s *Storage) AddFailure(ctx context.Context, key string, at time.Time, windowStart time.Time) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	switch {
+	case !ok:
+		a = &models.LoginAttempts{Failures: 1}
+		s.attempts[key] = a
+	case seconds(a.LastFailure) < windowStart.Unix():
+		a.Failures = 1
+		a.PrevFailure = time.Time{}
+	default:
+		a.Failures++
+		a.PrevFailure = a.LastFailure
+	}
+	a.LastFailure = unixTime(at)
+
+	return *a, nil
+}
+
+// RemoveFailure возвращает учтённую попытку, которая оказалась успешной
+func (s *Storage) RemoveFailure(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok && a.Failures > 0 {
+		a.Failures--
+	}
+	return nil
+}
+
+func (s *Storage) LockUntil(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok {
+		a.LockedUntil = unixTime(until)
+	}
+	return nil
+}
+
+func (s *Storage) ResetAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *Storage) DeleteStaleAttempts(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, a := range s.attempts {
+		if seconds(a.LastFailure) < before.Unix() && seconds(a.LockedUntil) < before.Unix() {
+			delete(s.attempts, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SaveSigningKey(ctx context.Context, key models.SigningKey) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextID("signing_keys")
+	key.PrivateKey = cloneBytes(key.PrivateKey)
+	key.PublicKey = cloneBytes(key.PublicKey)
+	key.CreatedAt = unixTime(key.CreatedAt)
+	key.ActivatedAt = unixTime(key.ActivatedAt)
+	key.RetiredAt = time.Time{}
+	s.signingKeys[key.ID] = &key
+	return key.ID, nil
+}
+
+// SigningKey возвращает активный ключ приложения для алгоритма alg
+func (s *Storage) SigningKey(ctx context.Context, appID int32, alg string) (models.SigningKey, error) {
+	const op = "memory.SigningKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res *models.SigningKey
+	for _, id := range sortedIDs(s.signingKeys) {
+		k := s.signingKeys[id]
+		if k.AppID == appID && k.Alg == alg && k.Status == models.KeyStatusActive {
+			res = k
+		}
+	}
+	if res == nil {
+		return models.SigningKey{}, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+	return *res, nil
+}
+
+func (s *Storage) SigningKeyByKID(ctx context.Context, kid string) (models.SigningKey, error) {
+	const op = "memory.SigningKeyByKID"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.signingKeys {
+		if k.KID == kid {
+			return *k, nil
+		}
+	}
+	return models.SigningKey{}, fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+}
+
+// SigningKeys возвращает все не удалённые ключи
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.SigningKey
+	for _, id := range sortedIDs(s.signingKeys) {
+		if k := s.signingKeys[id]; k.Status != models.KeyStatusDeleted {
+			res = append(res, *k)
+		}
+	}
+	return res, nil
+}
+
+// ActivateSigningKey делает ожидающий ключ активным, а прежний активный ключ того же приложения и алгоритма переводит в retired
+func (s *Storage) ActivateSigningKey(ctx context.Context, id int64, at time.Time) error {
+	const op = "memory.ActivateSigningKey"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.signingKeys[id]
+	if !ok || key.Status != models.KeyStatusPending {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+
+	for _, k := range s.signingKeys {
+		if k.AppID == key.AppID && k.Alg == key.Alg && k.Status == models.KeyStatusActive {
+			k.Status = models.KeyStatusRetired
+			k.RetiredAt = unixTime(at)
+		}
+	}
+	key.Status = models.KeyStatusActive
+	key.ActivatedAt = unixTime(at)
+	return nil
+}
+
+// DeleteSigningKey помечает ключ удалённым и стирает приватную часть
+func (s *Storage) DeleteSigningKey(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, ok := s.signingKeys[id]; ok {
+		k.Status = models.KeyStatusDeleted
+		k.PrivateKey = []byte{}
+	}
+	return nil
+}
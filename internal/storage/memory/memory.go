@@ -0,0 +1,235 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage хранит данные в памяти процесса. Подходит для тестов и временных окружений: данные теряются
+// при перезапуске. Семантика ошибок совпадает с sqlite и postgres
+type Storage struct {
+	mu  sync.Mutex
+	seq map[string]int64
+
+	apps             map[int32]*models.App
+	users            map[int64]*user
+	appUsers         map[int32]map[string]int64
+	admins           map[int64]*models.Admin
+	roles            map[int64]*models.Role
+	userRoles        map[int64]map[int64]struct{}
+	refreshTokens    map[int64]*models.RefreshToken
+	signingKeys      map[int64]*models.SigningKey
+	revokedTokens    map[string]models.RevokedToken
+	userRevocations  map[int64]userRevocation
+	attempts         map[string]*models.LoginAttempts
+	resets           map[int64]*models.PasswordReset
+	verifications    map[int64]*models.EmailVerification
+	notifications    map[int64]*models.Notification
+	mfa              map[int64]*models.MFA
+	recoveryCodes    map[int64][]*recoveryCode
+	mfaChallenges    map[int64]*models.MFAChallenge
+	webauthnCreds    map[int64]*models.WebAuthnCredential
+	webauthnSessions map[int64]*models.WebAuthnSession
+}
+
+type user struct {
+	models.User
+	appID int32
+}
+
+func New() *Storage {
+	return &Storage{
+		seq:              make(map[string]int64),
+		apps:             make(map[int32]*models.App),
+		users:            make(map[int64]*user),
+		appUsers:         make(map[int32]map[string]int64),
+		admins:           make(map[int64]*models.Admin),
+		roles:            make(map[int64]*models.Role),
+		userRoles:        make(map[int64]map[int64]struct{}),
+		refreshTokens:    make(map[int64]*models.RefreshToken),
+		signingKeys:      make(map[int64]*models.SigningKey),
+		revokedTokens:    make(map[string]models.RevokedToken),
+		userRevocations:  make(map[int64]userRevocation),
+		attempts:         make(map[string]*models.LoginAttempts),
+		resets:           make(map[int64]*models.PasswordReset),
+		verifications:    make(map[int64]*models.EmailVerification),
+		notifications:    make(map[int64]*models.Notification),
+		mfa:              make(map[int64]*models.MFA),
+		recoveryCodes:    make(map[int64][]*recoveryCode),
+		mfaChallenges:    make(map[int64]*models.MFAChallenge),
+		webauthnCreds:    make(map[int64]*models.WebAuthnCredential),
+		webauthnSessions: make(map[int64]*models.WebAuthnSession),
+	}
+}
+
+// SaveUser создаёт пользователя и сразу даёт ему доступ к приложению регистрации. Логин должен быть
+// свободен среди всех пользователей с доступом к приложению
+func (s *Storage) SaveUser(ctx context.Context, login string, pswdHash []byte, appid int32) (uid int64, err error) {
+	const op = "memory.SaveUser"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.appUsers[appid][login]; ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+	for _, u := range s.users {
+		if u.Login == login && u.appID == appid {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+	}
+
+	uid = s.nextID("users")
+	s.users[uid] = &user{User: models.User{ID: uid, Login: login, PassHash: cloneBytes(pswdHash)}, appID: appid}
+	s.addAppUser(appid, login, uid)
+	return uid, nil
+}
+
+func (s *Storage) User(ctx context.Context, login string, appid int32) (models.User, error) {
+	const op = "memory.User"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, ok := s.appUsers[appid][login]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return s.users[uid].User, nil
+}
+
+func (s *Storage) UserByID(ctx context.Context, uid int64) (models.User, error) {
+	const op = "memory.UserByID"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[uid]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return u.User, nil
+}
+
+func (s *Storage) IsAdmin(ctx context.Context, userID int64, appID int32) (models.Admin, error) {
+	const op = "memory.IsAdmin"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedIDs(s.admins) {
+		a := s.admins[id]
+		if a.UserID == userID && a.AppID == appID {
+			return *a, nil
+		}
+	}
+	return models.Admin{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+}
+
+func (s *Storage) App(ctx context.Context, appID int32) (models.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, storage.ErrAppNotFound
+	}
+	return *app, nil
+}
+
+// CreateAdmin делает пользователя приложения администратором уровня lvl и назначает ему роль admin_lvl_N,
+// чтобы CheckPermission не расходился с admins
+func (s *Storage) CreateAdmin(ctx context.Context, login string, lvl int32, appID int32) (uid int64, err error) {
+	const op = "memory.CreateAdmin"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, ok := s.appUsers[appID][login]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	id := s.nextID("admins")
+	s.admins[id] = &models.Admin{Id: id, Lvl: lvl, UserID: uid, AppID: appID}
+	s.assignAdminRole(uid, appID, lvl)
+	return id, nil
+}
+
+// DeleteAdmin снимает права администратора приложения appID с пользователя этого приложения
+// вместе с ролями admin_lvl_N его записей в admins
+func (s *Storage) DeleteAdmin(ctx context.Context, login string, appID int32) (res bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, ok := s.appUsers[appID][login]
+	if !ok {
+		return true, nil
+	}
+	for id, a := range s.admins {
+		if a.UserID == uid && a.AppID == appID {
+			if r, ok := s.roleByName(appID, storage.AdminRole(a.Lvl)); ok {
+				delete(s.userRoles[uid], r.ID)
+			}
+			delete(s.admins, id)
+		}
+	}
+	return true, nil
+}
+
+func (s *Storage) AddApp(ctx context.Context, name, secret, alg string) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, app := range s.apps {
+		if app.Name == name {
+			return 0, storage.ErrUniqueApp
+		}
+	}
+
+	id := int32(s.nextID("apps"))
+	s.apps[id] = &models.App{ID: int64(id), Name: name, Secret: secret, Alg: alg}
+	return id, nil
+}
+
+func (s *Storage) Close() error {
+	return nil
+}
+
+// nextID выдаёт следующий идентификатор таблицы, как автоинкремент в sql хранилищах
+func (s *Storage) nextID(table string) int64 {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+// sortedIDs возвращает ключи по возрастанию, чтобы списки шли в порядке вставки
+func sortedIDs[V any](m map[int64]V) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// unixTime отбрасывает доли секунды, как при хранении времени в unix секундах. Нулевое время остаётся нулевым
+func unixTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	return time.Unix(t.Unix(), 0)
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// seconds переводит время в unix секунды так же, как sql хранилища: нулевое время хранится как 0
+func seconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
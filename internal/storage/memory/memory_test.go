@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage/storagetest"
+	"testing"
+	"time"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, New())
+}
+
+func TestStorage_UseRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	id, err := s.SaveRefreshToken(ctx, models.RefreshToken{TokenHash: "hash", UserID: 1, AppID: 1, FamilyID: "family",
+		ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SaveRefreshToken() cerror = %v", err)
+	}
+
+	if ok, err := s.UseRefreshToken(ctx, id); err != nil || !ok {
+		t.Fatalf("UseRefreshToken() first got = %v, cerror = %v", ok, err)
+	}
+	if ok, err := s.UseRefreshToken(ctx, id); err != nil || ok {
+		t.Errorf("UseRefreshToken() second got = %v, cerror = %v", ok, err)
+	}
+
+	id, err = s.SaveRefreshToken(ctx, models.RefreshToken{TokenHash: "other", UserID: 1, AppID: 1, FamilyID: "family",
+		ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("SaveRefreshToken() cerror = %v", err)
+	}
+	if err := s.RevokeTokenFamily(ctx, "family"); err != nil {
+		t.Fatalf("RevokeTokenFamily() cerror = %v", err)
+	}
+	if ok, err := s.UseRefreshToken(ctx, id); err != nil || ok {
+		t.Errorf("UseRefreshToken() revoked got = %v, cerror = %v", ok, err)
+	}
+}
+
+func TestStorage_AddFailure(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		got, err := s.AddFailure(ctx, "key", now, now.Add(-time.Minute))
+		if err != nil {
+			t.Fatalf("AddFailure() cerror = %v", err)
+		}
+		if got.Failures != i {
+			t.Errorf("AddFailure() failures = %d, want %d", got.Failures, i)
+		}
+		if i > 1 && got.PrevFailure.Unix() != now.Unix() {
+			t.Errorf("AddFailure() prev failure = %v, want %v", got.PrevFailure, now)
+		}
+	}
+
+	got, err := s.AddFailure(ctx, "key", now.Add(time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("AddFailure() cerror = %v", err)
+	}
+	if got.Failures != 1 {
+		t.Errorf("AddFailure() after window failures = %d, want 1", got.Failures)
+	}
+}
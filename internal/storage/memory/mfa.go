@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+type recoveryCode struct {
+	hash string
+	used bool
+}
+
+// SaveMFASecret сохраняет секрет ещё не подтверждённой MFA, заменяя предыдущий. Если MFA уже включена,
+// секрет не меняется и возвращается ErrMFAEnabled
+func (s *Storage) SaveMFASecret(ctx context.Context, userID int64, secret string) error {
+	const op = "memory.SaveMFASecret"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.mfa[userID]; ok && m.Enabled {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAEnabled)
+	}
+	s.mfa[userID] = &models.MFA{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (s *Storage) MFA(ctx context.Context, userID int64) (models.MFA, error) {
+	const op = "memory.MFA"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mfa[userID]
+	if !ok {
+		return models.MFA{}, fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+	}
+	return *m, nil
+}
+
+// EnableMFA включает MFA и заменяет коды восстановления
+func (s *Storage) EnableMFA(ctx context.Context, userID int64, step int64, recoveryHashes []string) error {
+	const op = "memory.EnableMFA"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mfa[userID]
+	if !ok || m.Enabled {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAEnabled)
+	}
+	m.Enabled = true
+	m.LastStep = step
+
+	codes := make([]*recoveryCode, 0, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes = append(codes, &recoveryCode{hash: hash})
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+// UseMFAStep запоминает принятый интервал TOTP. Возвращает false, если код этого или более позднего
+// интервала уже был принят
+func (s *Storage) UseMFAStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mfa[userID]
+	if !ok || m.LastStep >= step {
+		return false, nil
+	}
+	m.LastStep = step
+	return true, nil
+}
+
+// UseRecoveryCode гасит код восстановления. Возвращает false, если кода нет или он уже использован
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.recoveryCodes[userID] {
+		if c.hash == codeHash && !c.used {
+			c.used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Storage) SaveMFAChallenge(ctx context.Context, c models.MFAChallenge) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.ID = s.nextID("mfa_challenges")
+	c.ExpiresAt = unixTime(c.ExpiresAt)
+	c.Attempts, c.Used = 0, false
+	s.mfaChallenges[c.ID] = &c
+	return c.ID, nil
+}
+
+func (s *Storage) MFAChallenge(ctx context.Context, tokenHash string) (models.MFAChallenge, error) {
+	const op = "memory.MFAChallenge"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.mfaChallenges {
+		if c.TokenHash == tokenHash {
+			return *c, nil
+		}
+	}
+	return models.MFAChallenge{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+// AttemptMFAChallenge учитывает попытку ввести код, если challenge не использован и лимит не исчерпан
+func (s *Storage) AttemptMFAChallenge(ctx context.Context, id int64, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.mfaChallenges[id]
+	if !ok || c.Used || c.Attempts >= maxAttempts {
+		return false, nil
+	}
+	c.Attempts++
+	return true, nil
+}
+
+// UseMFAChallenge помечает challenge использованным. Возвращает false, если он уже был использован
+func (s *Storage) UseMFAChallenge(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.mfaChallenges[id]
+	if !ok || c.Used {
+		return false, nil
+	}
+	c.Used = true
+	return true, nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) EnqueueNotification(ctx context.Context, n models.Notification) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n.ID = s.nextID("notifications")
+	n.Attempts, n.LastError, n.Failed = 0, "", false
+	n.NextAttemptAt = unixTime(n.NextAttemptAt)
+	n.CreatedAt = unixTime(n.CreatedAt)
+	s.notifications[n.ID] = &n
+	return n.ID, nil
+}
+
+// DueNotifications возвращает не более limit писем, время доставки которых наступило, в порядке постановки в очередь
+func (s *Storage) DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.Notification
+	for _, id := range sortedIDs(s.notifications) {
+		if len(res) >= limit {
+			break
+		}
+		if n := s.notifications[id]; !n.Failed && seconds(n.NextAttemptAt) <= now.Unix() {
+			res = append(res, *n)
+		}
+	}
+	return res, nil
+}
+
+// DeleteNotification удаляет доставленное письмо, чтобы токены из писем не хранились дольше необходимого
+func (s *Storage) DeleteNotification(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.notifications, id)
+	return nil
+}
+
+func (s *Storage) RetryNotification(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n, ok := s.notifications[id]; ok {
+		n.Attempts = attempts
+		n.NextAttemptAt = unixTime(next)
+		n.LastError = lastErr
+	}
+	return nil
+}
+
+func (s *Storage) FailNotification(ctx context.Context, id int64, attempts int, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n, ok := s.notifications[id]; ok {
+		n.Attempts = attempts
+		n.LastError = lastErr
+		n.Failed = true
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset.ID = s.nextID("password_resets")
+	reset.ExpiresAt = unixTime(reset.ExpiresAt)
+	reset.Used = false
+	s.resets[reset.ID] = &reset
+	return reset.ID, nil
+}
+
+func (s *Storage) PasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error) {
+	const op = "memory.PasswordReset"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.resets {
+		if r.TokenHash == tokenHash {
+			return *r, nil
+		}
+	}
+	return models.PasswordReset{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+// UsePasswordReset помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UsePasswordReset(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.resets[id]
+	if !ok || r.Used {
+		return false, nil
+	}
+	r.Used = true
+	return true, nil
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, uid int64, pswdHash []byte) error {
+	const op = "memory.UpdatePassword"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[uid]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	u.PassHash = cloneBytes(pswdHash)
+	return nil
+}
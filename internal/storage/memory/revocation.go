@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+type userRevocation struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+func (s *Storage) RevokeToken(ctx context.Context, token models.RevokedToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedTokens[token.ID]; !ok {
+		token.ExpiresAt = unixTime(token.ExpiresAt)
+		s.revokedTokens[token.ID] = token
+	}
+	return nil
+}
+
+func (s *Storage) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.revokedTokens[jti]
+	return ok, nil
+}
+
+// RevokeUserTokens отзывает все токены пользователя, выданные не позже at. at хранится с точностью до миллисекунды,
+// запись нужна до expiresAt, когда истекут все такие токены
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID int64, at time.Time, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.userRevocations[userID] = userRevocation{revokedAt: time.UnixMilli(at.UnixMilli()), expiresAt: time.Unix(expiresAt.Unix(), 0)}
+	for _, t := range s.refreshTokens {
+		if t.UserID == userID {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+// UserTokensRevokedAt возвращает момент последнего отзыва всех токенов пользователя или нулевое время
+func (s *Storage) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userRevocations[userID].revokedAt, nil
+}
+
+// DeleteExpiredRevocations удаляет записи об отзыве токенов, истёкших к моменту now
+func (s *Storage) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for jti, t := range s.revokedTokens {
+		if t.ExpiresAt.Unix() < now.Unix() {
+			delete(s.revokedTokens, jti)
+			deleted++
+		}
+	}
+	for uid, r := range s.userRevocations {
+		if r.expiresAt.Unix() < now.Unix() {
+			delete(s.userRevocations, uid)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,163 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"sort"
+)
+
+// SaveRole создаёт роль приложения вместе с её разрешениями. ErrRoleExists, если роль с таким именем
+// в приложении уже есть
+func (s *Storage) SaveRole(ctx context.Context, role models.Role) (int64, error) {
+	const op = "memory.SaveRole"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[role.AppID]; !ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	if _, ok := s.roleByName(role.AppID, role.Name); ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrRoleExists)
+	}
+
+	role.ID = s.nextID("roles")
+	role.Permissions = sortedSet(role.Permissions)
+	s.roles[role.ID] = &role
+	return role.ID, nil
+}
+
+// Roles возвращает роли приложения по имени
+func (s *Storage) Roles(ctx context.Context, appID int32) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.Role
+	for _, r := range s.roles {
+		if r.AppID == appID {
+			res = append(res, cloneRole(r))
+		}
+	}
+	sortRoles(res)
+	return res, nil
+}
+
+// UserRoles возвращает роли пользователя в приложении по имени
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int32) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.Role
+	for roleID := range s.userRoles[userID] {
+		if r := s.roles[roleID]; r.AppID == appID {
+			res = append(res, cloneRole(r))
+		}
+	}
+	sortRoles(res)
+	return res, nil
+}
+
+// DeleteRole удаляет роль приложения и снимает её со всех пользователей
+func (s *Storage) DeleteRole(ctx context.Context, appID int32, name string) error {
+	const op = "memory.DeleteRole"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.roleByName(appID, name)
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	for _, roles := range s.userRoles {
+		delete(roles, r.ID)
+	}
+	delete(s.roles, r.ID)
+	return nil
+}
+
+// AssignRole назначает роль приложения пользователю с доступом к нему. Повторное назначение не ошибка
+func (s *Storage) AssignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "memory.AssignRole"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.roleByName(appID, name)
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	u, ok := s.users[userID]
+	if !ok || s.appUsers[appID][u.Login] != userID {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	if s.userRoles[userID] == nil {
+		s.userRoles[userID] = make(map[int64]struct{})
+	}
+	s.userRoles[userID][r.ID] = struct{}{}
+	return nil
+}
+
+// UnassignRole снимает роль с пользователя. ErrRoleNotFound, если роли у пользователя не было
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "memory.UnassignRole"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.roleByName(appID, name)
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	if _, ok := s.userRoles[userID][r.ID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	delete(s.userRoles[userID], r.ID)
+	return nil
+}
+
+// assignAdminRole назначает пользователю роль администратора уровня lvl, создавая роль при первом назначении
+func (s *Storage) assignAdminRole(userID int64, appID int32, lvl int32) {
+	r, ok := s.roleByName(appID, storage.AdminRole(lvl))
+	if !ok {
+		r = &models.Role{ID: s.nextID("roles"), AppID: appID, Name: storage.AdminRole(lvl)}
+		s.roles[r.ID] = r
+	}
+	r.Permissions = sortedSet(append(r.Permissions, storage.AdminPermission))
+
+	if s.userRoles[userID] == nil {
+		s.userRoles[userID] = make(map[int64]struct{})
+	}
+	s.userRoles[userID][r.ID] = struct{}{}
+}
+
+func (s *Storage) roleByName(appID int32, name string) (*models.Role, bool) {
+	for _, r := range s.roles {
+		if r.AppID == appID && r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func cloneRole(r *models.Role) models.Role {
+	res := *r
+	res.Permissions = append([]string(nil), r.Permissions...)
+	return res
+}
+
+func sortRoles(roles []models.Role) {
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+}
+
+// sortedSet убирает повторы и сортирует, как разрешения роли в базе
+func sortedSet(values []string) []string {
+	var res []string
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token.ID = s.nextID("refresh_tokens")
+	token.ExpiresAt = unixTime(token.ExpiresAt)
+	token.Used, token.Revoked = false, false
+	s.refreshTokens[token.ID] = &token
+	return token.ID, nil
+}
+
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "memory.RefreshToken"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.TokenHash == tokenHash {
+			return *t, nil
+		}
+	}
+	return models.RefreshToken{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+// UseRefreshToken помечает токен использованным. Возвращает false, если токен уже был использован ранее
+func (s *Storage) UseRefreshToken(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[id]
+	if !ok || t.Used || t.Revoked {
+		return false, nil
+	}
+	t.Used = true
+	return true, nil
+}
+
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+func (s *Storage) SaveEmailVerification(ctx context.Context, v models.EmailVerification) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v.ID = s.nextID("email_verifications")
+	v.ExpiresAt = unixTime(v.ExpiresAt)
+	v.Used = false
+	s.verifications[v.ID] = &v
+	return v.ID, nil
+}
+
+func (s *Storage) EmailVerification(ctx context.Context, tokenHash string) (models.EmailVerification, error) {
+	const op = "memory.EmailVerification"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.verifications {
+		if v.TokenHash == tokenHash {
+			return *v, nil
+		}
+	}
+	return models.EmailVerification{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+// UseEmailVerification помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UseEmailVerification(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.verifications[id]
+	if !ok || v.Used {
+		return false, nil
+	}
+	v.Used = true
+	return true, nil
+}
+
+func (s *Storage) SetEmailVerified(ctx context.Context, uid int64) error {
+	const op = "memory.SetEmailVerified"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[uid]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (s *Storage) SetAppRequireVerified(ctx context.Context, appID int32, required bool) error {
+	const op = "memory.SetAppRequireVerified"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	app.RequireVerified = required
+	return nil
+}
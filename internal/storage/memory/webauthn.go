@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, c models.WebAuthnCredential) (int64, error) {
+	const op = "memory.SaveWebAuthnCredential"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cred := range s.webauthnCreds {
+		if bytes.Equal(cred.CredentialID, c.CredentialID) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+	}
+
+	c.ID = s.nextID("webauthn_credentials")
+	c.CredentialID = cloneBytes(c.CredentialID)
+	c.PublicKey = cloneBytes(c.PublicKey)
+	c.AAGUID = cloneBytes(c.AAGUID)
+	c.Transports = append([]string(nil), c.Transports...)
+	c.CreatedAt = unixTime(c.CreatedAt)
+	s.webauthnCreds[c.ID] = &c
+	return c.ID, nil
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []models.WebAuthnCredential
+	for _, id := range sortedIDs(s.webauthnCreds) {
+		if c := s.webauthnCreds[id]; c.UserID == userID {
+			res = append(res, *c)
+		}
+	}
+	return res, nil
+}
+
+// UpdateWebAuthnCredential сохраняет счётчик подписей и флаг резервной копии после успешного входа
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	const op = "memory.UpdateWebAuthnCredential"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.webauthnCreds {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			c.SignCount = signCount
+			c.BackupState = backupState
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.ID = s.nextID("webauthn_sessions")
+	session.Data = cloneBytes(session.Data)
+	session.ExpiresAt = unixTime(session.ExpiresAt)
+	session.Used = false
+	s.webauthnSessions[session.ID] = &session
+	return session.ID, nil
+}
+
+func (s *Storage) WebAuthnSession(ctx context.Context, tokenHash string) (models.WebAuthnSession, error) {
+	const op = "memory.WebAuthnSession"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.webauthnSessions {
+		if session.TokenHash == tokenHash {
+			return *session, nil
+		}
+	}
+	return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+}
+
+// UseWebAuthnSession помечает церемонию завершённой. Возвращает false, если она уже была завершена
+func (s *Storage) UseWebAuthnSession(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.webauthnSessions[id]
+	if !ok || session.Used {
+		return false, nil
+	}
+	session.Used = true
+	return true, nil
+}
+
+// SetAppWebAuthn задаёт relying party приложения. Пустой rpID отключает WebAuthn
+func (s *Storage) SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error {
+	const op = "memory.SetAppWebAuthn"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	app.RPID = rpID
+	app.RPOrigins = nil
+	if len(origins) > 0 {
+		app.RPOrigins = append([]string(nil), origins...)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"strings"
+	"time"
+)
+
+// appColumns поля приложения в том порядке, в котором их читает scanApp
+const appColumns = "id, name, secret, alg, require_verified, rp_id, rp_origins, disabled, " +
+	"access_ttl, refresh_ttl, registration_closed, require_mfa, login_methods, claims, password_policy"
+
+// appUsers пользователи приложения: зарегистрированные в нём или получившие к нему доступ
+const appUsers = "SELECT id FROM users WHERE (app_id = $1 OR id IN (SELECT user_id FROM user_apps WHERE app_id = $1))"
+
+// appOnlyUsers пользователи приложения, у которых нет доступа ни к одному другому приложению
+const appOnlyUsers = appUsers + " AND id NOT IN (SELECT user_id FROM user_apps WHERE app_id <> $1)"
+
+// Apps возвращает все приложения по возрастанию id
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "postgres.Apps"
+	query := "SELECT " + appColumns + " FROM apps ORDER BY id"
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, app)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UpdateApp переименовывает приложение. ErrUniqueApp, если имя занято другим приложением
+func (s *Storage) UpdateApp(ctx context.Context, appID int32, name string) error {
+	const op = "postgres.UpdateApp"
+
+	return s.updateApp(ctx, op, "UPDATE apps SET name = $1 WHERE id = $2", name, appID)
+}
+
+// SetAppDisabled выключает или включает приложение
+func (s *Storage) SetAppDisabled(ctx context.Context, appID int32, disabled bool) error {
+	const op = "postgres.SetAppDisabled"
+
+	return s.updateApp(ctx, op, "UPDATE apps SET disabled = $1 WHERE id = $2", disabled, appID)
+}
+
+// SetAppSecret заменяет секрет приложения
+func (s *Storage) SetAppSecret(ctx context.Context, appID int32, secret string) error {
+	const op = "postgres.SetAppSecret"
+
+	return s.updateApp(ctx, op, "UPDATE apps SET secret = $1 WHERE id = $2", secret, appID)
+}
+
+// SetAppSettings заменяет настройки приложения целиком
+func (s *Storage) SetAppSettings(ctx context.Context, appID int32, settings models.AppSettings) error {
+	const op = "postgres.SetAppSettings"
+
+	claims, err := encodeClaims(settings.Claims)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	policy, err := encodePasswordPolicy(settings.PasswordPolicy)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	query := `UPDATE apps SET access_ttl = $1, refresh_ttl = $2, registration_closed = $3, require_mfa = $4,
+		login_methods = $5, claims = $6, password_policy = $7 WHERE id = $8`
+
+	return s.updateApp(ctx, op, query, int64(settings.AccessTTL/time.Second), int64(settings.RefreshTTL/time.Second),
+		settings.RegistrationClosed, settings.RequireMFA, strings.Join(settings.LoginMethods, ","), claims, policy, appID)
+}
+
+// DeleteApp удаляет приложение вместе с его ролями, ключами, токенами и доступами пользователей.
+// Пока у приложения есть пользователи, удаление без cascade возвращает ErrAppHasUsers. С cascade
+// пользователи, у которых нет других приложений, удаляются, а остальные переносятся в одно из своих приложений
+func (s *Storage) DeleteApp(ctx context.Context, appID int32, cascade bool) error {
+	const op = "postgres.DeleteApp"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err = tx.QueryRowContext(ctx, "SELECT 1 FROM apps WHERE id = $1", appID).Scan(&found); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var members int
+	if err = tx.QueryRowContext(ctx, "SELECT count(*) FROM ("+appUsers+") u", appID).Scan(&members); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if members > 0 && !cascade {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppHasUsers)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET app_id = (SELECT min(app_id) FROM user_apps WHERE user_id = users.id AND app_id <> $1)
+		WHERE app_id = $1 AND id IN (SELECT user_id FROM user_apps WHERE app_id <> $1)`, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, table := range []string{"user_mfa", "mfa_recovery_codes", "mfa_challenges", "webauthn_credentials",
+		"webauthn_sessions", "user_revocations", "user_roles", "user_apps", "admins", "refresh_tokens", "password_resets",
+		"email_verifications"} {
+		query := "DELETE FROM " + table + " WHERE user_id IN (" + appOnlyUsers + ")"
+		if _, err = tx.ExecContext(ctx, query, appID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id IN ("+appOnlyUsers+")", appID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE role_id IN (SELECT id FROM roles WHERE app_id = $1)",
+		"DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE app_id = $1)",
+		"DELETE FROM roles WHERE app_id = $1",
+		"DELETE FROM admins WHERE app_id = $1",
+		"DELETE FROM user_apps WHERE app_id = $1",
+		"DELETE FROM refresh_tokens WHERE app_id = $1",
+		"DELETE FROM password_resets WHERE app_id = $1",
+		"DELETE FROM email_verifications WHERE app_id = $1",
+		"DELETE FROM mfa_challenges WHERE app_id = $1",
+		"DELETE FROM webauthn_sessions WHERE app_id = $1",
+		"DELETE FROM signing_keys WHERE app_id = $1",
+		"DELETE FROM revoked_tokens WHERE app_id = $1",
+		"DELETE FROM apps WHERE id = $1",
+	} {
+		if _, err = tx.ExecContext(ctx, query, appID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// updateApp меняет поля приложения, id приложения передаётся последним аргументом. ErrAppNotFound,
+// если приложения нет
+func (s *Storage) updateApp(ctx context.Context, op string, query string, args ...any) error {
+	ok, err := s.execOnce(ctx, op, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUniqueApp)
+		}
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	return nil
+}
+
+// scanApp читает приложение из строки с полями appColumns
+func scanApp(row interface{ Scan(dest ...any) error }) (models.App, error) {
+	var app models.App
+	var rpOrigins, loginMethods, claims, policy string
+	var accessTTL, refreshTTL int64
+	err := row.Scan(&app.ID, &app.Name, &app.Secret, &app.Alg, &app.RequireVerified, &app.RPID, &rpOrigins, &app.Disabled,
+		&accessTTL, &refreshTTL, &app.Settings.RegistrationClosed, &app.Settings.RequireMFA, &loginMethods, &claims, &policy)
+	if err != nil {
+		return app, err
+	}
+	app.RPOrigins = splitList(rpOrigins)
+	app.Settings.AccessTTL = time.Duration(accessTTL) * time.Second
+	app.Settings.RefreshTTL = time.Duration(refreshTTL) * time.Second
+	app.Settings.LoginMethods = splitList(loginMethods)
+	if claims != "" {
+		if err = json.Unmarshal([]byte(claims), &app.Settings.Claims); err != nil {
+			return app, err
+		}
+	}
+	if policy != "" {
+		if err = json.Unmarshal([]byte(policy), &app.Settings.PasswordPolicy); err != nil {
+			return app, err
+		}
+	}
+	return app, nil
+}
+
+// encodeClaims сохраняет claims приложения объектом JSON, пустые claims пустой строкой
+func encodeClaims(claims map[string]string) (string, error) {
+	if len(claims) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// encodePasswordPolicy сохраняет требования к паролю объектом JSON, nil пустой строкой
+func encodePasswordPolicy(rules *models.PasswordRules) (string, error) {
+	if rules == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
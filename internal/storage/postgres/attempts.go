@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) Attempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	const op = "postgres.Attempts"
+	query := "SELECT failures, last_failure, prev_failure, locked_until FROM login_attempts WHERE key = $1"
+
+	res, err := scanAttempts(s.db.QueryRowContext(ctx, query, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LoginAttempts{}, nil
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// AddFailure увеличивает счётчик одним запросом, чтобы параллельные попытки и реплики не теряли отказы.
+// Правые части SET видят строку до изменения, поэтому prev_failure получает прежний last_failure
+func (s *Storage) AddFailure(ctx context.Context, key string, at time.Time, windowStart time.Time) (models.LoginAttempts, error) {
+	const op = "postgres.AddFailure"
+	query := `INSERT INTO login_attempts (key, failures, last_failure) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			prev_failure = CASE WHEN login_attempts.last_failure < $3 THEN 0 ELSE login_attempts.last_failure END,
+			last_failure = excluded.last_failure
+		RETURNING failures, last_failure, prev_failure, locked_until`
+
+	res, err := scanAttempts(s.db.QueryRowContext(ctx, query, key, at.Unix(), windowStart.Unix()))
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// RemoveFailure возвращает учтённую попытку, которая оказалась успешной
+func (s *Storage) RemoveFailure(ctx context.Context, key string) error {
+	const op = "postgres.RemoveFailure"
+	query := "UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE key = $1"
+
+	if _, err := s.db.ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) LockUntil(ctx context.Context, key string, until time.Time) error {
+	const op = "postgres.LockUntil"
+	query := "UPDATE login_attempts SET locked_until = $1 WHERE key = $2"
+
+	if _, err := s.db.ExecContext(ctx, query, until.Unix(), key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) ResetAttempts(ctx context.Context, key string) error {
+	const op = "postgres.ResetAttempts"
+	query := "DELETE FROM login_attempts WHERE key = $1"
+
+	if _, err := s.db.ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteStaleAttempts(ctx context.Context, before time.Time) (int64, error) {
+	const op = "postgres.DeleteStaleAttempts"
+	query := "DELETE FROM login_attempts WHERE last_failure < $1 AND locked_until < $1"
+
+	res, err := s.db.ExecContext(ctx, query, before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+func scanAttempts(row scanner) (models.LoginAttempts, error) {
+	var res models.LoginAttempts
+	var lastFailure, prevFailure, lockedUntil int64
+
+	if err := row.Scan(&res.Failures, &lastFailure, &prevFailure, &lockedUntil); err != nil {
+		return res, err
+	}
+	res.LastFailure = fromUnix(lastFailure)
+	res.PrevFailure = fromUnix(prevFailure)
+	res.LockedUntil = fromUnix(lockedUntil)
+
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) EnqueueNotification(ctx context.Context, n models.Notification) (int64, error) {
+	const op = "postgres.EnqueueNotification"
+	query := `INSERT INTO notifications (recipient, subject, body, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, n.Recipient, n.Subject, n.Body, n.NextAttemptAt.Unix(), n.CreatedAt.Unix()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// DueNotifications возвращает не более limit писем, время доставки которых наступило, в порядке постановки в очередь
+func (s *Storage) DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	const op = "postgres.DueNotifications"
+	query := `SELECT id, recipient, subject, body, attempts, next_attempt_at, last_error, failed, created_at
+		FROM notifications WHERE NOT failed AND next_attempt_at <= $1 ORDER BY id LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, query, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// DeleteNotification удаляет доставленное письмо, чтобы токены из писем не хранились дольше необходимого
+func (s *Storage) DeleteNotification(ctx context.Context, id int64) error {
+	const op = "postgres.DeleteNotification"
+	query := "DELETE FROM notifications WHERE id = $1"
+
+	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RetryNotification(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	const op = "postgres.RetryNotification"
+	query := "UPDATE notifications SET attempts = $1, next_attempt_at = $2, last_error = $3 WHERE id = $4"
+
+	if _, err := s.db.ExecContext(ctx, query, attempts, next.Unix(), lastErr, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) FailNotification(ctx context.Context, id int64, attempts int, lastErr string) error {
+	const op = "postgres.FailNotification"
+	query := "UPDATE notifications SET attempts = $1, last_error = $2, failed = true WHERE id = $3"
+
+	if _, err := s.db.ExecContext(ctx, query, attempts, lastErr, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanNotification(row scanner) (models.Notification, error) {
+	var res models.Notification
+	var nextAttemptAt, createdAt int64
+
+	err := row.Scan(&res.ID, &res.Recipient, &res.Subject, &res.Body, &res.Attempts, &nextAttemptAt,
+		&res.LastError, &res.Failed, &createdAt)
+	if err != nil {
+		return res, err
+	}
+	res.NextAttemptAt = fromUnix(nextAttemptAt)
+	res.CreatedAt = fromUnix(createdAt)
+
+	return res, nil
+}
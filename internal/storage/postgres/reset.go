@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) (int64, error) {
+	const op = "postgres.SavePasswordReset"
+	query := "INSERT INTO password_resets (token_hash, user_id, app_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, reset.TokenHash, reset.UserID, reset.AppID, reset.ExpiresAt.Unix()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) PasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error) {
+	const op = "postgres.PasswordReset"
+	var res models.PasswordReset
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, expires_at, used FROM password_resets WHERE token_hash = $1"
+
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UsePasswordReset помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UsePasswordReset(ctx context.Context, id int64) (bool, error) {
+	const op = "postgres.UsePasswordReset"
+	query := "UPDATE password_resets SET used = true WHERE id = $1 AND NOT used"
+
+	return s.execOnce(ctx, op, query, id)
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, uid int64, pswdHash []byte) error {
+	const op = "postgres.UpdatePassword"
+	query := "UPDATE users SET passhash = $1 WHERE id = $2"
+
+	ok, err := s.execOnce(ctx, op, query, pswdHash, uid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
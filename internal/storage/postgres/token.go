@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) (int64, error) {
+	const op = "postgres.SaveRefreshToken"
+	query := `INSERT INTO refresh_tokens (token_hash, user_id, app_id, family_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, token.TokenHash, token.UserID, token.AppID, token.FamilyID,
+		token.ExpiresAt.Unix()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "postgres.RefreshToken"
+	var res models.RefreshToken
+	var expiresAt int64
+	query := `SELECT id, token_hash, user_id, app_id, family_id, expires_at, used, revoked
+		FROM refresh_tokens WHERE token_hash = $1`
+
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID,
+		&res.FamilyID, &expiresAt, &res.Used, &res.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseRefreshToken помечает токен использованным. Возвращает false, если токен уже был использован ранее
+func (s *Storage) UseRefreshToken(ctx context.Context, id int64) (bool, error) {
+	const op = "postgres.UseRefreshToken"
+	query := "UPDATE refresh_tokens SET used = true WHERE id = $1 AND NOT used AND NOT revoked"
+
+	return s.execOnce(ctx, op, query, id)
+}
+
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	const op = "postgres.RevokeTokenFamily"
+	query := "UPDATE refresh_tokens SET revoked = true WHERE family_id = $1"
+
+	if _, err := s.db.ExecContext(ctx, query, familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// execOnce выполняет условное обновление одной строки. false, если условие уже не выполнялось,
+// например токен был использован параллельным запросом
+func (s *Storage) execOnce(ctx context.Context, op string, query string, args ...any) (bool, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SaveEmailVerification(ctx context.Context, v models.EmailVerification) (int64, error) {
+	const op = "postgres.SaveEmailVerification"
+	query := "INSERT INTO email_verifications (token_hash, user_id, app_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, query, v.TokenHash, v.UserID, v.AppID, v.ExpiresAt.Unix()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) EmailVerification(ctx context.Context, tokenHash string) (models.EmailVerification, error) {
+	const op = "postgres.EmailVerification"
+	var res models.EmailVerification
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, expires_at, used FROM email_verifications WHERE token_hash = $1"
+
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseEmailVerification помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UseEmailVerification(ctx context.Context, id int64) (bool, error) {
+	const op = "postgres.UseEmailVerification"
+	query := "UPDATE email_verifications SET used = true WHERE id = $1 AND NOT used"
+
+	return s.execOnce(ctx, op, query, id)
+}
+
+func (s *Storage) SetEmailVerified(ctx context.Context, uid int64) error {
+	const op = "postgres.SetEmailVerified"
+	query := "UPDATE users SET email_verified = true WHERE id = $1"
+
+	ok, err := s.execOnce(ctx, op, query, uid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SetAppRequireVerified(ctx context.Context, appID int32, required bool) error {
+	const op = "postgres.SetAppRequireVerified"
+	query := "UPDATE apps SET require_verified = $1 WHERE id = $2"
+
+	ok, err := s.execOnce(ctx, op, query, required, appID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"strings"
+	"time"
+)
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, c models.WebAuthnCredential) (int64, error) {
+	const op = "postgres.SaveWebAuthnCredential"
+	query := `INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type, aaguid, sign_count,
+		transports, backup_eligible, backup_state, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, c.UserID, c.CredentialID, c.PublicKey, c.AttestationType, c.AAGUID,
+		int64(c.SignCount), strings.Join(c.Transports, ","), c.BackupEligible, c.BackupState, c.CreatedAt.Unix()).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	const op = "postgres.WebAuthnCredentials"
+	query := `SELECT id, user_id, credential_id, public_key, attestation_type, aaguid, sign_count, transports,
+		backup_eligible, backup_state, created_at FROM webauthn_credentials WHERE user_id = $1 ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.WebAuthnCredential
+	for rows.Next() {
+		var c models.WebAuthnCredential
+		var transports string
+		var signCount, createdAt int64
+		err = rows.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.AttestationType, &c.AAGUID, &signCount,
+			&transports, &c.BackupEligible, &c.BackupState, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		c.SignCount = uint32(signCount)
+		c.Transports = splitList(transports)
+		c.CreatedAt = time.Unix(createdAt, 0)
+		res = append(res, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UpdateWebAuthnCredential сохраняет счётчик подписей и флаг резервной копии после успешного входа
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	const op = "postgres.UpdateWebAuthnCredential"
+	query := "UPDATE webauthn_credentials SET sign_count = $1, backup_state = $2 WHERE credential_id = $3"
+
+	ok, err := s.execOnce(ctx, op, query, int64(signCount), backupState, credentialID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) (int64, error) {
+	const op = "postgres.SaveWebAuthnSession"
+	query := `INSERT INTO webauthn_sessions (token_hash, user_id, app_id, kind, data, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, session.TokenHash, session.UserID, session.AppID, session.Kind, session.Data,
+		session.ExpiresAt.Unix()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) WebAuthnSession(ctx context.Context, tokenHash string) (models.WebAuthnSession, error) {
+	const op = "postgres.WebAuthnSession"
+	var res models.WebAuthnSession
+	var expiresAt int64
+	query := `SELECT id, token_hash, user_id, app_id, kind, data, expires_at, used
+		FROM webauthn_sessions WHERE token_hash = $1`
+
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &res.Kind,
+		&res.Data, &expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseWebAuthnSession помечает церемонию завершённой. Возвращает false, если она уже была завершена
+func (s *Storage) UseWebAuthnSession(ctx context.Context, id int64) (bool, error) {
+	const op = "postgres.UseWebAuthnSession"
+	query := "UPDATE webauthn_sessions SET used = true WHERE id = $1 AND NOT used"
+
+	return s.execOnce(ctx, op, query, id)
+}
+
+// SetAppWebAuthn задаёт relying party приложения. Пустой rpID отключает WebAuthn
+func (s *Storage) SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error {
+	const op = "postgres.SetAppWebAuthn"
+	query := "UPDATE apps SET rp_id = $1, rp_origins = $2 WHERE id = $3"
+
+	ok, err := s.execOnce(ctx, op, query, rpID, strings.Join(origins, ","), appID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	return nil
+}
+
+// splitList разбирает список, сохранённый через запятую
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+// GrantAppAccess даёт пользователю доступ к приложению. Повторная выдача не ошибка. ErrUserExists, если
+// среди пользователей приложения уже есть другой с тем же логином
+func (s *Storage) GrantAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "sqlite.GrantAppAccess"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err = tx.QueryRowContext(ctx, "SELECT 1 FROM apps WHERE id = ?", appID).Scan(&found); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var login string
+	if err = tx.QueryRowContext(ctx, "SELECT login FROM users WHERE id = ?", userID).Scan(&login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_apps (user_id, app_id, login) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, app_id) DO NOTHING`, userID, appID, login)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeAppAccess забирает доступ к приложению вместе с правами администратора и ролями в нём и отзывает
+// refresh токены пользователя для этого приложения. ErrUserNotFound, если доступа не было
+func (s *Storage) RevokeAppAccess(ctx context.Context, userID int64, appID int32) error {
+	const op = "sqlite.RevokeAppAccess"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_apps WHERE user_id = ? AND app_id = ?", userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM admins WHERE user_id = ? AND app_id = ?",
+		"DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE app_id = ?)",
+		"UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ? AND app_id = ?",
+	} {
+		if _, err = tx.ExecContext(ctx, query, userID, appID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) HasAppAccess(ctx context.Context, userID int64, appID int32) (bool, error) {
+	const op = "sqlite.HasAppAccess"
+	query := "SELECT 1 FROM user_apps WHERE user_id = ? AND app_id = ?"
+
+	var found int
+	err := s.db.QueryRowContext(ctx, query, userID, appID).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return true, nil
+}
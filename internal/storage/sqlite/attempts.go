@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) Attempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	const op = "sqlite.Attempts"
+	query := "SELECT failures, last_failure, prev_failure, locked_until FROM login_attempts WHERE key = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := scanAttempts(stmt.QueryRowContext(ctx, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LoginAttempts{}, nil
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// AddFailure увеличивает счётчик одним запросом, чтобы параллельные попытки не терялись.
+// Правые части SET видят строку до изменения, поэтому prev_failure получает прежний last_failure
+func (s *Storage) AddFailure(ctx context.Context, key string, at time.Time, windowStart time.Time) (models.LoginAttempts, error) {
+	const op = "sqlite.AddFailure"
+	query := `INSERT INTO login_attempts (key, failures, last_failure) VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END,
+			prev_failure = CASE WHEN last_failure < ? THEN 0 ELSE last_failure END,
+			last_failure = excluded.last_failure
+		RETURNING failures, last_failure, prev_failure, locked_until`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := scanAttempts(stmt.QueryRowContext(ctx, key, at.Unix(), windowStart.Unix(), windowStart.Unix()))
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// RemoveFailure возвращает учтённую попытку, которая оказалась успешной
+func (s *Storage) RemoveFailure(ctx context.Context, key string) error {
+	const op = "sqlite.RemoveFailure"
+	query := "UPDATE login_attempts SET failures = max(failures - 1, 0) WHERE key = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) LockUntil(ctx context.Context, key string, until time.Time) error {
+	const op = "sqlite.LockUntil"
+	query := "UPDATE login_attempts SET locked_until = ? WHERE key = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, until.Unix(), key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) ResetAttempts(ctx context.Context, key string) error {
+	const op = "sqlite.ResetAttempts"
+	query := "DELETE FROM login_attempts WHERE key = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteStaleAttempts(ctx context.Context, before time.Time) (int64, error) {
+	const op = "sqlite.DeleteStaleAttempts"
+	query := "DELETE FROM login_attempts WHERE last_failure < ? AND locked_until < ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, before.Unix(), before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+func scanAttempts(row scanner) (models.LoginAttempts, error) {
+	var res models.LoginAttempts
+	var lastFailure, prevFailure, lockedUntil int64
+
+	if err := row.Scan(&res.Failures, &lastFailure, &prevFailure, &lockedUntil); err != nil {
+		return res, err
+	}
+	res.LastFailure = fromUnix(lastFailure)
+	res.PrevFailure = fromUnix(prevFailure)
+	res.LockedUntil = fromUnix(lockedUntil)
+
+	return res, nil
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_LoginAttempts(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	got, err := s.Attempts(ctx, "login:1:user")
+	if err != nil || !reflect.DeepEqual(got, models.LoginAttempts{}) {
+		t.Fatalf("Attempts() got = %v, cerror = %v, want empty", got, err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		got, err = s.AddFailure(ctx, "login:1:user", now, now.Add(-time.Hour))
+		if err != nil || got.Failures != i || !got.LastFailure.Equal(now) {
+			t.Fatalf("AddFailure() got = %v, cerror = %v, want %d failures", got, err, i)
+		}
+	}
+
+	if err = s.LockUntil(ctx, "login:1:user", now.Add(time.Minute)); err != nil {
+		t.Fatalf("LockUntil() cerror = %v", err)
+	}
+	want := models.LoginAttempts{Failures: 2, LastFailure: now, PrevFailure: now, LockedUntil: now.Add(time.Minute)}
+	if got, err = s.Attempts(ctx, "login:1:user"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Attempts() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if err = s.RemoveFailure(ctx, "login:1:user"); err != nil {
+		t.Fatalf("RemoveFailure() cerror = %v", err)
+	}
+	if got, err = s.Attempts(ctx, "login:1:user"); err != nil || got.Failures != 1 {
+		t.Errorf("Attempts() after remove got = %v, cerror = %v, want 1 failure", got, err)
+	}
+
+	// неудача после окна начинает счёт заново
+	later := now.Add(2 * time.Hour)
+	got, err = s.AddFailure(ctx, "login:1:user", later, later.Add(-time.Hour))
+	if err != nil || got.Failures != 1 || !got.PrevFailure.IsZero() {
+		t.Errorf("AddFailure() after window got = %v, cerror = %v, want 1 failure", got, err)
+	}
+
+	if _, err = s.AddFailure(ctx, "ip:10.0.0.1", now, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("AddFailure() cerror = %v", err)
+	}
+	deleted, err := s.DeleteStaleAttempts(ctx, now.Add(time.Hour))
+	if err != nil || deleted != 1 {
+		t.Errorf("DeleteStaleAttempts() got = %v, cerror = %v, want 1", deleted, err)
+	}
+
+	if err = s.ResetAttempts(ctx, "login:1:user"); err != nil {
+		t.Fatalf("ResetAttempts() cerror = %v", err)
+	}
+	if got, err = s.Attempts(ctx, "login:1:user"); err != nil || got.Failures != 0 {
+		t.Errorf("Attempts() after reset got = %v, cerror = %v", got, err)
+	}
+}
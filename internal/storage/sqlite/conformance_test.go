@@ -0,0 +1,13 @@
+package sqlite
+
+import (
+	"github.com/MorZLE/auth/internal/storage/storagetest"
+	"testing"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+
+	db := testDB(t)
+
+	storagetest.Run(t, &Storage{db: db})
+}
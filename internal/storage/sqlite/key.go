@@ -0,0 +1,185 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+const signingKeyColumns = "id, kid, app_id, alg, private_key, public_key, status, created_at, activated_at, retired_at"
+
+func (s *Storage) SaveSigningKey(ctx context.Context, key models.SigningKey) (int64, error) {
+	const op = "sqlite.SaveSigningKey"
+	query := "INSERT INTO signing_keys (kid, app_id, alg, private_key, public_key, status, created_at, activated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, key.KID, key.AppID, key.Alg, key.PrivateKey, key.PublicKey, key.Status,
+		unixTime(key.CreatedAt), unixTime(key.ActivatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// SigningKey возвращает активный ключ приложения для алгоритма alg
+func (s *Storage) SigningKey(ctx context.Context, appID int32, alg string) (models.SigningKey, error) {
+	const op = "sqlite.SigningKey"
+	query := "SELECT " + signingKeyColumns + " FROM signing_keys WHERE app_id = ? AND alg = ? AND status = ? ORDER BY id DESC LIMIT 1"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := scanSigningKey(stmt.QueryRowContext(ctx, appID, alg, models.KeyStatusActive))
+	if err != nil {
+		return key, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+func (s *Storage) SigningKeyByKID(ctx context.Context, kid string) (models.SigningKey, error) {
+	const op = "sqlite.SigningKeyByKID"
+	query := "SELECT " + signingKeyColumns + " FROM signing_keys WHERE kid = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return models.SigningKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := scanSigningKey(stmt.QueryRowContext(ctx, kid))
+	if err != nil {
+		return key, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+// SigningKeys возвращает все не удалённые ключи
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "sqlite.SigningKeys"
+	query := "SELECT " + signingKeyColumns + " FROM signing_keys WHERE status != ? ORDER BY id"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := stmt.QueryContext(ctx, models.KeyStatusDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.SigningKey
+	for rows.Next() {
+		key, err := scanSigningKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// ActivateSigningKey делает ожидающий ключ активным, а прежний активный ключ того же приложения и алгоритма переводит в retired
+func (s *Storage) ActivateSigningKey(ctx context.Context, id int64, at time.Time) error {
+	const op = "sqlite.ActivateSigningKey"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE signing_keys SET status = ?, retired_at = ?
+		WHERE status = ? AND (app_id, alg) = (SELECT app_id, alg FROM signing_keys WHERE id = ?)`,
+		models.KeyStatusRetired, at.Unix(), models.KeyStatusActive, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE signing_keys SET status = ?, activated_at = ? WHERE id = ? AND status = ?",
+		models.KeyStatusActive, at.Unix(), id, models.KeyStatusPending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrKeyNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteSigningKey помечает ключ удалённым и стирает приватную часть
+func (s *Storage) DeleteSigningKey(ctx context.Context, id int64) error {
+	const op = "sqlite.DeleteSigningKey"
+	query := "UPDATE signing_keys SET status = ?, private_key = x'' WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, models.KeyStatusDeleted, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSigningKey(row scanner) (models.SigningKey, error) {
+	var key models.SigningKey
+	var createdAt, activatedAt, retiredAt int64
+
+	err := row.Scan(&key.ID, &key.KID, &key.AppID, &key.Alg, &key.PrivateKey, &key.PublicKey, &key.Status,
+		&createdAt, &activatedAt, &retiredAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return key, storage.ErrKeyNotFound
+		}
+		return key, err
+	}
+	key.CreatedAt = fromUnix(createdAt)
+	key.ActivatedAt = fromUnix(activatedAt)
+	key.RetiredAt = fromUnix(retiredAt)
+
+	return key, nil
+}
+
+// unixTime и fromUnix хранят нулевое время как 0, чтобы не путать его с началом эпохи
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_SigningKey(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	created := time.Unix(time.Now().Unix(), 0)
+
+	keys := []models.SigningKey{
+		{KID: "kid_1", AppID: 1, Alg: "RS256", PrivateKey: []byte("private_1"), PublicKey: []byte("public_1"), Status: models.KeyStatusActive, CreatedAt: created, ActivatedAt: created},
+		{KID: "kid_2", AppID: 1, Alg: "RS256", PrivateKey: []byte("private_2"), PublicKey: []byte("public_2"), Status: models.KeyStatusActive, CreatedAt: created, ActivatedAt: created},
+		{KID: "kid_3", AppID: 2, Alg: "EdDSA", PrivateKey: []byte("private_3"), PublicKey: []byte("public_3"), Status: models.KeyStatusActive, CreatedAt: created, ActivatedAt: created},
+	}
+	for i := range keys {
+		id, err := s.SaveSigningKey(ctx, keys[i])
+		if err != nil {
+			t.Fatalf("SaveSigningKey() cerror = %v", err)
+		}
+		keys[i].ID = id
+	}
+
+	tests := []struct {
+		name    string
+		appID   int32
+		alg     string
+		want    models.SigningKey
+		wantErr error
+	}{
+		{name: "latest_key", appID: 1, alg: "RS256", want: keys[1], wantErr: nil},
+		{name: "other_app", appID: 2, alg: "EdDSA", want: keys[2], wantErr: nil},
+		{name: "other_alg", appID: 1, alg: "ES256", want: models.SigningKey{}, wantErr: storage.ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.SigningKey(ctx, tt.appID, tt.alg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SigningKey() cerror = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SigningKey() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := s.SigningKeyByKID(ctx, "kid_1")
+	if err != nil || !reflect.DeepEqual(got, keys[0]) {
+		t.Errorf("SigningKeyByKID() got = %v, cerror = %v, want %v", got, err, keys[0])
+	}
+	if _, err = s.SigningKeyByKID(ctx, "unknown"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("SigningKeyByKID() cerror = %v, wantErr %v", err, storage.ErrKeyNotFound)
+	}
+
+	all, err := s.SigningKeys(ctx)
+	if err != nil || !reflect.DeepEqual(all, keys) {
+		t.Errorf("SigningKeys() got = %v, cerror = %v, want %v", all, err, keys)
+	}
+}
+
+func TestStorage_SigningKeyLifecycle(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	created := time.Unix(time.Now().Unix(), 0)
+	activated := created.Add(time.Minute)
+
+	active := models.SigningKey{KID: "kid_active", AppID: 1, Alg: "RS256", PrivateKey: []byte("private_1"),
+		PublicKey: []byte("public_1"), Status: models.KeyStatusActive, CreatedAt: created, ActivatedAt: created}
+	pending := models.SigningKey{KID: "kid_pending", AppID: 1, Alg: "RS256", PrivateKey: []byte("private_2"),
+		PublicKey: []byte("public_2"), Status: models.KeyStatusPending, CreatedAt: created}
+	other := models.SigningKey{KID: "kid_other", AppID: 2, Alg: "RS256", PrivateKey: []byte("private_3"),
+		PublicKey: []byte("public_3"), Status: models.KeyStatusActive, CreatedAt: created, ActivatedAt: created}
+
+	var err error
+	for _, key := range []*models.SigningKey{&active, &pending, &other} {
+		if key.ID, err = s.SaveSigningKey(ctx, *key); err != nil {
+			t.Fatalf("SaveSigningKey() cerror = %v", err)
+		}
+	}
+
+	got, err := s.SigningKey(ctx, 1, "RS256")
+	if err != nil || got.KID != active.KID {
+		t.Fatalf("SigningKey() before activation got = %v, cerror = %v, want %v", got.KID, err, active.KID)
+	}
+
+	if err = s.ActivateSigningKey(ctx, pending.ID, activated); err != nil {
+		t.Fatalf("ActivateSigningKey() cerror = %v", err)
+	}
+	if err = s.ActivateSigningKey(ctx, pending.ID, activated); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("ActivateSigningKey() repeat cerror = %v, wantErr %v", err, storage.ErrKeyNotFound)
+	}
+
+	got, err = s.SigningKey(ctx, 1, "RS256")
+	if err != nil || got.KID != pending.KID || got.Status != models.KeyStatusActive || !got.ActivatedAt.Equal(activated) {
+		t.Errorf("SigningKey() after activation got = %v, cerror = %v", got, err)
+	}
+
+	got, err = s.SigningKeyByKID(ctx, active.KID)
+	if err != nil || got.Status != models.KeyStatusRetired || !got.RetiredAt.Equal(activated) {
+		t.Errorf("SigningKeyByKID() retired got = %v, cerror = %v", got, err)
+	}
+
+	got, err = s.SigningKeyByKID(ctx, other.KID)
+	if err != nil || got.Status != models.KeyStatusActive {
+		t.Errorf("SigningKeyByKID() other app got = %v, cerror = %v", got, err)
+	}
+
+	if err = s.DeleteSigningKey(ctx, active.ID); err != nil {
+		t.Fatalf("DeleteSigningKey() cerror = %v", err)
+	}
+	got, err = s.SigningKeyByKID(ctx, active.KID)
+	if err != nil || got.Status != models.KeyStatusDeleted || len(got.PrivateKey) != 0 {
+		t.Errorf("SigningKeyByKID() deleted got = %v, cerror = %v", got, err)
+	}
+
+	all, err := s.SigningKeys(ctx)
+	if err != nil || len(all) != 2 {
+		t.Errorf("SigningKeys() got = %v, cerror = %v, want 2 keys", all, err)
+	}
+}
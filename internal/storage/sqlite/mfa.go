@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+// SaveMFASecret сохраняет секрет ещё не подтверждённой MFA, заменяя предыдущий. Если MFA уже включена,
+// секрет не меняется и возвращается ErrMFAEnabled
+func (s *Storage) SaveMFASecret(ctx context.Context, userID int64, secret string) error {
+	const op = "sqlite.SaveMFASecret"
+	query := `INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0 WHERE enabled = 0`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAEnabled)
+	}
+	return nil
+}
+
+func (s *Storage) MFA(ctx context.Context, userID int64) (models.MFA, error) {
+	const op = "sqlite.MFA"
+	var res models.MFA
+	query := "SELECT user_id, secret, enabled, last_step FROM user_mfa WHERE user_id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, userID).Scan(&res.UserID, &res.Secret, &res.Enabled, &res.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// EnableMFA включает MFA и заменяет коды восстановления одной транзакцией
+func (s *Storage) EnableMFA(ctx context.Context, userID int64, step int64, recoveryHashes []string) error {
+	const op = "sqlite.EnableMFA"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE user_mfa SET enabled = 1, last_step = ? WHERE user_id = ? AND enabled = 0",
+		step, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAEnabled)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, hash := range recoveryHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UseMFAStep запоминает принятый интервал TOTP. Возвращает false, если код этого или более позднего
+// интервала уже был принят
+func (s *Storage) UseMFAStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	const op = "sqlite.UseMFAStep"
+	query := "UPDATE user_mfa SET last_step = ? WHERE user_id = ? AND last_step < ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode гасит код восстановления. Возвращает false, если кода нет или он уже использован
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	const op = "sqlite.UseRecoveryCode"
+	query := "UPDATE mfa_recovery_codes SET used = 1 WHERE user_id = ? AND code_hash = ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+func (s *Storage) SaveMFAChallenge(ctx context.Context, c models.MFAChallenge) (int64, error) {
+	const op = "sqlite.SaveMFAChallenge"
+	query := "INSERT INTO mfa_challenges (token_hash, user_id, app_id, expires_at, enroll) VALUES (?, ?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, c.TokenHash, c.UserID, c.AppID, c.ExpiresAt.Unix(), c.Enroll)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) MFAChallenge(ctx context.Context, tokenHash string) (models.MFAChallenge, error) {
+	const op = "sqlite.MFAChallenge"
+	var res models.MFAChallenge
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, expires_at, attempts, used, enroll FROM mfa_challenges WHERE token_hash = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &expiresAt,
+		&res.Attempts, &res.Used, &res.Enroll)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// AttemptMFAChallenge учитывает попытку ввести код. Проверка лимита и увеличение счётчика выполняются
+// одним запросом, поэтому параллельные попытки не превысят maxAttempts. Возвращает false, если challenge
+// уже использован, исчерпан или не найден
+func (s *Storage) AttemptMFAChallenge(ctx context.Context, id int64, maxAttempts int) (bool, error) {
+	const op = "sqlite.AttemptMFAChallenge"
+	query := "UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = ? AND attempts < ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id, maxAttempts)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+// UseMFAChallenge помечает challenge использованным. Возвращает false, если он уже был использован
+func (s *Storage) UseMFAChallenge(ctx context.Context, id int64) (bool, error) {
+	const op = "sqlite.UseMFAChallenge"
+	query := "UPDATE mfa_challenges SET used = 1 WHERE id = ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_MFA(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+
+	uid, err := s.SaveUser(ctx, "mfa_user", []byte("hash"), 1)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+
+	if _, err := s.MFA(ctx, uid); !errors.Is(err, storage.ErrMFANotFound) {
+		t.Fatalf("MFA() cerror = %v, want %v", err, storage.ErrMFANotFound)
+	}
+
+	if err = s.SaveMFASecret(ctx, uid, "first"); err != nil {
+		t.Fatalf("SaveMFASecret() cerror = %v", err)
+	}
+	if err = s.SaveMFASecret(ctx, uid, "second"); err != nil {
+		t.Fatalf("SaveMFASecret() replace cerror = %v", err)
+	}
+	want := models.MFA{UserID: uid, Secret: "second"}
+	if got, err := s.MFA(ctx, uid); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("MFA() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if err = s.EnableMFA(ctx, uid, 100, []string{"code1", "code2"}); err != nil {
+		t.Fatalf("EnableMFA() cerror = %v", err)
+	}
+	if err = s.EnableMFA(ctx, uid, 100, nil); !errors.Is(err, storage.ErrMFAEnabled) {
+		t.Errorf("EnableMFA() repeat cerror = %v, want %v", err, storage.ErrMFAEnabled)
+	}
+	if err = s.SaveMFASecret(ctx, uid, "third"); !errors.Is(err, storage.ErrMFAEnabled) {
+		t.Errorf("SaveMFASecret() enabled cerror = %v, want %v", err, storage.ErrMFAEnabled)
+	}
+	want = models.MFA{UserID: uid, Secret: "second", Enabled: true, LastStep: 100}
+	if got, err := s.MFA(ctx, uid); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("MFA() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if ok, err := s.UseMFAStep(ctx, uid, 100); err != nil || ok {
+		t.Errorf("UseMFAStep() same step got = %v, cerror = %v, want false", ok, err)
+	}
+	if ok, err := s.UseMFAStep(ctx, uid, 101); err != nil || !ok {
+		t.Errorf("UseMFAStep() next step got = %v, cerror = %v, want true", ok, err)
+	}
+
+	if ok, err := s.UseRecoveryCode(ctx, uid, "code1"); err != nil || !ok {
+		t.Errorf("UseRecoveryCode() got = %v, cerror = %v, want true", ok, err)
+	}
+	if ok, err := s.UseRecoveryCode(ctx, uid, "code1"); err != nil || ok {
+		t.Errorf("UseRecoveryCode() repeat got = %v, cerror = %v, want false", ok, err)
+	}
+	if ok, err := s.UseRecoveryCode(ctx, uid, "missing"); err != nil || ok {
+		t.Errorf("UseRecoveryCode() missing got = %v, cerror = %v, want false", ok, err)
+	}
+}
+
+func TestStorage_MFAChallenge(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	if _, err := s.MFAChallenge(ctx, "missing"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Fatalf("MFAChallenge() cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+
+	want := models.MFAChallenge{TokenHash: "challenge_hash", UserID: 1, AppID: 1, ExpiresAt: now.Add(time.Minute)}
+	id, err := s.SaveMFAChallenge(ctx, want)
+	if err != nil {
+		t.Fatalf("SaveMFAChallenge() cerror = %v", err)
+	}
+	want.ID = id
+
+	got, err := s.MFAChallenge(ctx, "challenge_hash")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("MFAChallenge() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	enroll := models.MFAChallenge{TokenHash: "enroll_hash", UserID: 1, AppID: 1, ExpiresAt: now.Add(time.Minute), Enroll: true}
+	if enroll.ID, err = s.SaveMFAChallenge(ctx, enroll); err != nil {
+		t.Fatalf("SaveMFAChallenge() enroll cerror = %v", err)
+	}
+	if got, err := s.MFAChallenge(ctx, "enroll_hash"); err != nil || !reflect.DeepEqual(got, enroll) {
+		t.Fatalf("MFAChallenge() enroll got = %v, cerror = %v, want %v", got, err, enroll)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if ok, err := s.AttemptMFAChallenge(ctx, id, 2); err != nil || ok != (i <= 2) {
+			t.Errorf("AttemptMFAChallenge() attempt %d got = %v, cerror = %v, want %v", i, ok, err, i <= 2)
+		}
+	}
+	if ok, err := s.AttemptMFAChallenge(ctx, id+1000, 2); err != nil || ok {
+		t.Errorf("AttemptMFAChallenge() missing got = %v, cerror = %v, want false", ok, err)
+	}
+
+	if ok, err := s.UseMFAChallenge(ctx, id); err != nil || !ok {
+		t.Fatalf("UseMFAChallenge() got = %v, cerror = %v, want true", ok, err)
+	}
+	if ok, err := s.UseMFAChallenge(ctx, id); err != nil || ok {
+		t.Errorf("UseMFAChallenge() repeat got = %v, cerror = %v, want false", ok, err)
+	}
+	if got, err := s.MFAChallenge(ctx, "challenge_hash"); err != nil || !got.Used || got.Attempts != 2 {
+		t.Errorf("MFAChallenge() got = %v, cerror = %v, want used with 2 attempts", got, err)
+	}
+}
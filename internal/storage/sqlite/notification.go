@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) EnqueueNotification(ctx context.Context, n models.Notification) (int64, error) {
+	const op = "sqlite.EnqueueNotification"
+	query := `INSERT INTO notifications (recipient, subject, body, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, n.Recipient, n.Subject, n.Body, n.NextAttemptAt.Unix(), n.CreatedAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// DueNotifications возвращает не более limit писем, время доставки которых наступило, в порядке постановки в очередь
+func (s *Storage) DueNotifications(ctx context.Context, now time.Time, limit int) ([]models.Notification, error) {
+	const op = "sqlite.DueNotifications"
+	query := `SELECT id, recipient, subject, body, attempts, next_attempt_at, last_error, failed, created_at
+		FROM notifications WHERE failed = 0 AND next_attempt_at <= ? ORDER BY id LIMIT ?`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := stmt.QueryContext(ctx, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// DeleteNotification удаляет доставленное письмо, чтобы токены из писем не хранились дольше необходимого
+func (s *Storage) DeleteNotification(ctx context.Context, id int64) error {
+	const op = "sqlite.DeleteNotification"
+	query := "DELETE FROM notifications WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RetryNotification(ctx context.Context, id int64, attempts int, next time.Time, lastErr string) error {
+	const op = "sqlite.RetryNotification"
+	query := "UPDATE notifications SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, attempts, next.Unix(), lastErr, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) FailNotification(ctx context.Context, id int64, attempts int, lastErr string) error {
+	const op = "sqlite.FailNotification"
+	query := "UPDATE notifications SET attempts = ?, last_error = ?, failed = 1 WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, attempts, lastErr, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanNotification(row scanner) (models.Notification, error) {
+	var res models.Notification
+	var nextAttemptAt, createdAt int64
+
+	err := row.Scan(&res.ID, &res.Recipient, &res.Subject, &res.Body, &res.Attempts, &nextAttemptAt,
+		&res.LastError, &res.Failed, &createdAt)
+	if err != nil {
+		return res, err
+	}
+	res.NextAttemptAt = fromUnix(nextAttemptAt)
+	res.CreatedAt = fromUnix(createdAt)
+
+	return res, nil
+}
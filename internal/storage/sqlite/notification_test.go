@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"testing"
+	"time"
+)
+
+func TestStorage_Notifications(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	first, err := s.EnqueueNotification(ctx, models.Notification{
+		Recipient: "user@example.com", Subject: "s1", Body: "b1", NextAttemptAt: now, CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("EnqueueNotification() cerror = %v", err)
+	}
+	second, err := s.EnqueueNotification(ctx, models.Notification{
+		Recipient: "user@example.com", Subject: "s2", Body: "b2", NextAttemptAt: now.Add(time.Hour), CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("EnqueueNotification() cerror = %v", err)
+	}
+
+	due, err := s.DueNotifications(ctx, now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != first || due[0].Subject != "s1" || !due[0].CreatedAt.Equal(now) {
+		t.Fatalf("DueNotifications() got = %+v, cerror = %v", due, err)
+	}
+
+	if err = s.RetryNotification(ctx, first, 1, now.Add(time.Minute), "timeout"); err != nil {
+		t.Fatalf("RetryNotification() cerror = %v", err)
+	}
+	due, err = s.DueNotifications(ctx, now.Add(time.Minute), 10)
+	if err != nil || len(due) != 1 || due[0].Attempts != 1 || due[0].LastError != "timeout" {
+		t.Fatalf("DueNotifications() after retry got = %+v, cerror = %v", due, err)
+	}
+
+	if err = s.FailNotification(ctx, first, 2, "timeout"); err != nil {
+		t.Fatalf("FailNotification() cerror = %v", err)
+	}
+	if err = s.DeleteNotification(ctx, second); err != nil {
+		t.Fatalf("DeleteNotification() cerror = %v", err)
+	}
+	// недоставленные и удалённые письма больше не попадают в выборку
+	if due, err = s.DueNotifications(ctx, now.Add(2*time.Hour), 10); err != nil || len(due) != 0 {
+		t.Errorf("DueNotifications() got = %+v, cerror = %v, want empty", due, err)
+	}
+}
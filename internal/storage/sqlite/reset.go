@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, reset models.PasswordReset) (int64, error) {
+	const op = "sqlite.SavePasswordReset"
+	query := "INSERT INTO password_resets (token_hash, user_id, app_id, expires_at) VALUES (?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, reset.TokenHash, reset.UserID, reset.AppID, reset.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) PasswordReset(ctx context.Context, tokenHash string) (models.PasswordReset, error) {
+	const op = "sqlite.PasswordReset"
+	var res models.PasswordReset
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, expires_at, used FROM password_resets WHERE token_hash = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UsePasswordReset помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UsePasswordReset(ctx context.Context, id int64) (bool, error) {
+	const op = "sqlite.UsePasswordReset"
+	query := "UPDATE password_resets SET used = 1 WHERE id = ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, uid int64, pswdHash []byte) error {
+	const op = "sqlite.UpdatePassword"
+	query := "UPDATE users SET passHash = ? WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, pswdHash, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
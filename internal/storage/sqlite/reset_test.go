@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_PasswordReset(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	if _, err := s.PasswordReset(ctx, "missing"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Fatalf("PasswordReset() cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+
+	want := models.PasswordReset{TokenHash: "hash_1", UserID: 1, AppID: 1, ExpiresAt: now.Add(time.Hour)}
+	id, err := s.SavePasswordReset(ctx, want)
+	if err != nil {
+		t.Fatalf("SavePasswordReset() cerror = %v", err)
+	}
+	want.ID = id
+
+	got, err := s.PasswordReset(ctx, "hash_1")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("PasswordReset() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if ok, err := s.UsePasswordReset(ctx, id); err != nil || !ok {
+		t.Fatalf("UsePasswordReset() got = %v, cerror = %v, want true", ok, err)
+	}
+	// повторное использование токена невозможно
+	if ok, err := s.UsePasswordReset(ctx, id); err != nil || ok {
+		t.Errorf("UsePasswordReset() repeat got = %v, cerror = %v, want false", ok, err)
+	}
+	if got, err = s.PasswordReset(ctx, "hash_1"); err != nil || !got.Used {
+		t.Errorf("PasswordReset() got = %v, cerror = %v, want used", got, err)
+	}
+}
+
+func TestStorage_UpdatePassword(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+
+	uid, err := s.SaveUser(ctx, "reset_user", []byte("old"), 1)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if err = s.UpdatePassword(ctx, uid, []byte("new")); err != nil {
+		t.Fatalf("UpdatePassword() cerror = %v", err)
+	}
+	user, err := s.UserByID(ctx, uid)
+	if err != nil || string(user.PassHash) != "new" {
+		t.Errorf("UserByID() got = %v, cerror = %v, want new passhash", user, err)
+	}
+
+	if err = s.UpdatePassword(ctx, uid+1000, []byte("new")); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("UpdatePassword() cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"time"
+)
+
+func (s *Storage) RevokeToken(ctx context.Context, token models.RevokedToken) error {
+	const op = "sqlite.RevokeToken"
+	query := "INSERT OR IGNORE INTO revoked_tokens (jti, user_id, app_id, expires_at) VALUES (?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, token.ID, token.UserID, token.AppID, token.ExpiresAt.Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "sqlite.TokenRevoked"
+	query := "SELECT 1 FROM revoked_tokens WHERE jti = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var found int
+	err = stmt.QueryRowContext(ctx, jti).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return true, nil
+}
+
+// RevokeUserTokens отзывает все токены пользователя, выданные не позже at. at хранится с точностью до миллисекунды,
+// запись нужна до expiresAt, когда истекут все такие токены
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID int64, at time.Time, expiresAt time.Time) error {
+	const op = "sqlite.RevokeUserTokens"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_revocations (user_id, revoked_at, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET revoked_at = excluded.revoked_at, expires_at = excluded.expires_at`,
+		userID, at.UnixMilli(), expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = 1 WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UserTokensRevokedAt возвращает момент последнего отзыва всех токенов пользователя или нулевое время
+func (s *Storage) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	const op = "sqlite.UserTokensRevokedAt"
+	query := "SELECT revoked_at FROM user_revocations WHERE user_id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var revokedAt int64
+	err = stmt.QueryRowContext(ctx, userID).Scan(&revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return time.UnixMilli(revokedAt), nil
+}
+
+// DeleteExpiredRevocations удаляет записи об отзыве токенов, истёкших к моменту now
+func (s *Storage) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error) {
+	const op = "sqlite.DeleteExpiredRevocations"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at < ?",
+		"DELETE FROM user_revocations WHERE expires_at < ?",
+	} {
+		res, err := tx.ExecContext(ctx, query, now.Unix())
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"testing"
+	"time"
+)
+
+func TestStorage_RevokeToken(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	tokens := []models.RevokedToken{
+		{ID: "jti_1", UserID: 1, AppID: 1, ExpiresAt: now.Add(time.Hour)},
+		{ID: "jti_2", UserID: 1, AppID: 1, ExpiresAt: now.Add(-time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := s.RevokeToken(ctx, token); err != nil {
+			t.Fatalf("RevokeToken() cerror = %v", err)
+		}
+	}
+	// повторный отзыв того же токена не является ошибкой
+	if err := s.RevokeToken(ctx, tokens[0]); err != nil {
+		t.Fatalf("RevokeToken() repeat cerror = %v", err)
+	}
+
+	for _, tt := range []struct {
+		jti  string
+		want bool
+	}{
+		{jti: "jti_1", want: true},
+		{jti: "jti_2", want: true},
+		{jti: "jti_unknown", want: false},
+	} {
+		got, err := s.TokenRevoked(ctx, tt.jti)
+		if err != nil || got != tt.want {
+			t.Errorf("TokenRevoked(%s) got = %v, cerror = %v, want %v", tt.jti, got, err, tt.want)
+		}
+	}
+
+	if err := s.RevokeUserTokens(ctx, 1, now, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RevokeUserTokens() cerror = %v", err)
+	}
+	if err := s.RevokeUserTokens(ctx, 2, now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeUserTokens() cerror = %v", err)
+	}
+	got, err := s.UserTokensRevokedAt(ctx, 2)
+	if err != nil || !got.Equal(now) {
+		t.Errorf("UserTokensRevokedAt() got = %v, cerror = %v, want %v", got, err, now)
+	}
+	got, err = s.UserTokensRevokedAt(ctx, 3)
+	if err != nil || !got.IsZero() {
+		t.Errorf("UserTokensRevokedAt() got = %v, cerror = %v, want zero time", got, err)
+	}
+
+	deleted, err := s.DeleteExpiredRevocations(ctx, now)
+	if err != nil || deleted != 2 {
+		t.Errorf("DeleteExpiredRevocations() got = %v, cerror = %v, want 2", deleted, err)
+	}
+	if revoked, _ := s.TokenRevoked(ctx, "jti_1"); !revoked {
+		t.Errorf("TokenRevoked(jti_1) got = false after cleanup, want true")
+	}
+	if at, _ := s.UserTokensRevokedAt(ctx, 1); !at.IsZero() {
+		t.Errorf("UserTokensRevokedAt(1) got = %v after cleanup, want zero time", at)
+	}
+}
+
+func TestStorage_RevokeUserTokens_RefreshTokens(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, token := range []models.RefreshToken{
+		{TokenHash: "hash_1", UserID: 1, AppID: 1, FamilyID: "family_1", ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "hash_2", UserID: 2, AppID: 1, FamilyID: "family_2", ExpiresAt: now.Add(time.Hour)},
+	} {
+		if _, err := s.SaveRefreshToken(ctx, token); err != nil {
+			t.Fatalf("SaveRefreshToken() cerror = %v", err)
+		}
+	}
+
+	if err := s.RevokeUserTokens(ctx, 1, now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeUserTokens() cerror = %v", err)
+	}
+
+	for hash, want := range map[string]bool{"hash_1": true, "hash_2": false} {
+		got, err := s.RefreshToken(ctx, hash)
+		if err != nil || got.Revoked != want {
+			t.Errorf("RefreshToken(%s) revoked = %v, cerror = %v, want %v", hash, got.Revoked, err, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+)
+
+// SaveRole создаёт роль приложения вместе с её разрешениями. ErrRoleExists, если роль с таким именем
+// в приложении уже есть
+func (s *Storage) SaveRole(ctx context.Context, role models.Role) (int64, error) {
+	const op = "sqlite.SaveRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err = tx.QueryRowContext(ctx, "SELECT 1 FROM apps WHERE id = ?", role.AppID).Scan(&found); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO roles (app_id, name) VALUES (?, ?)", role.AppID, role.Name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrRoleExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, p := range role.Permissions {
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO role_permissions (role_id, permission) VALUES (?, ?)", id, p)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// Roles возвращает роли приложения по имени
+func (s *Storage) Roles(ctx context.Context, appID int32) ([]models.Role, error) {
+	const op = "sqlite.Roles"
+	query := `SELECT r.id, r.app_id, r.name, p.permission FROM roles r
+		LEFT JOIN role_permissions p ON p.role_id = r.id WHERE r.app_id = ? ORDER BY r.name, p.permission`
+
+	res, err := s.queryRoles(ctx, query, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UserRoles возвращает роли пользователя в приложении по имени
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int32) ([]models.Role, error) {
+	const op = "sqlite.UserRoles"
+	query := `SELECT r.id, r.app_id, r.name, p.permission FROM roles r
+		JOIN user_roles u ON u.role_id = r.id
+		LEFT JOIN role_permissions p ON p.role_id = r.id
+		WHERE u.user_id = ? AND r.app_id = ? ORDER BY r.name, p.permission`
+
+	res, err := s.queryRoles(ctx, query, userID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// DeleteRole удаляет роль приложения и снимает её со всех пользователей
+func (s *Storage) DeleteRole(ctx context.Context, appID int32, name string) error {
+	const op = "sqlite.DeleteRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	id, err := roleID(ctx, tx, "SELECT id FROM roles WHERE app_id = ? AND name = ?", appID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE role_id = ?",
+		"DELETE FROM role_permissions WHERE role_id = ?",
+		"DELETE FROM roles WHERE id = ?",
+	} {
+		if _, err = tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// AssignRole назначает роль приложения пользователю с доступом к нему. Повторное назначение не ошибка
+func (s *Storage) AssignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "sqlite.AssignRole"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	id, err := roleID(ctx, tx, "SELECT id FROM roles WHERE app_id = ? AND name = ?", appID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var found int
+	err = tx.QueryRowContext(ctx, "SELECT 1 FROM user_apps WHERE user_id = ? AND app_id = ?", userID, appID).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UnassignRole снимает роль с пользователя. ErrRoleNotFound, если роли у пользователя не было
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, appID int32, name string) error {
+	const op = "sqlite.UnassignRole"
+	query := "DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE app_id = ? AND name = ?)"
+
+	res, err := s.db.ExecContext(ctx, query, userID, appID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+	return nil
+}
+
+// queryRoles собирает роли из строк (id, app_id, name, permission), отсортированных по роли
+func (s *Storage) queryRoles(ctx context.Context, query string, args ...any) ([]models.Role, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []models.Role
+	for rows.Next() {
+		var role models.Role
+		var permission sql.NullString
+		if err = rows.Scan(&role.ID, &role.AppID, &role.Name, &permission); err != nil {
+			return nil, err
+		}
+		if len(res) == 0 || res[len(res)-1].ID != role.ID {
+			res = append(res, role)
+		}
+		if permission.Valid {
+			last := &res[len(res)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+	return res, rows.Err()
+}
+
+// roleID ищет id роли в транзакции, ErrRoleNotFound если её нет
+func roleID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	var id int64
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storage.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// assignAdminRole назначает пользователю роль администратора уровня lvl, создавая роль при первом назначении
+func assignAdminRole(ctx context.Context, tx *sql.Tx, userID int64, appID int32, lvl int32) error {
+	name := storage.AdminRole(lvl)
+	if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO roles (app_id, name) VALUES (?, ?)", appID, name); err != nil {
+		return err
+	}
+	id, err := roleID(ctx, tx, "SELECT id FROM roles WHERE app_id = ? AND name = ?", appID, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO role_permissions (role_id, permission) VALUES (?, ?)", id, storage.AdminPermission)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, id)
+	return err
+}
@@ -24,18 +24,20 @@ type Storage struct {
 	db *sql.DB
 }
 
+// SaveUser создаёт пользователя и сразу даёт ему доступ к приложению регистрации. Логин должен быть
+// свободен среди всех пользователей с доступом к приложению
 func (s *Storage) SaveUser(ctx context.Context, login string, pswdHash []byte, appid int32) (uid int64, err error) {
 	const op = "sqlite.SaveUser"
-	query := "INSERT INTO users (login, passHash,app_id) VALUES (?, ?, ?)"
 
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	res, err := stmt.ExecContext(ctx, login, pswdHash, appid)
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO users (login, passHash,app_id) VALUES (?, ?, ?)", login, pswdHash, appid)
 	if err != nil {
-		var sqlErr sqlite3.Error
-		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		if isUniqueViolation(err) {
 			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
 		}
 		return 0, fmt.Errorf("%s: %w", op, err)
@@ -46,13 +48,25 @@ func (s *Storage) SaveUser(ctx context.Context, login string, pswdHash []byte, a
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	_, err = tx.ExecContext(ctx, "INSERT INTO user_apps (user_id, app_id, login) VALUES (?, ?, ?)", id, appid, login)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
 func (s *Storage) User(ctx context.Context, login string, appid int32) (models.User, error) {
 	var user models.User
 	const op = "sqlite.User"
-	query := "SELECT id, login,passHash FROM users WHERE login = ? and app_id = ?"
+	query := `SELECT u.id, u.login, u.passHash, u.email_verified FROM users u
+		JOIN user_apps m ON m.user_id = u.id WHERE m.login = ? AND m.app_id = ?`
 
 	stmt, err := s.db.Prepare(query)
 	if err != nil {
@@ -60,10 +74,9 @@ func (s *Storage) User(ctx context.Context, login string, appid int32) (models.U
 	}
 
 	res := stmt.QueryRowContext(ctx, login, appid)
-	err = res.Scan(&user.ID, &user.Login, &user.PassHash)
+	err = res.Scan(&user.ID, &user.Login, &user.PassHash, &user.EmailVerified)
 	if err != nil {
-		var sqlErr sqlite3.Error
-		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return user, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
 
@@ -72,7 +85,28 @@ func (s *Storage) User(ctx context.Context, login string, appid int32) (models.U
 	return user, nil
 }
 
-func (s *Storage) IsAdmin(ctx context.Context, userID int32, appID int32) (models.Admin, error) {
+func (s *Storage) UserByID(ctx context.Context, uid int64) (models.User, error) {
+	var user models.User
+	const op = "sqlite.UserByID"
+	query := "SELECT id, login, passHash, email_verified FROM users WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return user, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := stmt.QueryRowContext(ctx, uid)
+	err = res.Scan(&user.ID, &user.Login, &user.PassHash, &user.EmailVerified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		return user, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+func (s *Storage) IsAdmin(ctx context.Context, userID int64, appID int32) (models.Admin, error) {
 	var res models.Admin
 	const op = "sqlite.IsAdmin"
 	query := "SELECT id,user_id,lvl,app_id FROM admins WHERE user_id = ? and app_id = ?"
@@ -98,15 +132,14 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int32, appID int32) (model
 func (s *Storage) App(ctx context.Context, appID int32) (models.App, error) {
 	const op = "sqlite.App"
 	var res models.App
-	query := "SELECT id,name,secret FROM apps WHERE id = ?"
+	query := "SELECT " + appColumns + " FROM apps WHERE id = ?"
 
 	stmt, err := s.db.Prepare(query)
 	if err != nil {
 		return res, fmt.Errorf("%s: %w ", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, appID)
-	err = row.Scan(&res.ID, &res.Name, &res.Secret)
+	res, err = scanApp(stmt.QueryRowContext(ctx, appID))
 	if err != nil {
 		var sqlErr sqlite3.Error
 		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sql.ErrNoRows || err.Error() == "sql: no rows in result set" {
@@ -114,61 +147,87 @@ func (s *Storage) App(ctx context.Context, appID int32) (models.App, error) {
 		}
 		return res, fmt.Errorf("%s: %w ", op, err)
 	}
+
 	return res, nil
 }
 
+// CreateAdmin делает пользователя приложения администратором уровня lvl. В той же транзакции ему назначается
+// роль admin_lvl_N, чтобы CheckPermission не расходился с admins
 func (s *Storage) CreateAdmin(ctx context.Context, login string, lvl int32, appID int32) (uid int64, err error) {
 	const op = "storage.CreateAdmin"
-	query := "INSERT INTO admins (user_id, lvl, app_id) SELECT id, ?, ? FROM users WHERE login = ?"
 
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w ", op, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
 
-	res, err := stmt.ExecContext(ctx, lvl, appID, login)
+	var userID int64
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM user_apps WHERE login = ? AND app_id = ?", login, appID).Scan(&userID)
 	if err != nil {
-		var sqlErr sqlite3.Error
-		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 		}
-		return 0, fmt.Errorf("%s: %w ", op, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	res, err := tx.ExecContext(ctx, "INSERT INTO admins (user_id, lvl, app_id) VALUES (?, ?, ?)", userID, lvl, appID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	uid, err = res.LastInsertId()
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w ", op, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = assignAdminRole(ctx, tx, userID, appID, lvl); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 	return uid, nil
 }
 
-func (s *Storage) DeleteAdmin(ctx context.Context, login string) (res bool, err error) {
+// DeleteAdmin снимает права администратора приложения appID с пользователя этого приложения
+// вместе с ролями admin_lvl_N его записей в admins
+func (s *Storage) DeleteAdmin(ctx context.Context, login string, appID int32) (res bool, err error) {
 	const op = "storage.DeleteAdmin"
-	query := "delete from admins where user_id in (select id from users where login= ?)"
 
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return false, fmt.Errorf("%s: %w ", op, err)
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	_, err = stmt.ExecContext(ctx, login)
-	if err != nil {
-		var errSql sqlite3.Error
-		if errors.As(err, &errSql) && errSql.ExtendedCode == sql.ErrNoRows {
-			return false, storage.ErrUserNotFound
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_roles WHERE role_id IN (SELECT r.id FROM roles r
+			JOIN admins a ON r.app_id = a.app_id AND r.name = 'admin_lvl_' || a.lvl
+			WHERE a.app_id = ? AND a.user_id = user_roles.user_id)
+		AND user_id IN (SELECT user_id FROM user_apps WHERE login = ? AND app_id = ?)`,
+		"DELETE FROM admins WHERE app_id = ? AND user_id IN (SELECT user_id FROM user_apps WHERE login = ? AND app_id = ?)",
+	} {
+		if _, err = tx.ExecContext(ctx, query, appID, login, appID); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
 		}
+	}
+
+	if err = tx.Commit(); err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
-	return true, err
+	return true, nil
 }
-func (s *Storage) AddApp(ctx context.Context, name, secret string) (int32, error) {
+
+func (s *Storage) AddApp(ctx context.Context, name, secret, alg string) (int32, error) {
 	const op = "storage.AddApp"
 
-	query := "INSERT INTO apps (name,secret) VALUES(?,?)"
+	query := "INSERT INTO apps (name,secret,alg) VALUES(?,?,?)"
 	stmt, err := s.db.Prepare(query)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	res, err := stmt.ExecContext(ctx, name, secret)
+	res, err := stmt.ExecContext(ctx, name, secret, alg)
 	if err != nil {
 		var errSql sqlite3.Error
 		if errors.As(err, &errSql) && errSql.ExtendedCode == sql.ErrNoRows {
@@ -190,3 +249,8 @@ func (s *Storage) AddApp(ctx context.Context, name, secret string) (int32, error
 func (s *Storage) Close() error {
 	return s.db.Close()
 }
+
+func isUniqueViolation(err error) bool {
+	var sqlErr sqlite3.Error
+	return errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
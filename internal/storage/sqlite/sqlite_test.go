@@ -4,22 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/migrator"
 	"github.com/MorZLE/auth/internal/storage"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/MorZLE/auth/migrations"
 	_ "github.com/mattn/go-sqlite3"
-	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
 
 func TestStorage_AddApp(t *testing.T) {
 
-	db, remove := goTestDB(sqlite)
-	defer remove()
+	db := testDB(t)
 
 	checkres := func(t *testing.T, db *sql.DB, app models.App) bool {
 		var gotRes models.App
@@ -99,7 +96,7 @@ func TestStorage_AddApp(t *testing.T) {
 			s := &Storage{
 				db: db,
 			}
-			got, err := s.AddApp(context.Background(), tt.args.name, tt.args.secret)
+			got, err := s.AddApp(context.Background(), tt.args.name, tt.args.secret, "HS256")
 
 			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("AddApp() cerror = %v, wantErr %v", err, tt.wantErr)
@@ -119,24 +116,23 @@ func TestStorage_AddApp(t *testing.T) {
 
 func TestStorage_App(t *testing.T) {
 
-	db, remove := goTestDB(sqlite)
-	defer remove()
+	db := testDB(t)
 
 	apps := []models.App{
-		{ID: 1, Name: "awdawf", Secret: "secret"},
-		{ID: 2, Name: "morzGEAHle.com", Secret: "sef23fresef"},
-		{ID: 3, Name: "morzASZDe.com", Secret: "awdtrdehdf"},
-		{ID: 4, Name: "morEWFzle.com", Secret: "sef23aSEf432gawd"},
-		{ID: 5, Name: "morzle.com", Secret: "sef2aerbvb45whnw3awd"},
+		{ID: 1, Name: "awdawf", Secret: "secret", Alg: "HS256"},
+		{ID: 2, Name: "morzGEAHle.com", Secret: "sef23fresef", Alg: "HS256"},
+		{ID: 3, Name: "morzASZDe.com", Secret: "awdtrdehdf", Alg: "HS256"},
+		{ID: 4, Name: "morEWFzle.com", Secret: "sef23aSEf432gawd", Alg: "RS256"},
+		{ID: 5, Name: "morzle.com", Secret: "sef2aerbvb45whnw3awd", Alg: "EdDSA"},
 	}
 
 	checkres := func(t *testing.T, db *sql.DB, app models.App) {
-		query := "INSERT INTO apps (name,secret) VALUES(?,?)"
+		query := "INSERT INTO apps (name,secret,alg) VALUES(?,?,?)"
 		stmt, err := db.Prepare(query)
 		if err != nil {
 			t.Errorf("AddApp() cerror = %v", err)
 		}
-		_, err = stmt.ExecContext(context.Background(), app.Name, app.Secret)
+		_, err = stmt.ExecContext(context.Background(), app.Name, app.Secret, app.Alg)
 		if err != nil {
 			t.Errorf("AddApp() cerror = %v", err)
 		}
@@ -221,8 +217,7 @@ func TestStorage_App(t *testing.T) {
 
 func TestStorage_SaveUser(t *testing.T) {
 
-	db, remove := goTestDB(sqlite)
-	defer remove()
+	db := testDB(t)
 
 	checkDB := func(login string, appid int32) error {
 		var resUser models.User
@@ -311,8 +306,7 @@ func TestStorage_SaveUser(t *testing.T) {
 
 func TestStorage_User(t *testing.T) {
 
-	db, closeDB := goTestDB(sqlite)
-	defer closeDB()
+	db := testDB(t)
 
 	createUser := func(db *sql.DB, user models.User, appID int32) {
 		query := "INSERT INTO users (login, passHash,app_id) VALUES (?, ?, ?)"
@@ -322,6 +316,10 @@ func TestStorage_User(t *testing.T) {
 			panic(err)
 		}
 		_, err = stmt.ExecContext(context.Background(), user.Login, user.PassHash, appID)
+
+		// User ищет пользователя через доступ к приложению
+		_, err = db.ExecContext(context.Background(), "INSERT INTO user_apps (user_id, app_id, login) VALUES (?, ?, ?)",
+			user.ID, appID, user.Login)
 	}
 
 	users := []models.User{
@@ -391,49 +389,25 @@ func TestStorage_User(t *testing.T) {
 	}
 }
 
-const sqlite = "sqlite3"
-
-func goTestDB(vendor string) (*sql.DB, func()) {
-	switch vendor {
-	case sqlite:
-		return createTestSqliteDB("D:/Golang/auth/storage/test.db", "D:/Golang/auth/migrations/", "")
-	}
-	panic("unknown vendor db")
-	return nil, nil
-}
-
-func createTestSqliteDB(storagePath, migratorPath, migratorTable string) (*sql.DB, func()) {
-	db, err := sql.Open("sqlite3", storagePath)
-	if err != nil {
-		panic(err)
-	}
+// testDB возвращает пустую базу во временном каталоге теста со схемой из встроенных миграций
+func testDB(t *testing.T) *sql.DB {
+	storagePath := filepath.Join(t.TempDir(), "test.db")
 
-	m, err := migrate.New(
-		"file:"+migratorPath,
-		fmt.Sprintf("sqlite3://%s?x-migration-table=%s", storagePath, migratorTable),
-	)
+	m, err := migrator.New(migrations.SQLite, "sqlite", storagePath, migrator.Table)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	if err := m.Up(); err != nil {
-		if !errors.Is(err, migrate.ErrNoChange) {
-			panic(err)
-		}
+	if err := migrator.Up(m); err != nil {
+		t.Fatal(err)
 	}
-	err, _ = m.Close()
-	if err != nil {
-		panic(err)
+	if err, _ := m.Close(); err != nil {
+		t.Fatal(err)
 	}
 
-	return db, func() {
-		err := db.Close()
-		if err != nil {
-			panic(err)
-		}
-
-		err = os.Remove(storagePath)
-		if err != nil {
-			panic(err)
-		}
+	db, err := sql.Open("sqlite3", storagePath)
+	if err != nil {
+		t.Fatal(err)
 	}
+	t.Cleanup(func() { db.Close() })
+	return db
 }
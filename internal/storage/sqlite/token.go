@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) (int64, error) {
+	const op = "sqlite.SaveRefreshToken"
+	query := "INSERT INTO refresh_tokens (token_hash, user_id, app_id, family_id, expires_at) VALUES (?, ?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, token.TokenHash, token.UserID, token.AppID, token.FamilyID, token.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "sqlite.RefreshToken"
+	var res models.RefreshToken
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, family_id, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+	err = row.Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &res.FamilyID, &expiresAt, &res.Used, &res.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseRefreshToken помечает токен использованным. Возвращает false, если токен уже был использован ранее
+func (s *Storage) UseRefreshToken(ctx context.Context, id int64) (bool, error) {
+	const op = "sqlite.UseRefreshToken"
+	query := "UPDATE refresh_tokens SET used = 1 WHERE id = ? AND used = 0 AND revoked = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	const op = "sqlite.RevokeTokenFamily"
+	query := "UPDATE refresh_tokens SET revoked = 1 WHERE family_id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = stmt.ExecContext(ctx, familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"testing"
+	"time"
+)
+
+func TestStorage_RefreshToken(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+
+	tokens := []models.RefreshToken{
+		{TokenHash: "hash_1", UserID: 1, AppID: 1, FamilyID: "family_1", ExpiresAt: time.Unix(time.Now().Add(time.Hour).Unix(), 0)},
+		{TokenHash: "hash_2", UserID: 1, AppID: 1, FamilyID: "family_1", ExpiresAt: time.Unix(time.Now().Add(time.Hour).Unix(), 0)},
+		{TokenHash: "hash_3", UserID: 2, AppID: 1, FamilyID: "family_2", ExpiresAt: time.Unix(time.Now().Add(time.Hour).Unix(), 0)},
+	}
+	for i := range tokens {
+		id, err := s.SaveRefreshToken(ctx, tokens[i])
+		if err != nil {
+			t.Fatalf("SaveRefreshToken() cerror = %v", err)
+		}
+		tokens[i].ID = id
+	}
+
+	got, err := s.RefreshToken(ctx, "hash_1")
+	if err != nil {
+		t.Fatalf("RefreshToken() cerror = %v", err)
+	}
+	if got != tokens[0] {
+		t.Errorf("RefreshToken() got = %v, want %v", got, tokens[0])
+	}
+
+	if _, err = s.RefreshToken(ctx, "hash_unknown"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Errorf("RefreshToken() cerror = %v, wantErr %v", err, storage.ErrTokenNotFound)
+	}
+
+	ok, err := s.UseRefreshToken(ctx, tokens[0].ID)
+	if err != nil || !ok {
+		t.Errorf("UseRefreshToken() got = %v, cerror = %v, want true", ok, err)
+	}
+	ok, err = s.UseRefreshToken(ctx, tokens[0].ID)
+	if err != nil || ok {
+		t.Errorf("UseRefreshToken() second use got = %v, cerror = %v, want false", ok, err)
+	}
+
+	if err = s.RevokeTokenFamily(ctx, "family_1"); err != nil {
+		t.Fatalf("RevokeTokenFamily() cerror = %v", err)
+	}
+	for _, tt := range []struct {
+		hash        string
+		wantRevoked bool
+	}{
+		{hash: "hash_1", wantRevoked: true},
+		{hash: "hash_2", wantRevoked: true},
+		{hash: "hash_3", wantRevoked: false},
+	} {
+		got, err := s.RefreshToken(ctx, tt.hash)
+		if err != nil {
+			t.Fatalf("RefreshToken() cerror = %v", err)
+		}
+		if got.Revoked != tt.wantRevoked {
+			t.Errorf("RefreshToken(%s) revoked = %v, want %v", tt.hash, got.Revoked, tt.wantRevoked)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"time"
+)
+
+func (s *Storage) SaveEmailVerification(ctx context.Context, v models.EmailVerification) (int64, error) {
+	const op = "sqlite.SaveEmailVerification"
+	query := "INSERT INTO email_verifications (token_hash, user_id, app_id, expires_at) VALUES (?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, v.TokenHash, v.UserID, v.AppID, v.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) EmailVerification(ctx context.Context, tokenHash string) (models.EmailVerification, error) {
+	const op = "sqlite.EmailVerification"
+	var res models.EmailVerification
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, expires_at, used FROM email_verifications WHERE token_hash = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseEmailVerification помечает токен использованным. Возвращает false, если токен уже был использован
+func (s *Storage) UseEmailVerification(ctx context.Context, id int64) (bool, error) {
+	const op = "sqlite.UseEmailVerification"
+	query := "UPDATE email_verifications SET used = 1 WHERE id = ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+func (s *Storage) SetEmailVerified(ctx context.Context, uid int64) error {
+	const op = "sqlite.SetEmailVerified"
+	query := "UPDATE users SET email_verified = 1 WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SetAppRequireVerified(ctx context.Context, appID int32, required bool) error {
+	const op = "sqlite.SetAppRequireVerified"
+	query := "UPDATE apps SET require_verified = ? WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, required, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	return nil
+}
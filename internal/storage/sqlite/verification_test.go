@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_EmailVerification(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	uid, err := s.SaveUser(ctx, "verify_user", []byte("hash"), 1)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if user, err := s.UserByID(ctx, uid); err != nil || user.EmailVerified {
+		t.Fatalf("UserByID() got = %v, cerror = %v, want unverified", user, err)
+	}
+
+	if _, err := s.EmailVerification(ctx, "missing"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Fatalf("EmailVerification() cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+
+	want := models.EmailVerification{TokenHash: "verify_hash", UserID: uid, AppID: 1, ExpiresAt: now.Add(time.Hour)}
+	id, err := s.SaveEmailVerification(ctx, want)
+	if err != nil {
+		t.Fatalf("SaveEmailVerification() cerror = %v", err)
+	}
+	want.ID = id
+
+	got, err := s.EmailVerification(ctx, "verify_hash")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("EmailVerification() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if ok, err := s.UseEmailVerification(ctx, id); err != nil || !ok {
+		t.Fatalf("UseEmailVerification() got = %v, cerror = %v, want true", ok, err)
+	}
+	if ok, err := s.UseEmailVerification(ctx, id); err != nil || ok {
+		t.Errorf("UseEmailVerification() repeat got = %v, cerror = %v, want false", ok, err)
+	}
+
+	if err = s.SetEmailVerified(ctx, uid); err != nil {
+		t.Fatalf("SetEmailVerified() cerror = %v", err)
+	}
+	if user, err := s.UserByID(ctx, uid); err != nil || !user.EmailVerified {
+		t.Errorf("UserByID() got = %v, cerror = %v, want verified", user, err)
+	}
+	if err = s.SetEmailVerified(ctx, uid+1000); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("SetEmailVerified() cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+}
+
+func TestStorage_SetAppRequireVerified(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+
+	appID, err := s.AddApp(ctx, "verify_app", "verify_secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if err = s.SetAppRequireVerified(ctx, appID, true); err != nil {
+		t.Fatalf("SetAppRequireVerified() cerror = %v", err)
+	}
+	if app, err := s.App(ctx, appID); err != nil || !app.RequireVerified {
+		t.Errorf("App() got = %v, cerror = %v, want RequireVerified", app, err)
+	}
+	if err = s.SetAppRequireVerified(ctx, appID+1000, true); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("SetAppRequireVerified() cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+}
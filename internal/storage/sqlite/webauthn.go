@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+	"time"
+)
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, c models.WebAuthnCredential) (int64, error) {
+	const op = "sqlite.SaveWebAuthnCredential"
+	query := `INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type, aaguid, sign_count,
+		transports, backup_eligible, backup_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, c.UserID, c.CredentialID, c.PublicKey, c.AttestationType, c.AAGUID, c.SignCount,
+		strings.Join(c.Transports, ","), c.BackupEligible, c.BackupState, c.CreatedAt.Unix())
+	if err != nil {
+		var sqlErr sqlite3.Error
+		if errors.As(err, &sqlErr) && sqlErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrCredentialExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	const op = "sqlite.WebAuthnCredentials"
+	query := `SELECT id, user_id, credential_id, public_key, attestation_type, aaguid, sign_count, transports,
+		backup_eligible, backup_state, created_at FROM webauthn_credentials WHERE user_id = ? ORDER BY id`
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var res []models.WebAuthnCredential
+	for rows.Next() {
+		var c models.WebAuthnCredential
+		var transports string
+		var createdAt int64
+		err = rows.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey, &c.AttestationType, &c.AAGUID, &c.SignCount,
+			&transports, &c.BackupEligible, &c.BackupState, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		c.Transports = splitList(transports)
+		c.CreatedAt = time.Unix(createdAt, 0)
+		res = append(res, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UpdateWebAuthnCredential сохраняет счётчик подписей и флаг резервной копии после успешного входа
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	const op = "sqlite.UpdateWebAuthnCredential"
+	query := "UPDATE webauthn_credentials SET sign_count = ?, backup_state = ? WHERE credential_id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, signCount, backupState, credentialID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) (int64, error) {
+	const op = "sqlite.SaveWebAuthnSession"
+	query := "INSERT INTO webauthn_sessions (token_hash, user_id, app_id, kind, data, expires_at) VALUES (?, ?, ?, ?, ?, ?)"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, session.TokenHash, session.UserID, session.AppID, session.Kind, session.Data,
+		session.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) WebAuthnSession(ctx context.Context, tokenHash string) (models.WebAuthnSession, error) {
+	const op = "sqlite.WebAuthnSession"
+	var res models.WebAuthnSession
+	var expiresAt int64
+	query := "SELECT id, token_hash, user_id, app_id, kind, data, expires_at, used FROM webauthn_sessions WHERE token_hash = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&res.ID, &res.TokenHash, &res.UserID, &res.AppID, &res.Kind, &res.Data,
+		&expiresAt, &res.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return res, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+		}
+		return res, fmt.Errorf("%s: %w", op, err)
+	}
+	res.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return res, nil
+}
+
+// UseWebAuthnSession помечает церемонию завершённой. Возвращает false, если она уже была завершена
+func (s *Storage) UseWebAuthnSession(ctx context.Context, id int64) (bool, error) {
+	const op = "sqlite.UseWebAuthnSession"
+	query := "UPDATE webauthn_sessions SET used = 1 WHERE id = ? AND used = 0"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return n == 1, nil
+}
+
+// SetAppWebAuthn задаёт relying party приложения. Пустой rpID отключает WebAuthn
+func (s *Storage) SetAppWebAuthn(ctx context.Context, appID int32, rpID string, origins []string) error {
+	const op = "sqlite.SetAppWebAuthn"
+	query := "UPDATE apps SET rp_id = ?, rp_origins = ? WHERE id = ?"
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	res, err := stmt.ExecContext(ctx, rpID, strings.Join(origins, ","), appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+	return nil
+}
+
+// splitList разбирает список, сохранённый через запятую
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
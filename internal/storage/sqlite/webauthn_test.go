@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_WebAuthnCredentials(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	uid, err := s.SaveUser(ctx, "webauthn_user", []byte("hash"), 1)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+
+	if got, err := s.WebAuthnCredentials(ctx, uid); err != nil || len(got) != 0 {
+		t.Fatalf("WebAuthnCredentials() got = %v, cerror = %v, want empty", got, err)
+	}
+
+	want := models.WebAuthnCredential{
+		UserID:          uid,
+		CredentialID:    []byte("credential"),
+		PublicKey:       []byte("public key"),
+		AttestationType: "none",
+		AAGUID:          make([]byte, 16),
+		SignCount:       1,
+		Transports:      []string{"internal", "hybrid"},
+		BackupEligible:  true,
+		CreatedAt:       now,
+	}
+	id, err := s.SaveWebAuthnCredential(ctx, want)
+	if err != nil {
+		t.Fatalf("SaveWebAuthnCredential() cerror = %v", err)
+	}
+	want.ID = id
+
+	if _, err := s.SaveWebAuthnCredential(ctx, want); !errors.Is(err, storage.ErrCredentialExists) {
+		t.Errorf("SaveWebAuthnCredential() duplicate cerror = %v, want %v", err, storage.ErrCredentialExists)
+	}
+
+	got, err := s.WebAuthnCredentials(ctx, uid)
+	if err != nil || len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("WebAuthnCredentials() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if err = s.UpdateWebAuthnCredential(ctx, []byte("credential"), 5, true); err != nil {
+		t.Fatalf("UpdateWebAuthnCredential() cerror = %v", err)
+	}
+	if got, err := s.WebAuthnCredentials(ctx, uid); err != nil || got[0].SignCount != 5 || !got[0].BackupState {
+		t.Errorf("WebAuthnCredentials() got = %v, cerror = %v, want updated sign count", got, err)
+	}
+	if err = s.UpdateWebAuthnCredential(ctx, []byte("missing"), 5, true); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Errorf("UpdateWebAuthnCredential() missing cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+}
+
+func TestStorage_WebAuthnSession(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	if _, err := s.WebAuthnSession(ctx, "missing"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Fatalf("WebAuthnSession() cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+
+	want := models.WebAuthnSession{
+		TokenHash: "session_hash",
+		UserID:    1,
+		AppID:     1,
+		Kind:      models.WebAuthnLogin,
+		Data:      []byte(`{"challenge":"abc"}`),
+		ExpiresAt: now.Add(time.Minute),
+	}
+	id, err := s.SaveWebAuthnSession(ctx, want)
+	if err != nil {
+		t.Fatalf("SaveWebAuthnSession() cerror = %v", err)
+	}
+	want.ID = id
+
+	got, err := s.WebAuthnSession(ctx, "session_hash")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("WebAuthnSession() got = %v, cerror = %v, want %v", got, err, want)
+	}
+
+	if ok, err := s.UseWebAuthnSession(ctx, id); err != nil || !ok {
+		t.Fatalf("UseWebAuthnSession() got = %v, cerror = %v, want true", ok, err)
+	}
+	if ok, err := s.UseWebAuthnSession(ctx, id); err != nil || ok {
+		t.Errorf("UseWebAuthnSession() repeat got = %v, cerror = %v, want false", ok, err)
+	}
+}
+
+func TestStorage_SetAppWebAuthn(t *testing.T) {
+
+	db := testDB(t)
+
+	s := &Storage{
+		db: db,
+	}
+	ctx := context.Background()
+
+	appID, err := s.AddApp(ctx, "webauthn_app", "webauthn_secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	origins := []string{"https://app.example.com", "https://www.example.com"}
+	if err = s.SetAppWebAuthn(ctx, appID, "example.com", origins); err != nil {
+		t.Fatalf("SetAppWebAuthn() cerror = %v", err)
+	}
+
+	app, err := s.App(ctx, appID)
+	if err != nil || app.RPID != "example.com" || !reflect.DeepEqual(app.RPOrigins, origins) {
+		t.Errorf("App() got = %v, cerror = %v", app, err)
+	}
+
+	if err = s.SetAppWebAuthn(ctx, appID+1000, "example.com", origins); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("SetAppWebAuthn() cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+}
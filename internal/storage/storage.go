@@ -2,12 +2,39 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrUserExists   = errors.New("user exists")
-	ErrAppExists    = errors.New("app exist")
-	ErrAppNotFound  = errors.New("app not found")
-	ErrUniqueApp    = errors.New("unique app")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user exists")
+	ErrAppExists        = errors.New("app exist")
+	ErrAppNotFound      = errors.New("app not found")
+	ErrUniqueApp        = errors.New("unique app")
+	ErrTokenNotFound    = errors.New("token not found")
+	ErrKeyNotFound      = errors.New("signing key not found")
+	ErrMFANotFound      = errors.New("mfa not found")
+	ErrMFAEnabled       = errors.New("mfa already enabled")
+	ErrCredentialExists = errors.New("credential already registered")
+	ErrRoleExists       = errors.New("role exists")
+	ErrRoleNotFound     = errors.New("role not found")
+	ErrAppHasUsers      = errors.New("app has users")
 )
+
+// AdminPermission разрешение роли администратора приложения
+const AdminPermission = "admin"
+
+// adminRolePrefix начало имён ролей администраторов
+const adminRolePrefix = "admin_lvl_"
+
+// AdminRole имя роли, которую CreateAdmin назначает администратору уровня lvl вместе с записью в admins,
+// а DeleteAdmin снимает вместе с ней
+func AdminRole(lvl int32) string {
+	return fmt.Sprintf("%s%d", adminRolePrefix, lvl)
+}
+
+// IsAdminRole сообщает, что роль относится к администраторам и меняется только через CreateAdmin и DeleteAdmin
+func IsAdminRole(name string) bool {
+	return strings.HasPrefix(name, adminRolePrefix)
+}
@@ -0,0 +1,619 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/MorZLE/auth/internal/domain/models"
+	"github.com/MorZLE/auth/internal/service"
+	"github.com/MorZLE/auth/internal/storage"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Storage методы хранилища, поведение которых должно совпадать во всех реализациях
+type Storage interface {
+	service.UserSaver
+	service.UserProvider
+	service.AppProvider
+	service.AdminProvider
+	service.RoleProvider
+	service.TokenProvider
+}
+
+// Run проверяет реализацию хранилища на общем наборе сценариев. s должна быть пустой базой
+// с применёнными миграциями
+func Run(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	appID, err := s.AddApp(ctx, "conformance", "conformance secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	otherID, err := s.AddApp(ctx, "conformance other", "conformance other secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+
+	t.Run("apps", func(t *testing.T) { testApps(ctx, t, s, appID) })
+	t.Run("users", func(t *testing.T) { testUsers(ctx, t, s, appID, otherID) })
+	t.Run("admins", func(t *testing.T) { testAdmins(ctx, t, s) })
+	t.Run("access", func(t *testing.T) { testAccess(ctx, t, s, appID, otherID) })
+	t.Run("roles", func(t *testing.T) { testRoles(ctx, t, s, appID, otherID) })
+	t.Run("app_lifecycle", func(t *testing.T) { testAppLifecycle(ctx, t, s) })
+	t.Run("delete_app_cascade", func(t *testing.T) { testDeleteAppCascade(ctx, t, s) })
+}
+
+func testApps(ctx context.Context, t *testing.T, s Storage, appID int32) {
+	got, err := s.App(ctx, appID)
+	if err != nil {
+		t.Fatalf("App() cerror = %v", err)
+	}
+	want := models.App{ID: int64(appID), Name: "conformance", Secret: "conformance secret", Alg: "HS256"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("App() got = %+v, want %+v", got, want)
+	}
+
+	if _, err := s.AddApp(ctx, "conformance", "other secret", "HS256"); !errors.Is(err, storage.ErrUniqueApp) {
+		t.Errorf("AddApp() duplicate name cerror = %v, want %v", err, storage.ErrUniqueApp)
+	}
+	if _, err := s.AddApp(ctx, "conformance same secret", "conformance secret", "HS256"); err != nil {
+		t.Errorf("AddApp() duplicate secret cerror = %v", err)
+	}
+	if _, err := s.App(ctx, appID+1000); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("App() unknown cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+
+	if err := s.SetAppRequireVerified(ctx, appID, true); err != nil {
+		t.Fatalf("SetAppRequireVerified() cerror = %v", err)
+	}
+	if err := s.SetAppWebAuthn(ctx, appID, "example.com", []string{"https://example.com", "https://app.example.com"}); err != nil {
+		t.Fatalf("SetAppWebAuthn() cerror = %v", err)
+	}
+	got, err = s.App(ctx, appID)
+	if err != nil {
+		t.Fatalf("App() cerror = %v", err)
+	}
+	if !got.RequireVerified || got.RPID != "example.com" ||
+		!reflect.DeepEqual(got.RPOrigins, []string{"https://example.com", "https://app.example.com"}) {
+		t.Errorf("App() after update got = %+v", got)
+	}
+
+	if err := s.SetAppRequireVerified(ctx, appID+1000, true); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("SetAppRequireVerified() unknown cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+	if err := s.SetAppWebAuthn(ctx, appID+1000, "", nil); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("SetAppWebAuthn() unknown cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+}
+
+func testUsers(ctx context.Context, t *testing.T, s Storage, appID int32, otherID int32) {
+	uid, err := s.SaveUser(ctx, "conformance_user", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if _, err := s.SaveUser(ctx, "conformance_user", []byte("hash"), appID); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("SaveUser() duplicate cerror = %v, want %v", err, storage.ErrUserExists)
+	}
+
+	user, err := s.User(ctx, "conformance_user", appID)
+	if err != nil {
+		t.Fatalf("User() cerror = %v", err)
+	}
+	if user.ID != uid || user.Login != "conformance_user" || string(user.PassHash) != "hash" || user.EmailVerified {
+		t.Errorf("User() got = %+v", user)
+	}
+	if _, err := s.User(ctx, "unknown", appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("User() unknown cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	// логин уникален только в пределах приложения
+	if _, err := s.User(ctx, "conformance_user", otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("User() other app cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	otherUID, err := s.SaveUser(ctx, "conformance_user", []byte("other hash"), otherID)
+	if err != nil {
+		t.Fatalf("SaveUser() other app cerror = %v", err)
+	}
+	other, err := s.User(ctx, "conformance_user", otherID)
+	if err != nil {
+		t.Fatalf("User() other app cerror = %v", err)
+	}
+	if other.ID != otherUID || other.ID == uid || string(other.PassHash) != "other hash" {
+		t.Errorf("User() other app got = %+v", other)
+	}
+
+	if err := s.UpdatePassword(ctx, uid, []byte("new hash")); err != nil {
+		t.Fatalf("UpdatePassword() cerror = %v", err)
+	}
+	user, err = s.UserByID(ctx, uid)
+	if err != nil {
+		t.Fatalf("UserByID() cerror = %v", err)
+	}
+	if user.Login != "conformance_user" || string(user.PassHash) != "new hash" {
+		t.Errorf("UserByID() got = %+v", user)
+	}
+
+	if _, err := s.UserByID(ctx, uid+1000); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("UserByID() unknown cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if err := s.UpdatePassword(ctx, uid+1000, []byte("hash")); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("UpdatePassword() unknown cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+}
+
+// testAdmins работает со своими приложениями: роли admin_lvl_N, которые создаёт CreateAdmin, не должны
+// попадать в списки ролей остальных сценариев
+func testAdmins(ctx context.Context, t *testing.T, s Storage) {
+	appID, err := s.AddApp(ctx, "admins", "admins secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	otherID, err := s.AddApp(ctx, "admins other", "admins other secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+
+	uid, err := s.SaveUser(ctx, "conformance_admin", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+
+	if _, err := s.CreateAdmin(ctx, "conformance_admin", 2, otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("CreateAdmin() user of other app cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	otherUID, err := s.SaveUser(ctx, "conformance_admin", []byte("hash"), otherID)
+	if err != nil {
+		t.Fatalf("SaveUser() other app cerror = %v", err)
+	}
+	if _, err := s.CreateAdmin(ctx, "conformance_admin", 3, otherID); err != nil {
+		t.Fatalf("CreateAdmin() other app cerror = %v", err)
+	}
+
+	if _, err := s.IsAdmin(ctx, uid, appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("IsAdmin() before create cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	id, err := s.CreateAdmin(ctx, "conformance_admin", 2, appID)
+	if err != nil {
+		t.Fatalf("CreateAdmin() cerror = %v", err)
+	}
+	admin, err := s.IsAdmin(ctx, uid, appID)
+	if err != nil {
+		t.Fatalf("IsAdmin() cerror = %v", err)
+	}
+	if admin.Id != id || admin.UserID != uid || admin.Lvl != 2 || admin.AppID != appID {
+		t.Errorf("IsAdmin() got = %+v", admin)
+	}
+	// вместе с записью в admins назначается роль admin_lvl_N с разрешением admin
+	roles, err := s.UserRoles(ctx, uid, appID)
+	if err != nil {
+		t.Fatalf("UserRoles() cerror = %v", err)
+	}
+	if len(roles) != 1 || roles[0].Name != storage.AdminRole(2) ||
+		!reflect.DeepEqual(roles[0].Permissions, []string{storage.AdminPermission}) {
+		t.Errorf("UserRoles() admin got = %+v", roles)
+	}
+
+	if _, err := s.CreateAdmin(ctx, "unknown", 2, appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("CreateAdmin() unknown cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	if ok, err := s.DeleteAdmin(ctx, "conformance_admin", appID); err != nil || !ok {
+		t.Fatalf("DeleteAdmin() got = %v, cerror = %v", ok, err)
+	}
+	if _, err := s.IsAdmin(ctx, uid, appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("IsAdmin() after delete cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if roles, err := s.UserRoles(ctx, uid, appID); err != nil || len(roles) != 0 {
+		t.Errorf("UserRoles() after delete got = %+v, cerror = %v", roles, err)
+	}
+	if roles, err := s.UserRoles(ctx, otherUID, otherID); err != nil || len(roles) != 1 || roles[0].Name != storage.AdminRole(3) {
+		t.Errorf("UserRoles() other app after delete got = %+v, cerror = %v", roles, err)
+	}
+	if admin, err := s.IsAdmin(ctx, otherUID, otherID); err != nil || admin.Lvl != 3 {
+		t.Errorf("IsAdmin() other app after delete got = %+v, cerror = %v", admin, err)
+	}
+}
+
+func testAccess(ctx context.Context, t *testing.T, s Storage, appID int32, otherID int32) {
+	uid, err := s.SaveUser(ctx, "conformance_shared", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if ok, err := s.HasAppAccess(ctx, uid, appID); err != nil || !ok {
+		t.Errorf("HasAppAccess() own app got = %v, cerror = %v", ok, err)
+	}
+	if ok, err := s.HasAppAccess(ctx, uid, otherID); err != nil || ok {
+		t.Errorf("HasAppAccess() before grant got = %v, cerror = %v", ok, err)
+	}
+
+	if err := s.GrantAppAccess(ctx, uid, otherID); err != nil {
+		t.Fatalf("GrantAppAccess() cerror = %v", err)
+	}
+	if err := s.GrantAppAccess(ctx, uid, otherID); err != nil {
+		t.Errorf("GrantAppAccess() repeated cerror = %v", err)
+	}
+	user, err := s.User(ctx, "conformance_shared", otherID)
+	if err != nil {
+		t.Fatalf("User() granted app cerror = %v", err)
+	}
+	if user.ID != uid || string(user.PassHash) != "hash" {
+		t.Errorf("User() granted app got = %+v", user)
+	}
+	if _, err := s.SaveUser(ctx, "conformance_shared", []byte("hash"), otherID); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("SaveUser() login of granted user cerror = %v, want %v", err, storage.ErrUserExists)
+	}
+	if _, err := s.CreateAdmin(ctx, "conformance_shared", 2, otherID); err != nil {
+		t.Fatalf("CreateAdmin() granted app cerror = %v", err)
+	}
+
+	// логин conformance_user уже занят другим пользователем второго приложения
+	own, err := s.User(ctx, "conformance_user", appID)
+	if err != nil {
+		t.Fatalf("User() cerror = %v", err)
+	}
+	if err := s.GrantAppAccess(ctx, own.ID, otherID); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("GrantAppAccess() taken login cerror = %v, want %v", err, storage.ErrUserExists)
+	}
+	if err := s.GrantAppAccess(ctx, uid, otherID+1000); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("GrantAppAccess() unknown app cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+	if err := s.GrantAppAccess(ctx, uid+1000, otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("GrantAppAccess() unknown user cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	if err := s.RevokeAppAccess(ctx, uid, otherID); err != nil {
+		t.Fatalf("RevokeAppAccess() cerror = %v", err)
+	}
+	if ok, err := s.HasAppAccess(ctx, uid, otherID); err != nil || ok {
+		t.Errorf("HasAppAccess() after revoke got = %v, cerror = %v", ok, err)
+	}
+	if _, err := s.User(ctx, "conformance_shared", otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("User() after revoke cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if _, err := s.IsAdmin(ctx, uid, otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("IsAdmin() after revoke cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if err := s.RevokeAppAccess(ctx, uid, otherID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("RevokeAppAccess() repeated cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if _, err := s.User(ctx, "conformance_shared", appID); err != nil {
+		t.Errorf("User() own app after revoke cerror = %v", err)
+	}
+}
+
+func testRoles(ctx context.Context, t *testing.T, s Storage, appID int32, otherID int32) {
+	uid, err := s.SaveUser(ctx, "conformance_roles", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+
+	editorID, err := s.SaveRole(ctx, models.Role{AppID: appID, Name: "editor",
+		Permissions: []string{"posts:write", "posts:read", "posts:write"}})
+	if err != nil {
+		t.Fatalf("SaveRole() cerror = %v", err)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: appID, Name: "viewer"}); err != nil {
+		t.Fatalf("SaveRole() without permissions cerror = %v", err)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: appID, Name: "editor"}); !errors.Is(err, storage.ErrRoleExists) {
+		t.Errorf("SaveRole() duplicate cerror = %v, want %v", err, storage.ErrRoleExists)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: otherID, Name: "editor"}); err != nil {
+		t.Errorf("SaveRole() same name in other app cerror = %v", err)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: otherID + 1000, Name: "editor"}); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("SaveRole() unknown app cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+
+	roles, err := s.Roles(ctx, appID)
+	if err != nil {
+		t.Fatalf("Roles() cerror = %v", err)
+	}
+	if len(roles) != 2 || roles[0].ID != editorID || roles[0].Name != "editor" || roles[0].AppID != appID ||
+		!reflect.DeepEqual(roles[0].Permissions, []string{"posts:read", "posts:write"}) ||
+		roles[1].Name != "viewer" || len(roles[1].Permissions) != 0 {
+		t.Errorf("Roles() got = %+v", roles)
+	}
+
+	if err := s.AssignRole(ctx, uid, appID, "editor"); err != nil {
+		t.Fatalf("AssignRole() cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, uid, appID, "editor"); err != nil {
+		t.Errorf("AssignRole() repeated cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, uid, appID, "unknown"); !errors.Is(err, storage.ErrRoleNotFound) {
+		t.Errorf("AssignRole() unknown role cerror = %v, want %v", err, storage.ErrRoleNotFound)
+	}
+	if err := s.AssignRole(ctx, uid, otherID, "editor"); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("AssignRole() app without access cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	got, err := s.UserRoles(ctx, uid, appID)
+	if err != nil {
+		t.Fatalf("UserRoles() cerror = %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "editor" || len(got[0].Permissions) != 2 {
+		t.Errorf("UserRoles() got = %+v", got)
+	}
+	if got, err := s.UserRoles(ctx, uid, otherID); err != nil || len(got) != 0 {
+		t.Errorf("UserRoles() other app got = %+v, cerror = %v", got, err)
+	}
+
+	if err := s.UnassignRole(ctx, uid, appID, "editor"); err != nil {
+		t.Fatalf("UnassignRole() cerror = %v", err)
+	}
+	if err := s.UnassignRole(ctx, uid, appID, "editor"); !errors.Is(err, storage.ErrRoleNotFound) {
+		t.Errorf("UnassignRole() repeated cerror = %v, want %v", err, storage.ErrRoleNotFound)
+	}
+
+	// отзыв доступа к приложению снимает роли в нём
+	if err := s.GrantAppAccess(ctx, uid, otherID); err != nil {
+		t.Fatalf("GrantAppAccess() cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, uid, otherID, "editor"); err != nil {
+		t.Fatalf("AssignRole() granted app cerror = %v", err)
+	}
+	if err := s.RevokeAppAccess(ctx, uid, otherID); err != nil {
+		t.Fatalf("RevokeAppAccess() cerror = %v", err)
+	}
+	if got, err := s.UserRoles(ctx, uid, otherID); err != nil || len(got) != 0 {
+		t.Errorf("UserRoles() after revoke got = %+v, cerror = %v", got, err)
+	}
+
+	if err := s.AssignRole(ctx, uid, appID, "viewer"); err != nil {
+		t.Fatalf("AssignRole() cerror = %v", err)
+	}
+	if err := s.DeleteRole(ctx, appID, "viewer"); err != nil {
+		t.Fatalf("DeleteRole() cerror = %v", err)
+	}
+	if err := s.DeleteRole(ctx, appID, "viewer"); !errors.Is(err, storage.ErrRoleNotFound) {
+		t.Errorf("DeleteRole() repeated cerror = %v, want %v", err, storage.ErrRoleNotFound)
+	}
+	if got, err := s.UserRoles(ctx, uid, appID); err != nil || len(got) != 0 {
+		t.Errorf("UserRoles() after delete got = %+v, cerror = %v", got, err)
+	}
+	if roles, err := s.Roles(ctx, appID); err != nil || len(roles) != 1 {
+		t.Errorf("Roles() after delete got = %+v, cerror = %v", roles, err)
+	}
+}
+
+func testAppLifecycle(ctx context.Context, t *testing.T, s Storage) {
+	appID, err := s.AddApp(ctx, "lifecycle", "lifecycle secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	otherID, err := s.AddApp(ctx, "lifecycle other", "lifecycle other secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+
+	apps, err := s.Apps(ctx)
+	if err != nil {
+		t.Fatalf("Apps() cerror = %v", err)
+	}
+	if len(apps) < 2 || apps[len(apps)-2].ID != int64(appID) || apps[len(apps)-1].Name != "lifecycle other" {
+		t.Errorf("Apps() got = %+v", apps)
+	}
+
+	if err := s.UpdateApp(ctx, appID, "lifecycle renamed"); err != nil {
+		t.Fatalf("UpdateApp() cerror = %v", err)
+	}
+	if err := s.UpdateApp(ctx, appID, "lifecycle other"); !errors.Is(err, storage.ErrUniqueApp) {
+		t.Errorf("UpdateApp() taken name cerror = %v, want %v", err, storage.ErrUniqueApp)
+	}
+	if err := s.SetAppDisabled(ctx, appID, true); err != nil {
+		t.Fatalf("SetAppDisabled() cerror = %v", err)
+	}
+	if err := s.SetAppSecret(ctx, appID, "lifecycle new secret"); err != nil {
+		t.Fatalf("SetAppSecret() cerror = %v", err)
+	}
+	got, err := s.App(ctx, appID)
+	if err != nil {
+		t.Fatalf("App() cerror = %v", err)
+	}
+	if got.Name != "lifecycle renamed" || !got.Disabled || got.Secret != "lifecycle new secret" {
+		t.Errorf("App() after update got = %+v", got)
+	}
+
+	settings := models.AppSettings{
+		AccessTTL:          15 * time.Minute,
+		RefreshTTL:         48 * time.Hour,
+		RegistrationClosed: true,
+		RequireMFA:         true,
+		LoginMethods:       []string{models.LoginPassword, models.LoginWebAuthn},
+		Claims:             map[string]string{"tenant": "acme", "plan": "pro"},
+		PasswordPolicy:     &models.PasswordRules{MinLength: 12, MaxLength: 64, RequireDigit: true, ForbidLogin: true},
+	}
+	if err := s.SetAppSettings(ctx, appID, settings); err != nil {
+		t.Fatalf("SetAppSettings() cerror = %v", err)
+	}
+	if got, err = s.App(ctx, appID); err != nil || !reflect.DeepEqual(got.Settings, settings) {
+		t.Errorf("App() settings got = %+v, cerror = %v, want %+v", got.Settings, err, settings)
+	}
+	if err := s.SetAppSettings(ctx, appID, models.AppSettings{}); err != nil {
+		t.Fatalf("SetAppSettings() reset cerror = %v", err)
+	}
+	if got, err = s.App(ctx, appID); err != nil || !reflect.DeepEqual(got.Settings, models.AppSettings{}) {
+		t.Errorf("App() reset settings got = %+v, cerror = %v", got.Settings, err)
+	}
+
+	for name, err := range map[string]error{
+		"UpdateApp":      s.UpdateApp(ctx, appID+1000, "unknown"),
+		"SetAppDisabled": s.SetAppDisabled(ctx, appID+1000, true),
+		"SetAppSecret":   s.SetAppSecret(ctx, appID+1000, "unknown secret"),
+		"SetAppSettings": s.SetAppSettings(ctx, appID+1000, settings),
+		"DeleteApp":      s.DeleteApp(ctx, appID+1000, true),
+	} {
+		if !errors.Is(err, storage.ErrAppNotFound) {
+			t.Errorf("%s() unknown cerror = %v, want %v", name, err, storage.ErrAppNotFound)
+		}
+	}
+
+	onlyID, err := s.SaveUser(ctx, "lifecycle_only", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	sharedID, err := s.SaveUser(ctx, "lifecycle_shared", []byte("hash"), appID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if err := s.GrantAppAccess(ctx, sharedID, otherID); err != nil {
+		t.Fatalf("GrantAppAccess() cerror = %v", err)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: appID, Name: "editor", Permissions: []string{"posts:write"}}); err != nil {
+		t.Fatalf("SaveRole() cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, sharedID, appID, "editor"); err != nil {
+		t.Fatalf("AssignRole() cerror = %v", err)
+	}
+	if _, err := s.CreateAdmin(ctx, "lifecycle_only", 1, appID); err != nil {
+		t.Fatalf("CreateAdmin() cerror = %v", err)
+	}
+
+	if err := s.DeleteApp(ctx, appID, false); !errors.Is(err, storage.ErrAppHasUsers) {
+		t.Fatalf("DeleteApp() with users cerror = %v, want %v", err, storage.ErrAppHasUsers)
+	}
+	if _, err := s.App(ctx, appID); err != nil {
+		t.Fatalf("App() after blocked delete cerror = %v", err)
+	}
+
+	// cascade удаляет пользователей без других приложений и оставляет остальных в их приложениях
+	if err := s.DeleteApp(ctx, appID, true); err != nil {
+		t.Fatalf("DeleteApp() cascade cerror = %v", err)
+	}
+	if _, err := s.App(ctx, appID); !errors.Is(err, storage.ErrAppNotFound) {
+		t.Errorf("App() deleted cerror = %v, want %v", err, storage.ErrAppNotFound)
+	}
+	if _, err := s.UserByID(ctx, onlyID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("UserByID() app only user cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if u, err := s.User(ctx, "lifecycle_shared", otherID); err != nil || u.ID != sharedID {
+		t.Errorf("User() shared user got = %+v, cerror = %v", u, err)
+	}
+	if ok, err := s.HasAppAccess(ctx, sharedID, appID); err != nil || ok {
+		t.Errorf("HasAppAccess() deleted app got = %v, cerror = %v", ok, err)
+	}
+	if roles, err := s.Roles(ctx, appID); err != nil || len(roles) != 0 {
+		t.Errorf("Roles() deleted app got = %+v, cerror = %v", roles, err)
+	}
+
+	if err := s.DeleteApp(ctx, otherID, false); !errors.Is(err, storage.ErrAppHasUsers) {
+		t.Errorf("DeleteApp() app of moved user cerror = %v, want %v", err, storage.ErrAppHasUsers)
+	}
+	// пользователь остаётся пользователем своего приложения и после отзыва доступа к нему
+	if err := s.RevokeAppAccess(ctx, sharedID, otherID); err != nil {
+		t.Fatalf("RevokeAppAccess() cerror = %v", err)
+	}
+	if err := s.DeleteApp(ctx, otherID, false); !errors.Is(err, storage.ErrAppHasUsers) {
+		t.Errorf("DeleteApp() home app after revoke cerror = %v, want %v", err, storage.ErrAppHasUsers)
+	}
+	if err := s.DeleteApp(ctx, otherID, true); err != nil {
+		t.Fatalf("DeleteApp() cascade cerror = %v", err)
+	}
+	if _, err := s.UserByID(ctx, sharedID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("UserByID() user without apps cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+
+	emptyID, err := s.AddApp(ctx, "lifecycle empty", "lifecycle empty secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if err := s.DeleteApp(ctx, emptyID, false); err != nil {
+		t.Errorf("DeleteApp() without users cerror = %v", err)
+	}
+}
+
+// testDeleteAppCascade проверяет, что после удаления приложения от него не остаётся зависимых данных,
+// а данные пользователя в других приложениях не затрагиваются
+func testDeleteAppCascade(ctx context.Context, t *testing.T, s Storage) {
+	appID, err := s.AddApp(ctx, "cascade", "cascade secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	otherID, err := s.AddApp(ctx, "cascade other", "cascade other secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if err := s.SetAppSettings(ctx, appID, models.AppSettings{RequireMFA: true, Claims: map[string]string{"tenant": "acme"}}); err != nil {
+		t.Fatalf("SetAppSettings() cerror = %v", err)
+	}
+
+	uid, err := s.SaveUser(ctx, "cascade_shared", []byte("hash"), otherID)
+	if err != nil {
+		t.Fatalf("SaveUser() cerror = %v", err)
+	}
+	if err := s.GrantAppAccess(ctx, uid, appID); err != nil {
+		t.Fatalf("GrantAppAccess() cerror = %v", err)
+	}
+	if _, err := s.CreateAdmin(ctx, "cascade_shared", 2, appID); err != nil {
+		t.Fatalf("CreateAdmin() cerror = %v", err)
+	}
+	if _, err := s.CreateAdmin(ctx, "cascade_shared", 1, otherID); err != nil {
+		t.Fatalf("CreateAdmin() other app cerror = %v", err)
+	}
+	if _, err := s.SaveRole(ctx, models.Role{AppID: appID, Name: "editor", Permissions: []string{"posts:write"}}); err != nil {
+		t.Fatalf("SaveRole() cerror = %v", err)
+	}
+	if err := s.AssignRole(ctx, uid, appID, "editor"); err != nil {
+		t.Fatalf("AssignRole() cerror = %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	if _, err := s.SaveRefreshToken(ctx, models.RefreshToken{TokenHash: "cascade hash", UserID: uid, AppID: appID,
+		FamilyID: "cascade family", ExpiresAt: expires}); err != nil {
+		t.Fatalf("SaveRefreshToken() cerror = %v", err)
+	}
+	if _, err := s.SaveRefreshToken(ctx, models.RefreshToken{TokenHash: "cascade other hash", UserID: uid, AppID: otherID,
+		FamilyID: "cascade other family", ExpiresAt: expires}); err != nil {
+		t.Fatalf("SaveRefreshToken() other app cerror = %v", err)
+	}
+
+	if err := s.DeleteApp(ctx, appID, true); err != nil {
+		t.Fatalf("DeleteApp() cerror = %v", err)
+	}
+
+	if ok, err := s.HasAppAccess(ctx, uid, appID); err != nil || ok {
+		t.Errorf("HasAppAccess() deleted app got = %v, cerror = %v", ok, err)
+	}
+	if _, err := s.User(ctx, "cascade_shared", appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("User() deleted app cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if _, err := s.IsAdmin(ctx, uid, appID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("IsAdmin() deleted app cerror = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	if roles, err := s.Roles(ctx, appID); err != nil || len(roles) != 0 {
+		t.Errorf("Roles() deleted app got = %+v, cerror = %v", roles, err)
+	}
+	if roles, err := s.UserRoles(ctx, uid, appID); err != nil || len(roles) != 0 {
+		t.Errorf("UserRoles() deleted app got = %+v, cerror = %v", roles, err)
+	}
+	if _, err := s.RefreshToken(ctx, "cascade hash"); !errors.Is(err, storage.ErrTokenNotFound) {
+		t.Errorf("RefreshToken() deleted app cerror = %v, want %v", err, storage.ErrTokenNotFound)
+	}
+
+	if u, err := s.User(ctx, "cascade_shared", otherID); err != nil || u.ID != uid {
+		t.Errorf("User() other app got = %+v, cerror = %v", u, err)
+	}
+	if admin, err := s.IsAdmin(ctx, uid, otherID); err != nil || admin.Lvl != 1 {
+		t.Errorf("IsAdmin() other app got = %+v, cerror = %v", admin, err)
+	}
+	if roles, err := s.UserRoles(ctx, uid, otherID); err != nil || len(roles) != 1 || roles[0].Name != storage.AdminRole(1) {
+		t.Errorf("UserRoles() other app got = %+v, cerror = %v", roles, err)
+	}
+	if tok, err := s.RefreshToken(ctx, "cascade other hash"); err != nil || tok.AppID != otherID {
+		t.Errorf("RefreshToken() other app got = %+v, cerror = %v", tok, err)
+	}
+
+	// приложение, созданное после удаления, не получает ни настроек, ни ролей удалённого, даже если id совпал
+	newID, err := s.AddApp(ctx, "cascade new", "cascade new secret", "HS256")
+	if err != nil {
+		t.Fatalf("AddApp() cerror = %v", err)
+	}
+	if got, err := s.App(ctx, newID); err != nil || !reflect.DeepEqual(got.Settings, models.AppSettings{}) {
+		t.Errorf("App() new app settings got = %+v, cerror = %v", got.Settings, err)
+	}
+	if roles, err := s.Roles(ctx, newID); err != nil || len(roles) != 0 {
+		t.Errorf("Roles() new app got = %+v, cerror = %v", roles, err)
+	}
+}
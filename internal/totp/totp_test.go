@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// секрет из RFC 6238, приложение B: ASCII "12345678901234567890"
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	// ожидаемые значения RFC 6238 для SHA1, последние 6 цифр 8-значных кодов
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() cerror = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	prev, _ := Code(rfcSecret, step-1)
+	if got, ok := Validate(rfcSecret, prev, now); !ok || got != step-1 {
+		t.Errorf("Validate() previous step got = %d, %v", got, ok)
+	}
+
+	old, _ := Code(rfcSecret, step-2)
+	if _, ok := Validate(rfcSecret, old, now); ok {
+		t.Error("Validate() accepted code outside skew")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Error("Validate() accepted short code")
+	}
+}
+
+func TestGenerateSecret_URI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() cerror = %v", err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code() with generated secret cerror = %v", err)
+	}
+
+	u, err := url.Parse(URI("My App", "user@example.com", secret))
+	if err != nil {
+		t.Fatalf("URI() is not a valid url: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || !strings.HasPrefix(u.Path, "/My App:user@example.com") {
+		t.Errorf("URI() = %s", u)
+	}
+	if u.Query().Get("secret") != secret || u.Query().Get("issuer") != "My App" {
+		t.Errorf("URI() query = %v", u.Query())
+	}
+}
@@ -0,0 +1,28 @@
+create table if not exists user_mfa (
+    user_id   INTEGER primary key,
+    secret    text    not null,
+    enabled   INTEGER not null default 0,
+    last_step INTEGER not null default 0,
+    foreign key(user_id) references users(id)
+);
+
+create table if not exists mfa_recovery_codes (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id   INTEGER not null,
+    code_hash text    not null,
+    used      INTEGER not null default 0,
+    unique(user_id, code_hash),
+    foreign key(user_id) references users(id)
+);
+
+create table if not exists mfa_challenges (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash text    not null unique,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    expires_at INTEGER not null,
+    attempts   INTEGER not null default 0,
+    used       INTEGER not null default 0,
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
@@ -0,0 +1,5 @@
+drop table if exists webauthn_sessions;
+drop index if exists idx_webauthn_credentials_user;
+drop table if exists webauthn_credentials;
+alter table apps drop column rp_origins;
+alter table apps drop column rp_id;
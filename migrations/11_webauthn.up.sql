@@ -0,0 +1,31 @@
+alter table apps add column rp_id text not null default '';
+alter table apps add column rp_origins text not null default '';
+
+create table if not exists webauthn_credentials (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id          INTEGER not null,
+    credential_id    BLOB    not null unique,
+    public_key       BLOB    not null,
+    attestation_type text    not null default '',
+    aaguid           BLOB,
+    sign_count       INTEGER not null default 0,
+    transports       text    not null default '',
+    backup_eligible  INTEGER not null default 0,
+    backup_state     INTEGER not null default 0,
+    created_at       INTEGER not null,
+    foreign key(user_id) references users(id)
+);
+create index if not exists idx_webauthn_credentials_user on webauthn_credentials (user_id);
+
+create table if not exists webauthn_sessions (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash text    not null unique,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    kind       text    not null,
+    data       BLOB    not null,
+    expires_at INTEGER not null,
+    used       INTEGER not null default 0,
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
@@ -0,0 +1,17 @@
+-- откат невозможен, если один логин уже зарегистрирован в нескольких приложениях
+create table users_old (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    login          text    not null unique,
+    passHash       blob    not null,
+    app_id         INTEGER not null,
+    email_verified INTEGER not null default 0,
+    foreign key(app_id) references apps(id)
+);
+
+insert into users_old (id, login, passHash, app_id, email_verified)
+select id, login, passHash, app_id, email_verified from users;
+
+drop table users;
+alter table users_old rename to users;
+
+create index if not exists idx_login on users(login);
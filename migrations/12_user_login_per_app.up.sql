@@ -0,0 +1,16 @@
+-- логин уникален в пределах приложения. sqlite не умеет снимать ограничение, поэтому таблица пересоздаётся
+create table users_new (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    login          text    not null,
+    passHash       blob    not null,
+    app_id         INTEGER not null,
+    email_verified INTEGER not null default 0,
+    unique(login, app_id),
+    foreign key(app_id) references apps(id)
+);
+
+insert into users_new (id, login, passHash, app_id, email_verified)
+select id, login, passHash, app_id, email_verified from users;
+
+drop table users;
+alter table users_new rename to users;
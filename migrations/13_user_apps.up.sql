@@ -0,0 +1,15 @@
+-- членство пользователя в приложениях. login повторяет users.login, чтобы логин оставался уникальным
+-- среди всех пользователей, которым доступно приложение, а не только зарегистрированных в нём
+create table if not exists user_apps (
+    user_id INTEGER not null,
+    app_id  INTEGER not null,
+    login   text    not null,
+    primary key(user_id, app_id),
+    unique(app_id, login),
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
+
+-- существующие пользователи получают доступ к приложению, в котором зарегистрированы
+insert into user_apps (user_id, app_id, login)
+select id, app_id, login from users;
@@ -0,0 +1,33 @@
+-- роли и разрешения задаются для каждого приложения отдельно
+create table if not exists roles (
+    id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_id INTEGER not null,
+    name   text    not null,
+    unique(app_id, name),
+    foreign key(app_id) references apps(id)
+);
+
+create table if not exists role_permissions (
+    role_id    INTEGER not null,
+    permission text    not null,
+    primary key(role_id, permission),
+    foreign key(role_id) references roles(id)
+);
+
+create table if not exists user_roles (
+    user_id INTEGER not null,
+    role_id INTEGER not null,
+    primary key(user_id, role_id),
+    foreign key(user_id) references users(id),
+    foreign key(role_id) references roles(id)
+);
+
+-- каждый уровень администратора становится ролью admin_lvl_N с разрешением admin
+insert into roles (app_id, name)
+select distinct app_id, 'admin_lvl_' || lvl from admins;
+
+insert into role_permissions (role_id, permission)
+select id, 'admin' from roles where name like 'admin\_lvl\_%' escape '\';
+
+insert or ignore into user_roles (user_id, role_id)
+select a.user_id, r.id from admins a join roles r on r.app_id = a.app_id and r.name = 'admin_lvl_' || a.lvl;
@@ -0,0 +1 @@
+alter table apps drop column disabled;
@@ -0,0 +1,2 @@
+-- выключенное приложение не принимает вход и не выпускает токены
+alter table apps add column disabled INTEGER not null default 0;
@@ -0,0 +1,17 @@
+-- откат невозможен, если у нескольких приложений одинаковый секрет
+create table apps_old (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    name             text    not null unique,
+    secret           text    not null unique,
+    alg              text    not null default 'HS256',
+    require_verified INTEGER not null default 0,
+    rp_id            text    not null default '',
+    rp_origins       text    not null default '',
+    disabled         INTEGER not null default 0
+);
+
+insert into apps_old (id, name, secret, alg, require_verified, rp_id, rp_origins, disabled)
+select id, name, secret, alg, require_verified, rp_id, rp_origins, disabled from apps;
+
+drop table apps;
+alter table apps_old rename to apps;
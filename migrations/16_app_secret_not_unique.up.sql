@@ -0,0 +1,18 @@
+-- секреты хранятся зашифрованными, а уникальность секрета выдавала чужие секреты через ошибку AddApp.
+-- sqlite не умеет снимать ограничение, поэтому таблица пересоздаётся
+create table apps_new (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    name             text    not null unique,
+    secret           text    not null,
+    alg              text    not null default 'HS256',
+    require_verified INTEGER not null default 0,
+    rp_id            text    not null default '',
+    rp_origins       text    not null default '',
+    disabled         INTEGER not null default 0
+);
+
+insert into apps_new (id, name, secret, alg, require_verified, rp_id, rp_origins, disabled)
+select id, name, secret, alg, require_verified, rp_id, rp_origins, disabled from apps;
+
+drop table apps;
+alter table apps_new rename to apps;
@@ -0,0 +1,8 @@
+-- настройки приложения. TTL в секундах, 0 означает значение из конфига сервиса,
+-- login_methods через запятую, пустой список разрешает все способы входа, claims объект JSON
+alter table apps add column access_ttl INTEGER not null default 0;
+alter table apps add column refresh_ttl INTEGER not null default 0;
+alter table apps add column registration_closed INTEGER not null default 0;
+alter table apps add column require_mfa INTEGER not null default 0;
+alter table apps add column login_methods text not null default '';
+alter table apps add column claims text not null default '';
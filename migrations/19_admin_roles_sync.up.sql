@@ -0,0 +1,15 @@
+-- CreateAdmin и DeleteAdmin до этой миграции не трогали роли admin_lvl_N: роли получают администраторы,
+-- созданные после 14_roles, и теряют снятые с тех пор
+insert or ignore into roles (app_id, name)
+select distinct app_id, 'admin_lvl_' || lvl from admins;
+
+insert or ignore into role_permissions (role_id, permission)
+select distinct r.id, 'admin' from roles r join admins a on r.app_id = a.app_id and r.name = 'admin_lvl_' || a.lvl;
+
+insert or ignore into user_roles (user_id, role_id)
+select a.user_id, r.id from admins a join roles r on r.app_id = a.app_id and r.name = 'admin_lvl_' || a.lvl;
+
+delete from user_roles
+where role_id in (select id from roles where name like 'admin\_lvl\_%' escape '\')
+  and not exists (select 1 from admins a join roles r on r.app_id = a.app_id and r.name = 'admin_lvl_' || a.lvl
+                  where a.user_id = user_roles.user_id and r.id = user_roles.role_id);
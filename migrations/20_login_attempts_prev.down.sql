@@ -0,0 +1 @@
+alter table login_attempts drop column prev_failure;
@@ -0,0 +1,2 @@
+-- требования к паролю приложения объектом JSON, пустая строка оставляет password_policy из конфига
+alter table apps add column password_policy text not null default '';
@@ -0,0 +1,14 @@
+create table if not exists refresh_tokens (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash text    not null unique,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    family_id  text    not null,
+    expires_at INTEGER not null,
+    used       INTEGER not null default 0,
+    revoked    INTEGER not null default 0,
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
+
+create index if not exists idx_refresh_family on refresh_tokens(family_id);
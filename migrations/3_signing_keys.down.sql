@@ -0,0 +1,2 @@
+drop table if exists signing_keys;
+alter table apps drop column alg;
\ No newline at end of file
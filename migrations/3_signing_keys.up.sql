@@ -0,0 +1,14 @@
+alter table apps add column alg text not null default 'HS256';
+
+create table if not exists signing_keys (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    kid         text    not null unique,
+    app_id      INTEGER not null,
+    alg         text    not null,
+    private_key blob    not null,
+    public_key  blob    not null,
+    created_at  INTEGER not null,
+    foreign key(app_id) references apps(id)
+);
+
+create index if not exists idx_signing_keys_app on signing_keys(app_id, alg);
@@ -0,0 +1,4 @@
+drop index if exists idx_signing_keys_status;
+alter table signing_keys drop column retired_at;
+alter table signing_keys drop column activated_at;
+alter table signing_keys drop column status;
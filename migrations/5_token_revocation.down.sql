@@ -0,0 +1,4 @@
+drop index if exists idx_refresh_user;
+drop table if exists user_revocations;
+drop index if exists idx_revoked_tokens_expires;
+drop table if exists revoked_tokens;
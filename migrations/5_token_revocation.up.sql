@@ -0,0 +1,17 @@
+create table if not exists revoked_tokens (
+    jti        text    primary key,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    expires_at INTEGER not null
+);
+
+create index if not exists idx_revoked_tokens_expires on revoked_tokens(expires_at);
+
+-- токены пользователя, выданные не позже revoked_at, считаются отозванными
+create table if not exists user_revocations (
+    user_id    INTEGER primary key,
+    revoked_at INTEGER not null,
+    expires_at INTEGER not null
+);
+
+create index if not exists idx_refresh_user on refresh_tokens(user_id);
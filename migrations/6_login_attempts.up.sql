@@ -0,0 +1,6 @@
+create table if not exists login_attempts (
+    key          text    primary key,
+    failures     INTEGER not null default 0,
+    last_failure INTEGER not null default 0,
+    locked_until INTEGER not null default 0
+);
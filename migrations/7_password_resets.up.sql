@@ -0,0 +1,10 @@
+create table if not exists password_resets (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash text    not null unique,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    expires_at INTEGER not null,
+    used       INTEGER not null default 0,
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
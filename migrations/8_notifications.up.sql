@@ -0,0 +1,12 @@
+create table if not exists notifications (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipient       text    not null,
+    subject         text    not null,
+    body            text    not null,
+    attempts        INTEGER not null default 0,
+    next_attempt_at INTEGER not null,
+    last_error      text    not null default '',
+    failed          INTEGER not null default 0,
+    created_at      INTEGER not null
+);
+create index if not exists idx_notifications_due on notifications (failed, next_attempt_at);
@@ -0,0 +1,3 @@
+drop table if exists email_verifications;
+alter table apps drop column require_verified;
+alter table users drop column email_verified;
@@ -0,0 +1,16 @@
+alter table users add column email_verified INTEGER not null default 0;
+alter table apps add column require_verified INTEGER not null default 0;
+
+-- пользователи, зарегистрированные до появления подтверждения, считаются подтверждёнными
+update users set email_verified = 1;
+
+create table if not exists email_verifications (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash text    not null unique,
+    user_id    INTEGER not null,
+    app_id     INTEGER not null,
+    expires_at INTEGER not null,
+    used       INTEGER not null default 0,
+    foreign key(user_id) references users(id),
+    foreign key(app_id) references apps(id)
+);
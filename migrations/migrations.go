@@ -0,0 +1,14 @@
+// Package migrations встраивает sql миграции в бинарник, чтобы сервис и migrator не зависели от файлов рядом с ними
+package migrations
+
+import "embed"
+
+// SQLite миграции для sqlite
+//
+//go:embed *.sql
+var SQLite embed.FS
+
+// Postgres миграции для postgres, лежат в каталоге postgres
+//
+//go:embed postgres/*.sql
+var Postgres embed.FS
@@ -0,0 +1,24 @@
+create table if not exists user_mfa (
+    user_id   BIGINT  primary key references users(id),
+    secret    text    not null,
+    enabled   boolean not null default false,
+    last_step BIGINT  not null default 0
+);
+
+create table if not exists mfa_recovery_codes (
+    id        BIGSERIAL primary key,
+    user_id   BIGINT  not null references users(id),
+    code_hash text    not null,
+    used      boolean not null default false,
+    unique(user_id, code_hash)
+);
+
+create table if not exists mfa_challenges (
+    id         BIGSERIAL primary key,
+    token_hash text    not null unique,
+    user_id    BIGINT  not null references users(id),
+    app_id     INTEGER not null references apps(id),
+    expires_at BIGINT  not null,
+    attempts   INTEGER not null default 0,
+    used       boolean not null default false
+);
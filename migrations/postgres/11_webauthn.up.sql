@@ -0,0 +1,28 @@
+alter table apps add column rp_id text not null default '';
+alter table apps add column rp_origins text not null default '';
+
+create table if not exists webauthn_credentials (
+    id               BIGSERIAL primary key,
+    user_id          BIGINT  not null references users(id),
+    credential_id    bytea   not null unique,
+    public_key       bytea   not null,
+    attestation_type text    not null default '',
+    aaguid           bytea,
+    sign_count       BIGINT  not null default 0,
+    transports       text    not null default '',
+    backup_eligible  boolean not null default false,
+    backup_state     boolean not null default false,
+    created_at       BIGINT  not null
+);
+create index if not exists idx_webauthn_credentials_user on webauthn_credentials (user_id);
+
+create table if not exists webauthn_sessions (
+    id         BIGSERIAL primary key,
+    token_hash text    not null unique,
+    user_id    BIGINT  not null references users(id),
+    app_id     INTEGER not null references apps(id),
+    kind       text    not null,
+    data       bytea   not null,
+    expires_at BIGINT  not null,
+    used       boolean not null default false
+);
@@ -0,0 +1,3 @@
+-- откат невозможен, если один логин уже зарегистрирован в нескольких приложениях
+alter table users drop constraint users_login_app_id_key;
+alter table users add constraint users_login_key unique (login);
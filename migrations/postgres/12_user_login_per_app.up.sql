@@ -0,0 +1,3 @@
+-- логин уникален в пределах приложения
+alter table users drop constraint users_login_key;
+alter table users add constraint users_login_app_id_key unique (login, app_id);
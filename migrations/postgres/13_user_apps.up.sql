@@ -0,0 +1,13 @@
+-- членство пользователя в приложениях. login повторяет users.login, чтобы логин оставался уникальным
+-- среди всех пользователей, которым доступно приложение, а не только зарегистрированных в нём
+create table if not exists user_apps (
+    user_id BIGINT  not null references users(id),
+    app_id  INTEGER not null references apps(id),
+    login   text    not null,
+    primary key (user_id, app_id),
+    unique (app_id, login)
+);
+
+-- существующие пользователи получают доступ к приложению, в котором зарегистрированы
+insert into user_apps (user_id, app_id, login)
+select id, app_id, login from users;
@@ -0,0 +1,30 @@
+-- роли и разрешения задаются для каждого приложения отдельно
+create table if not exists roles (
+    id     BIGSERIAL primary key,
+    app_id INTEGER not null references apps(id),
+    name   text    not null,
+    unique (app_id, name)
+);
+
+create table if not exists role_permissions (
+    role_id    BIGINT not null references roles(id),
+    permission text   not null,
+    primary key (role_id, permission)
+);
+
+create table if not exists user_roles (
+    user_id BIGINT not null references users(id),
+    role_id BIGINT not null references roles(id),
+    primary key (user_id, role_id)
+);
+
+-- каждый уровень администратора становится ролью admin_lvl_N с разрешением admin
+insert into roles (app_id, name)
+select distinct app_id, 'admin_lvl_' || lvl from admins;
+
+insert into role_permissions (role_id, permission)
+select id, 'admin' from roles where name like 'admin\_lvl\_%';
+
+insert into user_roles (user_id, role_id)
+select a.user_id, r.id from admins a join roles r on r.app_id = a.app_id and r.name = 'admin_lvl_' || a.lvl
+on conflict do nothing;
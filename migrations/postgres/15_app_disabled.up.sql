@@ -0,0 +1,2 @@
+-- выключенное приложение не принимает вход и не выпускает токены
+alter table apps add column disabled boolean not null default false;
@@ -0,0 +1,2 @@
+-- откат невозможен, если у нескольких приложений одинаковый секрет
+alter table apps add constraint apps_secret_key unique (secret);
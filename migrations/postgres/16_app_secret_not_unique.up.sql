@@ -0,0 +1,2 @@
+-- секреты хранятся зашифрованными, а уникальность секрета выдавала чужие секреты через ошибку AddApp
+alter table apps drop constraint apps_secret_key;
@@ -0,0 +1,6 @@
+alter table apps drop column claims;
+alter table apps drop column login_methods;
+alter table apps drop column require_mfa;
+alter table apps drop column registration_closed;
+alter table apps drop column refresh_ttl;
+alter table apps drop column access_ttl;
@@ -0,0 +1 @@
+update user_revocations set revoked_at = revoked_at / 1000;
@@ -0,0 +1,2 @@
+-- revoked_at в миллисекундах: в секундах вход в ту же секунду после отзыва тоже считался отозванным
+update user_revocations set revoked_at = revoked_at * 1000;
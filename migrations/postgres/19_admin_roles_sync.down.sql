@@ -0,0 +1 @@
+-- роли синхронизированы с admins, откатывать нечего
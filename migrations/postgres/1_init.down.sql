@@ -0,0 +1,3 @@
+drop table if exists admins;
+drop table if exists users;
+drop table if exists apps;
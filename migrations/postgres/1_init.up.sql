@@ -0,0 +1,19 @@
+create table if not exists apps (
+    id     SERIAL primary key,
+    name   text not null unique,
+    secret text not null unique
+);
+
+create table if not exists users (
+    id       BIGSERIAL primary key,
+    login    text    not null unique,
+    passhash bytea   not null,
+    app_id   INTEGER not null references apps(id)
+);
+
+create table if not exists admins (
+    id      BIGSERIAL primary key,
+    user_id BIGINT  not null references users(id),
+    lvl     INTEGER not null,
+    app_id  INTEGER not null references apps(id)
+);
@@ -0,0 +1,2 @@
+-- время неудачи перед last_failure, по нему попытка видит счётчик до себя
+alter table login_attempts add column prev_failure BIGINT not null default 0;
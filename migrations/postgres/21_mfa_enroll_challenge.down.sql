@@ -0,0 +1 @@
+alter table mfa_challenges drop column enroll;
@@ -0,0 +1,2 @@
+-- challenge входа без включённой MFA в приложении с require_mfa, разрешает только подключить второй фактор
+alter table mfa_challenges add column enroll boolean not null default false;
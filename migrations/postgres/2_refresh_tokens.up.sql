@@ -0,0 +1,12 @@
+create table if not exists refresh_tokens (
+    id         BIGSERIAL primary key,
+    token_hash text    not null unique,
+    user_id    BIGINT  not null references users(id),
+    app_id     INTEGER not null references apps(id),
+    family_id  text    not null,
+    expires_at BIGINT  not null,
+    used       boolean not null default false,
+    revoked    boolean not null default false
+);
+
+create index if not exists idx_refresh_family on refresh_tokens(family_id);
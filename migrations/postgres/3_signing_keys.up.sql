@@ -0,0 +1,13 @@
+alter table apps add column alg text not null default 'HS256';
+
+create table if not exists signing_keys (
+    id          BIGSERIAL primary key,
+    kid         text    not null unique,
+    app_id      INTEGER not null references apps(id),
+    alg         text    not null,
+    private_key bytea   not null,
+    public_key  bytea   not null,
+    created_at  BIGINT  not null
+);
+
+create index if not exists idx_signing_keys_app on signing_keys(app_id, alg);
@@ -0,0 +1,7 @@
+alter table signing_keys add column status text not null default 'active';
+alter table signing_keys add column activated_at BIGINT not null default 0;
+alter table signing_keys add column retired_at BIGINT not null default 0;
+
+update signing_keys set activated_at = created_at;
+
+create index if not exists idx_signing_keys_status on signing_keys(status);
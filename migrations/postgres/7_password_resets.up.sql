@@ -0,0 +1,8 @@
+create table if not exists password_resets (
+    id         BIGSERIAL primary key,
+    token_hash text    not null unique,
+    user_id    BIGINT  not null references users(id),
+    app_id     INTEGER not null references apps(id),
+    expires_at BIGINT  not null,
+    used       boolean not null default false
+);
@@ -0,0 +1,14 @@
+alter table users add column email_verified boolean not null default false;
+alter table apps add column require_verified boolean not null default false;
+
+-- пользователи, зарегистрированные до появления подтверждения, считаются подтверждёнными
+update users set email_verified = true;
+
+create table if not exists email_verifications (
+    id         BIGSERIAL primary key,
+    token_hash text    not null unique,
+    user_id    BIGINT  not null references users(id),
+    app_id     INTEGER not null references apps(id),
+    expires_at BIGINT  not null,
+    used       boolean not null default false
+);
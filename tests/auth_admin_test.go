@@ -14,12 +14,19 @@ const (
 )
 
 func TestCreate_Admin_HappyPath(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 	appID := appID
 	login := gofakeit.Name()
 	lvl := gofakeit.Int32()
 	key := key
 
+	_, err := st.AuthClient.Register(ctx, &authv1.RegisterRequest{
+		Login:    login,
+		Password: RandomPassword(),
+		AppId:    int32(appID),
+	})
+	require.NoError(t, err)
+
 	createReq := authv1.CreateAdminRequest{
 		Login: login,
 		Lvl:   lvl,
@@ -33,7 +40,7 @@ func TestCreate_Admin_HappyPath(t *testing.T) {
 }
 
 func TestCreate_AddApp_HappyPath(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	login := gofakeit.Name()
 	key := key
@@ -51,7 +58,7 @@ func TestCreate_AddApp_HappyPath(t *testing.T) {
 }
 
 func TestCreate_IsAdmin_HappyPath(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 	appID := appID
 	login := gofakeit.Name()
 	lvl := gofakeit.Int32()
@@ -80,7 +87,7 @@ func TestCreate_IsAdmin_HappyPath(t *testing.T) {
 	require.NotEmpty(t, respAdm)
 
 	checkIsAdmin := authv1.IsAdminRequest{
-		UserId: int32(respReg.UserId),
+		UserId: respReg.UserId,
 		AppId:  int32(appID),
 	}
 
@@ -91,7 +98,7 @@ func TestCreate_IsAdmin_HappyPath(t *testing.T) {
 }
 
 func Test_DeleteAdmin(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	appID := appID
 	login := gofakeit.Name()
@@ -121,7 +128,7 @@ func Test_DeleteAdmin(t *testing.T) {
 	require.NotEmpty(t, respAdm)
 
 	checkIsAdmin := authv1.IsAdminRequest{
-		UserId: int32(respReg.UserId),
+		UserId: respReg.UserId,
 		AppId:  int32(appID),
 	}
 
@@ -133,6 +140,7 @@ func Test_DeleteAdmin(t *testing.T) {
 	deleteReq := authv1.DeleteAdminRequest{
 		Login: login,
 		Key:   key,
+		AppId: int32(appID),
 	}
 	respDelete, err := st.AuthClient.DeleteAdmin(ctx, &deleteReq)
 	require.NoError(t, err)
@@ -20,7 +20,7 @@ const (
 )
 
 func TestRegister_Login_HappyPath(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	login := gofakeit.Name()
 	pass := RandomPassword()
@@ -60,11 +60,11 @@ func TestRegister_Login_HappyPath(t *testing.T) {
 	assert.Equal(t, respReg.GetUserId(), int64(claims["uid"].(float64)))
 
 	const deltaSec = 1
-	assert.InDelta(t, loginTime.Add(st.Cfg.GRPC.Timeout).Unix(), claims["exp"].(float64), deltaSec)
+	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), claims["exp"].(float64), deltaSec)
 }
 
 func TestDuplicateRegister_HappyPath(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	login := gofakeit.Name()
 	pass := RandomPassword()
@@ -109,11 +109,11 @@ func TestDuplicateRegister_HappyPath(t *testing.T) {
 	assert.Equal(t, respReg.GetUserId(), int64(claims["uid"].(float64)))
 
 	const deltaSec = 1
-	assert.InDelta(t, loginTime.Add(st.Cfg.GRPC.Timeout).Unix(), claims["exp"].(float64), deltaSec)
+	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), claims["exp"].(float64), deltaSec)
 }
 
 func TestRegister_FailCases(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	tests := []struct {
 		name    string
@@ -157,7 +157,7 @@ func TestRegister_FailCases(t *testing.T) {
 }
 
 func TestLogin_FailCases(t *testing.T) {
-	ctx, st := suite.NewSuite(t)
+	ctx, st := suite.NewInProcessSuite(t)
 
 	tests := []struct {
 		name    string
@@ -198,7 +198,7 @@ func TestLogin_FailCases(t *testing.T) {
 			name:    "bad appid empty",
 			login:   gofakeit.Name(),
 			pass:    RandomPassword(),
-			wantErr: "internal cerror",
+			wantErr: "login not found",
 			appid:   124,
 		},
 	}
@@ -221,3 +221,80 @@ func TestLogin_FailCases(t *testing.T) {
 func RandomPassword() string {
 	return gofakeit.Password(true, true, true, true, false, passDefaultLen)
 }
+
+func TestLogin_Refresh_HappyPath(t *testing.T) {
+	ctx, st := suite.NewInProcessSuite(t)
+
+	login := gofakeit.Name()
+	pass := RandomPassword()
+
+	respReg, err := st.AuthClient.Register(ctx, &authv1.RegisterRequest{
+		Login:    login,
+		Password: pass,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respReg.GetUserId())
+
+	respLog, err := st.AuthClient.Login(ctx, &authv1.LoginRequest{
+		Login:    login,
+		Password: pass,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, respLog.GetRefreshToken())
+
+	respRefresh, err := st.AuthClient.Refresh(ctx, &authv1.RefreshRequest{RefreshToken: respLog.GetRefreshToken()})
+	require.NoError(t, err)
+	require.NotEmpty(t, respRefresh.GetToken())
+	require.NotEmpty(t, respRefresh.GetRefreshToken())
+	assert.NotEqual(t, respLog.GetRefreshToken(), respRefresh.GetRefreshToken())
+
+	// повторное использование отзывает всё семейство, включая только что выданный токен
+	_, err = st.AuthClient.Refresh(ctx, &authv1.RefreshRequest{RefreshToken: respLog.GetRefreshToken()})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid refresh token")
+
+	_, err = st.AuthClient.Refresh(ctx, &authv1.RefreshRequest{RefreshToken: respRefresh.GetRefreshToken()})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid refresh token")
+}
+
+func TestLogout_HappyPath(t *testing.T) {
+	ctx, st := suite.NewInProcessSuite(t)
+
+	login := gofakeit.Name()
+	pass := RandomPassword()
+
+	_, err := st.AuthClient.Register(ctx, &authv1.RegisterRequest{
+		Login:    login,
+		Password: pass,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	respLog, err := st.AuthClient.Login(ctx, &authv1.LoginRequest{
+		Login:    login,
+		Password: pass,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ValidateToken(ctx, &authv1.ValidateTokenRequest{Token: respLog.GetToken()})
+	require.NoError(t, err)
+
+	respLogout, err := st.AuthClient.Logout(ctx, &authv1.LogoutRequest{
+		Token:        respLog.GetToken(),
+		RefreshToken: respLog.GetRefreshToken(),
+	})
+	require.NoError(t, err)
+	assert.True(t, respLogout.GetResult())
+
+	_, err = st.AuthClient.ValidateToken(ctx, &authv1.ValidateTokenRequest{Token: respLog.GetToken()})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid token")
+
+	_, err = st.AuthClient.Refresh(ctx, &authv1.RefreshRequest{RefreshToken: respLog.GetRefreshToken()})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid refresh token")
+}
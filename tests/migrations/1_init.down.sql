@@ -1 +0,0 @@
-DELETE * FROM apps;
\ No newline at end of file
@@ -1,3 +0,0 @@
-INSERT  INTO app (id,name,secret)
-VALUES (1,'admin','test')
-ON CONFLICT DO NOTHING;
\ No newline at end of file
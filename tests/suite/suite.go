@@ -2,17 +2,27 @@ package suite
 
 import (
 	"context"
+	"github.com/MorZLE/auth/internal/app"
 	"github.com/MorZLE/auth/internal/config"
 	authv1 "github.com/MorZLE/auth/internal/generate/grpc/gen/morzle.auth.v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"io"
+	"log/slog"
 	"net"
+	"path/filepath"
 	"strconv"
 	"testing"
 )
 
 const host = "localhost"
 
+// Приложение, которое in-process сервер создаёт для тестов с app_id=1
+const (
+	appName   = "admin"
+	appSecret = "test"
+)
+
 type Suite struct {
 	*testing.T
 	Cfg        *config.Config
@@ -46,3 +56,57 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 		AuthClient: authv1.NewAuthClient(authClient),
 	}
 }
+
+// NewInProcessSuite поднимает сервер в том же процессе на хранилище memory и свободном порту, так что
+// тестам не нужны ни база, ни запущенный сервис. Каждый вызов получает собственное пустое хранилище
+// с приложением app_id=1 и секретом "test"
+func NewInProcessSuite(t *testing.T) (context.Context, *Suite) {
+
+	t.Helper()
+	t.Parallel()
+
+	cfg := config.MustLoadByPath(filepath.Join("..", "config", "local.yaml"))
+	cfg.StorageDriver = "memory"
+	if cfg.Password.Denylist != "" && !filepath.IsAbs(cfg.Password.Denylist) {
+		cfg.Password.Denylist = filepath.Join("..", cfg.Password.Denylist)
+	}
+
+	application := app.NewApp(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GRPC.Timeout)
+
+	if _, err := application.Storage.AddApp(ctx, appName, appSecret, "HS256"); err != nil {
+		cancel()
+		t.Fatalf("seed app failed: %v", err)
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		cancel()
+		t.Fatalf("listen failed: %v", err)
+	}
+	go func() {
+		_ = application.GRPCSrv.Serve(l)
+	}()
+
+	authClient, err := grpc.DialContext(context.Background(), l.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		cancel()
+		application.GRPCSrv.Stop()
+		t.Fatalf("controller server connection failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		t.Helper()
+		cancel()
+		_ = authClient.Close()
+		application.GRPCSrv.Stop()
+	})
+
+	return ctx, &Suite{
+		T:          t,
+		Cfg:        cfg,
+		AuthClient: authv1.NewAuthClient(authClient),
+	}
+}